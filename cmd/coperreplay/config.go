@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/net/capture"
+	"github.com/jessevdk/go-flags"
+)
+
+type config struct {
+	Commands  []string `short:"c" long:"command" description:"Only show or replay messages of this command, may be repeated"`
+	Direction string   `short:"d" long:"direction" description:"Only show or replay messages of this direction: recv or sent"`
+	Replay    string   `short:"r" long:"replay" description:"Replay the messages received from the captured peer to the regtest node at address:port"`
+	RealTime  bool     `long:"realtime" description:"Keep the intervals between the replayed messages"`
+	TestNet   bool     `long:"testnet" description:"Read captures of the test network"`
+	RegTest   bool     `long:"regtest" description:"Read captures of a regression test network"`
+
+	files     []string
+	direction *capture.Direction
+}
+
+// netParams returns the parameters of the network selected by the config.
+func (cfg *config) netParams() *model.BitcoinParams {
+	switch {
+	case cfg.TestNet:
+		return &model.TestNetParams
+	case cfg.RegTest:
+		return &model.RegressionNetParams
+	default:
+		return &model.MainNetParams
+	}
+}
+
+// parseDirection returns the direction named s.
+func parseDirection(s string) (capture.Direction, error) {
+	for _, dir := range []capture.Direction{capture.Received, capture.Sent} {
+		if dir.String() == s {
+			return dir, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown direction %q -- use recv or sent", s)
+}
+
+func loadConfig() (*config, error) {
+	cfg := config{}
+
+	appName := filepath.Base(os.Args[0])
+	appName = strings.TrimSuffix(appName, filepath.Ext(appName))
+	usageMessage := fmt.Sprintf("Use %s -h to show options", appName)
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	parser.Usage = "[OPTIONS] capture-file..."
+	args, err := parser.Parse()
+	if err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			fmt.Fprintln(os.Stderr, usageMessage)
+		}
+		return nil, err
+	}
+
+	fail := func(err error) (*config, error) {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, err
+	}
+
+	if cfg.TestNet && cfg.RegTest {
+		return fail(errors.New("the testnet and regtest params can't be " +
+			"used together -- choose one of the two"))
+	}
+	if len(args) == 0 {
+		return fail(errors.New("no capture file given"))
+	}
+	cfg.files = args
+
+	if cfg.Direction != "" {
+		dir, err := parseDirection(cfg.Direction)
+		if err != nil {
+			return fail(err)
+		}
+		cfg.direction = &dir
+	}
+
+	if cfg.Replay != "" {
+		// Captures are replayed as sent by the captured peer.
+		if cfg.direction != nil && *cfg.direction != capture.Received {
+			return fail(errors.New("only received messages can be " +
+				"replayed"))
+		}
+		dir := capture.Received
+		cfg.direction = &dir
+		if !cfg.RegTest {
+			return fail(errors.New("captures can only be replayed to " +
+				"a regtest node -- use --regtest"))
+		}
+		if _, _, err := net.SplitHostPort(cfg.Replay); err != nil {
+			cfg.Replay = net.JoinHostPort(cfg.Replay,
+				cfg.netParams().DefaultPort)
+		}
+	}
+
+	return &cfg, nil
+}
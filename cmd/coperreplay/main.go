@@ -0,0 +1,59 @@
+// coperreplay reads the captures of the messages exchanged with peers recorded
+// by a node run with message capture enabled.  It prints them, optionally
+// filtered by command and direction, or replays the messages a captured peer
+// sent to a regression test node.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/consensus"
+)
+
+func main() {
+	if err := replayMain(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func replayMain() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// The wire package bounds the messages it reads by the configured
+	// excessive block size.
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+
+	params := cfg.netParams()
+	f := newFilter(cfg.Commands, cfg.direction)
+	for _, file := range cfg.files {
+		r, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't open capture %s: %v\n", file, err)
+			return err
+		}
+
+		if cfg.Replay == "" {
+			err = printCapture(os.Stdout, r, params.BitcoinNet, f)
+		} else {
+			var conn net.Conn
+			conn, err = net.DialTimeout("tcp", cfg.Replay, dialTimeout)
+			if err == nil {
+				rp := &replayer{params: params, realTime: cfg.RealTime,
+					out: os.Stdout}
+				err = rp.replay(conn, cfg.Replay, r, f)
+			}
+		}
+		r.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't read capture %s: %v\n", file, err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/net/capture"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+)
+
+const (
+	// dialTimeout is the maximum time to establish a connection to the
+	// node.
+	dialTimeout = 10 * time.Second
+
+	// handshakeTimeout is the maximum time to wait for the version of the
+	// node.
+	handshakeTimeout = 30 * time.Second
+
+	// timeFormat is how the time of the records is printed.
+	timeFormat = "2006-01-02 15:04:05.000000"
+)
+
+// filter selects the records to show or replay.
+type filter struct {
+	commands  map[string]struct{}
+	direction *capture.Direction
+}
+
+// newFilter returns a filter keeping the records of one of the commands, or of
+// any command if there are none, and of the direction if not nil.
+func newFilter(commands []string, direction *capture.Direction) *filter {
+	f := &filter{direction: direction}
+	if len(commands) != 0 {
+		f.commands = make(map[string]struct{}, len(commands))
+		for _, cmd := range commands {
+			f.commands[cmd] = struct{}{}
+		}
+	}
+	return f
+}
+
+// match returns whether the record is kept.
+func (f *filter) match(rec *capture.Record) bool {
+	if f.direction != nil && rec.Direction != *f.direction {
+		return false
+	}
+	if f.commands != nil {
+		if _, ok := f.commands[rec.Command]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// readCapture calls fn with the records of the capture matching the filter,
+// in order, until fn returns an error.
+func readCapture(r io.Reader, btcnet wire.BitcoinNet, f *filter,
+	fn func(*capture.Record) error) error {
+
+	cr := capture.NewReader(r, btcnet)
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !f.match(rec) {
+			continue
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// formatRecord returns a record as a human-readable line.
+func formatRecord(rec *capture.Record) string {
+	line := fmt.Sprintf("%s %-4s %-12s %8d bytes", rec.Time.Format(timeFormat),
+		rec.Direction, rec.Command, rec.Size)
+	if rec.Msg == nil {
+		return line + "  undecodable: " + rec.DecodeErr.Error()
+	}
+	if summary := peer.MessageSummary(rec.Msg); summary != "" {
+		line += "  " + summary
+	}
+	return line
+}
+
+// printCapture prints the records of the capture matching the filter.
+func printCapture(w io.Writer, r io.Reader, btcnet wire.BitcoinNet, f *filter) error {
+	return readCapture(r, btcnet, f, func(rec *capture.Record) error {
+		_, err := fmt.Fprintln(w, formatRecord(rec))
+		return err
+	})
+}
+
+// isHandshake returns whether the message belongs to the version handshake,
+// which the peer package performs on its own.
+func isHandshake(msg wire.Message) bool {
+	switch msg.(type) {
+	case *wire.MsgVersion, *wire.MsgVerAck:
+		return true
+	}
+	return false
+}
+
+// replayer plays captured messages to a node as if it was the captured peer.
+type replayer struct {
+	params   *model.BitcoinParams
+	realTime bool
+	out      io.Writer
+}
+
+// replay connects to the node at addr and sends it the messages of the
+// capture matching the filter.
+func (rp *replayer) replay(conn net.Conn, addr string, r io.Reader, f *filter) error {
+	versions := make(chan *wire.MsgVersion, 1)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		UserAgentName: "coperreplay",
+		UserAgentVersion: fmt.Sprintf("%d.%d.%d", conf.AppMajor,
+			conf.AppMinor, conf.AppPatch),
+		ChainParams:     rp.params,
+		ProtocolVersion: peer.MaxProtocolVersion,
+		Listeners: peer.MessageListeners{
+			OnVersion: func(_ *peer.Peer, msg *wire.MsgVersion) {
+				versions <- msg
+			},
+		},
+	}, addr, false)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	msgs := make(chan *peer.PeerMessage)
+	p.AssociateConnection(conn, msgs, func(*peer.Peer) {})
+	done := make(chan struct{})
+	defer func() {
+		p.Disconnect()
+		close(done)
+	}()
+	go answerMessages(msgs, done)
+
+	select {
+	case <-versions:
+	case <-time.After(handshakeTimeout):
+		return fmt.Errorf("no version from %s", addr)
+	}
+
+	var last time.Time
+	return readCapture(r, rp.params.BitcoinNet, f, func(rec *capture.Record) error {
+		// The peer only sends messages it can encode.
+		if rec.Msg == nil || isHandshake(rec.Msg) {
+			return nil
+		}
+		if !p.Connected() {
+			return fmt.Errorf("%s disconnected", addr)
+		}
+		if rp.realTime && !last.IsZero() && rec.Time.After(last) {
+			time.Sleep(rec.Time.Sub(last))
+		}
+		last = rec.Time
+
+		sent := make(chan struct{}, 1)
+		p.QueueMessage(rec.Msg, sent)
+		<-sent
+		fmt.Fprintln(rp.out, formatRecord(rec))
+		return nil
+	})
+}
+
+// answerMessages keeps the connection alive by answering pings and consumes
+// the other messages of the node until done is closed.
+func answerMessages(msgs <-chan *peer.PeerMessage, done <-chan struct{}) {
+	for {
+		select {
+		case msg := <-msgs:
+			switch m := msg.Msg.(type) {
+			case *wire.MsgVerAck:
+				msg.Peerp.SetAckReceived(true)
+			case *wire.MsgPing:
+				msg.Peerp.QueueMessage(wire.NewMsgPong(m.Nonce), nil)
+			}
+			msg.Done <- struct{}{}
+		case <-done:
+			return
+		}
+	}
+}
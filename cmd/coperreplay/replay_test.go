@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/net/capture"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+	os.Exit(m.Run())
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// testCapture returns the capture of a handshake followed by a getaddr and a
+// ping from the peer, the ping being answered.
+func testCapture(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := capture.NewWriter(nopCloser{&buf}, model.RegressionNetParams.BitcoinNet)
+	me := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 18444, 0)
+	you := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.2"), 18444, 0)
+	records := []struct {
+		dir capture.Direction
+		msg wire.Message
+	}{
+		{capture.Received, wire.NewMsgVersion(me, you, 1, 0)},
+		{capture.Sent, wire.NewMsgVersion(you, me, 2, 0)},
+		{capture.Received, wire.NewMsgVerAck()},
+		{capture.Sent, wire.NewMsgVerAck()},
+		{capture.Received, wire.NewMsgGetAddr()},
+		{capture.Received, wire.NewMsgPing(7)},
+		{capture.Sent, wire.NewMsgPong(7)},
+	}
+	start := time.Unix(1500000000, 0)
+	for i, rec := range records {
+		err := w.Write(start.Add(time.Duration(i)*time.Millisecond), rec.dir,
+			wire.ProtocolVersion, rec.msg)
+		assert.Nil(t, err)
+	}
+	return buf.Bytes()
+}
+
+// commands returns the commands of the records of the capture matching the
+// filter.
+func commands(t *testing.T, data []byte, f *filter) []string {
+	var cmds []string
+	err := readCapture(bytes.NewReader(data), model.RegressionNetParams.BitcoinNet,
+		f, func(rec *capture.Record) error {
+			cmds = append(cmds, rec.Command)
+			return nil
+		})
+	assert.Nil(t, err)
+	return cmds
+}
+
+func TestFilter(t *testing.T) {
+	data := testCapture(t)
+	sent := capture.Sent
+	recv := capture.Received
+
+	assert.Equal(t, []string{"version", "version", "verack", "verack",
+		"getaddr", "ping", "pong"}, commands(t, data, newFilter(nil, nil)))
+	assert.Equal(t, []string{"version", "verack", "pong"},
+		commands(t, data, newFilter(nil, &sent)))
+	assert.Equal(t, []string{"ping", "pong"},
+		commands(t, data, newFilter([]string{"ping", "pong"}, nil)))
+	assert.Equal(t, []string{"ping"},
+		commands(t, data, newFilter([]string{"ping", "pong"}, &recv)))
+
+	// Errors are reported.
+	err := readCapture(bytes.NewReader(data[:len(data)-1]),
+		model.RegressionNetParams.BitcoinNet, newFilter(nil, nil),
+		func(*capture.Record) error { return nil })
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestPrintCapture(t *testing.T) {
+	var out bytes.Buffer
+	err := printCapture(&out, bytes.NewReader(testCapture(t)),
+		model.RegressionNetParams.BitcoinNet, newFilter([]string{"version"}, nil))
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Equal(t, 2, len(lines)) {
+		assert.True(t, strings.Contains(lines[0], " recv version "))
+		assert.True(t, strings.Contains(lines[0], "agent /copernicus"))
+		assert.True(t, strings.Contains(lines[1], " sent version "))
+	}
+}
+
+func TestParseDirection(t *testing.T) {
+	dir, err := parseDirection("sent")
+	assert.Nil(t, err)
+	assert.Equal(t, capture.Sent, dir)
+	_, err = parseDirection("both")
+	assert.NotNil(t, err)
+}
+
+// serveFakeNode answers the handshake on conn and reports the commands of the
+// other messages received until the connection is closed.  It speaks the wire
+// protocol directly since a peer would take the replayer, living in the same
+// process, for a connection to itself.
+func serveFakeNode(conn net.Conn, received chan<- []string) {
+	defer conn.Close()
+
+	var cmds []string
+	pver := uint32(peer.MaxProtocolVersion)
+	btcnet := model.RegressionNetParams.BitcoinNet
+	for {
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			received <- cmds
+			return
+		}
+		switch m := msg.(type) {
+		case *wire.MsgVersion:
+			version := wire.NewMsgVersion(&m.AddrYou, &m.AddrMe, 1, 0)
+			version.ProtocolVersion = int32(pver)
+			wire.WriteMessage(conn, version, pver, btcnet)
+			wire.WriteMessage(conn, wire.NewMsgVerAck(), pver, btcnet)
+		case *wire.MsgVerAck:
+		default:
+			cmds = append(cmds, msg.Command())
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			serveFakeNode(conn, received)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	var out bytes.Buffer
+	recv := capture.Received
+	rp := &replayer{params: &model.RegressionNetParams, out: &out}
+	err = rp.replay(conn, l.Addr().String(), bytes.NewReader(testCapture(t)),
+		newFilter(nil, &recv))
+	assert.Nil(t, err)
+
+	select {
+	case cmds := <-received:
+		assert.Equal(t, []string{"getaddr", "ping"}, cmds)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fake node did not see the connection close")
+	}
+	assert.Equal(t, 2, strings.Count(out.String(), "\n"))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/jessevdk/go-flags"
+)
+
+const (
+	defaultListen      = ":53"
+	defaultMaxCrawlers = 16
+	defaultTTL         = 60
+)
+
+var (
+	defaultDataDir = conf.AppDataDir("coperseeder", false)
+)
+
+type config struct {
+	Host        string   `short:"H" long:"host" description:"Seed DNS host name answered for, e.g. seed.example.com"`
+	Listen      string   `short:"l" long:"listen" description:"Listen on address:port for DNS queries over UDP and TCP"`
+	Seeders     []string `short:"s" long:"seeder" description:"Address of a node to start crawling from, may be repeated"`
+	DataDir     string   `short:"b" long:"datadir" description:"Directory to store the known addresses"`
+	MaxCrawlers int      `long:"maxcrawlers" description:"Maximum number of nodes crawled at once"`
+	TTL         uint32   `long:"ttl" description:"Time to live in seconds of the DNS answers"`
+	TestNet     bool     `long:"testnet" description:"Crawl the test network"`
+	RegTest     bool     `long:"regtest" description:"Crawl a regression test network"`
+}
+
+// netParams returns the parameters of the network selected by the config.
+func (cfg *config) netParams() *model.BitcoinParams {
+	switch {
+	case cfg.TestNet:
+		return &model.TestNetParams
+	case cfg.RegTest:
+		return &model.RegressionNetParams
+	default:
+		return &model.MainNetParams
+	}
+}
+
+// normalizeSeeder adds the default port of the network to the address when it
+// does not have one.
+func normalizeSeeder(addr, defaultPort string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, defaultPort)
+	}
+	return addr
+}
+
+func loadConfig() (*config, error) {
+	cfg := config{
+		Listen:      defaultListen,
+		DataDir:     defaultDataDir,
+		MaxCrawlers: defaultMaxCrawlers,
+		TTL:         defaultTTL,
+	}
+
+	appName := filepath.Base(os.Args[0])
+	appName = strings.TrimSuffix(appName, filepath.Ext(appName))
+	usageMessage := fmt.Sprintf("Use %s -h to show options", appName)
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	if _, err := parser.Parse(); err != nil {
+		if e, ok := err.(*flags.Error); !ok || e.Type != flags.ErrHelp {
+			fmt.Fprintln(os.Stderr, usageMessage)
+		}
+		return nil, err
+	}
+
+	if cfg.TestNet && cfg.RegTest {
+		err := errors.New("the testnet and regtest params can't be " +
+			"used together -- choose one of the two")
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, err
+	}
+
+	if cfg.Host == "" {
+		err := errors.New("the host name to answer for must be specified")
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, err
+	}
+	cfg.Host = strings.TrimSuffix(strings.ToLower(cfg.Host), ".")
+
+	if cfg.MaxCrawlers <= 0 {
+		cfg.MaxCrawlers = defaultMaxCrawlers
+	}
+
+	defaultPort := cfg.netParams().DefaultPort
+	for i, seeder := range cfg.Seeders {
+		cfg.Seeders[i] = normalizeSeeder(seeder, defaultPort)
+	}
+
+	cfg.DataDir = filepath.Join(cfg.DataDir, cfg.netParams().Name)
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't create data directory %s: %v\n",
+			cfg.DataDir, err)
+		return nil, err
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+)
+
+const (
+	// minProtocolVersion is the lowest protocol version of the nodes handed
+	// out to clients.
+	minProtocolVersion = wire.SendHeadersVersion
+
+	// crawlTick is how often the crawler looks for nodes due for a visit.
+	crawlTick = 5 * time.Second
+
+	// recrawlGood and recrawlBad are how long to wait before visiting a
+	// node again, depending on whether it was reachable lately.
+	recrawlGood = 15 * time.Minute
+	recrawlBad  = 2 * time.Hour
+
+	// dialTimeout is the maximum time to establish a connection to a node.
+	dialTimeout = 10 * time.Second
+
+	// addrTimeout is the maximum time to wait for the addresses of a node
+	// after the handshake.
+	addrTimeout = 20 * time.Second
+
+	// drainTimeout bounds how long messages of a node are still consumed
+	// after it was disconnected.
+	drainTimeout = 5 * time.Second
+
+	// goodMaxAge is how long after the last successful visit a node is
+	// still handed out.
+	goodMaxAge = 24 * time.Hour
+
+	// minReliability is the lowest reliability of a node handed out.
+	minReliability = 0.5
+
+	// reliabilityDecay weighs the previous reliability of a node against
+	// the outcome of the latest visit.
+	reliabilityDecay = 0.8
+
+	// maxNodes caps the number of nodes tracked.
+	maxNodes = 100000
+)
+
+// node is what the crawler knows about a node of the network.
+type node struct {
+	addr            *wire.NetAddress
+	services        wire.ServiceFlag
+	protocolVersion uint32
+	userAgent       string
+	lastAttempt     time.Time
+	lastSuccess     time.Time
+	reliability     float64
+	crawling        bool
+}
+
+// isGood returns whether the node may be handed out to clients requiring
+// the given services.  Only nodes listening on the default port of the
+// network qualify since DNS answers cannot carry a port.
+func (n *node) isGood(now time.Time, services wire.ServiceFlag, defaultPort uint16) bool {
+	return n.addr.Port == defaultPort &&
+		n.protocolVersion >= minProtocolVersion &&
+		n.services&services == services &&
+		n.reliability >= minReliability &&
+		now.Sub(n.lastSuccess) < goodMaxAge
+}
+
+// due returns whether the node should be visited again.
+func (n *node) due(now time.Time) bool {
+	if n.crawling {
+		return false
+	}
+	interval := recrawlGood
+	if n.reliability < minReliability {
+		interval = recrawlBad
+	}
+	return now.Sub(n.lastAttempt) >= interval
+}
+
+// visitResult is what was learned from visiting a node.
+type visitResult struct {
+	version *wire.MsgVersion
+	addrs   []*wire.NetAddress
+}
+
+// crawler keeps visiting the nodes of the network to learn about new ones and
+// to track which are reachable.
+type crawler struct {
+	params      *model.BitcoinParams
+	defaultPort uint16
+	amgr        *addrmgr.AddrManager
+	dial        func(addr string) (net.Conn, error)
+	maxCrawlers int
+
+	mtx   sync.RWMutex
+	nodes map[string]*node
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// newCrawler returns a crawler for the given network.  Known addresses are
+// kept in the address manager, which persists them across restarts.
+func newCrawler(params *model.BitcoinParams, amgr *addrmgr.AddrManager,
+	maxCrawlers int, dial func(addr string) (net.Conn, error)) *crawler {
+
+	port, _ := strconv.ParseUint(params.DefaultPort, 10, 16)
+	return &crawler{
+		params:      params,
+		defaultPort: uint16(port),
+		amgr:        amgr,
+		dial:        dial,
+		maxCrawlers: maxCrawlers,
+		nodes:       make(map[string]*node),
+		quit:        make(chan struct{}),
+	}
+}
+
+// acceptable returns whether an address is worth crawling.  Private regression
+// test networks are usually not publicly routable.
+func (c *crawler) acceptable(na *wire.NetAddress) bool {
+	if c.params.Name == model.RegressionNetParams.Name {
+		return addrmgr.IsValid(na)
+	}
+	return addrmgr.IsRoutable(na)
+}
+
+// addAddresses adds the passed addresses to the nodes to crawl.
+func (c *crawler) addAddresses(addrs []*wire.NetAddress) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, na := range addrs {
+		if !c.acceptable(na) || len(c.nodes) >= maxNodes {
+			continue
+		}
+		key := addrmgr.NetAddressKey(na)
+		if _, ok := c.nodes[key]; ok {
+			continue
+		}
+		c.nodes[key] = &node{addr: na}
+	}
+}
+
+// start launches the crawler.
+func (c *crawler) start() {
+	c.wg.Add(1)
+	go c.crawlHandler()
+}
+
+// stop stops the crawler and waits for the visits in progress.
+func (c *crawler) stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// dueNodes marks and returns up to max nodes due for a visit, the least
+// recently visited first.
+func (c *crawler) dueNodes(now time.Time, max int) []*node {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	due := make([]*node, 0, max)
+	for _, n := range c.nodes {
+		if n.due(now) {
+			due = append(due, n)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].lastAttempt.Before(due[j].lastAttempt)
+	})
+	if len(due) > max {
+		due = due[:max]
+	}
+	for _, n := range due {
+		n.crawling = true
+	}
+	return due
+}
+
+// crawlHandler visits the nodes of the network as they are due, with at most
+// maxCrawlers visits at once.  It must be run as a goroutine.
+func (c *crawler) crawlHandler() {
+	defer c.wg.Done()
+
+	slots := make(chan struct{}, c.maxCrawlers)
+	ticker := time.NewTicker(crawlTick)
+	defer ticker.Stop()
+
+	for {
+		for _, n := range c.dueNodes(time.Now(), cap(slots)-len(slots)) {
+			slots <- struct{}{}
+			c.wg.Add(1)
+			go func(n *node) {
+				defer c.wg.Done()
+				c.crawl(n)
+				<-slots
+			}(n)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// crawl visits a node and records the outcome.
+func (c *crawler) crawl(n *node) {
+	c.amgr.Attempt(n.addr)
+	result, err := c.visit(n.addr)
+	now := time.Now()
+
+	c.mtx.Lock()
+	n.crawling = false
+	n.lastAttempt = now
+	n.reliability *= reliabilityDecay
+	if err == nil {
+		n.reliability += 1 - reliabilityDecay
+		n.lastSuccess = now
+		n.services = result.version.Services
+		n.protocolVersion = uint32(result.version.ProtocolVersion)
+		n.userAgent = result.version.UserAgent
+	}
+	c.mtx.Unlock()
+
+	if err != nil {
+		log.Debug("Crawling %s failed: %v", addrmgr.NetAddressKey(n.addr), err)
+		return
+	}
+
+	c.amgr.Good(n.addr)
+	c.amgr.AddAddresses(result.addrs, n.addr)
+	c.addAddresses(result.addrs)
+}
+
+// visit connects to the node, performs the handshake and asks for the
+// addresses it knows.
+func (c *crawler) visit(na *wire.NetAddress) (*visitResult, error) {
+	addr := addrmgr.NetAddressKey(na)
+	conn, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(chan *wire.MsgVersion, 1)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		UserAgentName: "coperseeder",
+		UserAgentVersion: fmt.Sprintf("%d.%d.%d", conf.AppMajor,
+			conf.AppMinor, conf.AppPatch),
+		ChainParams:     c.params,
+		DisableRelayTx:  true,
+		ProtocolVersion: peer.MaxProtocolVersion,
+		Listeners: peer.MessageListeners{
+			OnVersion: func(_ *peer.Peer, msg *wire.MsgVersion) {
+				versions <- msg
+			},
+		},
+	}, addr, false)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	msgs := make(chan *peer.PeerMessage)
+	p.AssociateConnection(conn, msgs, func(*peer.Peer) {})
+	defer func() {
+		p.Disconnect()
+		go drainMessages(msgs)
+	}()
+
+	timeout := time.NewTimer(addrTimeout)
+	defer timeout.Stop()
+
+	result := &visitResult{}
+	select {
+	case result.version = <-versions:
+	case <-timeout.C:
+		return nil, fmt.Errorf("no version from %s", addr)
+	case <-c.quit:
+		return nil, fmt.Errorf("crawler stopped")
+	}
+
+	p.QueueMessage(wire.NewMsgGetAddr(), nil)
+	for {
+		select {
+		case msg := <-msgs:
+			switch m := msg.Msg.(type) {
+			case *wire.MsgVerAck:
+				msg.Peerp.SetAckReceived(true)
+			case *wire.MsgPing:
+				msg.Peerp.QueueMessage(wire.NewMsgPong(m.Nonce), nil)
+			case *wire.MsgAddr:
+				result.addrs = append(result.addrs, m.AddrList...)
+			}
+			msg.Done <- struct{}{}
+
+			// Nodes may first announce their own address alone, so
+			// only a larger message answers our request.
+			if m, ok := msg.Msg.(*wire.MsgAddr); ok && len(m.AddrList) > 1 {
+				return result, nil
+			}
+
+		case <-timeout.C:
+			// The node is reachable even if it did not answer.
+			return result, nil
+
+		case <-c.quit:
+			return result, nil
+		}
+	}
+}
+
+// drainMessages consumes the messages a disconnected node may still deliver so
+// that its input handler is not left blocked.
+func drainMessages(msgs <-chan *peer.PeerMessage) {
+	timeout := time.After(drainTimeout)
+	for {
+		select {
+		case msg := <-msgs:
+			msg.Done <- struct{}{}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// goodAddresses returns up to max addresses of good nodes offering the given
+// services, picked at random among the most reliable ones.  Either IPv4 or
+// IPv6 addresses are returned.
+func (c *crawler) goodAddresses(ipv6 bool, services wire.ServiceFlag, max int) []net.IP {
+	now := time.Now()
+
+	c.mtx.RLock()
+	good := make([]*node, 0)
+	for _, n := range c.nodes {
+		if addrmgr.IsIPv4(n.addr) == ipv6 {
+			continue
+		}
+		if n.isGood(now, services, c.defaultPort) {
+			good = append(good, n)
+		}
+	}
+	sort.Slice(good, func(i, j int) bool {
+		return good[i].reliability > good[j].reliability
+	})
+	if len(good) > 4*max {
+		good = good[:4*max]
+	}
+	ips := make([]net.IP, 0, len(good))
+	for _, n := range good {
+		ips = append(ips, n.addr.IP)
+	}
+	c.mtx.RUnlock()
+
+	rand.Shuffle(len(ips), func(i, j int) {
+		ips[i], ips[j] = ips[j], ips[i]
+	})
+	if len(ips) > max {
+		ips = ips[:max]
+	}
+	return ips
+}
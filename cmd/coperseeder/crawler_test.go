@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+	os.Exit(m.Run())
+}
+
+// newTestCrawler returns a crawler of the regression test network whose
+// connections are made by dial.
+// newTestCrawler returns a crawler with its address manager in a temporary
+// directory, and the func removing it.
+func newTestCrawler(t *testing.T, dial func(addr string) (net.Conn, error)) (*crawler, func()) {
+	dir, err := ioutil.TempDir("", "coperseeder")
+	assert.Nil(t, err)
+	amgr := addrmgr.New(dir, nil)
+	return newCrawler(&model.RegressionNetParams, amgr, 2, dial), func() { os.RemoveAll(dir) }
+}
+
+func TestNodeIsGood(t *testing.T) {
+	now := time.Now()
+	n := &node{
+		addr:            wire.NewNetAddressIPPort(net.ParseIP("1.2.3.4"), 8333, 0),
+		services:        wire.SFNodeNetwork | wire.SFNodeBloom,
+		protocolVersion: wire.FeeFilterVersion,
+		lastSuccess:     now.Add(-time.Hour),
+		reliability:     0.9,
+	}
+	assert.True(t, n.isGood(now, wire.SFNodeNetwork, 8333))
+	assert.True(t, n.isGood(now, wire.SFNodeNetwork|wire.SFNodeBloom, 8333))
+	assert.False(t, n.isGood(now, wire.SFNodeNetwork|wire.SFNodeXthin, 8333))
+	assert.False(t, n.isGood(now, wire.SFNodeNetwork, 18333))
+
+	n.protocolVersion = wire.SendHeadersVersion - 1
+	assert.False(t, n.isGood(now, wire.SFNodeNetwork, 8333))
+	n.protocolVersion = wire.SendHeadersVersion
+
+	n.reliability = minReliability / 2
+	assert.False(t, n.isGood(now, wire.SFNodeNetwork, 8333))
+	n.reliability = 0.9
+
+	n.lastSuccess = now.Add(-goodMaxAge)
+	assert.False(t, n.isGood(now, wire.SFNodeNetwork, 8333))
+}
+
+func TestNodeDue(t *testing.T) {
+	now := time.Now()
+	n := &node{}
+	assert.True(t, n.due(now))
+
+	n.lastAttempt = now
+	n.reliability = 0.9
+	assert.False(t, n.due(now))
+	assert.True(t, n.due(now.Add(recrawlGood)))
+
+	// Unreliable nodes are visited less often.
+	n.reliability = 0
+	assert.False(t, n.due(now.Add(recrawlGood)))
+	assert.True(t, n.due(now.Add(recrawlBad)))
+
+	n.lastAttempt = time.Time{}
+	n.crawling = true
+	assert.False(t, n.due(now))
+}
+
+func TestAddAddresses(t *testing.T) {
+	c, cleanup := newTestCrawler(t, nil)
+	defer cleanup()
+	c.addAddresses([]*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 18444, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 18444, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("0.0.0.0"), 18444, 0),
+	})
+	assert.Equal(t, 1, len(c.nodes))
+
+	// Only routable addresses are crawled on public networks.
+	c.params = &model.MainNetParams
+	c.addAddresses([]*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("1.2.3.4"), 8333, 0),
+	})
+	assert.Equal(t, 2, len(c.nodes))
+}
+
+func TestGoodAddresses(t *testing.T) {
+	c, cleanup := newTestCrawler(t, nil)
+	defer cleanup()
+	now := time.Now()
+	add := func(ip string, services wire.ServiceFlag, reliability float64) {
+		na := wire.NewNetAddressIPPort(net.ParseIP(ip), 18444, services)
+		c.nodes[addrmgr.NetAddressKey(na)] = &node{
+			addr:            na,
+			services:        services,
+			protocolVersion: wire.FeeFilterVersion,
+			lastSuccess:     now,
+			reliability:     reliability,
+		}
+	}
+	add("1.0.0.1", wire.SFNodeNetwork, 1)
+	add("1.0.0.2", wire.SFNodeNetwork|wire.SFNodeBloom, 0.8)
+	add("1.0.0.3", wire.SFNodeNetwork, 0.1)
+	add("2001:db8::1", wire.SFNodeNetwork, 1)
+
+	assert.Equal(t, 2, len(c.goodAddresses(false, wire.SFNodeNetwork, 16)))
+	assert.Equal(t, 1, len(c.goodAddresses(false, wire.SFNodeNetwork, 1)))
+	assert.Equal(t, []net.IP{net.ParseIP("1.0.0.2")},
+		c.goodAddresses(false, wire.SFNodeNetwork|wire.SFNodeBloom, 16))
+	assert.Equal(t, []net.IP{net.ParseIP("2001:db8::1")},
+		c.goodAddresses(true, wire.SFNodeNetwork, 16))
+}
+
+// serveFakeNode accepts a single connection on l and answers the handshake and
+// getaddr messages of the crawler like a node would.  It speaks the wire
+// protocol directly since a peer would take the crawler, living in the same
+// process, for a connection to itself.
+func serveFakeNode(t *testing.T, l net.Listener, addrs []*wire.NetAddress) {
+	conn, err := l.Accept()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	pver := uint32(peer.MaxProtocolVersion)
+	btcnet := model.RegressionNetParams.BitcoinNet
+	for {
+		msg, _, err := wire.ReadMessage(conn, pver, btcnet)
+		if err != nil {
+			return
+		}
+		var replies []wire.Message
+		switch m := msg.(type) {
+		case *wire.MsgVersion:
+			version := wire.NewMsgVersion(&m.AddrYou, &m.AddrMe, 1, 0)
+			version.ProtocolVersion = int32(pver)
+			version.Services = wire.SFNodeNetwork | wire.SFNodeBloom
+			replies = append(replies, version, wire.NewMsgVerAck())
+		case *wire.MsgGetAddr:
+			addrMsg := wire.NewMsgAddr()
+			addrMsg.AddAddresses(addrs...)
+			replies = append(replies, addrMsg)
+		}
+		for _, reply := range replies {
+			if err := wire.WriteMessage(conn, reply, pver, btcnet); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	learnt := []*wire.NetAddress{
+		wire.NewNetAddressIPPort(net.ParseIP("127.0.0.2"), 18444, wire.SFNodeNetwork),
+		wire.NewNetAddressIPPort(net.ParseIP("127.0.0.3"), 18444, wire.SFNodeNetwork),
+	}
+	go serveFakeNode(t, l, learnt)
+
+	c, cleanup := newTestCrawler(t, func(string) (net.Conn, error) {
+		return net.Dial("tcp", l.Addr().String())
+	})
+	defer cleanup()
+	na := wire.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 18444, 0)
+	c.addAddresses([]*wire.NetAddress{na})
+	n := c.nodes[addrmgr.NetAddressKey(na)]
+
+	c.crawl(n)
+	assert.Equal(t, 3, len(c.nodes))
+	assert.Equal(t, wire.SFNodeNetwork|wire.SFNodeBloom, n.services)
+	assert.Equal(t, uint32(peer.MaxProtocolVersion), n.protocolVersion)
+	assert.True(t, n.reliability > 0)
+	assert.False(t, n.lastSuccess.IsZero())
+
+	// A node which can't be reached loses reliability.
+	c.dial = func(string) (net.Conn, error) {
+		return nil, &net.AddrError{Err: "unreachable", Addr: "127.0.0.1"}
+	}
+	reliability := n.reliability
+	c.crawl(n)
+	assert.True(t, n.reliability < reliability)
+	assert.True(t, n.lastAttempt.After(n.lastSuccess))
+}
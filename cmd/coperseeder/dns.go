@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/net/wire"
+)
+
+const (
+	dnsHeaderLen = 12
+
+	// Query types and class answered for.
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+	dnsClassIN  = 1
+
+	// Header flags.
+	dnsFlagQR     = 1 << 15
+	dnsFlagAA     = 1 << 10
+	dnsFlagRD     = 1 << 8
+	dnsOpcodeMask = 0xf << 11
+
+	// Response codes.
+	dnsRcodeFormErr  = 1
+	dnsRcodeNXDomain = 3
+	dnsRcodeNotImp   = 4
+	dnsRcodeRefused  = 5
+
+	// dnsNamePointer points at the name of the question, which always
+	// directly follows the header.
+	dnsNamePointer = 0xc000 | dnsHeaderLen
+
+	// maxUDPMsgLen is the largest DNS message sent over UDP without EDNS.
+	maxUDPMsgLen = 512
+
+	// maxDNSAnswers is the number of addresses returned per query.  Fewer
+	// are returned when they would not fit in maxUDPMsgLen.
+	maxDNSAnswers = 16
+
+	// dnsStreamTimeout bounds how long a TCP client may stay idle.
+	dnsStreamTimeout = 10 * time.Second
+)
+
+var errMalformedQuery = errors.New("malformed DNS query")
+
+// dnsQuestion is the single question of a DNS query.
+type dnsQuestion struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+
+	// raw is the question as received, which is echoed in the response.
+	raw []byte
+}
+
+// parseQuestion parses the question following the header of msg.
+func parseQuestion(msg []byte) (*dnsQuestion, error) {
+	var labels []string
+	off := dnsHeaderLen
+	for {
+		if off >= len(msg) {
+			return nil, errMalformedQuery
+		}
+		l := int(msg[off])
+		off++
+		if l == 0 {
+			break
+		}
+		// Compression is not expected in questions.
+		if l > 63 || off+l > len(msg) {
+			return nil, errMalformedQuery
+		}
+		labels = append(labels, string(msg[off:off+l]))
+		off += l
+	}
+	if off+4 > len(msg) {
+		return nil, errMalformedQuery
+	}
+
+	return &dnsQuestion{
+		name:   strings.ToLower(strings.Join(labels, ".")),
+		qtype:  binary.BigEndian.Uint16(msg[off:]),
+		qclass: binary.BigEndian.Uint16(msg[off+2:]),
+		raw:    msg[dnsHeaderLen : off+4],
+	}, nil
+}
+
+// dnsServer answers the A and AAAA queries for the seed host name with the
+// addresses of good nodes found by the crawler.
+type dnsServer struct {
+	host    string
+	ttl     uint32
+	crawler *crawler
+}
+
+// requiredServices returns the services the nodes returned for name must
+// offer.  Besides the host itself, subdomains of the form x<hex>.host select
+// nodes by service bits, as queried by connmgr.SeedFromDNS.
+func (d *dnsServer) requiredServices(name string) (wire.ServiceFlag, bool) {
+	if name == d.host {
+		return wire.SFNodeNetwork, true
+	}
+	sub := strings.TrimSuffix(name, "."+d.host)
+	if sub == name || len(sub) < 2 || sub[0] != 'x' {
+		return 0, false
+	}
+	services, err := strconv.ParseUint(sub[1:], 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return wire.ServiceFlag(services), true
+}
+
+// inZone returns whether name is the host or one of its subdomains.
+func (d *dnsServer) inZone(name string) bool {
+	return name == d.host || strings.HasSuffix(name, "."+d.host)
+}
+
+// handle returns the response to the DNS query req, or nil when req is not
+// worth answering.
+func (d *dnsServer) handle(req []byte) []byte {
+	if len(req) < dnsHeaderLen {
+		return nil
+	}
+	flags := binary.BigEndian.Uint16(req[2:])
+	if flags&dnsFlagQR != 0 {
+		return nil
+	}
+
+	respFlags := uint16(dnsFlagQR|dnsFlagAA) | flags&(dnsFlagRD|dnsOpcodeMask)
+	resp := make([]byte, dnsHeaderLen, maxUDPMsgLen)
+	copy(resp, req[:2])
+	reply := func(rcode uint16, question []byte, answers uint16) []byte {
+		binary.BigEndian.PutUint16(resp[2:], respFlags|rcode)
+		if question != nil {
+			binary.BigEndian.PutUint16(resp[4:], 1)
+		}
+		binary.BigEndian.PutUint16(resp[6:], answers)
+		return resp
+	}
+
+	if flags&dnsOpcodeMask != 0 {
+		return reply(dnsRcodeNotImp, nil, 0)
+	}
+	if binary.BigEndian.Uint16(req[4:]) != 1 {
+		return reply(dnsRcodeFormErr, nil, 0)
+	}
+	q, err := parseQuestion(req)
+	if err != nil {
+		return reply(dnsRcodeFormErr, nil, 0)
+	}
+	resp = append(resp, q.raw...)
+
+	if !d.inZone(q.name) {
+		return reply(dnsRcodeRefused, q.raw, 0)
+	}
+	services, ok := d.requiredServices(q.name)
+	if !ok {
+		return reply(dnsRcodeNXDomain, q.raw, 0)
+	}
+	if q.qclass != dnsClassIN || (q.qtype != dnsTypeA && q.qtype != dnsTypeAAAA) {
+		// The name exists but has no records of that type.
+		return reply(0, q.raw, 0)
+	}
+
+	ipv6 := q.qtype == dnsTypeAAAA
+	var answers uint16
+	for _, ip := range d.crawler.goodAddresses(ipv6, services, maxDNSAnswers) {
+		if ipv6 {
+			ip = ip.To16()
+		} else {
+			ip = ip.To4()
+		}
+		if len(resp)+12+len(ip) > maxUDPMsgLen {
+			break
+		}
+		var rr [12]byte
+		binary.BigEndian.PutUint16(rr[0:], dnsNamePointer)
+		binary.BigEndian.PutUint16(rr[2:], q.qtype)
+		binary.BigEndian.PutUint16(rr[4:], dnsClassIN)
+		binary.BigEndian.PutUint32(rr[6:], d.ttl)
+		binary.BigEndian.PutUint16(rr[10:], uint16(len(ip)))
+		resp = append(resp, rr[:]...)
+		resp = append(resp, ip...)
+		answers++
+	}
+	return reply(0, q.raw, answers)
+}
+
+// serveUDP answers the DNS queries received on conn until it is closed.
+func (d *dnsServer) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxUDPMsgLen)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if resp := d.handle(buf[:n]); resp != nil {
+			if _, err := conn.WriteTo(resp, addr); err != nil {
+				log.Debug("Can't answer DNS query of %s: %v", addr, err)
+			}
+		}
+	}
+}
+
+// serveTCP accepts DNS clients on l until it is closed.
+func (d *dnsServer) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go d.serveStream(conn)
+	}
+}
+
+// serveStream answers the length-prefixed DNS queries received on conn until
+// the client goes away.
+func (d *dnsServer) serveStream(conn net.Conn) {
+	defer conn.Close()
+
+	var length [2]byte
+	for {
+		conn.SetDeadline(time.Now().Add(dnsStreamTimeout))
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		resp := d.handle(req)
+		if resp == nil {
+			return
+		}
+		binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+		if _, err := conn.Write(append(length[:], resp...)); err != nil {
+			return
+		}
+	}
+}
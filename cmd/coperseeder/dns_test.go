@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/connmgr"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestDNSServer returns a server for seed.test knowing a few good nodes of
+// the regression test network.
+func newTestDNSServer(t *testing.T) *dnsServer {
+	c, cleanup := newTestCrawler(t, nil)
+	defer cleanup()
+	now := time.Now()
+	for _, n := range []struct {
+		ip       string
+		services wire.ServiceFlag
+	}{
+		{"1.0.0.1", wire.SFNodeNetwork},
+		{"1.0.0.2", wire.SFNodeNetwork | wire.SFNodeBloom},
+		{"2001:db8::1", wire.SFNodeNetwork | wire.SFNodeBloom},
+	} {
+		na := wire.NewNetAddressIPPort(net.ParseIP(n.ip), 18444, n.services)
+		c.nodes[addrmgr.NetAddressKey(na)] = &node{
+			addr:            na,
+			services:        n.services,
+			protocolVersion: wire.FeeFilterVersion,
+			lastSuccess:     now,
+			reliability:     1,
+		}
+	}
+	return &dnsServer{host: "seed.test", ttl: 60, crawler: c}
+}
+
+// testLookup returns a lookup function whose queries are answered by d
+// in-process, without the network.
+func testLookup(d *dnsServer) connmgr.LookupFunc {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go d.serveStream(server)
+			return client, nil
+		},
+	}
+	return func(host string) ([]net.IP, error) {
+		addrs, err := r.LookupIPAddr(context.Background(), host)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+		return ips, nil
+	}
+}
+
+// buildQuery returns a DNS query for name and qtype.
+func buildQuery(id uint16, name string, qtype uint16) []byte {
+	msg := make([]byte, dnsHeaderLen)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRD)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range splitLabels(name) {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+	return msg
+}
+
+func splitLabels(name string) []string {
+	var labels []string
+	start := 0
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' {
+			labels = append(labels, name[start:i])
+			start = i + 1
+		}
+	}
+	return append(labels, name[start:])
+}
+
+func sortedIPs(ips []net.IP) []string {
+	s := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestHandleQuery(t *testing.T) {
+	d := newTestDNSServer(t)
+
+	resp := d.handle(buildQuery(0x1234, "SEED.test", dnsTypeA))
+	assert.Equal(t, uint16(0x1234), binary.BigEndian.Uint16(resp[0:]))
+	flags := binary.BigEndian.Uint16(resp[2:])
+	assert.Equal(t, uint16(dnsFlagQR|dnsFlagAA|dnsFlagRD), flags)
+	assert.Equal(t, uint16(1), binary.BigEndian.Uint16(resp[4:]))
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(resp[6:]))
+
+	rcode := func(resp []byte) uint16 {
+		return binary.BigEndian.Uint16(resp[2:]) & 0xf
+	}
+	assert.Equal(t, uint16(dnsRcodeNXDomain), rcode(d.handle(buildQuery(1, "foo.seed.test", dnsTypeA))))
+	assert.Equal(t, uint16(dnsRcodeNXDomain), rcode(d.handle(buildQuery(1, "xzz.seed.test", dnsTypeA))))
+	assert.Equal(t, uint16(dnsRcodeRefused), rcode(d.handle(buildQuery(1, "example.com", dnsTypeA))))
+	assert.Equal(t, uint16(dnsRcodeFormErr), rcode(d.handle(buildQuery(1, "seed.test", dnsTypeA)[:14])))
+
+	// Other record types of the host exist but are empty.
+	resp = d.handle(buildQuery(1, "seed.test", 16))
+	assert.Equal(t, uint16(0), rcode(resp))
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(resp[6:]))
+
+	// Responses are never answered.
+	query := buildQuery(1, "seed.test", dnsTypeA)
+	query[2] |= dnsFlagQR >> 8
+	assert.Nil(t, d.handle(query))
+}
+
+func TestResolve(t *testing.T) {
+	lookup := testLookup(newTestDNSServer(t))
+
+	ips, err := lookup("seed.test.")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.0.0.1", "1.0.0.2", "2001:db8::1"}, sortedIPs(ips))
+
+	ips, err = lookup("x5.seed.test.")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1.0.0.2", "2001:db8::1"}, sortedIPs(ips))
+
+	_, err = lookup("nonsense.seed.test.")
+	assert.NotNil(t, err)
+}
+
+func TestSeedFromDNS(t *testing.T) {
+	params := model.RegressionNetParams
+	params.DNSSeeds = []model.DNSSeed{{Host: "seed.test.", HasFiltering: true}}
+
+	seededCh := make(chan []*wire.NetAddress, 1)
+	connmgr.SeedFromDNS(&params, wire.SFNodeNetwork|wire.SFNodeBloom,
+		testLookup(newTestDNSServer(t)), func(addrs []*wire.NetAddress) {
+			seededCh <- addrs
+		})
+
+	var seeded []*wire.NetAddress
+	select {
+	case seeded = <-seededCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no addresses seeded")
+	}
+
+	ips := make([]net.IP, 0, len(seeded))
+	for _, na := range seeded {
+		assert.Equal(t, uint16(18444), na.Port)
+		ips = append(ips, na.IP)
+	}
+	assert.Equal(t, []string{"1.0.0.2", "2001:db8::1"}, sortedIPs(ips))
+}
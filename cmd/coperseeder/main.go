@@ -0,0 +1,89 @@
+// coperseeder crawls the Bitcoin Cash network and answers the DNS queries of
+// nodes looking for peers with the addresses of the good nodes it found.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/connmgr"
+	"github.com/copernet/copernicus/net/wire"
+)
+
+func main() {
+	if err := seederMain(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func seederMain() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// The wire package bounds the messages it reads by the configured
+	// excessive block size.
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+
+	params := cfg.netParams()
+	amgr := addrmgr.New(cfg.DataDir, net.LookupIP)
+	amgr.Start()
+	defer amgr.Stop()
+
+	c := newCrawler(params, amgr, cfg.MaxCrawlers, func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, dialTimeout)
+	})
+
+	// Start from the addresses known from previous runs and the given nodes,
+	// or ask the DNS seeds of the network when there are none.
+	c.addAddresses(amgr.AddressCache())
+	port, _ := strconv.ParseUint(params.DefaultPort, 10, 16)
+	for _, seeder := range cfg.Seeders {
+		host, portStr, _ := net.SplitHostPort(seeder)
+		seederPort, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			seederPort = port
+		}
+		na, err := amgr.HostToNetAddress(host, uint16(seederPort), wire.SFNodeNetwork)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't resolve seeder %s: %v\n", seeder, err)
+			return err
+		}
+		c.addAddresses([]*wire.NetAddress{na})
+	}
+	if len(cfg.Seeders) == 0 {
+		connmgr.SeedFromDNS(params, wire.SFNodeNetwork, net.LookupIP, c.addAddresses)
+	}
+
+	dns := &dnsServer{host: cfg.Host, ttl: cfg.TTL, crawler: c}
+	udpConn, err := net.ListenPacket("udp", cfg.Listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't listen on %s: %v\n", cfg.Listen, err)
+		return err
+	}
+	defer udpConn.Close()
+	tcpListener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't listen on %s: %v\n", cfg.Listen, err)
+		return err
+	}
+	defer tcpListener.Close()
+
+	c.start()
+	defer c.stop()
+	go dns.serveUDP(udpConn)
+	go dns.serveTCP(tcpListener)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	return nil
+}
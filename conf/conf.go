@@ -66,19 +66,18 @@ type Configuration struct {
 		FileName string   // the name of log file
 	}
 	Mempool struct {
-		MinFeeRate           int64  //
-		LimitAncestorCount   int    // Default for -limitancestorcount, max number of in-mempool ancestors
-		LimitAncestorSize    int    // Default for -limitancestorsize, maximum kilobytes of tx + all in-mempool ancestors
-		LimitDescendantCount int    // Default for -limitdescendantcount, max number of in-mempool descendants
-		LimitDescendantSize  int    // Default for -limitdescendantsize, maximum kilobytes of in-mempool descendants
-		MaxPoolSize          int64  `default:"300000000"` // Default for MaxPoolSize, maximum megabytes of mempool memory usage
-		MaxPoolExpiry        int    `default:"336"`       // Default for -mempoolexpiry, expiration time for mempool transactions in hours
-		CheckFrequency       uint64 `default:"4294967296"`
+		MinFeeRate     int64  //
+		MaxPoolSize    int64  `default:"300000000"` // Default for MaxPoolSize, maximum megabytes of mempool memory usage
+		MaxPoolExpiry  int    `default:"336"`       // Default for -mempoolexpiry, expiration time for mempool transactions in hours
+		CheckFrequency uint64 `default:"4294967296"`
+		PersistMempool bool   `default:"true"` // Save the mempool on shutdown and load it on restart
 	}
 	P2PNet struct {
 		ListenAddrs         []string `validate:"require" default:"1234"`
 		MaxPeers            int      `default:"128"`
 		TargetOutbound      int      `default:"64"`
+		BlockRelayOnly      int      `default:"2"` // Extra outbound peers which only relay blocks
+		MaxAnchors          int      `default:"2"` // Block-relay-only peers saved as anchors on shutdown
 		ConnectPeersOnStart []string
 		DisableBanning      bool   `default:"true"`
 		BanThreshold        uint32 `default:"100"`
@@ -98,6 +97,10 @@ type Configuration struct {
 		Upnp                bool     `default:"false"` // Use UPnP to map our listening port outside of NAT
 		ExternalIPs         []string // Add an ip to the list of local addresses we claim to listen on to peers
 		MaxTimeAdjustment   uint64   `default:"4200"`
+		MaxUploadTarget     uint64   `default:"0"` // Max MiB uploaded per 24h, historical blocks are served first to stop. 0 for no limit
+		MaxUploadRate       uint64   `default:"0"` // Max KiB per second written to non-whitelisted peers. 0 for no limit
+		Asmap               string   // ASN map file, relative to the data dir, used to group peers by autonomous system
+		CaptureMessages     bool     // Record the messages exchanged with each peer under message_capture in the data dir
 		//AddCheckpoints      []model.Checkpoint
 	}
 	AddrMgr struct {
@@ -119,6 +122,14 @@ type Configuration struct {
 	TxOut struct {
 		DustRelayFee int64 `default:"83"`
 	}
+	Policy struct {
+		Name                  string   `default:"default"` // Name reported in the reject messages of a non default policy
+		DisabledRules         []string // Standardness rules not checked, eg. dust, datacarrier, min-relay-fee
+		MinTxSize             uint     // Min size in bytes of a standard tx
+		MaxTxSize             uint     `default:"100000"` // Max size in bytes of a standard tx
+		ScriptTemplates       []string // Allowed scriptPubKey templates, all the standard ones when empty
+		MaxDatacarrierOutputs int      `default:"1"` // OP_RETURN outputs per tx, sharing Script.MaxDatacarrierBytes
+	}
 	Chain struct {
 		AssumeValid         string
 		UtxoHashStartHeight int32 `default:"-1"`
@@ -141,6 +152,17 @@ type Configuration struct {
 		Broadcast           bool `default:"false"`
 		SpendZeroConfChange bool `default:"true"`
 	}
+	Stratum struct {
+		Enable        bool    `default:"false"`
+		Listen        string  `default:"127.0.0.1:3333"`
+		PayAddress    string  // Address paid by the coinbase of the blocks mined through stratum
+		Password      string  // Password of the workers, any password is accepted when empty
+		Difficulty    float64 `default:"1"`           // Share difficulty of a new connection
+		MinDifficulty float64 `default:"0.001"`       // Lowest share difficulty set by vardiff
+		MaxDifficulty float64 `default:"10000000000"` // Highest share difficulty set by vardiff
+		ShareInterval int     `default:"10"`          // Seconds between the shares of a connection aimed at by vardiff
+		JobInterval   int     `default:"30"`          // Seconds between the jobs taking new mempool transactions
+	}
 }
 
 var (
@@ -249,7 +271,6 @@ func InitConfig(args []string) *Configuration {
 	config.DataDir = DataDir
 	config.Reindex = opts.Reindex
 	config.Excessiveblocksize = opts.Excessiveblocksize
-	config.Mempool.LimitAncestorCount = opts.Limitancestorcount
 	config.Script.PromiscuousMempoolFlags = opts.PromiscuousMempoolFlags
 	config.Mempool.MaxPoolSize = opts.MaxMempool
 
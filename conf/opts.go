@@ -26,7 +26,6 @@ type Opts struct {
 	MagneticAnomalyTime            int64  `long:"magneticanomalyactivationtime" default:"-1"`
 	StopAtHeight                   int32  `long:"stopatheight" default:"-1"`
 	PromiscuousMempoolFlags        string `long:"promiscuousmempoolflags"`
-	Limitancestorcount             int    `long:"limitancestorcount" default:"50000"`
 	BlockVersion                   int32  `long:"blockversion" default:"-1" description:"regtest block version"`
 	MaxMempool                     int64  `long:"maxmempool" default:"300000000"`
 	SpendZeroConfChange            uint8  `long:"spendzeroconfchange" default:"1"`
@@ -8,6 +8,7 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/lblockindex"
 	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/logic/lmempool"
 	"github.com/copernet/copernicus/logic/lreindex"
 	"github.com/copernet/copernicus/logic/ltx"
 	"github.com/copernet/copernicus/model"
@@ -118,4 +119,13 @@ func appInitMain(args []string) {
     tip block index: %s
 ---------------------`, gChain.Height(), gChain.IndexMapSize(), gChain.Tip().String())
 	}
+
+	if err := lmempool.LoadFeeEstimates(); err != nil && !os.IsNotExist(err) {
+		log.Error("failed to load fee estimates from disk: %v", err)
+	}
+	if conf.Cfg.Mempool.PersistMempool {
+		if _, err := lmempool.LoadMempool(); err != nil && !os.IsNotExist(err) {
+			log.Error("failed to load mempool from disk: %v", err)
+		}
+	}
 }
@@ -299,6 +299,9 @@ func ConnectTip(pIndexNew *blockindex.BlockIndex,
 	log.Print("bench", "debug", " - Writing chainstate: %.2fms [%.2fs]\n",
 		float64(nTime5-nTime4)*0.001, float64(gPersist.GlobalTimeChainState)*0.000001)
 
+	// Record the confirmation times of the mempool transactions before they
+	// are removed.
+	mempool.GetFeeEstimator().ProcessBlock(pIndexNew.Height, blockConnecting.Txs)
 	// Remove conflicting transactions from the mempool.;
 	mempool.GetInstance().RemoveTxSelf(blockConnecting.Txs)
 	// Update chainActive & related variables.
@@ -3,10 +3,8 @@ package lmempool
 import (
 	"container/list"
 	"fmt"
-	"github.com/copernet/copernicus/model/wallet"
 	"math"
 
-	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/ltx"
@@ -19,41 +17,38 @@ import (
 )
 
 func AcceptTxToMemPool(txn *tx.Tx) error {
+	return acceptTxToMemPool(txn, 0)
+}
+
+// acceptTxToMemPool accepts the transaction to the mempool as if it had
+// entered it at entryTime, or now if entryTime is zero.
+func acceptTxToMemPool(txn *tx.Tx, entryTime int64) error {
 	txEntry, err := ltx.CheckTxBeforeAcceptToMemPool(txn)
 	if err != nil {
+		countReject(err)
 		return err
 	}
+	if entryTime != 0 {
+		txEntry.SetTime(entryTime)
+	}
 
-	return addTxToMemPool(txEntry)
+	if err := addTxToMemPool(txEntry); err != nil {
+		countReject(err)
+		return err
+	}
+	return nil
 }
 
 func addTxToMemPool(txe *mempool.TxEntry) error {
 	pool := mempool.GetInstance()
 
-	ancestorNum := conf.Cfg.Mempool.LimitAncestorCount
-	ancestorSize := conf.Cfg.Mempool.LimitAncestorSize
-	descendantNum := conf.Cfg.Mempool.LimitDescendantCount
-	descendantSize := conf.Cfg.Mempool.LimitDescendantSize
-
 	pool.Lock()
 	defer pool.Unlock()
-	ancestors, err := pool.CalculateMemPoolAncestors(txe.Tx, uint64(ancestorNum), uint64(ancestorSize*1000),
-		uint64(descendantNum), uint64(descendantSize*1000), true)
-
-	if err != nil {
-		return err
-	}
-
-	err = pool.AddTx(txe, ancestors)
+	err := pool.AddTx(txe)
 	if err != nil {
 		log.Error("add tx failed:%s", err.Error())
 		return err
 	}
-
-	// TODO: simple implementation just for testing, remove this after complete wallet
-	if wallet.GetInstance().IsEnable() {
-		wallet.GetInstance().HandleRelatedMempoolTx(txe.Tx)
-	}
 	return nil
 }
 
@@ -111,6 +106,11 @@ func RemoveForReorg(nMemPoolHeight int32, flag int) {
 	oldPool := mempool.GetInstance()
 	log.Debug("RemoveForReorg start")
 	mempool.SetInstance(newPool)
+	newPool.TakeOver(oldPool)
+	defer newPool.PublishRemoved(oldPool)
+	for hash, delta := range oldPool.GetAllFeeDeltas() {
+		newPool.PrioritiseTransaction(hash, delta)
+	}
 	for _, txentry := range oldPool.GetAllTxEntry() {
 		txn := txentry.Tx
 		err := AcceptTxToMemPool(txn)
@@ -258,12 +258,15 @@ func CheckMempool(bestHeight int32) {
 		setParentCheck := make(map[util.Hash]struct{})
 
 		for _, preout := range entry.Tx.GetAllPreviousOut() {
-			if entry, ok := allEntry[preout.Hash]; ok {
-				tx2 := entry.Tx
+			if parent, ok := allEntry[preout.Hash]; ok {
+				tx2 := parent.Tx
 				if !(tx2.GetOutsCount() > int(preout.Index) && !tx2.GetTxOut(int(preout.Index)).IsNull()) {
 					panic("the tx introduced input dose not exist, or the input amount is nil ")
 				}
 
+				if parent.Depth >= entry.Depth {
+					panic("the transaction is not deeper than its parent")
+				}
 				fDependsWait = true
 				setParentCheck[tx2.GetHash()] = struct{}{}
 			} else {
@@ -280,59 +283,20 @@ func CheckMempool(bestHeight int32) {
 			panic("the two parent set should be equal")
 		}
 
-		// Verify ancestor state is correct.
-		nNoLimit := uint64(math.MaxUint64)
-		setAncestors, err := pool.CalculateMemPoolAncestors(entry.Tx, nNoLimit, nNoLimit, nNoLimit, nNoLimit, true)
-		if err != nil {
-			return
-		}
-		nCountCheck := int64(len(setAncestors)) + 1
-		nSizeCheck := int64(entry.TxSize)
-		nSigOpCheck := int64(entry.SigOpCount)
-		nFeesCheck := entry.TxFee
-		for ancestorIt := range setAncestors {
-			nSizeCheck += int64(ancestorIt.TxSize)
-			nSigOpCheck += int64(ancestorIt.SigOpCount)
-			nFeesCheck += ancestorIt.TxFee
-		}
-		if entry.SumTxCountWithAncestors != nCountCheck {
-			panic("the txentry's ancestors number is incorrect .")
-		}
-		if entry.SumTxSizeWitAncestors != nSizeCheck {
-			panic("the txentry's ancestors size is incorrect .")
-		}
-		if entry.SumTxSigOpCountWithAncestors != nSigOpCheck {
-			panic("the txentry's ancestors sigopcount is incorrect .")
-		}
-		if entry.SumTxFeeWithAncestors != nFeesCheck {
-			panic("the txentry's ancestors fee is incorrect .")
-		}
-
 		setChildrenCheck := make(map[*mempool.TxEntry]struct{})
-		childSize := 0
 		for i := 0; i < entry.Tx.GetOutsCount(); i++ {
 			o := outpoint.OutPoint{Hash: entry.Tx.GetHash(), Index: uint32(i)}
 			if e := pool.HasSPentOutWithoutLock(&o); e != nil {
 				if _, ok := allEntry[e.Tx.GetHash()]; !ok {
 					panic("the transaction should be in mempool ...")
 				}
-				if _, ok := setChildrenCheck[e]; !ok {
-					setChildrenCheck[e] = struct{}{}
-					childSize += e.TxSize
-				}
+				setChildrenCheck[e] = struct{}{}
 			}
 		}
 
 		if len(setChildrenCheck) != len(entry.ChildTx) {
 			panic("the transaction children set is different ...")
 		}
-		if entry.SumTxSizeWithDescendants < int64(childSize+entry.TxSize) {
-			panic("the transaction descendant's fee is less its children fee ...")
-		}
-
-		// Also check to make sure size is greater than sum with immediate
-		// children. Just a sanity check, not definitive that this calc is
-		// correct...
 		if fDependsWait {
 			waitingOnDependants.PushBack(entry)
 		} else {
@@ -414,3 +378,27 @@ func FindOrphanTxInMemPool(hash util.Hash) *tx.Tx {
 
 	return nil
 }
+
+// MissingParents returns the transactions spent by txn which are neither in
+// the utxo set nor in the mempool.
+func MissingParents(txn *tx.Tx) []util.Hash {
+	pool := mempool.GetInstance()
+	pool.RLock()
+	defer pool.RUnlock()
+
+	utxoCache := utxo.GetUtxoCacheInstance()
+	seen := make(map[util.Hash]struct{})
+	var parents []util.Hash
+	for _, e := range txn.GetIns() {
+		hash := e.PreviousOutPoint.Hash
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		if utxoCache.GetCoin(e.PreviousOutPoint) != nil || pool.GetCoin(e.PreviousOutPoint) != nil {
+			continue
+		}
+		seen[hash] = struct{}{}
+		parents = append(parents, hash)
+	}
+	return parents
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/copernet/copernicus/service/mining"
 	"github.com/copernet/copernicus/util"
 	"github.com/copernet/copernicus/util/amount"
+	"github.com/copernet/copernicus/util/bloom"
 	"github.com/copernet/copernicus/util/cashaddr"
 	"github.com/stretchr/testify/assert"
 	"math"
@@ -482,7 +483,7 @@ func TestSimpleOrphanChain(t *testing.T) {
 
 	generateTestBlocks(t, script.NewScriptRaw(harness.payScript))
 
-	recentRejects := make(map[util.Hash]struct{})
+	recentRejects := bloom.NewRollingFilter(100, 0.000001)
 	// Ensure the orphans are accepted (only up to the maximum allowed so
 	// none are evicted).
 	for _, tx := range chainedTxns[1 : maxOrphans+1] {
@@ -576,7 +577,7 @@ func TestOrphanReject(t *testing.T) {
 		t.Fatalf("unable to create transaction chain: %v", err)
 	}
 
-	recentRejects := make(map[util.Hash]struct{})
+	recentRejects := bloom.NewRollingFilter(100, 0.000001)
 	// Ensure orphans are rejected when the allow orphans flag is not set.
 	for _, tx := range chainedTxns[1:] {
 		// acceptedTxns, err := harness.txPool.ProcessTransaction(tx, false,
@@ -0,0 +1,273 @@
+package lmempool
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/policy"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// MaxPackageCount is the number of transactions of a package at most.
+	MaxPackageCount = 25
+
+	// MaxPackageSize is the total size of the transactions of a package at
+	// most.
+	MaxPackageSize = 101000
+)
+
+// checkPackage checks that the transactions of a package are distinct, spend
+// distinct outputs and come after the transactions of the package they spend.
+func checkPackage(txs []*tx.Tx) error {
+	if len(txs) == 0 || len(txs) > MaxPackageCount {
+		return errcode.NewError(errcode.RejectInvalid, "package-too-many-transactions")
+	}
+
+	size := 0
+	later := make(map[util.Hash]struct{}, len(txs))
+	for _, txn := range txs {
+		if _, ok := later[txn.GetHash()]; ok {
+			return errcode.NewError(errcode.RejectInvalid, "package-contains-duplicates")
+		}
+		later[txn.GetHash()] = struct{}{}
+		size += int(txn.EncodeSize())
+	}
+	if size > MaxPackageSize {
+		return errcode.NewError(errcode.RejectInvalid, "package-too-large")
+	}
+
+	spent := make(map[outpoint.OutPoint]struct{})
+	for _, txn := range txs {
+		delete(later, txn.GetHash())
+		for _, e := range txn.GetIns() {
+			if _, ok := later[e.PreviousOutPoint.Hash]; ok {
+				return errcode.NewError(errcode.RejectInvalid, "package-not-sorted")
+			}
+			if _, ok := spent[*e.PreviousOutPoint]; ok {
+				return errcode.NewError(errcode.RejectInvalid, "conflict-in-package")
+			}
+			spent[*e.PreviousOutPoint] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// AcceptPackageToMemPool accepts the transactions of a package, parents before
+// children, to the mempool together. Each must pass the checks of
+// AcceptTxToMemPool but the mempool min fee, which the package pays as a
+// whole, so that a child can pay for a parent whose fee is too low on its own.
+// Each must still pay the min relay fee rate, with the ancestors of a
+// descendant of the package if not on its own. Transactions already in the
+// mempool are left there and don't count towards the fee of the package. Either all the other transactions are added or none
+// is, and the results tell why.
+func AcceptPackageToMemPool(txs []*tx.Tx) ([]*AcceptResult, error) {
+	if err := checkPackage(txs); err != nil {
+		return nil, err
+	}
+
+	pool := mempool.GetInstance()
+	pending := newPendingPackage()
+	results := make([]*AcceptResult, 0, len(txs))
+	entries := make([]*mempool.TxEntry, 0, len(txs))
+	failed := false
+	fees, size := int64(0), int64(0)
+	for _, txn := range txs {
+		if entry := pool.FindTx(txn.GetHash()); entry != nil {
+			results = append(results, &AcceptResult{Entry: entry})
+			continue
+		}
+
+		txEntry, err := pending.accept(txn, false)
+		results = append(results, &AcceptResult{Entry: txEntry, Err: err})
+		if err != nil {
+			failed = true
+			continue
+		}
+		entries = append(entries, txEntry)
+		fees += txEntry.TxFee + pool.GetFeeDelta(txn.GetHash())
+		size += int64(txEntry.TxSize)
+	}
+	if failed {
+		return results, errcode.NewError(errcode.RejectInvalid, "package-validation-failed")
+	}
+	if len(entries) == 0 {
+		return results, nil
+	}
+	if err := checkPackageFeeRates(pool, entries); err != nil {
+		return results, err
+	}
+
+	pool.Lock()
+	minFeeRate := pool.GetMinFee(conf.Cfg.Mempool.MaxPoolSize)
+	minFee := minFeeRate.GetFee(int(size))
+	if fees < minFee {
+		pool.Unlock()
+		reason := fmt.Sprintf("package mempool min fee not met, %d < %d", fees, minFee)
+		return results, errcode.NewError(errcode.RejectInsufficientFee, reason)
+	}
+	pool.AddPackage(entries)
+	evicted := false
+	for _, txEntry := range entries {
+		evicted = evicted || !pool.IsTransactionInPool(txEntry.Tx)
+	}
+	pool.Unlock()
+	if evicted {
+		// What is left of the package doesn't pay for itself.
+		for _, txEntry := range entries {
+			pool.RemoveTxRecursive(txEntry.Tx, mempool.SIZELIMIT)
+		}
+		return results, errcode.NewError(errcode.RejectInsufficientFee, "mempool full")
+	}
+	return results, nil
+}
+
+// checkPackageFeeRates checks that each transaction of the package pays the
+// min relay fee rate, on its own or with the ancestors of a descendant, so
+// that a package can't carry transactions which nothing pays for. Only the
+// transactions of the package count, those of the mempool already paid.
+func checkPackageFeeRates(pool *mempool.TxMempool, entries []*mempool.TxEntry) error {
+	index := make(map[util.Hash]int, len(entries))
+	ancestors := make([]map[int]struct{}, len(entries))
+	paid := make([]bool, len(entries))
+	errs := make([]error, len(entries))
+	for i, txEntry := range entries {
+		index[txEntry.Tx.GetHash()] = i
+		ancestors[i] = map[int]struct{}{i: {}}
+		for _, e := range txEntry.Tx.GetIns() {
+			if parent, ok := index[e.PreviousOutPoint.Hash]; ok {
+				for j := range ancestors[parent] {
+					ancestors[i][j] = struct{}{}
+				}
+			}
+		}
+
+		fee, size := int64(0), 0
+		for j := range ancestors[i] {
+			fee += entries[j].TxFee + pool.GetFeeDelta(entries[j].Tx.GetHash())
+			size += entries[j].TxSize
+		}
+		errs[i] = policy.GetInstance().CheckFee(fee, size)
+		if errs[i] == nil {
+			for j := range ancestors[i] {
+				paid[j] = true
+			}
+		}
+	}
+
+	for i := range entries {
+		if !paid[i] {
+			return errs[i]
+		}
+	}
+	return nil
+}
+
+// maxLowFeeTxs is the number of low fee transactions kept at most.
+const maxLowFeeTxs = 100
+
+// lowFeeTxs are the recent transactions refused only for the mempool min fee,
+// kept to be reconsidered with a child paying for them.
+var lowFeeTxs = struct {
+	sync.Mutex
+	txs   map[util.Hash]*tx.Tx
+	order []util.Hash
+}{txs: make(map[util.Hash]*tx.Tx)}
+
+// AddLowFeeTx keeps a transaction refused only for the mempool min fee, in
+// case a child paying for it arrives.
+func AddLowFeeTx(txn *tx.Tx) {
+	lowFeeTxs.Lock()
+	defer lowFeeTxs.Unlock()
+	if _, ok := lowFeeTxs.txs[txn.GetHash()]; ok {
+		return
+	}
+	if len(lowFeeTxs.order) >= maxLowFeeTxs {
+		delete(lowFeeTxs.txs, lowFeeTxs.order[0])
+		lowFeeTxs.order = lowFeeTxs.order[1:]
+	}
+	lowFeeTxs.txs[txn.GetHash()] = txn
+	lowFeeTxs.order = append(lowFeeTxs.order, txn.GetHash())
+}
+
+func getLowFeeTx(hash util.Hash) *tx.Tx {
+	lowFeeTxs.Lock()
+	defer lowFeeTxs.Unlock()
+	return lowFeeTxs.txs[hash]
+}
+
+func removeLowFeeTx(hash util.Hash) {
+	lowFeeTxs.Lock()
+	defer lowFeeTxs.Unlock()
+	if _, ok := lowFeeTxs.txs[hash]; !ok {
+		return
+	}
+	delete(lowFeeTxs.txs, hash)
+	for i, h := range lowFeeTxs.order {
+		if h == hash {
+			lowFeeTxs.order = append(lowFeeTxs.order[:i], lowFeeTxs.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// acceptParentAndChild accepts a low fee parent with its child as a package.
+func acceptParentAndChild(parent, child *tx.Tx) bool {
+	if _, err := AcceptPackageToMemPool([]*tx.Tx{parent, child}); err != nil {
+		log.Debug("package of %s and child %s refused: %v", parent.GetHash(), child.GetHash(), err)
+		return false
+	}
+	removeLowFeeTx(parent.GetHash())
+	return true
+}
+
+// AcceptWithLowFeeParent accepts a transaction missing inputs with a low fee
+// parent it spends, if the two make a package paying the mempool min fee. It
+// returns the transactions added to the mempool.
+func AcceptWithLowFeeParent(txn *tx.Tx) []*tx.Tx {
+	for _, e := range txn.GetIns() {
+		parent := getLowFeeTx(e.PreviousOutPoint.Hash)
+		if parent == nil {
+			continue
+		}
+		if !acceptParentAndChild(parent, txn) {
+			return nil
+		}
+		return []*tx.Tx{parent, txn}
+	}
+	return nil
+}
+
+// AcceptWithOrphanChild accepts a low fee transaction with an orphan spending
+// it, the first which makes a package paying the mempool min fee. It returns
+// the transactions added to the mempool.
+func AcceptWithOrphanChild(txn *tx.Tx) []*tx.Tx {
+	pool := mempool.GetInstance()
+
+	// The orphans are collected under the lock, which accepting them takes.
+	orphans := make([]*tx.Tx, 0)
+	pool.RLock()
+	for i := 0; i < txn.GetOutsCount(); i++ {
+		out := outpoint.OutPoint{Hash: txn.GetHash(), Index: uint32(i)}
+		for _, orphan := range pool.OrphanTransactionsByPrev[out] {
+			orphans = append(orphans, orphan.Tx)
+		}
+	}
+	pool.RUnlock()
+
+	for _, orphan := range orphans {
+		if acceptParentAndChild(txn, orphan) {
+			pool.Lock()
+			pool.EraseOrphanTx(orphan.GetHash(), false)
+			pool.Unlock()
+			return []*tx.Tx{txn, orphan}
+		}
+	}
+	return nil
+}
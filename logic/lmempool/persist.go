@@ -0,0 +1,300 @@
+package lmempool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// MempoolFileName is the name of the mempool file in the data dir.
+	MempoolFileName = "mempool.dat"
+
+	// FeeEstimatesFileName is the name of the fee estimates file in the
+	// data dir.
+	FeeEstimatesFileName = "fee_estimates.dat"
+
+	// mempoolFileVersion is the version of the mempool file format.
+	mempoolFileVersion = 1
+
+	// checksumSize is the size of the double sha256 ending the mempool
+	// file.
+	checksumSize = util.Hash256Size
+)
+
+var (
+	errMempoolFileChecksum = errors.New("mempool file checksum mismatch")
+	errMempoolFileShort    = errors.New("mempool file too short")
+)
+
+// mempoolRecord is a transaction of the mempool file.
+type mempoolRecord struct {
+	tx       *tx.Tx
+	time     int64
+	feeDelta int64
+}
+
+// LoadMempoolStats counts the outcome of the transactions of a mempool file.
+type LoadMempoolStats struct {
+	Loaded       int
+	Failed       int
+	Expired      int
+	AlreadyThere int
+}
+
+// mempoolFilePath returns the path of the mempool file.
+func mempoolFilePath() string {
+	return filepath.Join(conf.Cfg.DataDir, MempoolFileName)
+}
+
+// writeMempoolFile writes the transactions and the fee deltas of the
+// transactions which are not among them, followed by the checksum of the
+// whole.
+//
+// The file starts with the uint64 version and the uint64 count of
+// transactions, each followed by its int64 entry time and int64 fee delta.
+// Then come the varint count of the other deltas, each a hash and an int64.
+func writeMempoolFile(w io.Writer, records []*mempoolRecord, deltas map[util.Hash]int64) error {
+	var buf bytes.Buffer
+	err := util.WriteElements(&buf, uint64(mempoolFileVersion), uint64(len(records)))
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := rec.tx.Serialize(&buf); err != nil {
+			return err
+		}
+		if err := util.WriteElements(&buf, rec.time, rec.feeDelta); err != nil {
+			return err
+		}
+	}
+
+	if err := util.WriteVarInt(&buf, uint64(len(deltas))); err != nil {
+		return err
+	}
+	for hash, delta := range deltas {
+		if _, err := buf.Write(hash[:]); err != nil {
+			return err
+		}
+		if err := util.WriteElements(&buf, delta); err != nil {
+			return err
+		}
+	}
+
+	checksum := util.DoubleSha256Bytes(buf.Bytes())
+	buf.Write(checksum)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// readMempoolFile reads a mempool file written by writeMempoolFile.
+func readMempoolFile(r io.Reader) ([]*mempoolRecord, map[util.Hash]int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < checksumSize {
+		return nil, nil, errMempoolFileShort
+	}
+	content := data[:len(data)-checksumSize]
+	if !bytes.Equal(util.DoubleSha256Bytes(content), data[len(content):]) {
+		return nil, nil, errMempoolFileChecksum
+	}
+
+	buf := bytes.NewReader(content)
+	var version, count uint64
+	if err := util.ReadElements(buf, &version, &count); err != nil {
+		return nil, nil, err
+	}
+	if version != mempoolFileVersion {
+		return nil, nil, fmt.Errorf("unsupported mempool file version %d", version)
+	}
+
+	var records []*mempoolRecord
+	for i := uint64(0); i < count; i++ {
+		rec := &mempoolRecord{tx: tx.NewEmptyTx()}
+		if err := rec.tx.Unserialize(buf); err != nil {
+			return nil, nil, err
+		}
+		if err := util.ReadElements(buf, &rec.time, &rec.feeDelta); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, rec)
+	}
+
+	deltaCount, err := util.ReadVarInt(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	deltas := make(map[util.Hash]int64)
+	for i := uint64(0); i < deltaCount; i++ {
+		var hash util.Hash
+		var delta int64
+		if _, err := io.ReadFull(buf, hash[:]); err != nil {
+			return nil, nil, err
+		}
+		if err := util.ReadElements(buf, &delta); err != nil {
+			return nil, nil, err
+		}
+		deltas[hash] = delta
+	}
+	return records, deltas, nil
+}
+
+// mempoolRecords returns the transactions of the mempool, parents before their
+// children, and the fee deltas of the transactions which are not in it.
+func mempoolRecords(pool *mempool.TxMempool) ([]*mempoolRecord, map[util.Hash]int64) {
+	deltas := pool.GetAllFeeDeltas()
+
+	pool.RLock()
+	entries := make([]*mempool.TxEntry, 0, len(pool.GetAllTxEntryWithoutLock()))
+	for _, entry := range pool.GetAllTxEntryWithoutLock() {
+		entries = append(entries, entry)
+	}
+	// A transaction is deeper in the mempool than any of its parents.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Depth < entries[j].Depth
+	})
+	records := make([]*mempoolRecord, 0, len(entries))
+	for _, entry := range entries {
+		hash := entry.Tx.GetHash()
+		records = append(records, &mempoolRecord{
+			tx:       entry.Tx,
+			time:     entry.GetTime(),
+			feeDelta: deltas[hash],
+		})
+		delete(deltas, hash)
+	}
+	pool.RUnlock()
+
+	return records, deltas
+}
+
+// DumpMempool writes the transactions of the mempool, with their entry time
+// and fee delta, to the mempool file of the data dir.
+func DumpMempool() error {
+	start := util.GetTimeMicroSec()
+	records, deltas := mempoolRecords(mempool.GetInstance())
+
+	path := mempoolFilePath()
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = writeMempoolFile(f, records, deltas)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	log.Info("Dumped %d mempool transactions to %s in %dus", len(records), path,
+		util.GetTimeMicroSec()-start)
+	return nil
+}
+
+// acceptMempoolRecord accepts the transaction of the record to the mempool as
+// if it had entered it at the time of the record.
+func acceptMempoolRecord(rec *mempoolRecord) error {
+	return acceptTxToMemPool(rec.tx, rec.time)
+}
+
+// LoadMempool accepts the transactions of the mempool file of the data dir
+// which have not expired, and restores the fee deltas.  Fee deltas already set
+// are kept.
+func LoadMempool() (*LoadMempoolStats, error) {
+	f, err := os.Open(mempoolFilePath())
+	if err != nil {
+		return nil, err
+	}
+	records, deltas, err := readMempoolFile(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	pool := mempool.GetInstance()
+	restoreDelta := func(hash util.Hash, delta int64) {
+		if delta != 0 && pool.GetFeeDelta(hash) == 0 {
+			pool.PrioritiseTransaction(hash, delta)
+		}
+	}
+
+	stats := &LoadMempoolStats{}
+	now := util.GetTimeSec()
+	expiry := int64(conf.Cfg.Mempool.MaxPoolExpiry) * 60 * 60
+	for _, rec := range records {
+		hash := rec.tx.GetHash()
+		if rec.time+expiry <= now {
+			stats.Expired++
+			continue
+		}
+		if pool.FindTx(hash) != nil {
+			stats.AlreadyThere++
+			continue
+		}
+		restoreDelta(hash, rec.feeDelta)
+		if err := acceptMempoolRecord(rec); err != nil {
+			log.Debug("Can't load mempool transaction %s: %v", hash, err)
+			stats.Failed++
+			continue
+		}
+		stats.Loaded++
+	}
+	for hash, delta := range deltas {
+		restoreDelta(hash, delta)
+	}
+
+	log.Info("Imported mempool transactions from disk: %d succeeded, %d failed, "+
+		"%d expired, %d already there", stats.Loaded, stats.Failed, stats.Expired,
+		stats.AlreadyThere)
+	return stats, nil
+}
+
+// feeEstimatesFilePath returns the path of the fee estimates file.
+func feeEstimatesFilePath() string {
+	return filepath.Join(conf.Cfg.DataDir, FeeEstimatesFileName)
+}
+
+// DumpFeeEstimates writes the state of the fee estimator to the fee estimates
+// file of the data dir.
+func DumpFeeEstimates() error {
+	path := feeEstimatesFilePath()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = mempool.GetFeeEstimator().Serialize(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// LoadFeeEstimates restores the state of the fee estimator from the fee
+// estimates file of the data dir.
+func LoadFeeEstimates() error {
+	f, err := os.Open(feeEstimatesFilePath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return mempool.GetFeeEstimator().Unserialize(f)
+}
@@ -0,0 +1,61 @@
+package lmempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPersistTestTx(index uint32) *tx.Tx {
+	txn := tx.NewTx(0, tx.TxVersion)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, index),
+		script.NewEmptyScript(), 0xffffffff))
+	txn.AddTxOut(txout.NewTxOut(1000, script.NewEmptyScript()))
+	return txn
+}
+
+func TestMempoolFile(t *testing.T) {
+	records := []*mempoolRecord{
+		{tx: newPersistTestTx(0), time: 1500000000, feeDelta: 0},
+		{tx: newPersistTestTx(1), time: 1500000100, feeDelta: -300},
+	}
+	deltas := map[util.Hash]int64{util.HashOne: 5000}
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeMempoolFile(&buf, records, deltas))
+	data := buf.Bytes()
+
+	gotRecords, gotDeltas, err := readMempoolFile(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, deltas, gotDeltas)
+	if assert.Equal(t, len(records), len(gotRecords)) {
+		for i, rec := range records {
+			assert.Equal(t, rec.tx.GetHash(), gotRecords[i].tx.GetHash())
+			assert.Equal(t, rec.time, gotRecords[i].time)
+			assert.Equal(t, rec.feeDelta, gotRecords[i].feeDelta)
+		}
+	}
+
+	// Corrupted and truncated files are refused.
+	corrupted := append([]byte(nil), data...)
+	corrupted[10] ^= 1
+	_, _, err = readMempoolFile(bytes.NewReader(corrupted))
+	assert.Equal(t, errMempoolFileChecksum, err)
+	_, _, err = readMempoolFile(bytes.NewReader(data[:len(data)-1]))
+	assert.Equal(t, errMempoolFileChecksum, err)
+	_, _, err = readMempoolFile(bytes.NewReader(data[:10]))
+	assert.Equal(t, errMempoolFileShort, err)
+
+	// So are unknown versions.
+	future := append([]byte{2}, data[1:len(data)-checksumSize]...)
+	future = append(future, util.DoubleSha256Bytes(future)...)
+	_, _, err = readMempoolFile(bytes.NewReader(future))
+	assert.NotNil(t, err)
+}
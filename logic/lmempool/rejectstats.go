@@ -0,0 +1,47 @@
+package lmempool
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/copernet/copernicus/errcode"
+)
+
+// rejectStats counts the transactions refused by the mempool by reason.
+var rejectStats = struct {
+	sync.Mutex
+	counts map[string]uint64
+}{counts: make(map[string]uint64)}
+
+// rejectReason returns the reason a transaction was refused for, without its
+// details, such as the fees of "mempool min fee not met, 10 < 20".
+func rejectReason(err error) string {
+	if e, ok := err.(errcode.ProjectError); ok {
+		return strings.SplitN(e.Desc, ", ", 2)[0]
+	}
+	return err.Error()
+}
+
+// countReject counts a transaction refused by the mempool, but an orphan,
+// which may be accepted once its parents arrive.
+func countReject(err error) {
+	if errcode.IsErrorCode(err, errcode.TxErrNoPreviousOut) {
+		return
+	}
+	reason := rejectReason(err)
+	rejectStats.Lock()
+	rejectStats.counts[reason]++
+	rejectStats.Unlock()
+}
+
+// RejectStats returns the number of transactions refused by the mempool by
+// reason since startup.
+func RejectStats() map[string]uint64 {
+	rejectStats.Lock()
+	defer rejectStats.Unlock()
+	counts := make(map[string]uint64, len(rejectStats.counts))
+	for reason, count := range rejectStats.counts {
+		counts[reason] = count
+	}
+	return counts
+}
@@ -0,0 +1,20 @@
+package lmempool
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/errcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectReason(t *testing.T) {
+	err := errcode.NewError(errcode.RejectInsufficientFee, "mempool min fee not met, 10 < 20")
+	assert.Equal(t, "mempool min fee not met", rejectReason(err))
+	assert.Equal(t, "txn-mempool-conflict", rejectReason(errcode.NewError(errcode.RejectConflict, "txn-mempool-conflict")))
+
+	before := RejectStats()["bad-txns-nonfinal"]
+	countReject(errcode.NewError(errcode.RejectInvalid, "bad-txns-nonfinal"))
+	countReject(errcode.New(errcode.TxErrNoPreviousOut))
+	assert.Equal(t, before+1, RejectStats()["bad-txns-nonfinal"])
+	assert.Equal(t, uint64(0), RejectStats()[errcode.TxErrNoPreviousOut.String()])
+}
@@ -0,0 +1,57 @@
+package lmempool
+
+import (
+	"github.com/copernet/copernicus/logic/ltx"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/tx"
+)
+
+// AcceptResult is the outcome of the acceptance of a transaction by a dry run
+// or with a package. Entry is set if the transaction is accepted, Err
+// otherwise.
+type AcceptResult struct {
+	Entry *mempool.TxEntry
+	Err   error
+}
+
+// pendingPackage holds the transactions accepted by a dry run or for a
+// package, which are checked as if they were in the mempool.
+type pendingPackage struct {
+	txs *ltx.PendingTxs
+}
+
+func newPendingPackage() *pendingPackage {
+	return &pendingPackage{
+		txs: ltx.NewPendingTxs(),
+	}
+}
+
+// accept checks the transaction as AcceptTxToMemPool would, with the mempool
+// min fee only if checkMinFee is set, and holds it if it passes.
+func (p *pendingPackage) accept(txn *tx.Tx, checkMinFee bool) (*mempool.TxEntry, error) {
+	var txEntry *mempool.TxEntry
+	var err error
+	if checkMinFee {
+		txEntry, err = ltx.CheckTxWithPendingTxs(txn, p.txs)
+	} else {
+		txEntry, err = ltx.CheckPackageTx(txn, p.txs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.txs.Add(txn)
+	return txEntry, nil
+}
+
+// TestAcceptTxsToMemPool checks the transactions as AcceptTxToMemPool would,
+// each as if the transactions accepted before it were in the mempool, without
+// adding any of them to the mempool.
+func TestAcceptTxsToMemPool(txs []*tx.Tx) []*AcceptResult {
+	pending := newPendingPackage()
+	results := make([]*AcceptResult, 0, len(txs))
+	for _, txn := range txs {
+		txEntry, err := pending.accept(txn, true)
+		results = append(results, &AcceptResult{Entry: txEntry, Err: err})
+	}
+	return results
+}
@@ -0,0 +1,71 @@
+package lmempool
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/policy"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPackage(t *testing.T) {
+	parent := newPersistTestTx(0)
+	child := tx.NewTx(0, tx.TxVersion)
+	child.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(parent.GetHash(), 0),
+		script.NewEmptyScript(), 0xffffffff))
+	child.AddTxOut(txout.NewTxOut(900, script.NewEmptyScript()))
+	conflict := newPersistTestTx(0)
+	conflict.AddTxOut(txout.NewTxOut(500, script.NewEmptyScript()))
+
+	assert.Nil(t, checkPackage([]*tx.Tx{parent, child}))
+	assert.Nil(t, checkPackage([]*tx.Tx{child}))
+
+	reasonOf := func(txs []*tx.Tx) string {
+		_, reason, _ := errcode.IsRejectCode(checkPackage(txs))
+		return reason
+	}
+	assert.Equal(t, "package-too-many-transactions", reasonOf(nil))
+	assert.Equal(t, "package-not-sorted", reasonOf([]*tx.Tx{child, parent}))
+	assert.Equal(t, "package-contains-duplicates", reasonOf([]*tx.Tx{parent, parent}))
+	assert.Equal(t, "conflict-in-package", reasonOf([]*tx.Tx{parent, conflict}))
+}
+
+func TestCheckPackageFeeRates(t *testing.T) {
+	policy.SetInstance(&policy.Policy{Name: policy.DefaultName, MinRelayFee: 1000})
+	defer policy.SetInstance(nil)
+	pool := mempool.NewTxMempool()
+	newEntry := func(txn *tx.Tx, fee int64) *mempool.TxEntry {
+		return mempool.NewTxentry(txn, fee, 0, 1, mempool.LockPoints{}, 0, false)
+	}
+
+	parent := newPersistTestTx(0)
+	child := tx.NewTx(0, tx.TxVersion)
+	child.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(parent.GetHash(), 0),
+		script.NewEmptyScript(), 0xffffffff))
+	child.AddTxOut(txout.NewTxOut(900, script.NewEmptyScript()))
+	other := newPersistTestTx(1)
+	rich := newEntry(child, 1000)
+
+	// The child pays for its parent.
+	assert.Nil(t, checkPackageFeeRates(pool, []*mempool.TxEntry{newEntry(parent, 0), rich}))
+
+	// But not for an unrelated transaction of the package.
+	err := checkPackageFeeRates(pool, []*mempool.TxEntry{newEntry(other, 0),
+		newEntry(parent, 0), rich})
+	assert.True(t, errcode.IsErrorCode(err, errcode.RejectInsufficientFee))
+
+	// Nor is a package paying too little as a whole accepted.
+	err = checkPackageFeeRates(pool, []*mempool.TxEntry{newEntry(parent, 0),
+		newEntry(child, 10)})
+	assert.True(t, errcode.IsErrorCode(err, errcode.RejectInsufficientFee))
+
+	// Fee deltas count.
+	pool.PrioritiseTransaction(other.GetHash(), 1000)
+	assert.Nil(t, checkPackageFeeRates(pool, []*mempool.TxEntry{newEntry(other, 0)}))
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/policy"
 	"github.com/copernet/copernicus/model/pow"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
@@ -82,15 +83,31 @@ func ScriptVerifyInit() {
 }
 
 func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
+	return CheckTxWithPendingTxs(txn, nil)
+}
+
+// CheckTxWithPendingTxs checks the transaction as CheckTxBeforeAcceptToMemPool
+// does, as if the pending transactions were in the mempool.
+func CheckTxWithPendingTxs(txn *tx.Tx, pending *PendingTxs) (*mempool.TxEntry, error) {
+	return checkTxBeforeAcceptToMemPool(txn, pending, true)
+}
+
+// CheckPackageTx checks a transaction of a package as CheckTxWithPendingTxs
+// does, except for the mempool min fee, which the caller checks against the
+// fee rate of the whole package.
+func CheckPackageTx(txn *tx.Tx, pending *PendingTxs) (*mempool.TxEntry, error) {
+	return checkTxBeforeAcceptToMemPool(txn, pending, false)
+}
+
+func checkTxBeforeAcceptToMemPool(txn *tx.Tx, pending *PendingTxs, checkMinFee bool) (*mempool.TxEntry, error) {
 	if err := txn.CheckRegularTransaction(); err != nil {
 		return nil, err
 	}
 
 	if model.ActiveNetParams.RequireStandard {
-		ok, reason := txn.IsStandard()
-		if !ok {
-			log.Debug("non standard tx: %s, reason: %s", txn.GetHash(), reason)
-			return nil, errcode.NewError(errcode.RejectNonstandard, reason)
+		if err := policy.GetInstance().CheckTx(txn); err != nil {
+			log.Debug("non standard tx: %s, reason: %v", txn.GetHash(), err)
+			return nil, err
 		}
 	}
 
@@ -104,13 +121,13 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	gPool := mempool.GetInstance()
 	gPool.RLock()
 	defer gPool.RUnlock()
-	if gPool.FindTx(txn.GetHash()) != nil {
+	if gPool.FindTx(txn.GetHash()) != nil || pending.Has(txn.GetHash()) {
 		log.Debug("tx already known in mempool, hash: %s", txn.GetHash())
 		return nil, errcode.NewError(errcode.RejectAlreadyKnown, "txn-already-in-mempool")
 	}
 
 	for _, e := range txn.GetIns() {
-		if gPool.HasSpentOut(e.PreviousOutPoint) {
+		if gPool.HasSpentOut(e.PreviousOutPoint) || pending.HasSpentOut(e.PreviousOutPoint) {
 			log.Debug("tx ins alread spent out in mempool")
 			return nil, errcode.NewError(errcode.RejectConflict, "txn-mempool-conflict")
 		}
@@ -123,7 +140,7 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	}
 
 	// are inputs are exists and available?
-	inputCoins, missingInput, spendCoinbase := inputCoinsOf(txn)
+	inputCoins, missingInput, spendCoinbase := inputCoinsOf(txn, pending)
 	if missingInput {
 		return nil, errcode.New(errcode.TxErrNoPreviousOut)
 	}
@@ -134,7 +151,7 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	// transactions that can't be mined yet. Must keep pool.cs for this
 	// unless we change CheckSequenceLocks to take a CoinsViewCache
 	// instead of create its own.
-	lp := CalculateLockPoints(txn, uint32(tx.StandardLockTimeVerifyFlags))
+	lp := calculateLockPoints(txn, uint32(tx.StandardLockTimeVerifyFlags), pending)
 	if lp == nil {
 		log.Debug("cann't calculate out lockpoints")
 		return nil, errcode.New(errcode.RejectNonstandard)
@@ -162,11 +179,11 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	// MAX_BLOCK_SIGOPS_PER_MB; we still consider this an invalid rather
 	// than merely non-standard transaction.
 	sigOpsCount := GetTransactionSigOpCount(txn, uint32(script.StandardScriptVerifyFlags), inputCoins)
-	if uint(sigOpsCount) > tx.MaxStandardTxSigOps {
-		return nil, errcode.NewError(errcode.RejectNonstandard, "bad-txns-too-many-sigops")
+	if err := policy.GetInstance().CheckSigOps(uint(sigOpsCount)); err != nil {
+		return nil, err
 	}
 
-	txFee, err := checkFee(txn, inputCoins)
+	txFee, err := checkFee(txn, inputCoins, checkMinFee)
 	if err != nil {
 		return nil, err
 	}
@@ -236,19 +253,29 @@ func CheckTxBeforeAcceptToMemPool(txn *tx.Tx) (*mempool.TxEntry, error) {
 	return txEntry, nil
 }
 
-func checkFee(txn *tx.Tx, inputCoins *utxo.CoinsMap) (int64, error) {
+func checkFee(txn *tx.Tx, inputCoins *utxo.CoinsMap, checkMinFee bool) (int64, error) {
 	inputValue := inputCoins.GetValueIn(txn)
 	txFee := inputValue - txn.GetValueOut()
+	if !checkMinFee {
+		return int64(txFee), nil
+	}
 
 	txsize := int64(txn.EncodeSize())
-	minfeeRate := mempool.GetInstance().GetMinFee(conf.Cfg.Mempool.MaxPoolSize)
+	pool := mempool.GetInstance()
+	minfeeRate := pool.GetMinFee(conf.Cfg.Mempool.MaxPoolSize)
 	rejectFee := minfeeRate.GetFee(int(txsize))
 
-	if int64(txFee) < rejectFee {
-		reason := fmt.Sprintf("mempool min fee not met %d < %d", txFee, rejectFee)
+	// The fee delta of a prioritised tx counts towards the mempool min fee.
+	modifiedFee := int64(txFee) + pool.GetFeeDelta(txn.GetHash())
+	if modifiedFee < rejectFee {
+		reason := fmt.Sprintf("mempool min fee not met, %d < %d", modifiedFee, rejectFee)
 		log.Debug("reject tx:%s, for %s", txn.GetHash(), reason)
 		return 0, errcode.NewError(errcode.RejectInsufficientFee, reason)
 	}
+	if err := policy.GetInstance().CheckFee(modifiedFee, int(txsize)); err != nil {
+		log.Debug("reject tx:%s, for %v", txn.GetHash(), err)
+		return 0, err
+	}
 
 	return int64(txFee), nil
 }
@@ -512,7 +539,7 @@ func areOutputsAlreadExist(transaction *tx.Tx) (exist bool) {
 	return false
 }
 
-func inputCoinsOf(txn *tx.Tx) (coinMap *utxo.CoinsMap, missingInput bool, spendCoinbase bool) {
+func inputCoinsOf(txn *tx.Tx, pending *PendingTxs) (coinMap *utxo.CoinsMap, missingInput bool, spendCoinbase bool) {
 	coinMap = utxo.NewEmptyCoinsMap()
 
 	for _, txin := range txn.GetIns() {
@@ -522,6 +549,9 @@ func inputCoinsOf(txn *tx.Tx) (coinMap *utxo.CoinsMap, missingInput bool, spendC
 		if coin == nil {
 			coin = mempool.GetInstance().GetCoin(prevout)
 		}
+		if coin == nil {
+			coin = pending.GetCoin(prevout)
+		}
 
 		if coin == nil || coin.IsSpent() {
 			return coinMap, true, spendCoinbase
@@ -629,7 +659,7 @@ func AreInputsStandard(transaction *tx.Tx, coinsMap *utxo.CoinsMap) bool {
 
 			subScript := script.NewScriptRaw(scriptSig.ParsedOpCodes[len(scriptSig.ParsedOpCodes)-1].Data)
 			opCount := subScript.GetSigOpCount(uint32(script.StandardCheckDataSigVerifyFlags), true)
-			if uint(opCount) > tx.MaxP2SHSigOps {
+			if !policy.GetInstance().AllowsP2SHSigOps(uint(opCount)) {
 				log.Debug("transaction has too many sigops")
 				return false
 			}
@@ -751,6 +781,10 @@ func errorNonMandatoryPass(j ScriptVerifyJob, innerErr error) error {
 
 //CalculateLockPoints calculate lockpoint(all ins' max time or height at which it can be spent) of transaction
 func CalculateLockPoints(transaction *tx.Tx, flags uint32) (lp *mempool.LockPoints) {
+	return calculateLockPoints(transaction, flags, nil)
+}
+
+func calculateLockPoints(transaction *tx.Tx, flags uint32, pending *PendingTxs) (lp *mempool.LockPoints) {
 	activeChain := chain.GetInstance()
 	tipHeight := activeChain.Height()
 	utxo := utxo.GetUtxoCacheInstance()
@@ -764,6 +798,9 @@ func CalculateLockPoints(transaction *tx.Tx, flags uint32) (lp *mempool.LockPoin
 		if coin == nil {
 			coin = mempool.GetInstance().GetCoin(e.PreviousOutPoint)
 		}
+		if coin == nil {
+			coin = pending.GetCoin(e.PreviousOutPoint)
+		}
 		if coin == nil {
 			return nil
 		}
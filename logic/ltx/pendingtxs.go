@@ -0,0 +1,65 @@
+package ltx
+
+import (
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/util"
+)
+
+// PendingTxs are transactions which passed the mempool checks but were not
+// added to the mempool. The transactions checked after them may spend their
+// outputs as if they were in the mempool, but not the outputs they spend.
+// A nil *PendingTxs holds no transaction.
+type PendingTxs struct {
+	txs   map[util.Hash]*tx.Tx
+	spent map[outpoint.OutPoint]struct{}
+}
+
+func NewPendingTxs() *PendingTxs {
+	return &PendingTxs{
+		txs:   make(map[util.Hash]*tx.Tx),
+		spent: make(map[outpoint.OutPoint]struct{}),
+	}
+}
+
+// Add adds the transaction, which must have passed the mempool checks with
+// the pending transactions.
+func (p *PendingTxs) Add(txn *tx.Tx) {
+	p.txs[txn.GetHash()] = txn
+	for _, e := range txn.GetIns() {
+		p.spent[*e.PreviousOutPoint] = struct{}{}
+	}
+}
+
+func (p *PendingTxs) Has(hash util.Hash) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.txs[hash]
+	return ok
+}
+
+func (p *PendingTxs) HasSpentOut(out *outpoint.OutPoint) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.spent[*out]
+	return ok
+}
+
+// GetCoin returns the output of a pending transaction as a mempool coin.
+func (p *PendingTxs) GetCoin(out *outpoint.OutPoint) *utxo.Coin {
+	if p == nil {
+		return nil
+	}
+	txn, ok := p.txs[out.Hash]
+	if !ok {
+		return nil
+	}
+	txOut := txn.GetTxOut(int(out.Index))
+	if txOut == nil {
+		return nil
+	}
+	return utxo.NewMempoolCoin(txOut)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/policy"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/txin"
@@ -249,7 +250,7 @@ func CreateTransaction(recipients []*wallet.Recipient, changePosInOut *int, sign
 	txn := tx.NewTx(lockTime, tx.DefaultVersion)
 	coins := AvailableCoins(true, false)
 	feeRet := amount.Amount(0)
-	dustRelayFee := util.NewFeeRate(conf.Cfg.TxOut.DustRelayFee)
+	dustRelayFee := util.NewFeeRate(policy.GetInstance().DustRelayFee)
 
 	// Start with no fee and loop until there is enough fee.
 	for {
@@ -475,7 +476,7 @@ func CreateTransaction(recipients []*wallet.Recipient, changePosInOut *int, sign
 	}
 
 	// Limit size.
-	if txn.SerializeSize() >= uint32(tx.MaxStandardTxSize) {
+	if txn.SerializeSize() >= uint32(policy.GetInstance().MaxTxSize) {
 		return nil, 0, errors.New("Transaction too large")
 	}
 	return txn, feeRet, nil
@@ -15,10 +15,13 @@ import (
 	"runtime/debug"
 
 	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lmempool"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/net/limits"
 	"github.com/copernet/copernicus/net/server"
 	"github.com/copernet/copernicus/rpc"
+	"github.com/copernet/copernicus/service/mining/stratum"
 	"github.com/copernet/copernicus/util"
 	"net"
 )
@@ -69,8 +72,32 @@ func bchMain(ctx context.Context, args []string) error {
 		return nil
 	}
 	s.Start()
+
+	var stratumServer *stratum.Server
+	if conf.Cfg.Stratum.Enable {
+		stratumServer, err = stratum.NewServer(conf.Cfg)
+		if err == nil {
+			err = stratumServer.Start()
+		}
+		if err != nil {
+			fmt.Printf("Init stratum server error: %s \n", err.Error())
+			s.Stop()
+			return err
+		}
+	}
 	defer func() {
+		if stratumServer != nil {
+			stratumServer.Stop()
+		}
 		s.Stop()
+		if conf.Cfg.Mempool.PersistMempool {
+			if err := lmempool.DumpMempool(); err != nil {
+				log.Error("failed to dump mempool: %v", err)
+			}
+		}
+		if err := lmempool.DumpFeeEstimates(); err != nil {
+			log.Error("failed to dump fee estimates: %v", err)
+		}
 		// Shutdown the RPC server if it's not disabled.
 		if !conf.Cfg.P2PNet.DisableRPC {
 			rpcServer.Stop()
@@ -0,0 +1,180 @@
+package mempool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/util"
+)
+
+// EventType is the kind of change of the mempool an Event tells.
+type EventType int
+
+const (
+	// TxAdded tells a transaction entered the mempool.
+	TxAdded EventType = iota
+	// TxRemoved tells a transaction left the mempool, for Event.Reason.
+	TxRemoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case TxAdded:
+		return "added"
+	case TxRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+func (r PoolRemovalReason) String() string {
+	switch r {
+	case EXPIRY:
+		return "expiry"
+	case SIZELIMIT:
+		return "sizelimit"
+	case REORG:
+		return "reorg"
+	case BLOCK:
+		return "block"
+	case CONFLICT:
+		return "conflict"
+	case REPLACED:
+		return "replaced"
+	}
+	return "unknown"
+}
+
+// Event is a change of the mempool. Sequence numbers the events of the
+// mempool from 1, so that a subscriber can tell it missed some.
+type Event struct {
+	Sequence uint64
+	Type     EventType
+	Tx       *tx.Tx
+	Time     time.Time
+
+	// Reason is why a removed transaction left the mempool.
+	Reason PoolRemovalReason
+	// ReplacedBy is the transaction which spent the inputs of a
+	// transaction removed for CONFLICT or REPLACED.
+	ReplacedBy *util.Hash
+}
+
+// Subscription receives the events of the mempool on a buffered channel. The
+// mempool never waits for a subscriber: the events which don't fit in the
+// buffer are dropped and counted.
+type Subscription struct {
+	events  chan *Event
+	dropped uint64
+	hub     *eventHub
+}
+
+// Events returns the channel the events are sent on, closed by Unsubscribe.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped as the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Unsubscribe stops the events and closes the channel.
+func (s *Subscription) Unsubscribe() {
+	s.hub.lock.Lock()
+	defer s.hub.lock.Unlock()
+	if _, ok := s.hub.subscribers[s]; ok {
+		delete(s.hub.subscribers, s)
+		close(s.events)
+	}
+}
+
+// eventHub sends the events of a mempool to its subscribers. It outlives the
+// mempool when another replaces it.
+type eventHub struct {
+	lock        sync.Mutex
+	sequence    uint64
+	subscribers map[*Subscription]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[*Subscription]struct{})}
+}
+
+func (h *eventHub) publish(eventType EventType, txn *tx.Tx, reason PoolRemovalReason, replacedBy *util.Hash) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.subscribers) == 0 {
+		return
+	}
+
+	h.sequence++
+	event := &Event{
+		Sequence:   h.sequence,
+		Type:       eventType,
+		Tx:         txn,
+		Time:       time.Now(),
+		Reason:     reason,
+		ReplacedBy: replacedBy,
+	}
+	for sub := range h.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the mempool, buffering
+// bufferSize events at most.
+func (m *TxMempool) Subscribe(bufferSize int) *Subscription {
+	sub := &Subscription{
+		events: make(chan *Event, bufferSize),
+		hub:    m.events,
+	}
+	m.events.lock.Lock()
+	m.events.subscribers[sub] = struct{}{}
+	m.events.lock.Unlock()
+	return sub
+}
+
+// TakeOver takes the subscribers of the mempool it replaces. It must be called
+// before the mempool is filled, so that the subscribers are told the
+// transactions added to it, and PublishRemoved once it is.
+func (m *TxMempool) TakeOver(old *TxMempool) {
+	m.Lock()
+	hub := m.events
+	m.events = old.events
+	m.Unlock()
+
+	// Subscribers may have come to the new mempool since it was created.
+	hub.lock.Lock()
+	old.events.lock.Lock()
+	for sub := range hub.subscribers {
+		sub.hub = old.events
+		old.events.subscribers[sub] = struct{}{}
+	}
+	hub.subscribers = make(map[*Subscription]struct{})
+	old.events.lock.Unlock()
+	hub.lock.Unlock()
+}
+
+// PublishRemoved tells the subscribers the transactions of the mempool it
+// replaced which it doesn't have were removed for REORG.
+func (m *TxMempool) PublishRemoved(old *TxMempool) {
+	old.RLock()
+	removed := make([]*tx.Tx, 0)
+	for hash, entry := range old.poolData {
+		if m.FindTx(hash) == nil {
+			removed = append(removed, entry.Tx)
+		}
+	}
+	old.RUnlock()
+
+	for _, txn := range removed {
+		m.events.publish(TxRemoved, txn, REORG, nil)
+	}
+}
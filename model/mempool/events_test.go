@@ -0,0 +1,117 @@
+package mempool
+
+import (
+	"testing"
+
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEventTestTx(prevout *outpoint.OutPoint, value amount.Amount) *tx.Tx {
+	scriptSig := script.NewEmptyScript()
+	scriptSig.PushOpCode(opcodes.OP_11)
+	scriptPubkey := script.NewEmptyScript()
+	scriptPubkey.PushOpCode(opcodes.OP_TRUE)
+
+	txn := tx.NewTx(0, tx.DefaultVersion)
+	txn.AddTxIn(txin.NewTxIn(prevout, scriptSig, script.SequenceFinal))
+	txn.AddTxOut(txout.NewTxOut(value, scriptPubkey))
+	return txn
+}
+
+func TestMempoolEvents(t *testing.T) {
+	mp := NewTxMempool()
+	sub := mp.Subscribe(10)
+	defer sub.Unsubscribe()
+
+	testEntryHelp := NewTestMemPoolEntry()
+
+	parent := newEventTestTx(outpoint.NewOutPoint(util.HashOne, 0), 10000)
+	child := newEventTestTx(outpoint.NewOutPoint(parent.GetHash(), 0), 9000)
+	for _, txn := range []*tx.Tx{parent, child} {
+		assert.Nil(t, mp.AddTx(testEntryHelp.FromTxToEntry(txn)))
+	}
+
+	event := <-sub.Events()
+	assert.Equal(t, uint64(1), event.Sequence)
+	assert.Equal(t, TxAdded, event.Type)
+	assert.Equal(t, parent.GetHash(), event.Tx.GetHash())
+	event = <-sub.Events()
+	assert.Equal(t, TxAdded, event.Type)
+	assert.Equal(t, child.GetHash(), event.Tx.GetHash())
+
+	// A transaction of a block double spending the parent replaces both.
+	conflict := newEventTestTx(outpoint.NewOutPoint(util.HashOne, 0), 5000)
+	mp.RemoveTxSelf([]*tx.Tx{conflict})
+	removed := make(map[util.Hash]*Event)
+	for i := 0; i < 2; i++ {
+		event = <-sub.Events()
+		assert.Equal(t, TxRemoved, event.Type)
+		removed[event.Tx.GetHash()] = event
+	}
+	for _, txn := range []*tx.Tx{parent, child} {
+		event := removed[txn.GetHash()]
+		if assert.NotNil(t, event) {
+			assert.Equal(t, CONFLICT, event.Reason)
+			assert.Equal(t, conflict.GetHash(), *event.ReplacedBy)
+		}
+	}
+	assert.Equal(t, uint64(0), sub.Dropped())
+}
+
+func TestMempoolEventsDropped(t *testing.T) {
+	mp := NewTxMempool()
+	sub := mp.Subscribe(1)
+
+	testEntryHelp := NewTestMemPoolEntry()
+	for i := uint32(0); i < 3; i++ {
+		txn := newEventTestTx(outpoint.NewOutPoint(util.HashOne, i), 10000)
+		assert.Nil(t, mp.AddTx(testEntryHelp.FromTxToEntry(txn)))
+	}
+	assert.Equal(t, uint64(2), sub.Dropped())
+
+	sub.Unsubscribe()
+	event, ok := <-sub.Events()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), event.Sequence)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+}
+
+func TestMempoolEventsTakeOver(t *testing.T) {
+	old := NewTxMempool()
+	sub := old.Subscribe(10)
+	defer sub.Unsubscribe()
+
+	testEntryHelp := NewTestMemPoolEntry()
+	kept := newEventTestTx(outpoint.NewOutPoint(util.HashOne, 0), 10000)
+	lost := newEventTestTx(outpoint.NewOutPoint(util.HashOne, 1), 10000)
+	for _, txn := range []*tx.Tx{kept, lost} {
+		assert.Nil(t, old.AddTx(testEntryHelp.FromTxToEntry(txn)))
+	}
+	<-sub.Events()
+	<-sub.Events()
+
+	// The subscribers are told what the new mempool is filled with, and
+	// what it lost.
+	mp := NewTxMempool()
+	mp.TakeOver(old)
+	assert.Nil(t, mp.AddTx(testEntryHelp.FromTxToEntry(kept)))
+	mp.PublishRemoved(old)
+
+	event := <-sub.Events()
+	assert.Equal(t, TxAdded, event.Type)
+	assert.Equal(t, kept.GetHash(), event.Tx.GetHash())
+	event = <-sub.Events()
+	assert.Equal(t, uint64(4), event.Sequence)
+	assert.Equal(t, TxRemoved, event.Type)
+	assert.Equal(t, REORG, event.Reason)
+	assert.Equal(t, lost.GetHash(), event.Tx.GetHash())
+}
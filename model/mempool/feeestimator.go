@@ -0,0 +1,505 @@
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/util"
+)
+
+// feeEstimatesVersion is the version of the serialized fee estimator.
+const feeEstimatesVersion = 1
+
+var gfeeEstimator *BlockPolicyEstimator
+
+// GetFeeEstimator returns the fee estimator fed by the mempool.
+func GetFeeEstimator() *BlockPolicyEstimator {
+	if gfeeEstimator == nil {
+		gfeeEstimator = NewBlockPolicyEstimator(*util.NewFeeRate(util.DefaultMinRelayTxFeePerK))
+	}
+	return gfeeEstimator
+}
+
+// SetFeeEstimator replaces the fee estimator fed by the mempool.
+func SetFeeEstimator(e *BlockPolicyEstimator) {
+	gfeeEstimator = e
+}
+
+// txConfirmStats tracks, for transactions grouped in buckets of fee rate, how
+// many blocks they took to confirm.  The counts are exponentially decaying
+// moving averages over the blocks.
+type txConfirmStats struct {
+	// buckets the upper bounds of the fee rate buckets, increasing.
+	buckets []float64
+
+	// txCtAvg the average number of confirmed txs per bucket.
+	txCtAvg []float64
+	// confAvg the average number of txs confirmed within Y blocks per
+	// bucket, indexed by Y-1 then bucket.
+	confAvg [][]float64
+	// avg the average sum of the fee rates of the confirmed txs per bucket.
+	avg []float64
+
+	curBlockTxCt []int
+	curBlockConf [][]int
+	curBlockVal  []float64
+
+	decay float64
+
+	// unconfTxs the number of unconfirmed txs per bucket, indexed by their
+	// entry height modulo the tracked confirmations, then bucket.
+	unconfTxs [][]int
+	// oldUnconfTxs the number of unconfirmed txs per bucket which entered
+	// the mempool longer ago than the tracked confirmations.
+	oldUnconfTxs []int
+}
+
+func newTxConfirmStats(buckets []float64, maxConfirms int, decay float64) *txConfirmStats {
+	stats := &txConfirmStats{
+		buckets:      buckets,
+		txCtAvg:      make([]float64, len(buckets)),
+		avg:          make([]float64, len(buckets)),
+		curBlockTxCt: make([]int, len(buckets)),
+		curBlockVal:  make([]float64, len(buckets)),
+		decay:        decay,
+		oldUnconfTxs: make([]int, len(buckets)),
+	}
+	stats.confAvg = make([][]float64, maxConfirms)
+	stats.curBlockConf = make([][]int, maxConfirms)
+	stats.unconfTxs = make([][]int, maxConfirms)
+	for i := 0; i < maxConfirms; i++ {
+		stats.confAvg[i] = make([]float64, len(buckets))
+		stats.curBlockConf[i] = make([]int, len(buckets))
+		stats.unconfTxs[i] = make([]int, len(buckets))
+	}
+	return stats
+}
+
+func (s *txConfirmStats) maxConfirms() int {
+	return len(s.confAvg)
+}
+
+// bucketIndex returns the index of the first bucket whose bound is not below
+// the fee rate.
+func (s *txConfirmStats) bucketIndex(feeRate float64) int {
+	index := sort.SearchFloat64s(s.buckets, feeRate)
+	if index == len(s.buckets) {
+		index--
+	}
+	return index
+}
+
+// clearCurrent rolls the unconfirmed txs which entered the mempool
+// maxConfirms blocks ago into the old ones and resets the counts of the block.
+func (s *txConfirmStats) clearCurrent(blockHeight int32) {
+	blockIndex := int(blockHeight) % len(s.unconfTxs)
+	for j := range s.buckets {
+		s.oldUnconfTxs[j] += s.unconfTxs[blockIndex][j]
+		s.unconfTxs[blockIndex][j] = 0
+		for i := range s.curBlockConf {
+			s.curBlockConf[i][j] = 0
+		}
+		s.curBlockTxCt[j] = 0
+		s.curBlockVal[j] = 0
+	}
+}
+
+// record counts a tx of the fee rate confirmed after blocksToConfirm blocks.
+func (s *txConfirmStats) record(blocksToConfirm int, feeRate float64) {
+	if blocksToConfirm < 1 {
+		return
+	}
+	bucket := s.bucketIndex(feeRate)
+	for i := blocksToConfirm; i <= len(s.curBlockConf); i++ {
+		s.curBlockConf[i-1][bucket]++
+	}
+	s.curBlockTxCt[bucket]++
+	s.curBlockVal[bucket] += feeRate
+}
+
+// updateMovingAverages decays the averages and adds the counts of the block.
+func (s *txConfirmStats) updateMovingAverages() {
+	for j := range s.buckets {
+		for i := range s.confAvg {
+			s.confAvg[i][j] = s.confAvg[i][j]*s.decay + float64(s.curBlockConf[i][j])
+		}
+		s.avg[j] = s.avg[j]*s.decay + s.curBlockVal[j]
+		s.txCtAvg[j] = s.txCtAvg[j]*s.decay + float64(s.curBlockTxCt[j])
+	}
+}
+
+// newTx counts an unconfirmed tx of the fee rate entered at the height and
+// returns its bucket.
+func (s *txConfirmStats) newTx(blockHeight int32, feeRate float64) int {
+	bucket := s.bucketIndex(feeRate)
+	s.unconfTxs[int(blockHeight)%len(s.unconfTxs)][bucket]++
+	return bucket
+}
+
+// removeTx forgets an unconfirmed tx of the bucket entered at entryHeight.
+func (s *txConfirmStats) removeTx(entryHeight, bestSeenHeight int32, bucket int) {
+	// bestSeenHeight is 0 until a block was processed, the tx was then
+	// tracked at height 0.
+	blocksAgo := int(bestSeenHeight - entryHeight)
+	if bestSeenHeight == 0 {
+		blocksAgo = 0
+	}
+	if blocksAgo < 0 {
+		log.Debug("fee estimator: tx entered at height %d after the best seen block %d",
+			entryHeight, bestSeenHeight)
+		return
+	}
+
+	if blocksAgo >= len(s.unconfTxs) {
+		if s.oldUnconfTxs[bucket] > 0 {
+			s.oldUnconfTxs[bucket]--
+		}
+		return
+	}
+	blockIndex := int(entryHeight) % len(s.unconfTxs)
+	if s.unconfTxs[blockIndex][bucket] > 0 {
+		s.unconfTxs[blockIndex][bucket]--
+	}
+}
+
+// estimateMedianVal returns the median fee rate of the txs of the range of
+// buckets, closest to the end of the buckets given by requireGreater, in
+// which at least successBreakPoint of the txs confirmed within confTarget
+// blocks.  The range must have seen on average sufficientTxVal txs per block.
+// It returns -1 if there is no such range.
+func (s *txConfirmStats) estimateMedianVal(confTarget int, sufficientTxVal,
+	successBreakPoint float64, requireGreater bool, blockHeight int32) float64 {
+
+	var nConf, totalNum float64
+	extraNum := 0
+	maxBucketIndex := len(s.buckets) - 1
+
+	// requireGreater means we are looking for the lowest fee rate such
+	// that all higher values pass, so we start at the highest fee rate
+	// bucket and step down.
+	startBucket, step := 0, 1
+	if requireGreater {
+		startBucket, step = maxBucketIndex, -1
+	}
+
+	// Buckets are combined until they have enough txs: near is the first
+	// and far the last bucket of the range.
+	curNearBucket, bestNearBucket := startBucket, startBucket
+	curFarBucket, bestFarBucket := startBucket, startBucket
+	foundAnswer := false
+	bins := len(s.unconfTxs)
+
+	for bucket := startBucket; bucket >= 0 && bucket <= maxBucketIndex; bucket += step {
+		curFarBucket = bucket
+		nConf += s.confAvg[confTarget-1][bucket]
+		totalNum += s.txCtAvg[bucket]
+		for confct := confTarget; confct < s.maxConfirms(); confct++ {
+			index := (int(blockHeight) - confct) % bins
+			if index < 0 {
+				index += bins
+			}
+			extraNum += s.unconfTxs[index][bucket]
+		}
+		extraNum += s.oldUnconfTxs[bucket]
+
+		// Only evaluate the range once it has enough txs to be
+		// statistically significant.
+		if totalNum >= sufficientTxVal/(1-s.decay) {
+			curPct := nConf / (totalNum + float64(extraNum))
+			if requireGreater && curPct < successBreakPoint {
+				break
+			}
+			if !requireGreater && curPct > successBreakPoint {
+				break
+			}
+
+			// The range passed, remember it and start a new one.
+			foundAnswer = true
+			nConf = 0
+			totalNum = 0
+			extraNum = 0
+			bestNearBucket = curNearBucket
+			bestFarBucket = curFarBucket
+			curNearBucket = bucket + step
+		}
+	}
+
+	minBucket, maxBucket := bestNearBucket, bestFarBucket
+	if minBucket > maxBucket {
+		minBucket, maxBucket = maxBucket, minBucket
+	}
+	var txSum float64
+	for j := minBucket; j <= maxBucket; j++ {
+		txSum += s.txCtAvg[j]
+	}
+	if !foundAnswer || txSum == 0 {
+		return -1
+	}
+
+	// The median of the range is the average fee rate of the bucket
+	// holding the middle tx.
+	txSum /= 2
+	for j := minBucket; j <= maxBucket; j++ {
+		if s.txCtAvg[j] < txSum {
+			txSum -= s.txCtAvg[j]
+		} else {
+			return s.avg[j] / s.txCtAvg[j]
+		}
+	}
+	return -1
+}
+
+// txStatsInfo is the tracking state of a mempool tx.
+type txStatsInfo struct {
+	blockHeight int32
+	bucket      int
+	feeRate     float64
+}
+
+// BlockPolicyEstimator estimates the fee rate a tx needs to confirm within a
+// number of blocks from the confirmation times of the mempool txs it saw
+// entering the mempool.  It is safe for concurrent access.
+type BlockPolicyEstimator struct {
+	lck sync.Mutex
+
+	bestSeenHeight int32
+	mapMemPoolTxs  map[util.Hash]*txStatsInfo
+	feeStats       *txConfirmStats
+
+	trackedTxs   int
+	untrackedTxs int
+}
+
+// NewBlockPolicyEstimator returns an estimator tracking the fee rates from the
+// min relay fee up to util.MaxFee.
+func NewBlockPolicyEstimator(minRelayFee util.FeeRate) *BlockPolicyEstimator {
+	minTrackedFee := minRelayFee.SataoshisPerK
+	if minTrackedFee < util.MinFeeRate {
+		minTrackedFee = util.MinFeeRate
+	}
+	var buckets []float64
+	for fee := float64(minTrackedFee); fee <= float64(util.MaxFee); fee *= util.FeeSpacing {
+		buckets = append(buckets, fee)
+	}
+	buckets = append(buckets, float64(util.InfFeeRate))
+
+	return &BlockPolicyEstimator{
+		mapMemPoolTxs: make(map[util.Hash]*txStatsInfo),
+		feeStats: newTxConfirmStats(buckets, int(util.MaxBlockConfirms),
+			util.DefaultDecay),
+	}
+}
+
+func entryFeeRate(entry *TxEntry) float64 {
+	return float64(util.NewFeeRateWithSize(entry.TxFee, int64(entry.TxSize)).SataoshisPerK)
+}
+
+// ProcessTransaction starts tracking a tx entering the mempool.  Txs entering
+// the mempool while it is not current, or which are not valid for fee
+// estimation, e.g. having mempool ancestors, are not tracked.
+func (e *BlockPolicyEstimator) ProcessTransaction(entry *TxEntry, validFeeEstimate bool) {
+	e.lck.Lock()
+	defer e.lck.Unlock()
+
+	hash := entry.Tx.GetHash()
+	if _, ok := e.mapMemPoolTxs[hash]; ok {
+		return
+	}
+
+	// Only txs entering the mempool at the best seen height can tell
+	// how long they took to confirm.
+	if entry.TxHeight != e.bestSeenHeight {
+		return
+	}
+	if !validFeeEstimate {
+		e.untrackedTxs++
+		return
+	}
+	e.trackedTxs++
+
+	feeRate := entryFeeRate(entry)
+	e.mapMemPoolTxs[hash] = &txStatsInfo{
+		blockHeight: entry.TxHeight,
+		bucket:      e.feeStats.newTx(entry.TxHeight, feeRate),
+		feeRate:     feeRate,
+	}
+}
+
+// RemoveTx stops tracking a tx which left the mempool without being
+// confirmed.  It returns whether the tx was tracked.
+func (e *BlockPolicyEstimator) RemoveTx(hash util.Hash) bool {
+	e.lck.Lock()
+	defer e.lck.Unlock()
+	return e.removeTx(hash) != nil
+}
+
+func (e *BlockPolicyEstimator) removeTx(hash util.Hash) *txStatsInfo {
+	info, ok := e.mapMemPoolTxs[hash]
+	if !ok {
+		return nil
+	}
+	e.feeStats.removeTx(info.blockHeight, e.bestSeenHeight, info.bucket)
+	delete(e.mapMemPoolTxs, hash)
+	return info
+}
+
+// ProcessBlock records the confirmation of the tracked txs of the block
+// connected at the height.  It must be called before the txs are removed from
+// the mempool.
+func (e *BlockPolicyEstimator) ProcessBlock(blockHeight int32, txs []*tx.Tx) {
+	e.lck.Lock()
+	defer e.lck.Unlock()
+
+	if blockHeight <= e.bestSeenHeight {
+		// Ignore reorgs and blocks already processed, the txs were
+		// already counted or will be recorded in the wrong bucket
+		// after a reorg.
+		return
+	}
+	e.bestSeenHeight = blockHeight
+
+	e.feeStats.clearCurrent(blockHeight)
+	countedTxs := 0
+	for _, txn := range txs {
+		info := e.removeTx(txn.GetHash())
+		if info == nil {
+			continue
+		}
+		blocksToConfirm := int(blockHeight - info.blockHeight)
+		if blocksToConfirm <= 0 {
+			continue
+		}
+		e.feeStats.record(blocksToConfirm, info.feeRate)
+		countedTxs++
+	}
+	e.feeStats.updateMovingAverages()
+
+	log.Debug("Blockpolicy after updating estimates for %d of %d txs in block, "+
+		"since last block %d of %d tracked, new mempool map size %d",
+		countedTxs, len(txs), e.trackedTxs, e.trackedTxs+e.untrackedTxs,
+		len(e.mapMemPoolTxs))
+	e.trackedTxs = 0
+	e.untrackedTxs = 0
+}
+
+// EstimateFee returns the fee rate a tx needs to be confirmed within
+// confTarget blocks with a high probability, or 0 if there is not enough data.
+func (e *BlockPolicyEstimator) EstimateFee(confTarget int) util.FeeRate {
+	e.lck.Lock()
+	defer e.lck.Unlock()
+
+	// It's not possible to get reasonable estimates for confTarget of 1.
+	if confTarget <= 1 || confTarget > e.feeStats.maxConfirms() {
+		return util.FeeRate{}
+	}
+	median := e.feeStats.estimateMedianVal(confTarget, util.SufficientFeeTxs,
+		util.MinSuccessPct, true, e.bestSeenHeight)
+	if median < 0 {
+		return util.FeeRate{}
+	}
+	return util.FeeRate{SataoshisPerK: int64(median)}
+}
+
+// EstimateSmartFee returns the fee rate a tx needs to be confirmed within
+// confTarget blocks, falling back to longer targets when there is not enough
+// data, and the target the estimate was found at.  The estimate is at least
+// the min fee of the mempool, 0 if there is none.
+func (e *BlockPolicyEstimator) EstimateSmartFee(confTarget int, pool *TxMempool) (util.FeeRate, int) {
+	e.lck.Lock()
+	if confTarget <= 0 || confTarget > e.feeStats.maxConfirms() {
+		e.lck.Unlock()
+		return util.FeeRate{}, confTarget
+	}
+
+	// It's not possible to get reasonable estimates for confTarget of 1.
+	if confTarget == 1 {
+		confTarget = 2
+	}
+	median := -1.0
+	for median < 0 && confTarget <= e.feeStats.maxConfirms() {
+		median = e.feeStats.estimateMedianVal(confTarget, util.SufficientFeeTxs,
+			util.MinSuccessPct, true, e.bestSeenHeight)
+		confTarget++
+	}
+	e.lck.Unlock()
+	answerFoundAtTarget := confTarget - 1
+
+	// A full mempool requires at least its min fee.
+	if pool != nil {
+		minPoolFee := pool.GetMinFeeRate()
+		if minPoolFee.SataoshisPerK > 0 && float64(minPoolFee.SataoshisPerK) > median {
+			return minPoolFee, answerFoundAtTarget
+		}
+	}
+	if median < 0 {
+		return util.FeeRate{}, answerFoundAtTarget
+	}
+	return util.FeeRate{SataoshisPerK: int64(median)}, answerFoundAtTarget
+}
+
+// Serialize writes the state of the estimator but the tracked mempool txs.
+func (e *BlockPolicyEstimator) Serialize(w io.Writer) error {
+	e.lck.Lock()
+	defer e.lck.Unlock()
+
+	s := e.feeStats
+	err := util.WriteElements(w, uint32(feeEstimatesVersion), e.bestSeenHeight,
+		s.decay, uint32(len(s.buckets)), uint32(s.maxConfirms()))
+	if err != nil {
+		return err
+	}
+	for _, values := range append([][]float64{s.buckets, s.avg, s.txCtAvg}, s.confAvg...) {
+		if err := binary.Write(w, binary.LittleEndian, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unserialize restores the state written by Serialize.  The estimator is left
+// unchanged on error.
+func (e *BlockPolicyEstimator) Unserialize(r io.Reader) error {
+	var version, numBuckets, maxConfirms uint32
+	var bestSeenHeight int32
+	var decay float64
+	err := util.ReadElements(r, &version, &bestSeenHeight, &decay, &numBuckets, &maxConfirms)
+	if err != nil {
+		return err
+	}
+	if version != feeEstimatesVersion {
+		return fmt.Errorf("unsupported fee estimates version %d", version)
+	}
+	if decay <= 0 || decay >= 1 {
+		return errors.New("corrupt fee estimates: decay must be between 0 and 1")
+	}
+	if numBuckets <= 1 || numBuckets > 1000 {
+		return errors.New("corrupt fee estimates: must have between 2 and 1000 buckets")
+	}
+	if maxConfirms == 0 || maxConfirms > 6*24*7 {
+		return errors.New("corrupt fee estimates: must track between 1 and 1008 confirmations")
+	}
+
+	s := newTxConfirmStats(make([]float64, numBuckets), int(maxConfirms), decay)
+	for _, values := range append([][]float64{s.buckets, s.avg, s.txCtAvg}, s.confAvg...) {
+		if err := binary.Read(r, binary.LittleEndian, values); err != nil {
+			return err
+		}
+	}
+	if !sort.Float64sAreSorted(s.buckets) {
+		return errors.New("corrupt fee estimates: buckets must be increasing")
+	}
+
+	e.lck.Lock()
+	defer e.lck.Unlock()
+	// The unconfirmed txs were counted in the previous buckets, drop them.
+	e.mapMemPoolTxs = make(map[util.Hash]*txStatsInfo)
+	e.feeStats = s
+	e.bestSeenHeight = bestSeenHeight
+	return nil
+}
@@ -0,0 +1,116 @@
+package mempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// newEstimatorTestEntry returns an entry of a unique tx paying the fee rate,
+// entered at the height.
+func newEstimatorTestEntry(n uint32, feeRate int64, height int32) *TxEntry {
+	txn := tx.NewTx(0, tx.TxVersion)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, n),
+		script.NewEmptyScript(), 0xffffffff))
+	txn.AddTxOut(txout.NewTxOut(1000, script.NewEmptyScript()))
+	fee := feeRate * int64(txn.SerializeSize()) / 1000
+	return NewTxentry(txn, fee, 0, height, LockPoints{}, 1, false)
+}
+
+// feedEstimator simulates blocks in which the txs paying at least
+// confirmedFeeRate are confirmed in the next block while the others never are.
+func feedEstimator(e *BlockPolicyEstimator, blocks int, feeRates []int64,
+	confirmedFeeRate int64) {
+
+	n := uint32(0)
+	height := int32(1)
+	e.ProcessBlock(height, nil)
+	for i := 0; i < blocks; i++ {
+		var confirmed []*tx.Tx
+		for _, feeRate := range feeRates {
+			for k := 0; k < 5; k++ {
+				entry := newEstimatorTestEntry(n, feeRate, height)
+				n++
+				e.ProcessTransaction(entry, true)
+				if feeRate >= confirmedFeeRate {
+					confirmed = append(confirmed, entry.Tx)
+				}
+			}
+		}
+		height++
+		e.ProcessBlock(height, confirmed)
+	}
+}
+
+func TestBlockPolicyEstimator(t *testing.T) {
+	e := NewBlockPolicyEstimator(*util.NewFeeRate(util.DefaultMinRelayTxFeePerK))
+
+	// Without data there is no estimate.
+	assert.Equal(t, int64(0), e.EstimateFee(2).SataoshisPerK)
+	feeRate, found := e.EstimateSmartFee(2, nil)
+	assert.Equal(t, int64(0), feeRate.SataoshisPerK)
+	assert.Equal(t, int(util.MaxBlockConfirms), found)
+
+	var feeRates []int64
+	for j := int64(1); j <= 10; j++ {
+		feeRates = append(feeRates, j*10000)
+	}
+	feedEstimator(e, 200, feeRates, 60000)
+
+	estimate := e.EstimateFee(2).SataoshisPerK
+	assert.True(t, estimate >= 60000, "estimate %d", estimate)
+	assert.True(t, estimate <= 100000, "estimate %d", estimate)
+
+	// A tx is never expected to be confirmed in the next block.
+	assert.Equal(t, int64(0), e.EstimateFee(1).SataoshisPerK)
+	feeRate, found = e.EstimateSmartFee(1, nil)
+	assert.Equal(t, estimate, feeRate.SataoshisPerK)
+	assert.Equal(t, 2, found)
+	assert.Equal(t, int64(0), e.EstimateFee(int(util.MaxBlockConfirms)+1).SataoshisPerK)
+
+	// Txs leaving the mempool unconfirmed are forgotten.
+	entry := newEstimatorTestEntry(1<<30, 50000, e.bestSeenHeight)
+	e.ProcessTransaction(entry, true)
+	assert.True(t, e.RemoveTx(entry.Tx.GetHash()))
+	assert.False(t, e.RemoveTx(entry.Tx.GetHash()))
+
+	// Txs entered at another height or not valid for estimation are not
+	// tracked.
+	entry = newEstimatorTestEntry(1<<30+1, 50000, e.bestSeenHeight-1)
+	e.ProcessTransaction(entry, true)
+	assert.False(t, e.RemoveTx(entry.Tx.GetHash()))
+	entry = newEstimatorTestEntry(1<<30+2, 50000, e.bestSeenHeight)
+	e.ProcessTransaction(entry, false)
+	assert.False(t, e.RemoveTx(entry.Tx.GetHash()))
+}
+
+func TestBlockPolicyEstimatorSerialize(t *testing.T) {
+	e := NewBlockPolicyEstimator(*util.NewFeeRate(util.DefaultMinRelayTxFeePerK))
+	feedEstimator(e, 200, []int64{20000, 40000, 80000}, 40000)
+	estimate := e.EstimateFee(3)
+	assert.NotEqual(t, int64(0), estimate.SataoshisPerK)
+
+	var buf bytes.Buffer
+	assert.Nil(t, e.Serialize(&buf))
+	data := buf.Bytes()
+
+	restored := NewBlockPolicyEstimator(*util.NewFeeRate(util.DefaultMinRelayTxFeePerK))
+	assert.Nil(t, restored.Unserialize(bytes.NewReader(data)))
+	assert.Equal(t, e.bestSeenHeight, restored.bestSeenHeight)
+	assert.Equal(t, estimate, restored.EstimateFee(3))
+
+	// Truncated or unknown data leaves the estimator unchanged.
+	empty := NewBlockPolicyEstimator(*util.NewFeeRate(util.DefaultMinRelayTxFeePerK))
+	assert.NotNil(t, empty.Unserialize(bytes.NewReader(data[:len(data)-1])))
+	future := append([]byte{2}, data[1:]...)
+	assert.NotNil(t, empty.Unserialize(bytes.NewReader(future)))
+	assert.Equal(t, int32(0), empty.bestSeenHeight)
+	assert.Equal(t, int64(0), empty.EstimateFee(3).SataoshisPerK)
+}
@@ -15,41 +15,26 @@ type TxEntry struct {
 	// txFee tis transaction fee
 	TxFee    int64
 	TxHeight int32
+	// feeDelta the fee delta set by prioritisetransaction
+	feeDelta int64
 	// sigOpCount sigop plus P2SH sigops count
 	SigOpCount int
 	// time Local time when entering the memPool
 	time int64
 	// usageSize and total memory usage;
 	usageSize int
-	// childTx the tx's all Descendants transaction
+	// ChildTx the tx's children in the mempool, spending its outputs
 	ChildTx map[*TxEntry]struct{}
-	// parentTx the tx's all Ancestors transaction
+	// ParentTx the tx's parents in the mempool, whose outputs it spends
 	ParentTx map[*TxEntry]struct{}
 	// lp Track the height and time at which tx was final
 	lp LockPoints
 	// spendsCoinBase keep track of transactions that spend a coinBase
 	spendsCoinbase bool
-
-	//Statistics Information for every txentry with its ancestors And descend.
-	StatisInformation
-}
-
-type StatisInformation struct {
-	// sumTxCountWithDescendants is this tx and all Descendants transaction's number. init number is 1.
-	SumTxCountWithDescendants int64
-	// sumFeeWithDescendants is calculated by this tx and all Descendants transaction;
-	SumTxFeeWithDescendants int64
-	// sumSizeWithDescendants size calculated by this tx and all Descendants transaction;
-	SumTxSizeWithDescendants int64
-
-	SumTxCountWithAncestors      int64
-	SumTxSizeWitAncestors        int64
-	SumTxSigOpCountWithAncestors int64
-	SumTxFeeWithAncestors        int64
-}
-
-func (t *TxEntry) GetSigOpCountWithAncestors() int64 {
-	return t.SumTxSigOpCountWithAncestors
+	// Depth is one more than the highest depth of the tx's parents, so a tx
+	// always orders after its parents. It is raised when a parent enters the
+	// memPool after the tx, and not lowered when the parents leave it.
+	Depth int
 }
 
 func (t *TxEntry) GetUsageSize() int64 {
@@ -72,6 +57,27 @@ func (t *TxEntry) GetTime() int64 {
 	return t.time
 }
 
+// SetTime sets the time the tx entered the memPool. The mempool sorts its
+// entries by time, so it must be set before the entry is added.
+func (t *TxEntry) SetTime(time int64) {
+	t.time = time
+}
+
+// GetModifiedFee returns the fee of the tx plus its fee delta, which orders
+// the tx for mining and eviction.
+func (t *TxEntry) GetModifiedFee() int64 {
+	return t.TxFee + t.feeDelta
+}
+
+func (t *TxEntry) GetFeeDelta() int64 {
+	return t.feeDelta
+}
+
+// UpdateFeeDelta sets the fee delta of the tx.
+func (t *TxEntry) UpdateFeeDelta(feeDelta int64) {
+	t.feeDelta = feeDelta
+}
+
 // UpdateParent update the tx's parent transaction.
 func (t *TxEntry) UpdateParent(parent *TxEntry, add bool) {
 	if add {
@@ -100,19 +106,6 @@ func (t *TxEntry) UpdateChildOfParents(add bool) {
 	}
 }
 
-func (t *TxEntry) UpdateDescendantState(updateCount, updateSize int, updateFee int64) {
-	t.SumTxCountWithDescendants += int64(updateCount)
-	t.SumTxSizeWithDescendants += int64(updateSize)
-	t.SumTxFeeWithDescendants += updateFee
-}
-
-func (t *TxEntry) UpdateAncestorState(updateCount, updateSize, updateSigOps int, updateFee int64) {
-	t.SumTxSizeWitAncestors += int64(updateSize)
-	t.SumTxCountWithAncestors += int64(updateCount)
-	t.SumTxSigOpCountWithAncestors += int64(updateSigOps)
-	t.SumTxFeeWithAncestors += updateFee
-}
-
 func (t *TxEntry) Less(than mapcontainer.Lesser) bool {
 	th := than.(*TxEntry)
 	if t.time == th.time {
@@ -136,15 +129,6 @@ func NewTxentry(tx *tx.Tx, txFee int64, acceptTime int64, height int32, lp LockP
 	t.TxHeight = height
 	t.SigOpCount = sigOpsCount
 
-	t.SumTxSizeWithDescendants = int64(t.TxSize)
-	t.SumTxFeeWithDescendants = txFee
-	t.SumTxCountWithDescendants = 1
-
-	t.SumTxFeeWithAncestors = txFee
-	t.SumTxSizeWitAncestors = int64(t.TxSize)
-	t.SumTxCountWithAncestors = 1
-	t.SumTxSigOpCountWithAncestors = int64(sigOpsCount)
-
 	t.ParentTx = make(map[*TxEntry]struct{})
 	t.ChildTx = make(map[*TxEntry]struct{})
 
@@ -172,29 +156,27 @@ func (t *TxEntry) CheckLockPointValidity(chain *chain.Chain) bool {
 	return true
 }
 
-type EntryFeeSort TxEntry
-
-func (e EntryFeeSort) Less(than mapcontainer.Lesser) bool {
-	t := than.(EntryFeeSort)
-	if e.SumTxFeeWithAncestors == t.SumTxFeeWithAncestors {
-		thash := e.Tx.GetHash()
-		thhash := t.Tx.GetHash()
-		return thash.Cmp(&thhash) < 0
-	}
-	return e.SumTxFeeWithAncestors > than.(EntryFeeSort).SumTxFeeWithAncestors
+// GetModifiedFeeRate returns the fee rate of the tx paying its modified fee.
+func (t *TxEntry) GetModifiedFeeRate() *util.FeeRate {
+	return util.NewFeeRateWithSize(t.GetModifiedFee(), int64(t.TxSize))
 }
 
-type EntryAncestorFeeRateSort TxEntry
+// EntryFeeRateSort sorts the entries by increasing modified fee rate, the
+// deeper first on a tie, so that the end of a chain comes before its start.
+type EntryFeeRateSort TxEntry
 
-func (r *EntryAncestorFeeRateSort) Less(than mapcontainer.Lesser) bool {
-	t := than.(*EntryAncestorFeeRateSort)
+func (r *EntryFeeRateSort) Less(than mapcontainer.Lesser) bool {
+	t := than.(*EntryFeeRateSort)
 
-	b1 := util.NewFeeRateWithSize((r).SumTxFeeWithAncestors, r.SumTxSizeWitAncestors).SataoshisPerK
-	b2 := util.NewFeeRateWithSize(t.SumTxFeeWithAncestors, t.SumTxSizeWitAncestors).SataoshisPerK
-	if b1 == b2 {
+	r1 := (*TxEntry)(r).GetModifiedFeeRate().SataoshisPerK
+	r2 := (*TxEntry)(t).GetModifiedFeeRate().SataoshisPerK
+	if r1 == r2 {
+		if r.Depth != t.Depth {
+			return r.Depth > t.Depth
+		}
 		rhash := r.Tx.GetHash()
 		thhash := t.Tx.GetHash()
 		return rhash.Cmp(&thhash) < 0
 	}
-	return b1 > b2
+	return r1 < r2
 }
@@ -38,10 +38,10 @@ func TestTxentry(t *testing.T) {
 		}{Height: 10, Time: 1540177584, MaxInputBlock: nil},
 		spendsCoinbase: true,
 	}
-	txentry.SumTxSigOpCountWithAncestors = 10
+	txentry.feeDelta = 200
 
-	sigOpCount := txentry.GetSigOpCountWithAncestors()
-	assert.Equal(t, sigOpCount, int64(10))
+	feeRate := txentry.GetModifiedFeeRate()
+	assert.Equal(t, feeRate, &util.FeeRate{SataoshisPerK: 10000})
 
 	usageSize := txentry.GetUsageSize()
 	assert.Equal(t, usageSize, int64(10))
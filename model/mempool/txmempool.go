@@ -3,11 +3,11 @@ package mempool
 import (
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/copernet/copernicus/conf"
-	"github.com/copernet/copernicus/errcode"
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/outpoint"
@@ -71,12 +71,14 @@ type TxMempool struct {
 	poolData map[util.Hash]*TxEntry
 	//NextTx key is txPrevout, value is tx.
 	nextTx map[outpoint.OutPoint]*TxEntry
-	//RootTx contain all root transaction in mempool.
+	//RootTx contain all transaction without parents in mempool.
 	rootTx map[util.Hash]*TxEntry
-	// txByAncestorFeeRateSort btree.BTree
 	// timeSortData            btree.BTree
-	txByAncestorFeeRateSort mapcontainer.MapContainer
-	timeSortData            mapcontainer.MapContainer
+	timeSortData mapcontainer.MapContainer
+	// txByFeeRate sorts the entries by increasing modified fee rate. The fee
+	// rate of a tx is the lowest score it can be evicted by, so the entries to
+	// evict are looked for in this order.
+	txByFeeRate mapcontainer.MapContainer
 
 	//
 	usageSize int64
@@ -87,13 +89,23 @@ type TxMempool struct {
 	OrphanTransactionsByPrev map[outpoint.OutPoint]map[util.Hash]OrphanTx
 	OrphanTransactions       map[util.Hash]OrphanTx
 
-	nextSweep int
+	// orphansByPeer are the orphans by the peer which sent them.
+	orphansByPeer map[int64]*peerOrphans
+
+	nextSweep time.Time
 
 	//MaxMemPoolSize               int64
 	incrementalRelayFee          util.FeeRate //
 	rollingMinimumFeeRate        int64
 	blockSinceLastRollingFeeBump bool
 	lastRollingFeeUpdate         int64
+
+	// feeDeltas the fee deltas set by the user on transactions, which may
+	// not be in the mempool yet.
+	feeDeltas map[util.Hash]int64
+
+	// events sends the changes of the mempool to its subscribers.
+	events *eventHub
 }
 
 func (m *TxMempool) Lock() {
@@ -113,44 +125,118 @@ func (m *TxMempool) GetCheckFrequency() uint64 {
 	return conf.Cfg.Mempool.CheckFrequency
 }
 
+// GetMinFeeRate returns the minimum fee rate of the mempool. It takes the
+// write lock, as GetMinFee decays the rolling minimum fee rate.
 func (m *TxMempool) GetMinFeeRate() util.FeeRate {
-	m.RLock()
+	m.Lock()
 	feeRate := m.GetMinFee(conf.Cfg.Mempool.MaxPoolSize)
-	m.RUnlock()
+	m.Unlock()
 	return feeRate
 }
 
 // AddTx operator is safe for concurrent write And read access.
 // this function is used to add tx to the memPool, and now the tx should
 // be passed all appropriate checks.
-func (m *TxMempool) AddTx(txEntry *TxEntry, ancestors map[*TxEntry]struct{}) error {
+func (m *TxMempool) AddTx(txEntry *TxEntry) error {
+	m.addTx(txEntry)
+	m.LimitMempoolSize(conf.Cfg.Mempool.MaxPoolSize, int64(conf.Cfg.Mempool.MaxPoolExpiry)*60*60)
+	return nil
+}
+
+// AddPackage adds the entries of a package, parents before children, which
+// passed all appropriate checks together. The mempool size is limited once
+// the whole package is in, so that a parent is not evicted before the child
+// paying for it arrives.
+func (m *TxMempool) AddPackage(entries []*TxEntry) {
+	for _, txEntry := range entries {
+		m.addTx(txEntry)
+	}
+	m.LimitMempoolSize(conf.Cfg.Mempool.MaxPoolSize, int64(conf.Cfg.Mempool.MaxPoolExpiry)*60*60)
+}
+
+func (m *TxMempool) addTx(txEntry *TxEntry) {
+	txEntry.UpdateFeeDelta(m.feeDeltas[txEntry.Tx.GetHash()])
+
 	// insert new txEntry to the memPool; and update the memPool's memory consume.
 	m.timeSortData.ReplaceOrInsert(txEntry)
 	m.poolData[txEntry.Tx.GetHash()] = txEntry
 	m.usageSize += int64(txEntry.usageSize)
 
-	// Update ancestors with information about this tx
-	parentSet := m.updateNextTx(txEntry)
+	m.linkTx(txEntry)
+	m.totalTxSize += uint64(txEntry.TxSize)
+	m.TransactionsUpdated++
+	// Txs with mempool parents are mined after them, so their fee rate
+	// doesn't tell the fee rate needed to confirm.
+	GetFeeEstimator().ProcessTransaction(txEntry, len(txEntry.ParentTx) == 0)
+	m.events.publish(TxAdded, txEntry.Tx, UNKNOWN, nil)
+}
 
-	// Update txEntry's parents
-	for hash := range parentSet {
-		if parent, ok := m.poolData[hash]; ok {
+// linkTx links the entry with its parents and children in the mempool. Only
+// the direct links are kept, so adding a tx costs the same whatever the length
+// of its chain of ancestors. The entry only has children in the mempool when
+// it comes back from a disconnected block.
+func (m *TxMempool) linkTx(txEntry *TxEntry) {
+	txEntry.Depth = 1
+	for _, in := range txEntry.Tx.GetIns() {
+		m.nextTx[*in.PreviousOutPoint] = txEntry
+		if parent, ok := m.poolData[in.PreviousOutPoint.Hash]; ok {
 			txEntry.UpdateParent(parent, true)
+			if parent.Depth >= txEntry.Depth {
+				txEntry.Depth = parent.Depth + 1
+			}
 		}
 	}
-
-	// Update txEntry's parents' child
 	txEntry.UpdateChildOfParents(true)
-	m.updateAncestors(true, txEntry, ancestors)
-	m.updateEntryForAncestors(txEntry, ancestors)
-	m.totalTxSize += uint64(txEntry.TxSize)
-	m.TransactionsUpdated++
-	m.txByAncestorFeeRateSort.ReplaceOrInsert((*EntryAncestorFeeRateSort)(txEntry))
-	if txEntry.SumTxCountWithAncestors == 1 {
-		m.rootTx[txEntry.Tx.GetHash()] = txEntry
+
+	hash := txEntry.Tx.GetHash()
+	for i := 0; i < txEntry.Tx.GetOutsCount(); i++ {
+		if child, ok := m.nextTx[outpoint.OutPoint{Hash: hash, Index: uint32(i)}]; ok {
+			child.UpdateParent(txEntry, true)
+			txEntry.UpdateChild(child, true)
+			delete(m.rootTx, child.Tx.GetHash())
+		}
+	}
+	m.deepenDescendants(txEntry)
+
+	if len(txEntry.ParentTx) == 0 {
+		m.rootTx[hash] = txEntry
+	}
+	m.txByFeeRate.ReplaceOrInsert((*EntryFeeRateSort)(txEntry))
+}
+
+// deepenDescendants raises the depth of the descendants of the entry which
+// don't order after it anymore, which only happens to the children it found
+// in the mempool when it entered, as on a reorg. The depth breaks the ties of
+// txByFeeRate, so the descendants are sorted again.
+func (m *TxMempool) deepenDescendants(entry *TxEntry) {
+	stack := []*TxEntry{entry}
+	for len(stack) > 0 {
+		parent := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for child := range parent.ChildTx {
+			if child.Depth <= parent.Depth {
+				m.txByFeeRate.Delete((*EntryFeeRateSort)(child))
+				child.Depth = parent.Depth + 1
+				m.txByFeeRate.ReplaceOrInsert((*EntryFeeRateSort)(child))
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// unlinkTx unlinks the entry from its parents and children in the mempool.
+// The children left without parents become roots, unless they are removed
+// too.
+func (m *TxMempool) unlinkTx(entry *TxEntry, removed map[*TxEntry]struct{}) {
+	for child := range entry.ChildTx {
+		child.UpdateParent(entry, false)
+		if _, ok := removed[child]; !ok && len(child.ParentTx) == 0 {
+			m.rootTx[child.Tx.GetHash()] = child
+		}
+	}
+	for parent := range entry.ParentTx {
+		parent.UpdateChild(entry, false)
 	}
-	m.LimitMempoolSize(conf.Cfg.Mempool.MaxPoolSize, int64(conf.Cfg.Mempool.MaxPoolExpiry)*60*60)
-	return nil
 }
 
 func (m *TxMempool) HasSpentOut(out *outpoint.OutPoint) bool {
@@ -164,6 +250,7 @@ func (m *TxMempool) HasSpentOut(out *outpoint.OutPoint) bool {
 func (m *TxMempool) CleanOrphan() {
 	m.OrphanTransactionsByPrev = make(map[outpoint.OutPoint]map[util.Hash]OrphanTx)
 	m.OrphanTransactions = make(map[util.Hash]OrphanTx)
+	m.orphansByPeer = make(map[int64]*peerOrphans)
 	log.Debug("mempool.CleanOrphan clean txn: %v", m.OrphanTransactions)
 }
 
@@ -210,9 +297,7 @@ func (m *TxMempool) CalculateMemPoolAncestorsWithLock(txhash *util.Hash) map[*Tx
 	if !ok {
 		return nil
 	}
-	noLimit := uint64(math.MaxUint64)
-	ancestors, _ := m.CalculateMemPoolAncestors(entry.Tx, noLimit, noLimit, noLimit, noLimit, true)
-	return ancestors
+	return m.CalculateMemPoolAncestors(entry.Tx)
 }
 
 func (m *TxMempool) RemoveTxRecursive(origTx *tx.Tx, reason PoolRemovalReason) {
@@ -232,6 +317,15 @@ func (m *TxMempool) GetRootTx() map[util.Hash]TxEntry {
 	return n
 }
 
+// GetRootTxWithoutLock returns the entries without parents in the mempool.
+func (m *TxMempool) GetRootTxWithoutLock() map[util.Hash]*TxEntry {
+	ret := make(map[util.Hash]*TxEntry, len(m.rootTx))
+	for k, v := range m.rootTx {
+		ret[k] = v
+	}
+	return ret
+}
+
 func (m *TxMempool) Size() int {
 	m.RLock()
 	defer m.RUnlock()
@@ -282,14 +376,63 @@ func (m *TxMempool) RemoveTxSelf(txs []*tx.Tx) {
 		if entry, ok := m.poolData[tx.GetHash()]; ok {
 			stage := make(map[*TxEntry]struct{})
 			stage[entry] = struct{}{}
-			m.RemoveStaged(stage, true, BLOCK)
+			m.RemoveStaged(stage, BLOCK)
 		}
 		m.removeConflicts(tx)
+		delete(m.feeDeltas, tx.GetHash())
 	}
 	m.lastRollingFeeUpdate = util.GetTimeSec()
 	m.blockSinceLastRollingFeeBump = true
 }
 
+// PrioritiseTransaction adds delta satoshis to the fee delta of the
+// transaction, which may not be in the mempool yet. The modified fee of a
+// transaction in the mempool is updated along with its order of eviction.
+func (m *TxMempool) PrioritiseTransaction(hash util.Hash, delta int64) {
+	m.Lock()
+	defer m.Unlock()
+	m.feeDeltas[hash] += delta
+	feeDelta := m.feeDeltas[hash]
+	if feeDelta == 0 {
+		delete(m.feeDeltas, hash)
+	}
+
+	entry, ok := m.poolData[hash]
+	if !ok {
+		return
+	}
+	m.txByFeeRate.Delete((*EntryFeeRateSort)(entry))
+	entry.UpdateFeeDelta(feeDelta)
+	m.txByFeeRate.ReplaceOrInsert((*EntryFeeRateSort)(entry))
+	m.TransactionsUpdated++
+}
+
+// GetFeeDelta returns the fee delta of the transaction.
+func (m *TxMempool) GetFeeDelta(hash util.Hash) int64 {
+	m.RLock()
+	defer m.RUnlock()
+	return m.feeDeltas[hash]
+}
+
+// GetAllFeeDeltas returns a copy of the fee deltas of the mempool.
+func (m *TxMempool) GetAllFeeDeltas() map[util.Hash]int64 {
+	m.RLock()
+	defer m.RUnlock()
+	deltas := make(map[util.Hash]int64, len(m.feeDeltas))
+	for hash, delta := range m.feeDeltas {
+		deltas[hash] = delta
+	}
+	return deltas
+}
+
+// GetTransactionsUpdated returns the number of times the transactions of the
+// mempool changed.
+func (m *TxMempool) GetTransactionsUpdated() uint64 {
+	m.RLock()
+	defer m.RUnlock()
+	return m.TransactionsUpdated
+}
+
 func (m *TxMempool) FindTx(hash util.Hash) *TxEntry {
 	m.RLock()
 	defer m.RUnlock()
@@ -299,6 +442,12 @@ func (m *TxMempool) FindTx(hash util.Hash) *TxEntry {
 	return nil
 }
 
+// FindTxWithoutLock returns the entry of the tx in the mempool, whose lock is
+// held by the caller.
+func (m *TxMempool) FindTxWithoutLock(hash util.Hash) *TxEntry {
+	return m.poolData[hash]
+}
+
 func (m *TxMempool) GetCoin(outpoint *outpoint.OutPoint) *utxo.Coin {
 	// m.RLock()
 	// defer m.RUnlock()
@@ -351,7 +500,8 @@ func (m *TxMempool) GetMinFee(sizeLimit int64) util.FeeRate {
 		} else if m.usageSize < sizeLimit/2 {
 			halfLife /= 2
 		}
-		m.rollingMinimumFeeRate = m.rollingMinimumFeeRate / int64(math.Pow(2.0, float64(timeTmp-m.lastRollingFeeUpdate))/float64(halfLife))
+		m.rollingMinimumFeeRate = int64(float64(m.rollingMinimumFeeRate) /
+			math.Pow(2.0, float64(timeTmp-m.lastRollingFeeUpdate)/float64(halfLife)))
 		m.lastRollingFeeUpdate = timeTmp
 		if m.rollingMinimumFeeRate < m.incrementalRelayFee.GetFeePerK()/2 {
 			m.rollingMinimumFeeRate = 0
@@ -375,49 +525,71 @@ func (m *TxMempool) trimToSize(sizeLimit int64) []*outpoint.OutPoint {
 	maxFeeRateRemove := int64(0)
 
 	for len(m.poolData) > 0 && m.usageSize > sizeLimit {
-		less, _ := m.txByAncestorFeeRateSort.Min()
-		removeIt := less.(*EntryAncestorFeeRateSort)
-
-		rmless, _ := m.txByAncestorFeeRateSort.Delete(removeIt)
-		rem := rmless.(*EntryAncestorFeeRateSort)
-		if rem.Tx.GetHash() != removeIt.Tx.GetHash() {
-			panic("the two element should have the same Txhash")
+		// The tx of the lowest score is evicted with its descendants, so
+		// that a parent is kept as long as a child paying for it is.
+		removeIt, score := m.evictionCandidate()
+
+		// The mempool min fee is raised above the score of the evicted
+		// package, so that it is not accepted again right away.
+		removed := util.NewFeeRate(score + m.incrementalRelayFee.SataoshisPerK)
+		m.trackPackageRemoved(*removed)
+		if removed.SataoshisPerK > maxFeeRateRemove {
+			maxFeeRateRemove = removed.SataoshisPerK
 		}
-		removed := util.NewFeeRateWithSize(rem.TxFee, int64(rem.TxSize))
-		removed.SataoshisPerK += m.incrementalRelayFee.SataoshisPerK
 
-		maxFeeRateRemove = util.NewFeeRateWithSize(removeIt.SumTxFeeWithDescendants, removeIt.SumTxSizeWithDescendants).SataoshisPerK
 		stage := make(map[*TxEntry]struct{})
-		m.CalculateDescendants((*TxEntry)(removeIt), stage)
+		m.CalculateDescendants(removeIt, stage)
 		nTxnRemoved += len(stage)
-		txn := make([]*tx.Tx, 0, len(stage))
-		for iter := range stage {
-			txn = append(txn, iter.Tx)
-		}
-
-		// here, don't update Descendant transaction state's reason :
-		// all Descendant transaction of the removed tx also will be removed.
-		m.RemoveStaged(stage, false, SIZELIMIT)
+		m.RemoveStaged(stage, SIZELIMIT)
 		for e := range stage {
 			log.Debug("remove tx hash : %s, mempool size : %d\n", e.Tx.GetHash(), m.usageSize)
-		}
-		for _, tx := range txn {
-			for _, preout := range tx.GetAllPreviousOut() {
+			for _, preout := range e.Tx.GetAllPreviousOut() {
 				if _, ok := m.poolData[preout.Hash]; ok {
 					continue
 				}
 				if _, ok := m.nextTx[preout]; !ok {
+					preout := preout
 					ret = append(ret, &preout)
 				}
 			}
 		}
-
 	}
 
 	log.Debug("mempool", fmt.Sprintf("removed %d txn, rolling minimum fee bumped : %d", nTxnRemoved, maxFeeRateRemove))
 	return ret
 }
 
+// maxScoredDescendants is the number of descendants of an entry counted in its
+// eviction score at most, the nearest first.
+const maxScoredDescendants = 100
+
+// evictionCandidate returns the entry of the lowest score, with its score: the
+// higher of its own fee rate and the fee rate of its package with its
+// descendants. The mempool keeps no sums over the descendants, so the packages
+// are walked, only for the entries whose own fee rate is below the lowest
+// score found yet, and up to maxScoredDescendants so that a long chain paid
+// for by its end is not walked once per tx.
+func (m *TxMempool) evictionCandidate() (*TxEntry, int64) {
+	var candidate *TxEntry
+	var candidateScore int64
+	m.txByFeeRate.Ascend(func(i mapcontainer.Lesser) bool {
+		entry := (*TxEntry)(i.(*EntryFeeRateSort))
+		score := entry.GetModifiedFeeRate().SataoshisPerK
+		if candidate != nil && score >= candidateScore {
+			return false
+		}
+		stats := m.nearDescendantStats(entry, maxScoredDescendants)
+		if packageRate := util.NewFeeRateWithSize(stats.Fee, stats.Size).SataoshisPerK; packageRate > score {
+			score = packageRate
+		}
+		if candidate == nil || score < candidateScore {
+			candidate, candidateScore = entry, score
+		}
+		return true
+	})
+	return candidate, candidateScore
+}
+
 // Expire all transaction (and their dependencies) in the memPool older
 // than time. Return the number of removed transactions.
 func (m *TxMempool) expire(time int64) int {
@@ -435,75 +607,49 @@ func (m *TxMempool) expire(time int64) int {
 	for removeIt := range toremove {
 		m.CalculateDescendants(removeIt, stage)
 	}
-	m.RemoveStaged(stage, false, EXPIRY)
+	m.RemoveStaged(stage, EXPIRY)
 	return len(stage)
 }
 
-func (m *TxMempool) RemoveStaged(entriesToRemove map[*TxEntry]struct{}, updateDescendants bool, reason PoolRemovalReason) {
-	m.updateForRemoveFromMempool(entriesToRemove, updateDescendants)
+func (m *TxMempool) RemoveStaged(entriesToRemove map[*TxEntry]struct{}, reason PoolRemovalReason) {
+	m.removeStaged(entriesToRemove, reason, nil)
+}
+
+// removeStaged removes the entries for the reason, replacedBy being the
+// transaction conflicting with them if any.
+func (m *TxMempool) removeStaged(entriesToRemove map[*TxEntry]struct{}, reason PoolRemovalReason,
+	replacedBy *util.Hash) {
+
 	for rem := range entriesToRemove {
-		if _, ok := m.rootTx[rem.Tx.GetHash()]; ok {
-			delete(m.rootTx, rem.Tx.GetHash())
-		}
-		m.delTxentry(rem, reason)
+		m.unlinkTx(rem, entriesToRemove)
+	}
+	for rem := range entriesToRemove {
+		m.delTxentry(rem, reason, replacedBy)
 		log.Debug("remove one transaction late, the mempool size : ", m.usageSize)
 	}
 }
 
 func (m *TxMempool) removeConflicts(tx *tx.Tx) {
 	// Remove transactions which depend on inputs of tx, recursively
+	txHash := tx.GetHash()
 	for _, preout := range tx.GetAllPreviousOut() {
 		if flictEntry, ok := m.nextTx[preout]; ok {
-			if flictEntry.Tx.GetHash() != tx.GetHash() {
-				m.removeTxRecursive(flictEntry.Tx, CONFLICT)
+			if flictEntry.Tx.GetHash() != txHash {
+				m.removeTxRecursiveFor(flictEntry.Tx, CONFLICT, &txHash)
 			}
 		}
 	}
 }
 
-func (m *TxMempool) updateForRemoveFromMempool(entriesToRemove map[*TxEntry]struct{}, updateDescendants bool) {
-	nNoLimit := uint64(math.MaxUint64)
-
-	if updateDescendants {
-		for removeIt := range entriesToRemove {
-			setDescendants := make(map[*TxEntry]struct{})
-			m.CalculateDescendants(removeIt, setDescendants)
-			delete(setDescendants, removeIt)
-			modifySize := -removeIt.TxSize
-			modifyFee := -removeIt.TxFee
-			modifySigOps := -removeIt.SigOpCount
-
-			for dit := range setDescendants {
-				// Google's btree library use binary search and Less() to find item.However we want to do
-				// set[key] = value to update exited item. The dit will change SumTxSizeWitAncestors and
-				// its key also change which looks like dead lock:(.So temporarily use delete and insert to instead.
-				m.timeSortData.Delete(dit)
-				m.txByAncestorFeeRateSort.Delete((*EntryAncestorFeeRateSort)(dit))
-				dit.UpdateAncestorState(-1, modifySize, modifySigOps, modifyFee)
-				m.timeSortData.ReplaceOrInsert(dit)
-				m.txByAncestorFeeRateSort.ReplaceOrInsert((*EntryAncestorFeeRateSort)(dit))
-			}
-		}
-	}
-
-	for removeIt := range entriesToRemove {
-		for updateIt := range removeIt.ChildTx {
-			updateIt.UpdateParent(removeIt, false)
-		}
-	}
-
-	for removeIt := range entriesToRemove {
-		ancestors, err := m.CalculateMemPoolAncestors(removeIt.Tx, nNoLimit, nNoLimit, nNoLimit, nNoLimit, true)
-		if err != nil {
-			return
-		}
-		removeIt.UpdateChildOfParents(false)
-		m.updateAncestors(false, removeIt, ancestors)
-	}
-}
-
 // removeTxRecursive remove this transaction And its all descent transaction from mempool.
 func (m *TxMempool) removeTxRecursive(origTx *tx.Tx, reason PoolRemovalReason) {
+	m.removeTxRecursiveFor(origTx, reason, nil)
+}
+
+// removeTxRecursiveFor removes the transaction and its descendants as
+// removeTxRecursive, replacedBy being the transaction conflicting with it if
+// any.
+func (m *TxMempool) removeTxRecursiveFor(origTx *tx.Tx, reason PoolRemovalReason, replacedBy *util.Hash) {
 	// Remove transaction from memory pool
 	txToRemove := make(map[*TxEntry]struct{})
 
@@ -530,7 +676,7 @@ func (m *TxMempool) removeTxRecursive(origTx *tx.Tx, reason PoolRemovalReason) {
 	for it := range txToRemove {
 		m.CalculateDescendants(it, allRemoves)
 	}
-	m.RemoveStaged(allRemoves, false, reason)
+	m.removeStaged(allRemoves, reason, replacedBy)
 }
 
 // CalculateDescendants Calculates descendants of entry that are not already in setDescendants, and
@@ -561,117 +707,105 @@ func (m *TxMempool) CalculateDescendants(entry *TxEntry, descendants map[*TxEntr
 	}
 }
 
-func (m *TxMempool) updateNextTx(txEntry *TxEntry) (parentSet map[util.Hash]struct{}) {
-	parentSet = make(map[util.Hash]struct{})
-	ins := txEntry.Tx.GetIns()
-	for _, in := range ins {
-		m.nextTx[*in.PreviousOutPoint] = txEntry
-		parentSet[in.PreviousOutPoint.Hash] = struct{}{}
-	}
-
-	return
+// PackageStats are the count, size, modified fees and sigops of a tx together
+// with its ancestors or descendants in the mempool.
+type PackageStats struct {
+	Count  int64
+	Size   int64
+	Fee    int64
+	SigOps int64
 }
 
-// updateAncestorsOf update each of ancestors transaction state; add or remove this
-// txentry txfee, txsize, txcount.
-func (m *TxMempool) updateAncestors(add bool, txEntry *TxEntry, ancestors map[*TxEntry]struct{}) {
-	updateCount := -1
-	if add {
-		updateCount = 1
+func newPackageStats(entry *TxEntry, others map[*TxEntry]struct{}) PackageStats {
+	stats := PackageStats{
+		Count:  1,
+		Size:   int64(entry.TxSize),
+		Fee:    entry.GetModifiedFee(),
+		SigOps: int64(entry.SigOpCount),
 	}
-	updateSize := updateCount * txEntry.TxSize
-	updateFee := int64(updateCount) * txEntry.TxFee
-	// update each of ancestors transaction state;
-	for ancestorit := range ancestors {
-		ancestorit.UpdateDescendantState(updateCount, updateSize, updateFee)
+	for other := range others {
+		stats.Count++
+		stats.Size += int64(other.TxSize)
+		stats.Fee += other.GetModifiedFee()
+		stats.SigOps += int64(other.SigOpCount)
 	}
+	return stats
 }
 
-func (m *TxMempool) updateEntryForAncestors(entry *TxEntry, setAncestors map[*TxEntry]struct{}) {
-	updateCount := len(setAncestors)
-	updateSize := 0
-	updateFee := int64(0)
-	updateSigOpsCount := 0
+// GetAncestorStats returns the stats of the tx with its ancestors in the
+// mempool. The mempool keeps no sums over the ancestors, so they are walked.
+func (m *TxMempool) GetAncestorStats(entry *TxEntry) PackageStats {
+	m.RLock()
+	defer m.RUnlock()
+	return newPackageStats(entry, m.CalculateMemPoolAncestors(entry.Tx))
+}
 
-	for ancestorIt := range setAncestors {
-		updateFee += ancestorIt.TxFee
-		updateSigOpsCount += ancestorIt.SigOpCount
-		updateSize += ancestorIt.TxSize
-	}
-	entry.UpdateAncestorState(updateCount, updateSize, updateSigOpsCount, updateFee)
+// GetDescendantStats returns the stats of the tx with its descendants in the
+// mempool. The mempool keeps no sums over the descendants, so they are walked.
+func (m *TxMempool) GetDescendantStats(entry *TxEntry) PackageStats {
+	m.RLock()
+	defer m.RUnlock()
+	return m.descendantStats(entry)
 }
 
-// CalculateMemPoolAncestors get tx all ancestors transaction in mempool.
-// when the find is false: the tx must in mempool, so directly get his parent.
-func (m *TxMempool) CalculateMemPoolAncestors(tx *tx.Tx, limitAncestorCount uint64,
-	limitAncestorSize uint64, limitDescendantCount uint64, limitDescendantSize uint64,
-	searchForParent bool) (ancestors map[*TxEntry]struct{}, err error) {
+func (m *TxMempool) descendantStats(entry *TxEntry) PackageStats {
+	descendants := make(map[*TxEntry]struct{})
+	m.CalculateDescendants(entry, descendants)
+	delete(descendants, entry)
+	return newPackageStats(entry, descendants)
+}
 
-	parents := make(map[*TxEntry]struct{})
-	txIns := tx.GetIns()
-	if searchForParent {
-		for _, txIn := range txIns {
-			if entry, ok := m.poolData[txIn.PreviousOutPoint.Hash]; ok {
-				parents[entry] = struct{}{}
-				if uint64(len(parents))+1 > limitAncestorCount {
-					return nil, errcode.New(errcode.ManyUnspendDepend)
-				}
+// nearDescendantStats returns the stats of the entry with its maxCount nearest
+// descendants at most.
+func (m *TxMempool) nearDescendantStats(entry *TxEntry, maxCount int) PackageStats {
+	descendants := make(map[*TxEntry]struct{})
+	stage := []*TxEntry{entry}
+	for len(stage) > 0 && len(descendants) < maxCount {
+		current := stage[0]
+		stage = stage[1:]
+		for child := range current.ChildTx {
+			if _, ok := descendants[child]; ok {
+				continue
 			}
+			if len(descendants) == maxCount {
+				break
+			}
+			descendants[child] = struct{}{}
+			stage = append(stage, child)
 		}
-	} else {
-		// If we're not searching for parents, we require this to be an entry in
-		// the mempool already.
-		if entry, ok := m.poolData[tx.GetHash()]; ok {
-			parents = entry.ParentTx
-		} else {
-			panic("the tx must be in mempool")
-		}
-	}
-
-	tempParents := make([]*TxEntry, len(parents))
-	j := 0
-	for entry := range parents {
-		tempParents[j] = entry
-		j++
 	}
+	return newPackageStats(entry, descendants)
+}
 
-	totalSizeWithAncestors := int64(tx.EncodeSize())
-	ancestors = make(map[*TxEntry]struct{})
-	for len(tempParents) > 0 {
-		entry := tempParents[0]
-		tempParents = tempParents[1:]
-
-		ancestors[entry] = struct{}{}
-		if uint64(entry.SumTxSizeWithDescendants+int64(entry.TxSize)) > limitDescendantSize {
-			return nil, errcode.New(errcode.ManyUnspendDepend)
-		}
-
-		if uint64(entry.SumTxCountWithDescendants+1) > limitDescendantCount {
-			return nil, errcode.New(errcode.ManyUnspendDepend)
-		}
-
-		totalSizeWithAncestors += int64(entry.TxSize)
-		if uint64(totalSizeWithAncestors) > limitAncestorSize {
-			return nil, errcode.New(errcode.ManyUnspendDepend)
+// CalculateMemPoolAncestors get tx all ancestors transaction in mempool, the
+// tx being in the mempool or not. It walks the whole ancestry, so it is only
+// used on demand, never when a tx is added.
+func (m *TxMempool) CalculateMemPoolAncestors(txn *tx.Tx) map[*TxEntry]struct{} {
+	ancestors := make(map[*TxEntry]struct{})
+	stage := make([]*TxEntry, 0)
+	for _, txIn := range txn.GetIns() {
+		if entry, ok := m.poolData[txIn.PreviousOutPoint.Hash]; ok {
+			if _, ok := ancestors[entry]; !ok {
+				ancestors[entry] = struct{}{}
+				stage = append(stage, entry)
+			}
 		}
+	}
 
-		grandTxentrys := entry.ParentTx
-		for grandEntry := range grandTxentrys {
-			if _, ok := ancestors[grandEntry]; !ok {
-				tempParents = append(tempParents, grandEntry)
-			}
-			if uint64(len(tempParents)+len(ancestors)+1) > limitAncestorCount {
-				return nil, errcode.New(errcode.ManyUnspendDepend)
+	for len(stage) > 0 {
+		entry := stage[len(stage)-1]
+		stage = stage[:len(stage)-1]
+		for parent := range entry.ParentTx {
+			if _, ok := ancestors[parent]; !ok {
+				ancestors[parent] = struct{}{}
+				stage = append(stage, parent)
 			}
 		}
 	}
-
-	return ancestors, nil
+	return ancestors
 }
 
-func (m *TxMempool) delTxentry(removeEntry *TxEntry, reason PoolRemovalReason) {
-	// todo add signal for any subscriber
-
+func (m *TxMempool) delTxentry(removeEntry *TxEntry, reason PoolRemovalReason, replacedBy *util.Hash) {
 	for _, preout := range removeEntry.Tx.GetAllPreviousOut() {
 		delete(m.nextTx, preout)
 	}
@@ -684,22 +818,19 @@ func (m *TxMempool) delTxentry(removeEntry *TxEntry, reason PoolRemovalReason) {
 	m.totalTxSize -= uint64(removeEntry.TxSize)
 	delete(m.poolData, removeEntry.Tx.GetHash())
 	m.timeSortData.Delete(removeEntry)
-	m.txByAncestorFeeRateSort.Delete((*EntryAncestorFeeRateSort)(removeEntry))
+	m.txByFeeRate.Delete((*EntryFeeRateSort)(removeEntry))
+	GetFeeEstimator().RemoveTx(removeEntry.Tx.GetHash())
+	m.events.publish(TxRemoved, removeEntry.Tx, reason, replacedBy)
 }
 
 func (m *TxMempool) TxInfoAll() []*TxMempoolInfo {
 	m.RLock()
 	defer m.RUnlock()
 
-	ret := make([]*TxMempoolInfo, len(m.poolData))
-	index := 0
-	m.txByAncestorFeeRateSort.Ascend(func(i mapcontainer.Lesser) bool {
-		entry := TxEntry(*i.(*EntryAncestorFeeRateSort))
-		ret[index] = entry.GetInfo()
-		index++
-		return true
-	})
-
+	ret := make([]*TxMempoolInfo, 0, len(m.poolData))
+	for _, entry := range m.poolData {
+		ret = append(ret, entry.GetInfo())
+	}
 	return ret
 }
 
@@ -709,14 +840,16 @@ func NewTxMempool() *TxMempool {
 		poolData: make(map[util.Hash]*TxEntry),
 		nextTx:   make(map[outpoint.OutPoint]*TxEntry),
 		rootTx:   make(map[util.Hash]*TxEntry),
-		// txByAncestorFeeRateSort: *btree.New(32),
 		// timeSortData:            *btree.New(32),
-		txByAncestorFeeRateSort: skiplist.New(30000),
-		timeSortData:            skiplist.New(30000),
-		incrementalRelayFee:     *util.NewFeeRate(1),
+		timeSortData:        skiplist.New(30000),
+		txByFeeRate:         skiplist.New(30000),
+		incrementalRelayFee: *util.NewFeeRate(1),
 
 		OrphanTransactionsByPrev: make(map[outpoint.OutPoint]map[util.Hash]OrphanTx),
 		OrphanTransactions:       make(map[util.Hash]OrphanTx),
+		orphansByPeer:            make(map[int64]*peerOrphans),
+		feeDeltas:                make(map[util.Hash]int64),
+		events:                   newEventHub(),
 	}
 }
 
@@ -725,27 +858,49 @@ func InitMempool() {
 }
 
 const (
-	OrphanTxExpireTime          = 20 * 60
-	OrphanTxExpireInterval      = 5 * 60
+	// OrphanTxExpireTime is how long an orphan is kept at most.
+	OrphanTxExpireTime = 20 * time.Minute
+	// OrphanTxExpireInterval is how often expired orphans are removed at most.
+	OrphanTxExpireInterval = 5 * time.Minute
+	// DefaultMaxOrphanTransaction is the number of orphans kept at most.
 	DefaultMaxOrphanTransaction = 100
+	// MaxOrphanTxPerPeer is the number of orphans kept at most for a peer.
+	MaxOrphanTxPerPeer = 25
+	// MaxOrphanTxSizePerPeer is the total size of the orphans kept at most
+	// for a peer.
+	MaxOrphanTxSizePerPeer = 400000
 )
 
+// OrphanTx is a transaction missing inputs, kept until its parents arrive.
+// NodeID is the peer which sent it, 0 if none did.
 type OrphanTx struct {
 	Tx         *tx.Tx
 	NodeID     int64
-	Expiration int
+	Size       int
+	Time       time.Time
+	Expiration time.Time
 }
 
+// peerOrphans are the orphans sent by a peer, to limit its share of the pool.
+type peerOrphans struct {
+	txs  map[util.Hash]struct{}
+	size int
+}
+
+// AddOrphanTx keeps a transaction missing inputs, then evicts the expired
+// orphans and those over the limits. The limits of a peer only apply to the
+// orphans it sent, the other orphans only count towards the global limit.
 func (m *TxMempool) AddOrphanTx(orphantx *tx.Tx, nodeID int64) {
 	if _, ok := m.OrphanTransactions[orphantx.GetHash()]; ok {
 		return
 	}
-	sz := orphantx.EncodeSize()
+	sz := int(orphantx.EncodeSize())
 	if sz >= consensus.MaxTxSize {
 		return
 	}
 
-	o := OrphanTx{Tx: orphantx, NodeID: nodeID, Expiration: time.Now().Second() + OrphanTxExpireTime}
+	now := time.Now()
+	o := OrphanTx{Tx: orphantx, NodeID: nodeID, Size: sz, Time: now, Expiration: now.Add(OrphanTxExpireTime)}
 
 	m.OrphanTransactions[orphantx.GetHash()] = o
 	for _, preout := range orphantx.GetAllPreviousOut() {
@@ -757,8 +912,20 @@ func (m *TxMempool) AddOrphanTx(orphantx *tx.Tx, nodeID int64) {
 			m.OrphanTransactionsByPrev[preout] = mi
 		}
 	}
+	if nodeID != 0 {
+		peer, ok := m.orphansByPeer[nodeID]
+		if !ok {
+			peer = &peerOrphans{txs: make(map[util.Hash]struct{})}
+			m.orphansByPeer[nodeID] = peer
+		}
+		peer.txs[orphantx.GetHash()] = struct{}{}
+		peer.size += sz
+	}
 
-	evicted := m.limitOrphanTx()
+	evicted := m.limitOrphanTx(now)
+	if nodeID != 0 {
+		evicted += m.limitPeerOrphanTx(nodeID)
+	}
 	if evicted > 0 {
 		log.Debug("Orphan transaction overflow, removed %d orphan tx", evicted)
 	}
@@ -779,68 +946,129 @@ func (m *TxMempool) HaveTransaction(tx *tx.Tx) bool {
 }
 
 func (m *TxMempool) EraseOrphanTx(txHash util.Hash, removeRedeemers bool) {
-
-	if orphanTx, ok := m.OrphanTransactions[txHash]; ok {
-		for _, preout := range orphanTx.Tx.GetAllPreviousOut() {
-			if orphans, exist := m.OrphanTransactionsByPrev[preout]; exist {
-				delete(orphans, txHash)
-				if len(orphans) == 0 {
-					delete(m.OrphanTransactionsByPrev, preout)
-				}
+	orphanTx, ok := m.OrphanTransactions[txHash]
+	if !ok {
+		return
+	}
+	for _, preout := range orphanTx.Tx.GetAllPreviousOut() {
+		if orphans, exist := m.OrphanTransactionsByPrev[preout]; exist {
+			delete(orphans, txHash)
+			if len(orphans) == 0 {
+				delete(m.OrphanTransactionsByPrev, preout)
 			}
 		}
 	}
+	if peer, exist := m.orphansByPeer[orphanTx.NodeID]; exist {
+		delete(peer.txs, txHash)
+		peer.size -= orphanTx.Size
+		if len(peer.txs) == 0 {
+			delete(m.orphansByPeer, orphanTx.NodeID)
+		}
+	}
+	delete(m.OrphanTransactions, txHash)
+
 	if removeRedeemers {
 		preout := outpoint.OutPoint{Hash: txHash}
-		orphan := m.OrphanTransactions[txHash]
-		for i := 0; i < orphan.Tx.GetOutsCount(); i++ {
+		for i := 0; i < orphanTx.Tx.GetOutsCount(); i++ {
 			preout.Index = uint32(i)
-			for _, orphan := range m.OrphanTransactionsByPrev[preout] {
-				m.EraseOrphanTx(orphan.Tx.GetHash(), true)
+			for hash := range m.OrphanTransactionsByPrev[preout] {
+				m.EraseOrphanTx(hash, true)
 			}
 		}
 	}
-	delete(m.OrphanTransactions, txHash)
 }
 
-func (m *TxMempool) limitOrphanTx() (removeNum int) {
-	now := time.Now().Second()
-	if m.nextSweep <= now {
-		minExpTime := now + OrphanTxExpireTime - OrphanTxExpireInterval
+// limitOrphanTx removes the expired orphans, at most once an
+// OrphanTxExpireInterval, then random orphans while there are more than
+// DefaultMaxOrphanTransaction.
+func (m *TxMempool) limitOrphanTx(now time.Time) (removeNum int) {
+	if !m.nextSweep.After(now) {
+		minExpTime := now.Add(OrphanTxExpireTime - OrphanTxExpireInterval)
 		for hash, orphan := range m.OrphanTransactions {
-			if orphan.Expiration <= now {
+			if !orphan.Expiration.After(now) {
 				m.EraseOrphanTx(hash, true)
 				removeNum++
-			} else {
-				if minExpTime > orphan.Expiration {
-					minExpTime = orphan.Expiration
-				}
+			} else if orphan.Expiration.Before(minExpTime) {
+				minExpTime = orphan.Expiration
 			}
 		}
-		m.nextSweep = minExpTime + OrphanTxExpireInterval
-	}
-
-	if len(m.OrphanTransactions) <= DefaultMaxOrphanTransaction {
-		return
+		m.nextSweep = minExpTime.Add(OrphanTxExpireInterval)
 	}
 
 	for hash := range m.OrphanTransactions {
+		if len(m.OrphanTransactions) <= DefaultMaxOrphanTransaction {
+			break
+		}
 		m.EraseOrphanTx(hash, true)
 		removeNum++
-		break
 	}
 	return
 }
 
+// limitPeerOrphanTx removes the oldest orphans of a peer while it is over
+// MaxOrphanTxPerPeer or MaxOrphanTxSizePerPeer.
+func (m *TxMempool) limitPeerOrphanTx(nodeID int64) (removeNum int) {
+	for {
+		peer, ok := m.orphansByPeer[nodeID]
+		if !ok || len(peer.txs) <= MaxOrphanTxPerPeer && peer.size <= MaxOrphanTxSizePerPeer {
+			return
+		}
+		var oldest *OrphanTx
+		for hash := range peer.txs {
+			orphan := m.OrphanTransactions[hash]
+			if oldest == nil || orphan.Time.Before(oldest.Time) {
+				oldest = &orphan
+			}
+		}
+		m.EraseOrphanTx(oldest.Tx.GetHash(), true)
+		removeNum++
+	}
+}
+
+// RemoveOrphansByTag removes the orphans sent by a peer and returns how many
+// there were.
 func (m *TxMempool) RemoveOrphansByTag(nodeID int64) int {
-	numEvicted := 0
 	m.Lock()
-	for _, otx := range m.OrphanTransactions {
-		if otx.NodeID == nodeID {
-			m.EraseOrphanTx(otx.Tx.GetHash(), true)
+	defer m.Unlock()
+	peer, ok := m.orphansByPeer[nodeID]
+	if !ok {
+		return 0
+	}
+	numEvicted := 0
+	for hash := range peer.txs {
+		if _, ok := m.OrphanTransactions[hash]; ok {
+			m.EraseOrphanTx(hash, true)
 			numEvicted++
 		}
 	}
-	m.Unlock()
 	return numEvicted
 }
+
+// GetOrphanTxs returns the orphans, oldest first.
+func (m *TxMempool) GetOrphanTxs() []OrphanTx {
+	m.RLock()
+	defer m.RUnlock()
+	orphans := make([]OrphanTx, 0, len(m.OrphanTransactions))
+	for _, orphan := range m.OrphanTransactions {
+		orphans = append(orphans, orphan)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Time.Before(orphans[j].Time)
+	})
+	return orphans
+}
+
+// HasOrphanSpending reports whether an orphan spends an output of the
+// transaction.
+func (m *TxMempool) HasOrphanSpending(hash util.Hash) bool {
+	m.RLock()
+	defer m.RUnlock()
+	for _, orphan := range m.OrphanTransactions {
+		for _, e := range orphan.Tx.GetIns() {
+			if e.PreviousOutPoint.Hash == hash {
+				return true
+			}
+		}
+	}
+	return false
+}
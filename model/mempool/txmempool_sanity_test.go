@@ -6,10 +6,10 @@ import (
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/persist"
 	"github.com/copernet/copernicus/util/algorithm/mapcontainer"
-	"math"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/copernet/copernicus/model/opcodes"
 	"github.com/copernet/copernicus/model/outpoint"
@@ -164,13 +164,11 @@ func TestMempoolRemove(t *testing.T) {
 		t.Errorf("expect 0 got %d", mp.Size())
 	}
 
-	noLimit := uint64(math.MaxUint64)
 	testEntryHelp := NewTestMemPoolEntry()
 
 	// Just the parent
-	ancestors, _ := mp.CalculateMemPoolAncestors(txParent, noLimit, noLimit, noLimit, noLimit, true)
 	entryParent := testEntryHelp.FromTxToEntry(txParent)
-	err = mp.AddTx(entryParent, ancestors)
+	err = mp.AddTx(entryParent)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -181,18 +179,16 @@ func TestMempoolRemove(t *testing.T) {
 	}
 
 	// Parent, children, grandchildren
-	err = mp.AddTx(entryParent, ancestors)
+	err = mp.AddTx(entryParent)
 	if err != nil {
 		t.Error(err.Error())
 	}
 	for i := 0; i < 3; i++ {
-		ancestors, _ := mp.CalculateMemPoolAncestors(txChild[i], noLimit, noLimit, noLimit, noLimit, true)
 		entry := testEntryHelp.FromTxToEntry(txChild[i])
-		mp.AddTx(entry, ancestors)
+		mp.AddTx(entry)
 
-		ancestors, _ = mp.CalculateMemPoolAncestors(txGrandChild[i], noLimit, noLimit, noLimit, noLimit, true)
 		entry = testEntryHelp.FromTxToEntry(txGrandChild[i])
-		mp.AddTx(entry, ancestors)
+		mp.AddTx(entry)
 	}
 	ps = mp.Size()
 
@@ -229,13 +225,11 @@ func TestMempoolRemove(t *testing.T) {
 	// Add children and grandchildren, but NOT the parent (simulate the parent
 	// being in a block)
 	for i := 0; i < 3; i++ {
-		ancestors, _ := mp.CalculateMemPoolAncestors(txChild[i], noLimit, noLimit, noLimit, noLimit, true)
 		entry := testEntryHelp.FromTxToEntry(txChild[i])
-		mp.AddTx(entry, ancestors)
+		mp.AddTx(entry)
 
-		ancestors, _ = mp.CalculateMemPoolAncestors(txGrandChild[i], noLimit, noLimit, noLimit, noLimit, true)
 		entry = testEntryHelp.FromTxToEntry(txGrandChild[i])
-		mp.AddTx(entry, ancestors)
+		mp.AddTx(entry)
 	}
 
 	// Now remove the parent, as might happen if a block-re-org occurs but the
@@ -294,7 +288,51 @@ func TestMempoolOrphan(t *testing.T) {
 
 }
 
-func TestMempoolAncestorIndexing(t *testing.T) {
+func TestMempoolOrphanLimits(t *testing.T) {
+	newOrphan := func(index uint32) *tx.Tx {
+		txn := tx.NewTx(0, tx.TxVersion)
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, index), script.NewEmptyScript(), 0))
+		txn.AddTxOut(txout.NewTxOut(amount.Amount(33000), script.NewEmptyScript()))
+		return txn
+	}
+
+	mp := NewTxMempool()
+	var first util.Hash
+	for i := 0; i < MaxOrphanTxPerPeer+1; i++ {
+		txn := newOrphan(uint32(i))
+		if i == 0 {
+			first = txn.GetHash()
+		}
+		mp.AddOrphanTx(txn, 1)
+	}
+	// The oldest orphan of the peer makes room for its last one.
+	assert.Equal(t, MaxOrphanTxPerPeer, len(mp.OrphanTransactions))
+	_, ok := mp.OrphanTransactions[first]
+	assert.False(t, ok)
+
+	// Orphans of no peer only count towards the global limit.
+	for i := 0; i < DefaultMaxOrphanTransaction; i++ {
+		mp.AddOrphanTx(newOrphan(uint32(1000+i)), 0)
+	}
+	assert.Equal(t, DefaultMaxOrphanTransaction, len(mp.OrphanTransactions))
+
+	// Expired orphans are removed with the next orphan.
+	for hash, orphan := range mp.OrphanTransactions {
+		orphan.Expiration = time.Now().Add(-time.Second)
+		mp.OrphanTransactions[hash] = orphan
+	}
+	mp.nextSweep = time.Time{}
+	last := newOrphan(2000)
+	mp.AddOrphanTx(last, 2)
+	assert.Equal(t, 1, len(mp.OrphanTransactions))
+	assert.Equal(t, 1, len(mp.GetOrphanTxs()))
+	assert.True(t, mp.HasOrphanSpending(util.HashOne))
+	assert.Equal(t, 0, mp.RemoveOrphansByTag(1))
+	assert.Equal(t, 1, mp.RemoveOrphansByTag(2))
+	assert.Equal(t, 0, len(mp.orphansByPeer))
+}
+
+func TestMempoolFeeRateIndexing(t *testing.T) {
 	scriptSig := script.NewEmptyScript()
 	err := scriptSig.PushOpCode(opcodes.OP_11)
 	if err != nil {
@@ -310,225 +348,110 @@ func TestMempoolAncestorIndexing(t *testing.T) {
 		t.Error(err.Error())
 	}
 
-	noLimit := uint64(math.MaxUint64)
 	testEntryHelp := NewTestMemPoolEntry()
 	mp := NewTxMempool()
+	addTx := func(txn *tx.Tx, fee amount.Amount) *TxEntry {
+		entry := testEntryHelp.SetFee(fee).FromTxToEntry(txn)
+		if err := mp.AddTx(entry); err != nil {
+			t.Error(err.Error())
+		}
+		return entry
+	}
+	feeRateOrder := func() []util.Hash {
+		hashes := make([]util.Hash, 0)
+		mp.txByFeeRate.Ascend(func(i mapcontainer.Lesser) bool {
+			hashes = append(hashes, i.(*EntryFeeRateSort).Tx.GetHash())
+			return true
+		})
+		return hashes
+	}
+	inHashOrder := func(tx1, tx2 *tx.Tx) []util.Hash {
+		hash1, hash2 := tx1.GetHash(), tx2.GetHash()
+		if hash1.Cmp(&hash2) < 0 {
+			return []util.Hash{hash1, hash2}
+		}
+		return []util.Hash{hash2, hash1}
+	}
 
 	/* 3rd highest fee */
 	tx1 := tx.NewTx(0, 0)
-	tx1.AddTxOut(txout.NewTxOut(
-		amount.Amount(10*util.COIN),
-		scriptPubkey,
-	))
-	ancestors, err := mp.CalculateMemPoolAncestors(tx1, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry1 := testEntryHelp.SetFee(10000).FromTxToEntry(tx1)
-	err = mp.AddTx(entry1, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx1.AddTxOut(txout.NewTxOut(amount.Amount(10*util.COIN), scriptPubkey))
+	addTx(tx1, 10000)
 
 	/* highest fee */
 	tx2 := tx.NewTx(0, 0)
-	tx2.AddTxOut(txout.NewTxOut(
-		amount.Amount(2*util.COIN),
-		scriptPubkey,
-	))
-	tx2Size := tx2.EncodeSize()
-	ancestors, err = mp.CalculateMemPoolAncestors(tx2, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry2 := testEntryHelp.SetFee(20000).FromTxToEntry(tx2)
-	err = mp.AddTx(entry2, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx2.AddTxOut(txout.NewTxOut(amount.Amount(2*util.COIN), scriptPubkey))
+	addTx(tx2, 20000)
 
 	/* lowest fee */
 	tx3 := tx.NewTx(0, 0)
-	tx3.AddTxOut(txout.NewTxOut(
-		amount.Amount(5*util.COIN),
-		scriptPubkey,
-	))
-	ancestors, err = mp.CalculateMemPoolAncestors(tx3, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry3 := testEntryHelp.SetFee(0).FromTxToEntry(tx3)
-	err = mp.AddTx(entry3, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx3.AddTxOut(txout.NewTxOut(amount.Amount(5*util.COIN), scriptPubkey))
+	entry3 := addTx(tx3, 0)
 
 	/*  2nd highest fee */
 	tx4 := tx.NewTx(0, 0)
-	tx4.AddTxOut(txout.NewTxOut(
-		amount.Amount(7*util.COIN),
-		scriptPubkey,
-	))
-	ancestors, err = mp.CalculateMemPoolAncestors(tx4, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry4 := testEntryHelp.SetFee(15000).FromTxToEntry(tx4)
-	err = mp.AddTx(entry4, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx4.AddTxOut(txout.NewTxOut(amount.Amount(7*util.COIN), scriptPubkey))
+	addTx(tx4, 15000)
 
 	/* equal fee rate to tx1, but newer */
 	tx5 := tx.NewTx(0, 0)
-	tx5.AddTxOut(txout.NewTxOut(
-		amount.Amount(11*util.COIN),
-		scriptPubkey,
-	))
-	ancestors, err = mp.CalculateMemPoolAncestors(tx5, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry5 := testEntryHelp.SetFee(10000).FromTxToEntry(tx5)
-	err = mp.AddTx(entry5, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx5.AddTxOut(txout.NewTxOut(amount.Amount(11*util.COIN), scriptPubkey))
+	addTx(tx5, 10000)
 
 	assert.Equal(t, mp.Size(), 5, "mempool size should equal 5")
+	assert.Equal(t, 5, len(mp.GetRootTx()))
 
-	sortedOrder := make([]util.Hash, 6)
-	sortedOrder[0] = tx2.GetHash() //20000
-	sortedOrder[1] = tx4.GetHash() //15000
-
-	tx1hash := tx1.GetHash()
-	tx5hash := tx5.GetHash()
-
-	if tx1hash.Cmp(&tx5hash) < 0 {
-		sortedOrder[2] = tx1.GetHash()
-		sortedOrder[3] = tx5.GetHash()
-	} else {
-		sortedOrder[2] = tx5.GetHash()
-		sortedOrder[3] = tx1.GetHash()
-	}
-
-	sortedOrder[4] = tx3.GetHash() //0
-
-	index := 0
-	mp.txByAncestorFeeRateSort.Ascend(func(i mapcontainer.Lesser) bool {
-		entry := i.(*EntryAncestorFeeRateSort)
-		if entry.Tx.GetHash() != sortedOrder[index] {
-			t.Errorf("the sort by fee is error, index : %d, expect hash : %s, actual hash is : %v\n",
-				index, sortedOrder[index], entry.Tx.GetHash())
-			return true
-		}
-		index++
-		return true
-	})
+	sortedOrder := []util.Hash{tx3.GetHash()}
+	sortedOrder = append(sortedOrder, inHashOrder(tx1, tx5)...)
+	sortedOrder = append(sortedOrder, tx4.GetHash(), tx2.GetHash())
+	assert.Equal(t, sortedOrder, feeRateOrder())
 
 	/* low fee parent with high fee child */
 	/* tx6 (0) -> tx7 (high) */
 	tx6 := tx.NewTx(0, 0)
-	tx6.AddTxOut(txout.NewTxOut(
-		amount.Amount(20*util.COIN),
-		scriptPubkey,
-	))
-	tx6Size := tx6.EncodeSize()
-	ancestors, err = mp.CalculateMemPoolAncestors(tx6, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	entry6 := testEntryHelp.SetFee(0).FromTxToEntry(tx6)
-	err = mp.AddTx(entry6, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	tx6.AddTxOut(txout.NewTxOut(amount.Amount(20*util.COIN), scriptPubkey))
+	entry6 := addTx(tx6, 0)
 
-	tx3hash := tx3.GetHash()
-	tx6hash := tx6.GetHash()
-
-	if tx3hash.Cmp(&tx6hash) < 0 {
-		sortedOrder[4] = tx3hash
-		sortedOrder[5] = tx6hash
-	} else {
-		sortedOrder[4] = tx6hash
-		sortedOrder[5] = tx3hash
-	}
-
-	index = 0
-	mp.txByAncestorFeeRateSort.Ascend(func(i mapcontainer.Lesser) bool {
-		entry := i.(*EntryAncestorFeeRateSort)
-		if entry.Tx.GetHash() != sortedOrder[index] {
-			t.Errorf("the sort by fee is error, index : %d, expect hash : %s, actual hash is : %v\n",
-				index, sortedOrder[index], entry.Tx.GetHash())
-			return true
-		}
-		index++
-		return true
-	})
+	sortedOrder = inHashOrder(tx3, tx6)
+	sortedOrder = append(sortedOrder, inHashOrder(tx1, tx5)...)
+	sortedOrder = append(sortedOrder, tx4.GetHash(), tx2.GetHash())
+	assert.Equal(t, sortedOrder, feeRateOrder())
 
 	tx7 := tx.NewTx(0, 0)
-	tx7.AddTxIn(txin.NewTxIn(
-		outpoint.NewOutPoint(tx6hash, 0),
-		scriptSig,
-		0,
-	))
-	tx7.AddTxOut(txout.NewTxOut(
-		amount.Amount(10*util.COIN),
-		scriptPubkey,
-	))
-	tx7Size := tx7.EncodeSize()
-	ancestors, _ = mp.CalculateMemPoolAncestors(tx7, noLimit, noLimit, noLimit, noLimit, true)
-	/* set the fee to just below tx2's feerate when including ancestor */
-	fee := 20000/tx2Size*(tx7Size+tx6Size) - 1
-	entry7 := testEntryHelp.SetFee(amount.Amount(fee)).FromTxToEntry(tx7)
-	err = mp.AddTx(entry7, ancestors)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	assert.Equal(t, mp.Size(), 7, "mempool size should equal 0")
-	tmpOrder := make([]util.Hash, 7)
-	tmpOrder[0] = sortedOrder[0]
-	tmpOrder[1] = tx7.GetHash()
-	copy(tmpOrder[2:], sortedOrder[1:])
-	sortedOrder = tmpOrder
-
-	index = 0
-	mp.txByAncestorFeeRateSort.Ascend(func(i mapcontainer.Lesser) bool {
-		entry := i.(*EntryAncestorFeeRateSort)
-		if entry.Tx.GetHash() != sortedOrder[index] {
-			t.Errorf("the sort by fee is error, index : %d, expect hash : %s, actual hash is : %v\n",
-				index, sortedOrder[index], entry.Tx.GetHash())
-			return false
-		}
-		index++
-		return true
-	})
-	/* after tx6 is mined, tx7 should move up in the sort */
-	vtx := []*tx.Tx{tx6}
-	mp.RemoveTxSelf(vtx)
-	sortedOrder = append(sortedOrder[:1], sortedOrder[2:]...)
-
-	if tx3hash.Cmp(&tx6hash) < 0 {
-		sortedOrder = sortedOrder[:len(sortedOrder)-1]
-	} else {
-		sortedOrder = append(sortedOrder[:4], sortedOrder[5:]...)
-	}
-
-	sortedOrder = append([]util.Hash{tx7.GetHash()}, sortedOrder...)
-
-	index = 0
-	mp.txByAncestorFeeRateSort.Ascend(func(i mapcontainer.Lesser) bool {
-		entry := i.(*EntryAncestorFeeRateSort)
-		h := entry.Tx.GetHash()
-		if entry.Tx.GetHash() != sortedOrder[index] {
-			t.Errorf("the sort by ancestor fee is error, index : %d, expect hash : %s, actual hash is : %v\n",
-				index, sortedOrder[index], &h)
-			return false
-		}
-		index++
-		return true
-	})
+	tx7.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(tx6.GetHash(), 0), scriptSig, 0))
+	tx7.AddTxOut(txout.NewTxOut(amount.Amount(10*util.COIN), scriptPubkey))
+	entry7 := addTx(tx7, 1000000)
+	assert.Equal(t, mp.Size(), 7, "mempool size should equal 7")
+	assert.Equal(t, 1, entry6.Depth)
+	assert.Equal(t, 2, entry7.Depth)
+	assert.Equal(t, 6, len(mp.GetRootTx()))
+
+	sortedOrder = inHashOrder(tx3, tx6)
+	sortedOrder = append(sortedOrder, inHashOrder(tx1, tx5)...)
+	sortedOrder = append(sortedOrder, tx4.GetHash(), tx2.GetHash(), tx7.GetHash())
+	assert.Equal(t, sortedOrder, feeRateOrder())
+
+	// The parent is scored by its package with its child, so a tx paying as
+	// little as it is evicted first.
+	candidate, score := mp.evictionCandidate()
+	assert.Equal(t, entry3, candidate)
+	assert.Equal(t, int64(0), score)
+	stats := mp.GetDescendantStats(entry6)
+	assert.Equal(t, int64(1000000), stats.Fee)
+
+	/* after tx6 is mined, tx7 has no parent left */
+	mp.RemoveTxSelf([]*tx.Tx{tx6})
+	assert.Equal(t, 0, len(entry7.ParentTx))
+	assert.Equal(t, 6, len(mp.GetRootTx()))
+	sortedOrder = []util.Hash{tx3.GetHash()}
+	sortedOrder = append(sortedOrder, inHashOrder(tx1, tx5)...)
+	sortedOrder = append(sortedOrder, tx4.GetHash(), tx2.GetHash(), tx7.GetHash())
+	assert.Equal(t, sortedOrder, feeRateOrder())
+
+	/* removing tx7 removes it from both indexes */
+	mp.RemoveTxRecursive(tx7, UNKNOWN)
+	assert.Equal(t, 5, len(mp.GetRootTx()))
+	assert.Equal(t, sortedOrder[:5], feeRateOrder())
 }
 
 func TestTxMempool_GetMinFee(t *testing.T) {
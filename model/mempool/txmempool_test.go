@@ -2,7 +2,6 @@ package mempool
 
 import (
 	"fmt"
-	"math"
 	"testing"
 
 	"github.com/copernet/copernicus/conf"
@@ -106,7 +105,6 @@ func TestTxMempooladdTx(t *testing.T) {
 
 	testPool := NewTxMempool()
 	poolSize := testPool.Size()
-	noLimit := uint64(math.MaxUint64)
 
 	// Nothing in pool, remove should do nothing:
 	testPool.removeTxRecursive(txParentPtr, UNKNOWN)
@@ -117,11 +115,7 @@ func TestTxMempooladdTx(t *testing.T) {
 	}
 
 	// Just add the parent:
-	ancestors, err := testPool.CalculateMemPoolAncestors(txParentPtr, noLimit, noLimit, noLimit, noLimit, true)
-	if err != nil {
-		t.Error(err.Error())
-	}
-	if err := testPool.AddTx(testEntryHelp.FromTxToEntry(txParentPtr), ancestors); err != nil {
+	if err := testPool.AddTx(testEntryHelp.FromTxToEntry(txParentPtr)); err != nil {
 		t.Error("add Tx failure : ", err)
 		return
 	}
@@ -134,25 +128,16 @@ func TestTxMempooladdTx(t *testing.T) {
 	}
 
 	// Parent, children, grandchildren:
-	ancestors, _ = testPool.CalculateMemPoolAncestors(txParentPtr, noLimit, noLimit, noLimit, noLimit, true)
-	err = testPool.AddTx(testEntryHelp.FromTxToEntry(txParentPtr), ancestors)
+	err := testPool.AddTx(testEntryHelp.FromTxToEntry(txParentPtr))
 	if err != nil {
 		t.Error(err.Error())
 	}
 	for i := 0; i < 3; i++ {
-		ancestors, err := testPool.CalculateMemPoolAncestors(&txChild[i], noLimit, noLimit, noLimit, noLimit, true)
-		if err != nil {
-			t.Error(err.Error())
-		}
-		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txChild[i]), ancestors)
-		if err != nil {
-			t.Error(err.Error())
-		}
-		ancestors, err = testPool.CalculateMemPoolAncestors(&txGrandChild[i], noLimit, noLimit, noLimit, noLimit, true)
+		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txChild[i]))
 		if err != nil {
 			t.Error(err.Error())
 		}
-		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txGrandChild[i]), ancestors)
+		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txGrandChild[i]))
 		if err != nil {
 			t.Error(err.Error())
 		}
@@ -195,13 +180,11 @@ func TestTxMempooladdTx(t *testing.T) {
 	// Add children and grandchildren, but NOT the parent (simulate the parent
 	// being in a block)
 	for i := 0; i < 3; i++ {
-		ancestors, _ := testPool.CalculateMemPoolAncestors(&txChild[i], noLimit, noLimit, noLimit, noLimit, true)
-		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txChild[i]), ancestors)
+		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txChild[i]))
 		if err != nil {
 			t.Error(err.Error())
 		}
-		ancestors, _ = testPool.CalculateMemPoolAncestors(&txGrandChild[i], noLimit, noLimit, noLimit, noLimit, true)
-		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txGrandChild[i]), ancestors)
+		err = testPool.AddTx(testEntryHelp.FromTxToEntry(&txGrandChild[i]))
 		if err != nil {
 			t.Error(err.Error())
 		}
@@ -257,15 +240,10 @@ func createTx() []*TxEntry {
 
 func TestMempoolSortTime(t *testing.T) {
 	testPool := NewTxMempool()
-	noLimit := uint64(math.MaxUint64)
 
 	set := createTx()
 	for _, e := range set {
-		ancestors, err := testPool.CalculateMemPoolAncestors(e.Tx, noLimit, noLimit, noLimit, noLimit, true)
-		if err != nil {
-			t.Error(err.Error())
-		}
-		err = testPool.AddTx(e, ancestors)
+		err := testPool.AddTx(e)
 		if err != nil {
 			t.Error(err.Error())
 		}
@@ -300,13 +278,11 @@ func TestMempoolSortTime(t *testing.T) {
 
 func TestTxMempoolTrimToSize(t *testing.T) {
 	testPool := NewTxMempool()
-	noLimit := uint64(math.MaxUint64)
 
 	set := createTx()
 	fmt.Println("tx number : ", len(set))
 	for _, e := range set {
-		ancestors, _ := testPool.CalculateMemPoolAncestors(e.Tx, noLimit, noLimit, noLimit, noLimit, true)
-		err := testPool.AddTx(e, ancestors)
+		err := testPool.AddTx(e)
 		if err != nil {
 			t.Error(err.Error())
 		}
@@ -424,3 +400,260 @@ func TestTxMempool_GetCoin(t *testing.T) {
 	assert.Equal(t, out.GetValue(), coin3.GetAmount())
 	assert.Equal(t, out.GetScriptPubKey(), coin3.GetScriptPubKey())
 }
+
+func TestTxMempoolPrioritiseTransaction(t *testing.T) {
+	testPool := NewTxMempool()
+	addTx := func(txn *tx.Tx, fee amount.Amount) *TxEntry {
+		entry := NewTestMemPoolEntry().SetFee(fee).FromTxToEntry(txn)
+		if err := testPool.AddTx(entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	parentTx := tx.NewTx(0, tx.TxVersion)
+	parentTx.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: util.HashOne, Index: 0},
+		script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+	parentTx.AddTxOut(txout.NewTxOut(33000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+	childTx := tx.NewTx(0, tx.TxVersion)
+	childTx.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: parentTx.GetHash(), Index: 0},
+		script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+	childTx.AddTxOut(txout.NewTxOut(22000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+	otherTx := tx.NewTx(0, tx.TxVersion)
+	otherTx.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: util.HashOne, Index: 1},
+		script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+	otherTx.AddTxOut(txout.NewTxOut(33000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+
+	// A delta set before the tx arrives is applied when it enters the pool.
+	testPool.PrioritiseTransaction(childTx.GetHash(), 500)
+	parent := addTx(parentTx, 1000)
+	child := addTx(childTx, 1000)
+	assert.Equal(t, child.GetModifiedFee(), int64(1500))
+	assert.Equal(t, testPool.GetAncestorStats(child).Fee, int64(2500))
+	assert.Equal(t, testPool.GetDescendantStats(parent).Fee, int64(2500))
+
+	// A delta on a tx in the pool updates the stats including it.
+	testPool.PrioritiseTransaction(parentTx.GetHash(), 2000)
+	assert.Equal(t, parent.GetModifiedFee(), int64(3000))
+	assert.Equal(t, testPool.GetAncestorStats(parent).Fee, int64(3000))
+	assert.Equal(t, testPool.GetDescendantStats(parent).Fee, int64(4500))
+	assert.Equal(t, testPool.GetAncestorStats(child).Fee, int64(4500))
+
+	// Deltas cancelling out are forgotten.
+	testPool.PrioritiseTransaction(childTx.GetHash(), -500)
+	assert.Equal(t, testPool.GetFeeDelta(childTx.GetHash()), int64(0))
+	assert.Equal(t, len(testPool.GetAllFeeDeltas()), 1)
+	assert.Equal(t, testPool.GetDescendantStats(parent).Fee, int64(4000))
+
+	// The tx of the lowest modified score is evicted first.
+	other := addTx(otherTx, 100000)
+	first, _ := testPool.evictionCandidate()
+	assert.Equal(t, first, child)
+	testPool.PrioritiseTransaction(otherTx.GetHash(), -99900)
+	first, _ = testPool.evictionCandidate()
+	assert.Equal(t, first, other)
+	testPool.trimToSize(testPool.usageSize - 1)
+	assert.Equal(t, testPool.Size(), 2)
+	assert.Equal(t, testPool.FindTx(otherTx.GetHash()) == nil, true)
+
+	// Deltas of txs in a block are forgotten.
+	testPool.RemoveTxSelf([]*tx.Tx{parentTx})
+	assert.Equal(t, testPool.GetFeeDelta(parentTx.GetHash()), int64(0))
+}
+
+func TestTxMempoolAddPackage(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	testPool := NewTxMempool()
+	newTx := func(prevHash util.Hash, index uint32) *tx.Tx {
+		txn := tx.NewTx(0, tx.TxVersion)
+		txn.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: prevHash, Index: index},
+			script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(33000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+		return txn
+	}
+
+	// A parent paying nothing, with a child paying for both.
+	parentTx := newTx(util.HashOne, 0)
+	childTx := newTx(parentTx.GetHash(), 0)
+	parent := NewTestMemPoolEntry().SetFee(0).FromTxToEntry(parentTx)
+	child := NewTestMemPoolEntry().SetFee(20000).FromTxToEntry(childTx)
+	testPool.AddPackage([]*TxEntry{parent, child})
+	assert.Equal(t, testPool.Size(), 2)
+	assert.Equal(t, testPool.GetAncestorStats(child).Fee, int64(20000))
+	assert.Equal(t, testPool.GetDescendantStats(parent).Fee, int64(20000))
+
+	// The parent is kept for its child rather than a tx paying more than it.
+	otherTx := newTx(util.HashOne, 1)
+	other := NewTestMemPoolEntry().SetFee(1000).FromTxToEntry(otherTx)
+	testPool.AddPackage([]*TxEntry{other})
+	testPool.trimToSize(testPool.usageSize - 1)
+	assert.Equal(t, testPool.Size(), 2)
+	assert.Equal(t, testPool.FindTx(otherTx.GetHash()) == nil, true)
+
+	// The mempool min fee is raised above the fee rate of the evicted tx.
+	evicted := util.NewFeeRateWithSize(1000, int64(other.TxSize))
+	assert.Equal(t, testPool.rollingMinimumFeeRate > evicted.SataoshisPerK, true)
+}
+
+func TestTxMempoolTrimToSizePackages(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	testPool := NewTxMempool()
+	addTx := func(prevHash util.Hash, index uint32, fee amount.Amount) *TxEntry {
+		txn := tx.NewTx(0, tx.TxVersion)
+		txn.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: prevHash, Index: index},
+			script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(33000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+		entry := NewTestMemPoolEntry().SetFee(fee).FromTxToEntry(txn)
+		if err := testPool.AddTx(entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	// A parent paying nothing with a child paying a little, and a parent
+	// paying much with a child paying nothing.
+	lowParent := addTx(util.HashOne, 0, 0)
+	lowChild := addTx(lowParent.Tx.GetHash(), 0, 500)
+	highParent := addTx(util.HashOne, 1, 20000)
+	highChild := addTx(highParent.Tx.GetHash(), 0, 0)
+
+	// The child paying nothing is evicted alone, its parent paying for
+	// itself.
+	testPool.trimToSize(testPool.usageSize - 1)
+	assert.Equal(t, testPool.Size(), 3)
+	assert.Equal(t, testPool.FindTx(highChild.Tx.GetHash()) == nil, true)
+
+	// The parent paying nothing is evicted with its child, scored by their
+	// package.
+	testPool.trimToSize(testPool.usageSize - 1)
+	assert.Equal(t, testPool.Size(), 1)
+	assert.Equal(t, testPool.FindTx(lowParent.Tx.GetHash()) == nil, true)
+	assert.Equal(t, testPool.FindTx(lowChild.Tx.GetHash()) == nil, true)
+	packageRate := util.NewFeeRateWithSize(500, int64(lowParent.TxSize+lowChild.TxSize))
+	assert.Equal(t, testPool.rollingMinimumFeeRate > packageRate.SataoshisPerK, true)
+}
+
+// newTxChain returns a chain of n txs, each spending the output of the one
+// before it.
+func newTxChain(n int) []*tx.Tx {
+	txs := make([]*tx.Tx, 0, n)
+	prevHash := util.HashOne
+	for i := 0; i < n; i++ {
+		txn := tx.NewTx(0, tx.TxVersion)
+		txn.AddTxIn(txin2.NewTxIn(&outpoint.OutPoint{Hash: prevHash, Index: 0},
+			script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(amount.Amount(util.COIN-int64(i)*1000),
+			script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+		prevHash = txn.GetHash()
+		txs = append(txs, txn)
+	}
+	return txs
+}
+
+func addTxChain(t testing.TB, testPool *TxMempool, txs []*tx.Tx) []*TxEntry {
+	entries := make([]*TxEntry, 0, len(txs))
+	for _, txn := range txs {
+		entry := NewTestMemPoolEntry().SetFee(1000).FromTxToEntry(txn)
+		if err := testPool.AddTx(entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+const benchTxChainLength = 5000
+
+func TestTxMempoolLongChain(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	testPool := NewTxMempool()
+	txs := newTxChain(benchTxChainLength)
+	entries := addTxChain(t, testPool, txs)
+
+	last := entries[len(entries)-1]
+	assert.Equal(t, testPool.Size(), benchTxChainLength)
+	assert.Equal(t, last.Depth, benchTxChainLength)
+	assert.Equal(t, len(testPool.GetRootTx()), 1)
+	assert.Equal(t, testPool.GetAncestorStats(last).Count, int64(benchTxChainLength))
+	assert.Equal(t, testPool.GetDescendantStats(entries[0]).Fee, int64(benchTxChainLength*1000))
+	assert.Equal(t, testPool.nearDescendantStats(entries[0], 10).Count, int64(11))
+	assert.Equal(t, testPool.nearDescendantStats(last, 10).Count, int64(1))
+
+	// The tx after a mined one becomes a root.
+	testPool.RemoveTxSelf(txs[:1])
+	assert.Equal(t, testPool.Size(), benchTxChainLength-1)
+	_, ok := testPool.GetRootTx()[txs[1].GetHash()]
+	assert.Equal(t, ok, true)
+
+	// Only the end of the chain is evicted.
+	testPool.trimToSize(testPool.usageSize - 1)
+	assert.Equal(t, testPool.Size(), benchTxChainLength-2)
+	assert.Equal(t, testPool.FindTx(last.Tx.GetHash()) == nil, true)
+
+	testPool.RemoveTxRecursive(txs[1], UNKNOWN)
+	assert.Equal(t, testPool.Size(), 0)
+	assert.Equal(t, testPool.usageSize, int64(0))
+}
+
+func BenchmarkTxMempoolAddChain(b *testing.B) {
+	conf.Cfg = conf.InitConfig([]string{})
+	txs := newTxChain(benchTxChainLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addTxChain(b, NewTxMempool(), txs)
+	}
+}
+
+// BenchmarkTxMempoolMineChain removes a chain one tx at a time, from its
+// root, as the blocks mining it would.
+func BenchmarkTxMempoolMineChain(b *testing.B) {
+	conf.Cfg = conf.InitConfig([]string{})
+	txs := newTxChain(benchTxChainLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		testPool := NewTxMempool()
+		addTxChain(b, testPool, txs)
+		b.StartTimer()
+		for j := range txs {
+			testPool.RemoveTxSelf(txs[j : j+1])
+		}
+	}
+}
+
+// BenchmarkTxMempoolTrimChain evicts a chain one tx at a time, from its end.
+func BenchmarkTxMempoolTrimChain(b *testing.B) {
+	conf.Cfg = conf.InitConfig([]string{})
+	txs := newTxChain(benchTxChainLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		testPool := NewTxMempool()
+		addTxChain(b, testPool, txs)
+		b.StartTimer()
+		testPool.trimToSize(0)
+	}
+}
+
+// BenchmarkTxMempoolTrimPaidChain evicts once from a chain paying nothing
+// but its last tx, which pays for all the others it descends from.
+func BenchmarkTxMempoolTrimPaidChain(b *testing.B) {
+	conf.Cfg = conf.InitConfig([]string{})
+	txs := newTxChain(benchTxChainLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		testPool := NewTxMempool()
+		for j, txn := range txs {
+			fee := amount.Amount(0)
+			if j == len(txs)-1 {
+				fee = amount.Amount(util.COIN)
+			}
+			if err := testPool.AddTx(NewTestMemPoolEntry().SetFee(fee).FromTxToEntry(txn)); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StartTimer()
+		testPool.trimToSize(testPool.usageSize - 1)
+	}
+}
@@ -0,0 +1,322 @@
+// Package policy holds the standardness rules the mempool applies to the
+// transactions it accepts, on top of the consensus rules.
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/util"
+)
+
+// DefaultName is the name of the policy loaded from the config when none is
+// given. The reject reasons of the other policies tell their name.
+const DefaultName = "default"
+
+// The rules of a policy, each of which can be disabled on its own.
+const (
+	// RuleVersion rejects the txs of a version which isn't standard.
+	RuleVersion = "version"
+	// RuleTxSize rejects the txs smaller than MinTxSize or larger than
+	// MaxTxSize.
+	RuleTxSize = "tx-size"
+	// RuleScriptSig rejects the scriptSigs which are too large or not push
+	// only.
+	RuleScriptSig = "scriptsig"
+	// RuleScriptPubKey rejects the outputs whose script doesn't match one of
+	// ScriptTemplates.
+	RuleScriptPubKey = "scriptpubkey"
+	// RuleBareMultiSig rejects the bare multisig outputs.
+	RuleBareMultiSig = "bare-multisig"
+	// RuleDust rejects the outputs worth less than spending them costs at
+	// DustRelayFee.
+	RuleDust = "dust"
+	// RuleDataCarrier limits the OP_RETURN outputs to MaxDataCarrierOutputs,
+	// sharing MaxDataCarrierBytes.
+	RuleDataCarrier = "datacarrier"
+	// RuleSigOps rejects the txs with more than MaxTxSigOps sigops.
+	RuleSigOps = "sigops"
+	// RuleP2SHSigOps rejects the P2SH inputs with more than MaxP2SHSigOps
+	// sigops.
+	RuleP2SHSigOps = "p2sh-sigops"
+	// RuleMinRelayFee rejects the txs paying less than MinRelayFee.
+	RuleMinRelayFee = "min-relay-fee"
+)
+
+// Rules are all the rules of a policy.
+var Rules = []string{
+	RuleVersion,
+	RuleTxSize,
+	RuleScriptSig,
+	RuleScriptPubKey,
+	RuleBareMultiSig,
+	RuleDust,
+	RuleDataCarrier,
+	RuleSigOps,
+	RuleP2SHSigOps,
+	RuleMinRelayFee,
+}
+
+// scriptTemplates maps the names of the standard scriptPubKey templates to
+// their script type.
+var scriptTemplates = map[string]int{
+	"pubkey":     script.ScriptPubkey,
+	"pubkeyhash": script.ScriptPubkeyHash,
+	"scripthash": script.ScriptHash,
+	"multisig":   script.ScriptMultiSig,
+	"nulldata":   script.ScriptNullData,
+}
+
+// Policy is a named set of standardness rules with their parameters.
+type Policy struct {
+	Name string
+
+	// Disabled are the rules which aren't checked.
+	Disabled map[string]bool
+
+	MinTxSize uint
+	MaxTxSize uint
+
+	// ScriptTemplates are the names of the scriptPubKey templates allowed.
+	ScriptTemplates []string
+
+	MaxDataCarrierOutputs int
+	MaxDataCarrierBytes   uint
+
+	// DustRelayFee and MinRelayFee are in satoshis per kB.
+	DustRelayFee int64
+	MinRelayFee  int64
+
+	MaxTxSigOps   uint
+	MaxP2SHSigOps uint
+}
+
+var (
+	lock sync.RWMutex
+	// active is the policy set at runtime, nil to follow the config.
+	active *Policy
+)
+
+// GetInstance returns the policy the mempool applies.
+func GetInstance() *Policy {
+	lock.RLock()
+	defer lock.RUnlock()
+	if active != nil {
+		return active
+	}
+	return FromConfig(conf.Cfg)
+}
+
+// SetInstance replaces the policy the mempool applies, nil to go back to the
+// one of the config. The policy must not be changed afterwards.
+func SetInstance(p *Policy) {
+	lock.Lock()
+	defer lock.Unlock()
+	active = p
+}
+
+// FromConfig returns the policy described by the config.
+func FromConfig(cfg *conf.Configuration) *Policy {
+	p := &Policy{
+		Name:                  cfg.Policy.Name,
+		Disabled:              make(map[string]bool),
+		MinTxSize:             cfg.Policy.MinTxSize,
+		MaxTxSize:             cfg.Policy.MaxTxSize,
+		ScriptTemplates:       cfg.Policy.ScriptTemplates,
+		MaxDataCarrierOutputs: cfg.Policy.MaxDatacarrierOutputs,
+		MaxDataCarrierBytes:   cfg.Script.MaxDatacarrierBytes,
+		DustRelayFee:          cfg.TxOut.DustRelayFee,
+		MinRelayFee:           cfg.Mempool.MinFeeRate,
+		MaxTxSigOps:           tx.MaxStandardTxSigOps,
+		MaxP2SHSigOps:         tx.MaxP2SHSigOps,
+	}
+	if p.Name == "" {
+		p.Name = DefaultName
+	}
+	if p.MaxTxSize == 0 {
+		p.MaxTxSize = tx.MaxStandardTxSize
+	}
+	if len(p.ScriptTemplates) == 0 {
+		p.ScriptTemplates = TemplateNames()
+	}
+	if !cfg.Script.AcceptDataCarrier {
+		p.MaxDataCarrierOutputs = 0
+	}
+	p.Disabled[RuleBareMultiSig] = cfg.Script.IsBareMultiSigStd
+	for _, rule := range cfg.Policy.DisabledRules {
+		p.Disabled[rule] = true
+	}
+	return p
+}
+
+// TemplateNames returns the names of the standard scriptPubKey templates.
+func TemplateNames() []string {
+	names := make([]string, 0, len(scriptTemplates))
+	for name := range scriptTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate tells whether the rules and templates of the policy exist.
+func (p *Policy) Validate() error {
+	for rule := range p.Disabled {
+		if !IsRule(rule) {
+			return fmt.Errorf("unknown policy rule %q", rule)
+		}
+	}
+	for _, name := range p.ScriptTemplates {
+		if _, ok := scriptTemplates[name]; !ok {
+			return fmt.Errorf("unknown script template %q", name)
+		}
+	}
+	if p.MinTxSize > p.MaxTxSize {
+		return fmt.Errorf("min tx size %d above max tx size %d", p.MinTxSize, p.MaxTxSize)
+	}
+	return nil
+}
+
+// IsRule tells whether rule names a rule of the policies.
+func IsRule(rule string) bool {
+	for _, r := range Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy returns a copy of the policy which can be changed.
+func (p *Policy) Copy() *Policy {
+	c := *p
+	c.Disabled = make(map[string]bool, len(p.Disabled))
+	for rule, disabled := range p.Disabled {
+		c.Disabled[rule] = disabled
+	}
+	c.ScriptTemplates = append([]string(nil), p.ScriptTemplates...)
+	return &c
+}
+
+// Enabled tells whether the rule is checked.
+func (p *Policy) Enabled(rule string) bool {
+	return !p.Disabled[rule]
+}
+
+// reject returns the error of a tx breaking the policy for reason.
+func (p *Policy) reject(code errcode.RejectCode, reason string) error {
+	if p.Name != DefaultName {
+		reason = fmt.Sprintf("%s (policy %s)", reason, p.Name)
+	}
+	return errcode.NewError(code, reason)
+}
+
+func (p *Policy) allowsTemplate(pubKeyType int) bool {
+	for _, name := range p.ScriptTemplates {
+		if scriptTemplates[name] == pubKeyType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTx checks the version, size, inputs and outputs of the tx.
+func (p *Policy) CheckTx(txn *tx.Tx) error {
+	if p.Enabled(RuleVersion) {
+		if txn.GetVersion() > tx.MaxStandardVersion || txn.GetVersion() < 1 {
+			return p.reject(errcode.RejectNonstandard, "version")
+		}
+	}
+
+	if p.Enabled(RuleTxSize) {
+		size := uint(txn.EncodeSize())
+		if size > p.MaxTxSize {
+			return p.reject(errcode.RejectNonstandard, "tx-size")
+		}
+		if size < p.MinTxSize {
+			return p.reject(errcode.RejectNonstandard, "tx-size-small")
+		}
+	}
+
+	if p.Enabled(RuleScriptSig) {
+		for _, in := range txn.GetIns() {
+			if ok, reason := in.CheckStandard(); !ok {
+				return p.reject(errcode.RejectNonstandard, reason)
+			}
+		}
+	}
+
+	dataOutputs := 0
+	var dataBytes uint
+	dustRelayFee := util.NewFeeRate(p.DustRelayFee)
+	for _, out := range txn.GetOuts() {
+		pubKeyType, pubKeys, isStandard := out.GetScriptPubKey().IsStandardScriptPubKey()
+		if p.Enabled(RuleScriptPubKey) {
+			if !isStandard || !p.allowsTemplate(pubKeyType) {
+				return p.reject(errcode.RejectNonstandard, "scriptpubkey")
+			}
+			if pubKeyType == script.ScriptMultiSig {
+				opM := pubKeys[0][0]
+				opN := pubKeys[len(pubKeys)-1][0]
+				if opN < 1 || opN > 3 || opM < 1 || opM > opN {
+					return p.reject(errcode.RejectNonstandard, "scriptpubkey")
+				}
+			}
+		}
+
+		if pubKeyType == script.ScriptNullData {
+			if p.Enabled(RuleDataCarrier) {
+				size := uint(out.GetScriptPubKey().Size())
+				if p.MaxDataCarrierOutputs == 0 || size > p.MaxDataCarrierBytes {
+					return p.reject(errcode.RejectNonstandard, "scriptpubkey")
+				}
+				dataOutputs++
+				dataBytes += size
+			}
+		} else if pubKeyType == script.ScriptMultiSig && p.Enabled(RuleBareMultiSig) {
+			return p.reject(errcode.RejectNonstandard, "bare-multisig")
+		} else if p.Enabled(RuleDust) && out.IsDust(dustRelayFee) {
+			return p.reject(errcode.RejectNonstandard, "dust")
+		}
+	}
+
+	if dataOutputs > p.MaxDataCarrierOutputs {
+		return p.reject(errcode.RejectNonstandard, "multi-op-return")
+	}
+	if dataBytes > p.MaxDataCarrierBytes {
+		return p.reject(errcode.RejectNonstandard, "datacarrier-size")
+	}
+
+	return nil
+}
+
+// CheckSigOps checks the number of sigops of a tx.
+func (p *Policy) CheckSigOps(sigOps uint) error {
+	if p.Enabled(RuleSigOps) && sigOps > p.MaxTxSigOps {
+		return p.reject(errcode.RejectNonstandard, "bad-txns-too-many-sigops")
+	}
+	return nil
+}
+
+// AllowsP2SHSigOps tells whether a P2SH input may have this number of sigops.
+func (p *Policy) AllowsP2SHSigOps(sigOps uint) bool {
+	return !p.Enabled(RuleP2SHSigOps) || sigOps <= p.MaxP2SHSigOps
+}
+
+// CheckFee checks the fee of a tx of the size against the min relay fee.
+func (p *Policy) CheckFee(fee int64, size int) error {
+	if !p.Enabled(RuleMinRelayFee) {
+		return nil
+	}
+	minFee := util.NewFeeRate(p.MinRelayFee).GetFee(size)
+	if fee < minFee {
+		return p.reject(errcode.RejectInsufficientFee,
+			fmt.Sprintf("min relay fee not met, %d < %d", fee, minFee))
+	}
+	return nil
+}
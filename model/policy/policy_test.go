@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() *conf.Configuration {
+	cfg := &conf.Configuration{}
+	cfg.Policy.MaxDatacarrierOutputs = 1
+	cfg.Script.AcceptDataCarrier = true
+	cfg.Script.MaxDatacarrierBytes = 223
+	cfg.Script.IsBareMultiSigStd = true
+	cfg.TxOut.DustRelayFee = 83
+	return cfg
+}
+
+func p2pkhScript() *script.Script {
+	b := []byte{opcodes.OP_DUP, opcodes.OP_HASH160, 0x14}
+	b = append(b, bytes.Repeat([]byte{0x01}, 20)...)
+	b = append(b, opcodes.OP_EQUALVERIFY, opcodes.OP_CHECKSIG)
+	return script.NewScriptRaw(b)
+}
+
+func nullDataScript(size int) *script.Script {
+	b := []byte{opcodes.OP_RETURN, opcodes.OP_PUSHDATA1, byte(size - 3)}
+	b = append(b, bytes.Repeat([]byte{0x02}, size-3)...)
+	return script.NewScriptRaw(b)
+}
+
+func newTestTx(outs ...*txout.TxOut) *tx.Tx {
+	txn := tx.NewTx(0, tx.DefaultVersion)
+	txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, 0),
+		script.NewScriptRaw([]byte{opcodes.OP_TRUE}), script.SequenceFinal))
+	for _, out := range outs {
+		txn.AddTxOut(out)
+	}
+	return txn
+}
+
+func reasonOf(err error) string {
+	_, reason, _ := errcode.IsRejectCode(err)
+	return reason
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := testConfig()
+	cfg.Policy.DisabledRules = []string{RuleDust}
+	p := FromConfig(cfg)
+
+	assert.Equal(t, DefaultName, p.Name)
+	assert.Equal(t, tx.MaxStandardTxSize, p.MaxTxSize)
+	assert.Equal(t, TemplateNames(), p.ScriptTemplates)
+	assert.False(t, p.Enabled(RuleDust))
+	assert.False(t, p.Enabled(RuleBareMultiSig))
+	assert.True(t, p.Enabled(RuleDataCarrier))
+	assert.Nil(t, p.Validate())
+
+	cfg.Script.AcceptDataCarrier = false
+	cfg.Script.IsBareMultiSigStd = false
+	p = FromConfig(cfg)
+	assert.Equal(t, 0, p.MaxDataCarrierOutputs)
+	assert.True(t, p.Enabled(RuleBareMultiSig))
+
+	p.Disabled["no-such-rule"] = true
+	assert.NotNil(t, p.Validate())
+}
+
+func TestCheckTx(t *testing.T) {
+	p := FromConfig(testConfig())
+
+	assert.Nil(t, p.CheckTx(newTestTx(txout.NewTxOut(10000, p2pkhScript()))))
+	assert.Equal(t, "dust", reasonOf(p.CheckTx(newTestTx(txout.NewTxOut(1, p2pkhScript())))))
+
+	p.Disabled[RuleDust] = true
+	assert.Nil(t, p.CheckTx(newTestTx(txout.NewTxOut(1, p2pkhScript()))))
+
+	p.ScriptTemplates = []string{"nulldata"}
+	assert.Equal(t, "scriptpubkey", reasonOf(p.CheckTx(newTestTx(txout.NewTxOut(10000, p2pkhScript())))))
+
+	p.Disabled[RuleScriptPubKey] = true
+	p.MinTxSize = 1000
+	assert.Equal(t, "tx-size-small", reasonOf(p.CheckTx(newTestTx(txout.NewTxOut(10000, p2pkhScript())))))
+}
+
+func TestCheckTxDataCarrier(t *testing.T) {
+	p := FromConfig(testConfig())
+
+	twoOutputs := newTestTx(txout.NewTxOut(0, nullDataScript(80)), txout.NewTxOut(0, nullDataScript(80)))
+	assert.Equal(t, "multi-op-return", reasonOf(p.CheckTx(twoOutputs)))
+
+	p.MaxDataCarrierOutputs = 2
+	assert.Nil(t, p.CheckTx(twoOutputs))
+
+	// The outputs share the byte budget.
+	p.MaxDataCarrierBytes = 150
+	assert.Equal(t, "datacarrier-size", reasonOf(p.CheckTx(twoOutputs)))
+
+	p.Disabled[RuleDataCarrier] = true
+	assert.Nil(t, p.CheckTx(twoOutputs))
+}
+
+func TestRejectReportsPolicy(t *testing.T) {
+	p := FromConfig(testConfig())
+	p.Name = "strict"
+	p.MaxTxSigOps = 10
+
+	assert.Nil(t, p.CheckSigOps(10))
+	err := p.CheckSigOps(11)
+	code, reason, ok := errcode.IsRejectCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, errcode.RejectNonstandard, code)
+	assert.Equal(t, "bad-txns-too-many-sigops (policy strict)", reason)
+
+	p.MinRelayFee = 1000
+	assert.Nil(t, p.CheckFee(250, 250))
+	code, _, _ = errcode.IsRejectCode(p.CheckFee(249, 250))
+	assert.Equal(t, errcode.RejectInsufficientFee, code)
+
+	p.Disabled[RuleMinRelayFee] = true
+	assert.Nil(t, p.CheckFee(0, 250))
+}
+
+func TestSetInstance(t *testing.T) {
+	conf.Cfg = testConfig()
+	defer SetInstance(nil)
+
+	assert.Equal(t, DefaultName, GetInstance().Name)
+
+	p := GetInstance().Copy()
+	p.Name = "relaxed"
+	p.Disabled[RuleDust] = true
+	SetInstance(p)
+	assert.Equal(t, "relaxed", GetInstance().Name)
+	assert.False(t, GetInstance().Enabled(RuleDust))
+
+	SetInstance(nil)
+	assert.Equal(t, DefaultName, GetInstance().Name)
+	assert.True(t, GetInstance().Enabled(RuleDust))
+}
@@ -47,6 +47,14 @@ var globalWallet *Wallet
  */
 var fallbackFee = util.NewFeeRate(20000)
 
+// mempoolEventBuffer is the number of mempool events waiting for the wallet
+// at most.
+const mempoolEventBuffer = 1000
+
+// txConfirmTarget is the number of blocks within which the txs of the wallet
+// should be confirmed when estimating their fee.
+const txConfirmTarget = 6
+
 func InitWallet() {
 	defer func() {
 		if globalWallet == nil {
@@ -72,6 +80,7 @@ func InitWallet() {
 	}
 
 	chain.GetInstance().Subscribe(walletInstance.handleBlockChainNotification)
+	go walletInstance.handleMempoolEvents(mempool.GetInstance().Subscribe(mempoolEventBuffer))
 
 	globalWallet = walletInstance
 }
@@ -327,8 +336,10 @@ func (w *Wallet) GetMinimumFee(byteSize int) int64 {
 	feeNeeded := w.payTxFee.GetFee(byteSize)
 	// User didn't set tx fee
 	if feeNeeded == 0 {
-		minFeeRate := mempool.GetInstance().GetMinFeeRate()
-		feeNeeded = minFeeRate.GetFee(byteSize)
+		// The estimate is at least the min fee of the mempool.
+		feeRate, _ := mempool.GetFeeEstimator().EstimateSmartFee(txConfirmTarget,
+			mempool.GetInstance())
+		feeNeeded = feeRate.GetFee(byteSize)
 
 		// ... unless we don't have enough mempool data for estimatefee, then
 		// use fallbackFee.
@@ -517,6 +528,36 @@ func (w *Wallet) HandleRelatedMempoolTx(txe *tx.Tx) {
 	}
 }
 
+// handleMempoolEvents adds the transactions entering the mempool which are
+// related to the wallet.  It runs until the subscription ends.
+func (w *Wallet) handleMempoolEvents(sub *mempool.Subscription) {
+	dropped := uint64(0)
+	for event := range sub.Events() {
+		// The transactions of the dropped events are found in the mempool.
+		if n := sub.Dropped(); n != dropped {
+			log.Warn("wallet missed %d mempool events, rescanning the mempool", n-dropped)
+			dropped = n
+			w.scanMempool()
+		}
+		if event.Type == mempool.TxAdded {
+			w.HandleRelatedMempoolTx(event.Tx)
+		}
+	}
+}
+
+// scanMempool adds the transactions of the mempool related to the wallet which
+// it doesn't have yet.
+func (w *Wallet) scanMempool() {
+	for _, entry := range mempool.GetInstance().GetAllTxEntry() {
+		w.txnLock.RLock()
+		_, ok := w.walletTxns[entry.Tx.GetHash()]
+		w.txnLock.RUnlock()
+		if !ok {
+			w.HandleRelatedMempoolTx(entry.Tx)
+		}
+	}
+}
+
 func (w *Wallet) handleBlockChainNotification(notification *chain.Notification) {
 	switch notification.Type {
 
@@ -49,6 +49,15 @@ type AddrManager struct {
 	nNew           int
 	lamtx          sync.Mutex
 	localAddresses map[string]*localAddress
+
+	// triedCollisions holds, by address key, the new addresses found good
+	// while their tried bucket is full.  They wait for the entry they
+	// would evict to be tested.
+	triedCollisions map[string]*KnownAddress
+
+	// asmap, when set, groups addresses by autonomous system rather than
+	// by prefix.  It is set before Start and never changed afterwards.
+	asmap *Asmap
 }
 
 type serializedKnownAddress struct {
@@ -67,6 +76,9 @@ type serializedAddrManager struct {
 	Addresses    []*serializedKnownAddress
 	NewBuckets   [newBucketCount][]string // string is NetAddressKey
 	TriedBuckets [triedBucketCount][]string
+	// AsmapChecksum identifies the asmap the buckets were computed with,
+	// it is empty when there was none.
+	AsmapChecksum string
 }
 
 type localAddress struct {
@@ -165,6 +177,23 @@ const (
 
 	// serialisationVersion is the current version of the on-disk format.
 	serialisationVersion = 1
+
+	// maxTriedCollisions is the most new addresses which may wait for a
+	// tried entry to be tested before taking its place.
+	maxTriedCollisions = 10
+
+	// replacementInterval is how recently a tried entry must have been
+	// connected to, or attempted, to count as tested when resolving a
+	// collision.
+	replacementInterval = 4 * time.Hour
+
+	// collisionTestWindow is how long a collision waits for its tried
+	// entry to be tested before the entry is evicted anyway.
+	collisionTestWindow = 40 * time.Minute
+
+	// failedTestDelay is how long after an attempt a tried entry which did
+	// not succeed is considered to have failed its test.
+	failedTestDelay = time.Minute
 )
 
 // updateAddress is a helper function to either update an address already known
@@ -314,8 +343,8 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 
 	data1 := []byte{}
 	data1 = append(data1, a.key[:]...)
-	data1 = append(data1, []byte(GroupKey(netAddr))...)
-	data1 = append(data1, []byte(GroupKey(srcAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(netAddr))...)
+	data1 = append(data1, []byte(a.GroupKey(srcAddr))...)
 	hash1 := util.DoubleSha256Bytes(data1)
 	hash64 := binary.LittleEndian.Uint64(hash1)
 	hash64 %= newBucketsPerGroup
@@ -323,7 +352,7 @@ func (a *AddrManager) getNewBucket(netAddr, srcAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(srcAddr)...)
+	data2 = append(data2, a.GroupKey(srcAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := util.DoubleSha256Bytes(data2)
@@ -343,7 +372,7 @@ func (a *AddrManager) getTriedBucket(netAddr *wire.NetAddress) int {
 	binary.LittleEndian.PutUint64(hashbuf[:], hash64)
 	data2 := []byte{}
 	data2 = append(data2, a.key[:]...)
-	data2 = append(data2, GroupKey(netAddr)...)
+	data2 = append(data2, a.GroupKey(netAddr)...)
 	data2 = append(data2, hashbuf[:]...)
 
 	hash2 := util.DoubleSha256Bytes(data2)
@@ -381,6 +410,7 @@ func (a *AddrManager) savePeers() {
 	sam := new(serializedAddrManager)
 	sam.Version = serialisationVersion
 	copy(sam.Key[:], a.key[:])
+	sam.AsmapChecksum = a.asmap.Checksum()
 
 	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
 	i := 0
@@ -492,6 +522,12 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		a.addrIndex[NetAddressKey(ka.na)] = ka
 	}
 
+	if sam.AsmapChecksum != a.asmap.Checksum() {
+		log.Info("The asmap changed, rebucketing the addresses of %s",
+			filePath)
+		return a.rebucket(&sam)
+	}
+
 	for i := range sam.NewBuckets {
 		for _, val := range sam.NewBuckets[i] {
 			ka, ok := a.addrIndex[val]
@@ -537,6 +573,45 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 	return nil
 }
 
+// rebucket places the deserialized addresses in the buckets computed with the
+// current asmap rather than the saved ones.  Tried addresses stay tried when
+// their bucket has room and are otherwise moved back to the new table, where
+// addresses without room are dropped.
+func (a *AddrManager) rebucket(sam *serializedAddrManager) error {
+	for i := range sam.TriedBuckets {
+		for _, val := range sam.TriedBuckets[i] {
+			ka, ok := a.addrIndex[val]
+			if !ok {
+				return fmt.Errorf("triedbucket contains %s but "+
+					"none in address list", val)
+			}
+
+			bucket := a.getTriedBucket(ka.na)
+			if ka.tried || a.addrTried[bucket].Len() >= triedBucketSize {
+				continue
+			}
+			ka.tried = true
+			a.nTried++
+			a.addrTried[bucket].PushBack(ka)
+		}
+	}
+
+	for k, ka := range a.addrIndex {
+		if ka.tried {
+			continue
+		}
+		bucket := a.getNewBucket(ka.na, ka.srcAddr)
+		if len(a.addrNew[bucket]) >= newBucketSize {
+			delete(a.addrIndex, k)
+			continue
+		}
+		ka.refs = 1
+		a.nNew++
+		a.addrNew[bucket][k] = ka
+	}
+	return nil
+}
+
 // UnserializeNetAddress converts a given address string to a *wire.NetAddress
 func (a *AddrManager) UnserializeNetAddress(addr string) (*wire.NetAddress, error) {
 	host, portStr, err := net.SplitHostPort(addr)
@@ -697,6 +772,7 @@ func (a *AddrManager) reset() {
 	for i := range a.addrTried {
 		a.addrTried[i] = list.New()
 	}
+	a.triedCollisions = make(map[string]*KnownAddress)
 }
 
 // HostToNetAddress returns a netaddress given a host address.  If the address
@@ -760,12 +836,28 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	if a.numAddresses() == 0 {
+	return a.getAddress(false)
+}
+
+// GetNewTableAddress returns a single address picked from the new table the
+// same way GetAddress does.  It returns nil if the new table is empty.  Feeler
+// connections use it to find out which new addresses are reachable.
+func (a *AddrManager) GetNewTableAddress() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.getAddress(true)
+}
+
+// getAddress picks an address from both tables or, when newOnly is set, from
+// the new table only.  It must be called with the mutex held.
+func (a *AddrManager) getAddress(newOnly bool) *KnownAddress {
+	if a.numAddresses() == 0 || (newOnly && a.nNew == 0) {
 		return nil
 	}
 
 	// Use a 50% chance for choosing between tried and new table entries.
-	if a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
+	if !newOnly && a.nTried > 0 && (a.nNew == 0 || a.rand.Intn(2) == 0) {
 		// Tried entry.
 		large := 1 << 30
 		factor := 1.0
@@ -868,11 +960,20 @@ func (a *AddrManager) Connected(addr *wire.NetAddress) {
 
 // Good marks the given address as good.  To be called after a successful
 // connection and version exchange.  If the address is unknown to the address
-// manager it will be ignored.
+// manager it will be ignored.  A new address whose tried bucket is full does
+// not evict an entry right away: it waits as a collision for the entry to be
+// tested, see ResolveCollisions.
 func (a *AddrManager) Good(addr *wire.NetAddress) {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
+	a.good(addr, true)
+}
+
+// good marks the given address as good, moving it to the tried table.  Unless
+// testBeforeEvict is false, a full tried bucket records a collision instead of
+// evicting one of its entries.  It must be called with the mutex held.
+func (a *AddrManager) good(addr *wire.NetAddress, testBeforeEvict bool) {
 	ka := a.find(addr)
 	if ka == nil {
 		return
@@ -890,11 +991,25 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 		return
 	}
 
+	addrKey := NetAddressKey(addr)
+	bucket := a.getTriedBucket(ka.na)
+	if testBeforeEvict && a.addrTried[bucket].Len() >= triedBucketSize {
+		if _, ok := a.triedCollisions[addrKey]; !ok &&
+			len(a.triedCollisions) < maxTriedCollisions {
+
+			log.Trace("Collision with %s while moving %s to tried",
+				NetAddressKey(a.pickTried(bucket).Value.(*KnownAddress).na),
+				addrKey)
+			a.triedCollisions[addrKey] = ka
+		}
+		return
+	}
+
 	// ok, need to move it to tried.
+	delete(a.triedCollisions, addrKey)
 
 	// remove from all new buckets.
 	// record one of the buckets in question and call it the `first'
-	addrKey := NetAddressKey(addr)
 	oldBucket := -1
 	for i := range a.addrNew {
 		// we check for existence so we can record the first one
@@ -913,8 +1028,6 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 		return
 	}
 
-	bucket := a.getTriedBucket(ka.na)
-
 	// Room in this tried bucket?
 	if a.addrTried[bucket].Len() < triedBucketSize {
 		ka.tried = true
@@ -955,6 +1068,76 @@ func (a *AddrManager) Good(addr *wire.NetAddress) {
 	a.addrNew[newBucket][rmkey] = rmka
 }
 
+// ResolveCollisions settles the collisions whose tried entry was tested.  An
+// entry which was connected to recently stays and the new address is dropped
+// from the collisions.  An entry which was attempted without success, or left
+// untested for longer than the test window, is evicted in favour of the new
+// address.  Other collisions keep waiting for their test.
+func (a *AddrManager) ResolveCollisions() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	now := time.Now()
+	for key, ka := range a.triedCollisions {
+		// The address may have been moved or expired meanwhile.
+		if ka.tried || a.addrIndex[key] != ka {
+			delete(a.triedCollisions, key)
+			continue
+		}
+
+		bucket := a.getTriedBucket(ka.na)
+		if a.addrTried[bucket].Len() < triedBucketSize {
+			a.good(ka.na, false)
+			continue
+		}
+
+		old := a.pickTried(bucket).Value.(*KnownAddress)
+		switch {
+		case now.Sub(old.lastsuccess) < replacementInterval:
+			// The tried entry is still good, keep it.
+			log.Trace("Keeping %s in tried over %s",
+				NetAddressKey(old.na), key)
+			delete(a.triedCollisions, key)
+
+		case now.Sub(old.lastattempt) < replacementInterval:
+			// The tried entry was tested and, once the attempt
+			// had time to complete, failed.
+			if now.Sub(old.lastattempt) > failedTestDelay {
+				a.good(ka.na, false)
+			}
+
+		case now.Sub(ka.lastsuccess) > collisionTestWindow:
+			// The tried entry could not be tested in time.
+			a.good(ka.na, false)
+		}
+	}
+}
+
+// SelectTriedCollision returns the tried entry a random collision would
+// evict, so that it may be tested with a feeler connection.  It returns nil
+// if there are no collisions.
+func (a *AddrManager) SelectTriedCollision() *KnownAddress {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if len(a.triedCollisions) == 0 {
+		return nil
+	}
+	nth := a.rand.Intn(len(a.triedCollisions))
+	for _, ka := range a.triedCollisions {
+		if nth > 0 {
+			nth--
+			continue
+		}
+		entry := a.pickTried(a.getTriedBucket(ka.na))
+		if entry == nil {
+			return nil
+		}
+		return entry.Value.(*KnownAddress)
+	}
+	return nil
+}
+
 // AddLocalAddress adds na to the list of known local addresses to advertise
 // with the given priority.
 func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPriority) error {
@@ -1065,7 +1248,7 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 // specified peers and actively avoid advertising and connecting to
 // discovered peers in order to prevent it from becoming a public test
 // network.
-func (a *AddrManager) NewAddress(filterOut func(gKey string) bool) (string, error) {
+func (a *AddrManager) NewAddress(filterOut func(na *wire.NetAddress, gKey string) bool) (string, error) {
 
 	if !conf.Cfg.AddrMgr.SimNet && len(conf.Cfg.AddrMgr.ConnectPeers) == 0 {
 		for tries := 0; tries < 100; tries++ {
@@ -1079,10 +1262,11 @@ func (a *AddrManager) NewAddress(filterOut func(gKey string) bool) (string, erro
 			// Just check that we don't already have an address
 			// in the same group so that we are not connecting
 			// to the same network segment at the expense of
-			// others.
-			key := GroupKey(addr.NetAddress())
+			// others, and that the caller does not otherwise
+			// object to it.
+			key := a.GroupKey(addr.NetAddress())
 
-			if filterOut(key) {
+			if filterOut(addr.NetAddress(), key) {
 				continue
 			}
 
@@ -1159,6 +1343,29 @@ func (a *AddrManager) GetAllLocalAddress() []LocalAddressInfo {
 	return localAddressesInfo
 }
 
+// SetAsmap makes the address manager group addresses by the autonomous system
+// the passed map assigns them, see GroupKey.  It must be called before Start.
+func (a *AddrManager) SetAsmap(asmap *Asmap) {
+	a.asmap = asmap
+}
+
+// MappedAS returns the number of the autonomous system of the address, or 0
+// if there is no asmap or the address is not mapped.
+func (a *AddrManager) MappedAS(na *wire.NetAddress) uint32 {
+	return a.asmap.MappedAS(na)
+}
+
+// GroupKey returns a string representing the network group an address is part
+// of.  With an asmap, addresses mapped to an autonomous system are grouped by
+// it as "AS" followed by its number.  The package level GroupKey is used
+// otherwise.
+func (a *AddrManager) GroupKey(na *wire.NetAddress) string {
+	if asn := a.asmap.MappedAS(na); asn != 0 {
+		return fmt.Sprintf("AS%d", asn)
+	}
+	return GroupKey(na)
+}
+
 // New returns a new bitcoin address manager.
 // Use Start to begin processing asynchronous address updates.
 func New(dataDir string, lookupFunc func(string) ([]net.IP, error)) *AddrManager {
@@ -434,6 +434,126 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+func TestGetNewTableAddress(t *testing.T) {
+	n := addrmgr.New("testgetnewtableaddress", lookupFunc)
+	if rv := n.GetNewTableAddress(); rv != nil {
+		t.Errorf("GetNewTableAddress failed: got: %v want: %v\n", rv, nil)
+	}
+
+	err := n.AddAddressByIP(someIP + ":8333")
+	if err != nil {
+		t.Fatalf("Adding address failed: %v", err)
+	}
+	ka := n.GetNewTableAddress()
+	if ka == nil {
+		t.Fatalf("Did not get an address where there is one in the new table")
+	}
+
+	// Tried addresses are never returned.
+	n.Good(ka.NetAddress())
+	if rv := n.GetNewTableAddress(); rv != nil {
+		t.Errorf("GetNewTableAddress failed: got: %v want: %v\n", rv, nil)
+	}
+}
+
+// addUntilCollision adds addresses of a single group, marking each one good,
+// until a new tried collision shows up.  It returns the colliding address.
+func addUntilCollision(t *testing.T, n *addrmgr.AddrManager, next *int) *wire.NetAddress {
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	collisions := addrmgr.TstNumTriedCollisions(n)
+	for ; *next < 1<<16; *next++ {
+		s := fmt.Sprintf("60.173.%d.%d:8333", *next/256, *next%256)
+		addr, err := n.UnserializeNetAddress(s)
+		if err != nil {
+			t.Fatalf("Failed to turn %s into an address: %v", s, err)
+		}
+		n.AddAddress(addr, srcAddr)
+		n.Good(addr)
+		if addrmgr.TstNumTriedCollisions(n) > collisions {
+			*next++
+			return addr
+		}
+	}
+	t.Fatalf("No tried collision after %d addresses", *next)
+	return nil
+}
+
+func TestTriedCollisions(t *testing.T) {
+	n := addrmgr.New("testtriedcollisions", lookupFunc)
+	if ka := n.SelectTriedCollision(); ka != nil {
+		t.Errorf("SelectTriedCollision: got %v, want nil", ka)
+	}
+
+	// A full tried bucket does not evict anything right away.
+	next := 0
+	addr := addUntilCollision(t, n, &next)
+	if addrmgr.TstIsTried(n, addr) {
+		t.Errorf("Colliding address %v was moved to tried", addr)
+	}
+	old := n.SelectTriedCollision()
+	if old == nil || !addrmgr.TstIsTried(n, old.NetAddress()) {
+		t.Fatalf("SelectTriedCollision: got %v, want a tried address", old)
+	}
+
+	// A tried entry which was recently connected to stays.
+	n.ResolveCollisions()
+	if addrmgr.TstNumTriedCollisions(n) != 0 || addrmgr.TstIsTried(n, addr) {
+		t.Errorf("Collision with a good tried entry was not dropped")
+	}
+
+	// A tried entry which fails its test is evicted once the attempt had
+	// time to complete.
+	n.Good(addr)
+	if addrmgr.TstNumTriedCollisions(n) != 1 {
+		t.Fatalf("Colliding address %v was not recorded again", addr)
+	}
+	now := time.Now()
+	addrmgr.TstSetLastAttemptAndSuccess(n, old.NetAddress(),
+		now.Add(-30*time.Second), now.Add(-5*time.Hour))
+	n.ResolveCollisions()
+	if addrmgr.TstNumTriedCollisions(n) != 1 {
+		t.Errorf("Collision was resolved while its test was in progress")
+	}
+	addrmgr.TstSetLastAttemptAndSuccess(n, old.NetAddress(),
+		now.Add(-2*time.Minute), now.Add(-5*time.Hour))
+	n.ResolveCollisions()
+	if addrmgr.TstNumTriedCollisions(n) != 0 || !addrmgr.TstIsTried(n, addr) ||
+		addrmgr.TstIsTried(n, old.NetAddress()) {
+		t.Errorf("Tried entry %v which failed its test was not evicted", old)
+	}
+
+	// An untested tried entry is evicted after the test window.
+	addr = addUntilCollision(t, n, &next)
+	old = n.SelectTriedCollision()
+	addrmgr.TstSetLastAttemptAndSuccess(n, old.NetAddress(),
+		now.Add(-5*time.Hour), now.Add(-5*time.Hour))
+	n.ResolveCollisions()
+	if addrmgr.TstIsTried(n, addr) {
+		t.Errorf("Collision was resolved before the test window")
+	}
+	addrmgr.TstSetLastAttemptAndSuccess(n, addr, now, now.Add(-41*time.Minute))
+	n.ResolveCollisions()
+	if !addrmgr.TstIsTried(n, addr) || addrmgr.TstIsTried(n, old.NetAddress()) {
+		t.Errorf("Untested tried entry %v was not evicted", old)
+	}
+
+	// Collisions are bounded.
+	for i := 0; i < 20; i++ {
+		n.Good(addUntilCollision(t, n, &next))
+		if addrmgr.TstNumTriedCollisions(n) == 10 {
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		addr, _ := n.UnserializeNetAddress(fmt.Sprintf("60.173.255.%d:8333", i))
+		n.AddAddress(addr, addr)
+		n.Good(addr)
+	}
+	if got := addrmgr.TstNumTriedCollisions(n); got != 10 {
+		t.Errorf("Number of tried collisions: got %d, want %d", got, 10)
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []wire.NetAddress{
 		{IP: net.ParseIP("192.168.0.100")},
@@ -586,7 +706,7 @@ func TestNewAddress(t *testing.T) {
 
 	conf.Cfg = conf.InitConfig(nil)
 	for i := 0; i < 100; i++ {
-		addr, err := amgr.NewAddress(func(s string) bool {
+		addr, err := amgr.NewAddress(func(na *wire.NetAddress, s string) bool {
 			ret := []bool{true, false}
 			return ret[rand.Intn(2)]
 		})
@@ -0,0 +1,334 @@
+package addrmgr
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"net"
+
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/util"
+)
+
+// asmapInvalid is returned by the decoders when the map ends in the middle
+// of a value.
+const asmapInvalid = 0xffffffff
+
+// The instructions of the asmap bytecode.
+const (
+	asmapReturn = iota
+	asmapJump
+	asmapMatch
+	asmapDefault
+)
+
+// The sizes of the exponent classes in which the operands of the asmap
+// bytecode are encoded.
+var (
+	asmapTypeBitSizes  = []uint8{0, 0, 1}
+	asmapASNBitSizes   = []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24}
+	asmapMatchBitSizes = []uint8{1, 2, 3, 4, 5, 6, 7, 8}
+	asmapJumpBitSizes  = []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16,
+		17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30}
+)
+
+// ErrInvalidAsmap describes an error where an asmap does not decode to a
+// well formed program.
+var ErrInvalidAsmap = errors.New("invalid asmap")
+
+// Asmap maps IP addresses to the number of the autonomous system announcing
+// them.  It is stored in the compressed format of the asmap files produced for
+// bitcoind: a bytecode, read least significant bit first, which walks the bits
+// of an IPv6 address and returns an AS number.
+type Asmap struct {
+	data     []byte
+	checksum string
+}
+
+// DecodeAsmap checks that data holds a well formed asmap and returns it.
+func DecodeAsmap(data []byte) (*Asmap, error) {
+	m := &Asmap{data: data}
+	if !m.sanityCheck(128) {
+		return nil, ErrInvalidAsmap
+	}
+	m.checksum = hex.EncodeToString(util.DoubleSha256Bytes(data))
+	return m, nil
+}
+
+// LoadAsmap reads the asmap file at path.
+func LoadAsmap(path string) (*Asmap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeAsmap(data)
+}
+
+// Checksum returns a string identifying the content of the map.  It changes
+// whenever the map does, and is empty for a nil map.
+func (m *Asmap) Checksum() string {
+	if m == nil {
+		return ""
+	}
+	return m.checksum
+}
+
+// MappedAS returns the number of the autonomous system of the address, or 0
+// if it is not mapped.  Only IPv4 and IPv6 addresses are mapped; IPv6 ones
+// which tunnel an IPv4 address are mapped through it.
+func (m *Asmap) MappedAS(na *wire.NetAddress) uint32 {
+	if m == nil || IsLocal(na) || !IsRoutable(na) || IsOnionCatTor(na) {
+		return 0
+	}
+	ip := na.IP.To16()
+	if ip4 := linkedIPv4(na); ip4 != nil {
+		ip = ip4.To16()
+	}
+	return m.interpret(ip)
+}
+
+// linkedIPv4 returns the IPv4 address an IPv6 address tunnels, if any.
+func linkedIPv4(na *wire.NetAddress) net.IP {
+	switch {
+	case IsIPv4(na):
+		return na.IP.To4()
+	case IsRFC6145(na) || IsRFC6052(na):
+		return net.IP(na.IP[12:16])
+	case IsRFC3964(na):
+		return net.IP(na.IP[2:6])
+	case IsRFC4380(na):
+		ip := make(net.IP, 4)
+		for i, b := range na.IP[12:16] {
+			ip[i] = b ^ 0xff
+		}
+		return ip
+	}
+	return nil
+}
+
+// bit returns the bit at position pos of the map.
+func (m *Asmap) bit(pos int) uint32 {
+	return uint32(m.data[pos/8]>>uint(pos%8)) & 1
+}
+
+// end returns the position just past the last bit of the map.
+func (m *Asmap) end() int {
+	return len(m.data) * 8
+}
+
+// decodeBits decodes the value at *pos encoded with the given exponent
+// classes, advancing *pos past it.  Each class but the last is preceded by a
+// bit telling whether the value lies beyond it.
+func (m *Asmap) decodeBits(pos *int, minval uint32, bitSizes []uint8) uint32 {
+	val := minval
+	for i, size := range bitSizes {
+		var more uint32
+		if i+1 != len(bitSizes) {
+			if *pos == m.end() {
+				break
+			}
+			more = m.bit(*pos)
+			*pos++
+		}
+		if more == 1 {
+			val += 1 << size
+			continue
+		}
+		for b := uint8(0); b < size; b++ {
+			if *pos == m.end() {
+				// The mantissa straddles the end.
+				return asmapInvalid
+			}
+			val += m.bit(*pos) << (size - 1 - b)
+			*pos++
+		}
+		return val
+	}
+	// The exponent straddles the end.
+	return asmapInvalid
+}
+
+func (m *Asmap) decodeType(pos *int) uint32 {
+	return m.decodeBits(pos, 0, asmapTypeBitSizes)
+}
+
+func (m *Asmap) decodeASN(pos *int) uint32 {
+	return m.decodeBits(pos, 1, asmapASNBitSizes)
+}
+
+func (m *Asmap) decodeMatch(pos *int) uint32 {
+	return m.decodeBits(pos, 2, asmapMatchBitSizes)
+}
+
+func (m *Asmap) decodeJump(pos *int) uint32 {
+	return m.decodeBits(pos, 17, asmapJumpBitSizes)
+}
+
+// interpret runs the map on the 128 bits of ip, most significant bit first.
+// The map must have passed sanityCheck.
+func (m *Asmap) interpret(ip net.IP) uint32 {
+	ipBit := func(i int) uint32 {
+		return uint32(ip[i/8]>>uint(7-i%8)) & 1
+	}
+
+	pos := 0
+	left := len(ip) * 8
+	var defaultASN uint32
+	for pos != m.end() {
+		switch m.decodeType(&pos) {
+		case asmapReturn:
+			asn := m.decodeASN(&pos)
+			if asn == asmapInvalid {
+				return 0
+			}
+			return asn
+
+		case asmapJump:
+			jump := m.decodeJump(&pos)
+			if jump == asmapInvalid || left == 0 ||
+				int64(jump) >= int64(m.end()-pos) {
+				return 0
+			}
+			if ipBit(len(ip)*8-left) == 1 {
+				pos += int(jump)
+			}
+			left--
+
+		case asmapMatch:
+			match := m.decodeMatch(&pos)
+			if match == asmapInvalid {
+				return 0
+			}
+			matchLen := bits.Len32(match) - 1
+			if left < matchLen {
+				return 0
+			}
+			for b := 0; b < matchLen; b++ {
+				if ipBit(len(ip)*8-left) != (match>>uint(matchLen-1-b))&1 {
+					return defaultASN
+				}
+				left--
+			}
+
+		case asmapDefault:
+			defaultASN = m.decodeASN(&pos)
+			if defaultASN == asmapInvalid {
+				return 0
+			}
+
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// sanityCheck returns whether every path through the map consumes at most
+// the given number of input bits and ends with a return, so that interpret
+// always completes.
+func (m *Asmap) sanityCheck(inputBits int) bool {
+	// jumps are the positions we may still jump to along with the number
+	// of input bits left after the jump, the nearest one last.
+	type jumpTarget struct {
+		pos  int
+		left int
+	}
+	var jumps []jumpTarget
+
+	pos := 0
+	prevOp := uint32(asmapJump)
+	hadIncompleteMatch := false
+	for pos != m.end() {
+		if len(jumps) > 0 && pos >= jumps[len(jumps)-1].pos {
+			// A jump lands in the middle of the previous
+			// instruction.
+			return false
+		}
+		switch op := m.decodeType(&pos); op {
+		case asmapReturn:
+			if prevOp == asmapDefault {
+				// A default followed by a return is a longer
+				// return.
+				return false
+			}
+			if m.decodeASN(&pos) == asmapInvalid {
+				return false
+			}
+			if len(jumps) == 0 {
+				// Nothing is left to run: only up to seven zero
+				// padding bits may follow.
+				if m.end()-pos > 7 {
+					return false
+				}
+				for ; pos != m.end(); pos++ {
+					if m.bit(pos) != 0 {
+						return false
+					}
+				}
+				return true
+			}
+			// Carry on as if the nearest jump was taken.
+			next := jumps[len(jumps)-1]
+			if pos != next.pos {
+				// Unreachable code.
+				return false
+			}
+			inputBits = next.left
+			jumps = jumps[:len(jumps)-1]
+			prevOp = asmapJump
+
+		case asmapJump:
+			jump := m.decodeJump(&pos)
+			if jump == asmapInvalid || int64(jump) > int64(m.end()-pos) ||
+				inputBits == 0 {
+				return false
+			}
+			inputBits--
+			target := pos + int(jump)
+			if len(jumps) > 0 && target >= jumps[len(jumps)-1].pos {
+				// Intersecting jumps.
+				return false
+			}
+			jumps = append(jumps, jumpTarget{pos: target, left: inputBits})
+			prevOp = asmapJump
+
+		case asmapMatch:
+			match := m.decodeMatch(&pos)
+			if match == asmapInvalid {
+				return false
+			}
+			matchLen := bits.Len32(match) - 1
+			if prevOp != asmapMatch {
+				hadIncompleteMatch = false
+			}
+			// Within a sequence of matches at most one may be
+			// shorter than a byte.
+			if matchLen < 8 && hadIncompleteMatch {
+				return false
+			}
+			hadIncompleteMatch = matchLen < 8
+			if inputBits < matchLen {
+				return false
+			}
+			inputBits -= matchLen
+			prevOp = asmapMatch
+
+		case asmapDefault:
+			if prevOp == asmapDefault {
+				// Two successive defaults could be one.
+				return false
+			}
+			if m.decodeASN(&pos) == asmapInvalid {
+				return false
+			}
+			prevOp = asmapDefault
+
+		default:
+			// The instruction straddles the end.
+			return false
+		}
+	}
+	// The end is reached without a return.
+	return false
+}
@@ -0,0 +1,251 @@
+package addrmgr_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/wire"
+)
+
+// asmapWriter assembles asmap bytecode, least significant bit first.
+type asmapWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *asmapWriter) writeBit(bit uint32) {
+	if w.bits%8 == 0 {
+		w.data = append(w.data, 0)
+	}
+	w.data[w.bits/8] |= byte(bit&1) << uint(w.bits%8)
+	w.bits++
+}
+
+func (w *asmapWriter) writeBits(val, minval uint32, bitSizes []uint8) {
+	val -= minval
+	for i, size := range bitSizes {
+		if i+1 != len(bitSizes) {
+			if val >= 1<<size {
+				w.writeBit(1)
+				val -= 1 << size
+				continue
+			}
+			w.writeBit(0)
+		}
+		for b := int(size) - 1; b >= 0; b-- {
+			w.writeBit(val >> uint(b))
+		}
+		return
+	}
+}
+
+func (w *asmapWriter) writeReturn(asn uint32) {
+	w.writeBit(0)
+	w.writeBits(asn, 1, []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24})
+}
+
+func (w *asmapWriter) writeJump(offset uint32) {
+	w.writeBit(1)
+	w.writeBit(0)
+	w.writeBits(offset, 17, []uint8{5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30})
+}
+
+func (w *asmapWriter) writeMatch(b byte) {
+	w.writeBit(1)
+	w.writeBit(1)
+	w.writeBit(0)
+	w.writeBits(0x100|uint32(b), 2, []uint8{1, 2, 3, 4, 5, 6, 7, 8})
+}
+
+func (w *asmapWriter) writeDefault(asn uint32) {
+	w.writeBit(1)
+	w.writeBit(1)
+	w.writeBit(1)
+	w.writeBits(asn, 1, []uint8{15, 16, 17, 18, 19, 20, 21, 22, 23, 24})
+}
+
+// testAsmap returns a map assigning IPv4 addresses below 128.0.0.0 to AS 100,
+// the other IPv4 addresses to AS 200 and IPv6 addresses to AS 300.
+func testAsmap() []byte {
+	w := &asmapWriter{}
+	w.writeDefault(300)
+	for _, b := range net.IPv4(0, 0, 0, 0)[:12] {
+		w.writeMatch(b)
+	}
+	// A return of AS 100 takes 17 bits.
+	w.writeJump(17)
+	w.writeReturn(100)
+	w.writeReturn(200)
+	return w.data
+}
+
+func TestDecodeAsmap(t *testing.T) {
+	data := testAsmap()
+	if _, err := addrmgr.DecodeAsmap(data); err != nil {
+		t.Fatalf("DecodeAsmap: unexpected error %v", err)
+	}
+
+	invalid := [][]byte{
+		nil,
+		{0xff},
+		data[:len(data)-2],
+		append(append([]byte{}, data...), 0x01),
+		append(append([]byte{}, data...), 0x00),
+	}
+	for i, data := range invalid {
+		if _, err := addrmgr.DecodeAsmap(data); err != addrmgr.ErrInvalidAsmap {
+			t.Errorf("DecodeAsmap #%d: got %v, want %v", i, err,
+				addrmgr.ErrInvalidAsmap)
+		}
+	}
+
+	// The checksum follows the content.
+	m1, _ := addrmgr.DecodeAsmap(testAsmap())
+	w := &asmapWriter{}
+	w.writeReturn(1)
+	m2, err := addrmgr.DecodeAsmap(w.data)
+	if err != nil {
+		t.Fatalf("DecodeAsmap: unexpected error %v", err)
+	}
+	if m1.Checksum() == "" || m1.Checksum() == m2.Checksum() {
+		t.Errorf("Checksum: got %q and %q", m1.Checksum(), m2.Checksum())
+	}
+	var nilMap *addrmgr.Asmap
+	if nilMap.Checksum() != "" {
+		t.Errorf("Checksum of nil map: got %q", nilMap.Checksum())
+	}
+}
+
+func TestMappedAS(t *testing.T) {
+	m, err := addrmgr.DecodeAsmap(testAsmap())
+	if err != nil {
+		t.Fatalf("DecodeAsmap: unexpected error %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want uint32
+	}{
+		{"12.1.2.3", 100},
+		{"127.255.1.1", 0}, // local
+		{"173.194.115.66", 200},
+		{"10.1.2.3", 0}, // unroutable
+		{"2600:1000::1", 300},
+		{"2002:ad12:0101::1", 200},                    // 6to4 of 173.18.1.1
+		{"2001:0:4136:e378:8000:63bf:f3f5:feff", 100}, // teredo of 12.10.1.0
+		{"fd87:d87e:eb43::1", 0},                      // tor
+	}
+	for _, test := range tests {
+		na := wire.NewNetAddressIPPort(net.ParseIP(test.ip), 8333, 0)
+		if got := m.MappedAS(na); got != test.want {
+			t.Errorf("MappedAS(%s): got %d, want %d", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestGroupKeyAsmap(t *testing.T) {
+	n := addrmgr.New("testgroupkeyasmap", lookupFunc)
+	na := wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333, 0)
+	if got := n.GroupKey(na); got != addrmgr.GroupKey(na) {
+		t.Errorf("GroupKey without asmap: got %s, want %s", got,
+			addrmgr.GroupKey(na))
+	}
+	if got := n.MappedAS(na); got != 0 {
+		t.Errorf("MappedAS without asmap: got %d, want 0", got)
+	}
+
+	m, _ := addrmgr.DecodeAsmap(testAsmap())
+	n.SetAsmap(m)
+	if got := n.GroupKey(na); got != "AS100" {
+		t.Errorf("GroupKey with asmap: got %s, want AS100", got)
+	}
+	tor := wire.NewNetAddressIPPort(net.ParseIP("fd87:d87e:eb43::1"), 8333, 0)
+	if got := n.GroupKey(tor); got != addrmgr.GroupKey(tor) {
+		t.Errorf("GroupKey of unmapped address: got %s, want %s", got,
+			addrmgr.GroupKey(tor))
+	}
+}
+
+// readPeersFile returns the asmap checksum saved in the peers file of dir
+// along with the number of non empty new buckets and of tried addresses.
+func readPeersFile(t *testing.T, dir string) (string, int, int) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "peers.json"))
+	if err != nil {
+		t.Fatalf("Cannot read peers file: %v", err)
+	}
+	var sam struct {
+		AsmapChecksum string
+		NewBuckets    [][]string
+		TriedBuckets  [][]string
+	}
+	if err := json.Unmarshal(data, &sam); err != nil {
+		t.Fatalf("Cannot decode peers file: %v", err)
+	}
+	newBuckets, tried := 0, 0
+	for _, bucket := range sam.NewBuckets {
+		if len(bucket) != 0 {
+			newBuckets++
+		}
+	}
+	for _, bucket := range sam.TriedBuckets {
+		tried += len(bucket)
+	}
+	return sam.AsmapChecksum, newBuckets, tried
+}
+
+func TestAsmapRebucket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asmaprebucket")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Addresses of distinct /16 end up in distinct new buckets.
+	n := addrmgr.New(dir, lookupFunc)
+	n.Start()
+	srcAddr := wire.NewNetAddressIPPort(net.IPv4(173, 144, 173, 111), 8333, 0)
+	for i := 0; i < 10; i++ {
+		addr := wire.NewNetAddressIPPort(net.IPv4(12, byte(i), 1, 1), 8333, 0)
+		n.AddAddress(addr, srcAddr)
+	}
+	good := wire.NewNetAddressIPPort(net.IPv4(173, 18, 1, 1), 8333, 0)
+	n.AddAddress(good, srcAddr)
+	n.Good(good)
+	n.Stop()
+	checksum, newBuckets, tried := readPeersFile(t, dir)
+	if checksum != "" || newBuckets < 2 || tried != 1 {
+		t.Fatalf("Peers file without asmap: got checksum %q, %d new "+
+			"buckets, %d tried", checksum, newBuckets, tried)
+	}
+
+	// With an asmap they all belong to the same AS, hence bucket.
+	m, _ := addrmgr.DecodeAsmap(testAsmap())
+	n = addrmgr.New(dir, lookupFunc)
+	n.SetAsmap(m)
+	n.Start()
+	if got := n.NumAddresses(); got != 11 {
+		t.Errorf("Number of addresses after rebucketing: got %d, want 11", got)
+	}
+	n.Stop()
+	checksum, newBuckets, tried = readPeersFile(t, dir)
+	if checksum != m.Checksum() || newBuckets != 1 || tried != 1 {
+		t.Errorf("Peers file with asmap: got checksum %q, %d new "+
+			"buckets, %d tried", checksum, newBuckets, tried)
+	}
+
+	// Going back to no asmap rebuckets again.
+	n = addrmgr.New(dir, lookupFunc)
+	n.Start()
+	n.Stop()
+	if checksum, newBuckets, _ = readPeersFile(t, dir); checksum != "" ||
+		newBuckets < 2 {
+		t.Errorf("Peers file without asmap: got checksum %q, %d new "+
+			"buckets", checksum, newBuckets)
+	}
+}
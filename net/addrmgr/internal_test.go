@@ -23,3 +23,25 @@ func TstNewKnownAddress(na *wire.NetAddress, attempts int,
 	return &KnownAddress{na: na, attempts: attempts, lastattempt: lastattempt,
 		lastsuccess: lastsuccess, tried: tried, refs: refs}
 }
+
+func TstNumTriedCollisions(a *AddrManager) int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return len(a.triedCollisions)
+}
+
+func TstIsTried(a *AddrManager, na *wire.NetAddress) bool {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	ka := a.find(na)
+	return ka != nil && ka.tried
+}
+
+func TstSetLastAttemptAndSuccess(a *AddrManager, na *wire.NetAddress,
+	lastattempt, lastsuccess time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	ka := a.find(na)
+	ka.lastattempt = lastattempt
+	ka.lastsuccess = lastsuccess
+}
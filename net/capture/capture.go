@@ -0,0 +1,218 @@
+// Package capture records the messages exchanged with peers and reads them
+// back.
+//
+// A capture file holds the messages exchanged with a single peer, in the
+// order they were sent or received.  Each record is made of the time of the
+// message in microseconds since the epoch (int64, little endian), its
+// direction (one byte), the protocol version it was encoded with (uint32,
+// little endian) and the message itself, header included, as it was sent or
+// received.  Messages which could not be decoded are recorded as well.
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/copernet/copernicus/net/wire"
+)
+
+// Direction tells whether a message was sent to or received from the peer.
+type Direction uint8
+
+const (
+	// Received is the direction of the messages sent by the peer.
+	Received Direction = iota
+
+	// Sent is the direction of the messages sent to the peer.
+	Sent
+)
+
+// String returns the direction in human-readable form.
+func (d Direction) String() string {
+	switch d {
+	case Received:
+		return "recv"
+	case Sent:
+		return "sent"
+	}
+	return fmt.Sprintf("Direction(%d)", uint8(d))
+}
+
+// recordHeaderSize is the size of the fields preceding the message of a
+// record.
+const recordHeaderSize = 8 + 1 + 4
+
+// FileSuffix is the file name extension of capture files.
+const FileSuffix = ".dat"
+
+// Record is a captured message.
+type Record struct {
+	Time            time.Time
+	Direction       Direction
+	ProtocolVersion uint32
+
+	// Command is the command of the message header.
+	Command string
+
+	// Raw is the message as it was sent or received, header included.
+	Raw []byte
+
+	// Msg is the decoded message.  It is nil if the message could not be
+	// decoded, in which case DecodeErr tells why.
+	Msg       wire.Message
+	DecodeErr error
+
+	// Size is the size of the message on the wire, header included.
+	Size int
+}
+
+// maxPayloadSize bounds the payload size of the records read so that a
+// corrupted capture does not exhaust the memory.
+const maxPayloadSize = 2 * wire.MaxMessagePayload
+
+// FileName returns the name of the capture file of the peer at addr.
+func FileName(addr string) string {
+	r := strings.NewReplacer(":", "_", "[", "", "]", "", "/", "_")
+	return r.Replace(addr) + FileSuffix
+}
+
+// Writer appends the messages exchanged with a peer to its capture file.  It
+// is safe for concurrent access.
+type Writer struct {
+	mtx    sync.Mutex
+	w      io.WriteCloser
+	btcnet wire.BitcoinNet
+}
+
+// NewWriter returns a Writer recording the messages of the given network to
+// w.
+func NewWriter(w io.WriteCloser, btcnet wire.BitcoinNet) *Writer {
+	return &Writer{w: w, btcnet: btcnet}
+}
+
+// Create opens the capture file of the peer at addr in dir, creating both as
+// needed.  Messages of later connections to the same peer are appended to the
+// same file.
+func Create(dir, addr string, btcnet wire.BitcoinNet) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, FileName(addr)),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriter(f, btcnet), nil
+}
+
+// Write records msg, encoded with protocol version pver, as exchanged at t in
+// the given direction.
+func (w *Writer) Write(t time.Time, dir Direction, pver uint32, msg wire.Message) error {
+	var buf bytes.Buffer
+	if err := wire.WriteMessage(&buf, msg, pver, w.btcnet); err != nil {
+		return err
+	}
+	return w.WriteRaw(t, dir, pver, buf.Bytes())
+}
+
+// WriteRaw records the message raw, header included, as exchanged at t in the
+// given direction with protocol version pver.  The message does not need to
+// decode, but it must be complete.
+func (w *Writer) WriteRaw(t time.Time, dir Direction, pver uint32, raw []byte) error {
+	if len(raw) < wire.MessageHeaderSize {
+		return fmt.Errorf("message header truncated to %d bytes", len(raw))
+	}
+	length := binary.LittleEndian.Uint32(raw[16:20])
+	if uint64(len(raw)) != wire.MessageHeaderSize+uint64(length) {
+		return fmt.Errorf("message of %d bytes, header indicates %d",
+			len(raw), wire.MessageHeaderSize+uint64(length))
+	}
+
+	buf := make([]byte, 0, recordHeaderSize+len(raw))
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(t.UnixNano()/int64(time.Microsecond)))
+	header[8] = byte(dir)
+	binary.LittleEndian.PutUint32(header[9:13], pver)
+	buf = append(buf, header[:]...)
+	buf = append(buf, raw...)
+
+	// A record is written at once so that concurrent writers do not
+	// interleave.
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// Close closes the underlying file.
+func (w *Writer) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.w.Close()
+}
+
+// Reader reads the records of a capture file.
+type Reader struct {
+	r      io.Reader
+	btcnet wire.BitcoinNet
+}
+
+// NewReader returns a Reader of the capture of a peer of the given network.
+func NewReader(r io.Reader, btcnet wire.BitcoinNet) *Reader {
+	return &Reader{r: r, btcnet: btcnet}
+}
+
+// Next returns the next record.  It returns io.EOF at the end of the capture
+// and io.ErrUnexpectedEOF if it ends in the middle of a record.
+func (r *Reader) Next() (*Record, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return nil, err
+	}
+	micros := int64(binary.LittleEndian.Uint64(header[0:8]))
+	rec := &Record{
+		Time:            time.Unix(0, micros*int64(time.Microsecond)),
+		Direction:       Direction(header[8]),
+		ProtocolVersion: binary.LittleEndian.Uint32(header[9:13]),
+	}
+	if rec.Direction != Received && rec.Direction != Sent {
+		return nil, fmt.Errorf("invalid direction %d", header[8])
+	}
+
+	raw := make([]byte, wire.MessageHeaderSize)
+	if _, err := io.ReadFull(r.r, raw); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	length := binary.LittleEndian.Uint32(raw[16:20])
+	if length > maxPayloadSize {
+		return nil, fmt.Errorf("message payload of %d bytes is too large", length)
+	}
+	raw = append(raw, make([]byte, length)...)
+	if _, err := io.ReadFull(r.r, raw[wire.MessageHeaderSize:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	rec.Command = string(bytes.TrimRight(raw[4:4+wire.CommandSize], "\x00"))
+	rec.Raw = raw
+	rec.Size = len(raw)
+
+	// The record is kept whether or not its message decodes.
+	_, rec.Msg, _, rec.DecodeErr = wire.ReadMessageN(bytes.NewReader(raw),
+		rec.ProtocolVersion, r.btcnet)
+	return rec, nil
+}
+
+// unexpectedEOF turns io.EOF, which only ends a capture between records, into
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
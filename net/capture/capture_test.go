@@ -0,0 +1,142 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestWriteRead(t *testing.T) {
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+	var buf bytes.Buffer
+	w := NewWriter(nopCloser{&buf}, wire.TestNet3)
+
+	now := time.Unix(1500000000, 123456000)
+	assert.Nil(t, w.Write(now, Sent, wire.ProtocolVersion, wire.NewMsgPing(42)))
+	assert.Nil(t, w.Write(now.Add(time.Second), Received,
+		wire.ProtocolVersion, wire.NewMsgPong(42)))
+
+	r := NewReader(bytes.NewReader(buf.Bytes()), wire.TestNet3)
+	rec, err := r.Next()
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(rec.Time))
+	assert.Equal(t, Sent, rec.Direction)
+	assert.Equal(t, uint32(wire.ProtocolVersion), rec.ProtocolVersion)
+	assert.Equal(t, wire.NewMsgPing(42), rec.Msg)
+	assert.Nil(t, rec.DecodeErr)
+	assert.Equal(t, wire.CmdPing, rec.Command)
+	assert.Equal(t, wire.MessageHeaderSize+8, rec.Size)
+
+	rec, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, Received, rec.Direction)
+	assert.Equal(t, wire.NewMsgPong(42), rec.Msg)
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// Truncated records are reported.
+	r = NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), wire.TestNet3)
+	_, err = r.Next()
+	assert.Nil(t, err)
+	_, err = r.Next()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	r = NewReader(bytes.NewReader(buf.Bytes()[:recordHeaderSize]), wire.TestNet3)
+	_, err = r.Next()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestCreate(t *testing.T) {
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+	dir, err := ioutil.TempDir("", "capture")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, "2001_db8__1_8333.dat", FileName("[2001:db8::1]:8333"))
+
+	// Later connections append to the file of the peer.
+	for i := 0; i < 2; i++ {
+		w, err := Create(filepath.Join(dir, "capture"), "10.0.0.1:8333", wire.TestNet3)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Write(time.Now(), Sent, wire.ProtocolVersion,
+			wire.NewMsgPing(uint64(i))))
+		assert.Nil(t, w.Close())
+	}
+
+	f, err := os.Open(filepath.Join(dir, "capture", "10.0.0.1_8333.dat"))
+	assert.Nil(t, err)
+	defer f.Close()
+	r := NewReader(f, wire.TestNet3)
+	for i := 0; i < 2; i++ {
+		rec, err := r.Next()
+		assert.Nil(t, err)
+		assert.Equal(t, wire.NewMsgPing(uint64(i)), rec.Msg)
+	}
+}
+
+// frame returns the message of the given command and payload as sent on the
+// wire.
+func frame(btcnet wire.BitcoinNet, command string, payload []byte) []byte {
+	var buf bytes.Buffer
+	var header [wire.MessageHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(btcnet))
+	copy(header[4:4+wire.CommandSize], command)
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(payload)))
+	copy(header[20:24], util.DoubleSha256Bytes(payload)[0:4])
+	buf.Write(header[:])
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestWriteRawUndecodable(t *testing.T) {
+	conf.Cfg = &conf.Configuration{Excessiveblocksize: consensus.DefaultMaxBlockSize}
+	var buf bytes.Buffer
+	w := NewWriter(nopCloser{&buf}, wire.TestNet3)
+
+	// Messages are recorded as received, whether or not they decode.
+	shortPing := frame(wire.TestNet3, wire.CmdPing, []byte{1, 2})
+	unknown := frame(wire.TestNet3, "unknown", []byte{1, 2, 3})
+	now := time.Now()
+	assert.Nil(t, w.WriteRaw(now, Received, wire.ProtocolVersion, shortPing))
+	assert.Nil(t, w.WriteRaw(now, Received, wire.ProtocolVersion, unknown))
+
+	// Incomplete messages are not.
+	assert.NotNil(t, w.WriteRaw(now, Received, wire.ProtocolVersion, unknown[:10]))
+	assert.NotNil(t, w.WriteRaw(now, Received, wire.ProtocolVersion, unknown[:len(unknown)-1]))
+
+	r := NewReader(bytes.NewReader(buf.Bytes()), wire.TestNet3)
+	rec, err := r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, wire.CmdPing, rec.Command)
+	assert.Equal(t, shortPing, rec.Raw)
+	assert.Equal(t, len(shortPing), rec.Size)
+	assert.Nil(t, rec.Msg)
+	assert.NotNil(t, rec.DecodeErr)
+
+	rec, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "unknown", rec.Command)
+	assert.Equal(t, unknown, rec.Raw)
+	assert.Nil(t, rec.Msg)
+	assert.NotNil(t, rec.DecodeErr)
+
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
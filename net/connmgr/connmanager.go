@@ -63,6 +63,17 @@ type ConnReq struct {
 	Addr      net.Addr
 	Permanent bool
 
+	// BlockRelayOnly marks an outbound connection which only relays blocks
+	// and headers.  Transactions and addresses are never exchanged with
+	// such peers, which makes the connection harder to infer for an
+	// attacker observing transaction relay.
+	BlockRelayOnly bool
+
+	// Feeler marks a short-lived outbound connection made to test whether
+	// an address is reachable.  Feelers do not count toward any target and
+	// are never retried nor replaced.
+	Feeler bool
+
 	conn       net.Conn
 	state      ConnState
 	stateMtx   sync.RWMutex
@@ -126,6 +137,15 @@ type Config struct {
 	// maintain. Defaults to 8.
 	TargetOutbound int32
 
+	// TargetBlockRelayOnly is the number of additional block-relay-only
+	// outbound network connections to maintain.  These do not count
+	// toward TargetOutbound.
+	TargetBlockRelayOnly int32
+
+	// Anchors are the addresses of block-relay-only peers from a previous
+	// session.  They are dialed first on start, up to TargetBlockRelayOnly.
+	Anchors []net.Addr
+
 	// RetryDuration is the duration to wait before retrying connection
 	// requests. Defaults to 5s.
 	RetryDuration time.Duration
@@ -184,7 +204,7 @@ type ConnManager struct {
 // After maxFailedConnectionAttempts new connections will be retried after the
 // configured retry duration.
 func (cm *ConnManager) handleFailedConn(c *ConnReq) {
-	if atomic.LoadInt32(&cm.stop) != 0 {
+	if atomic.LoadInt32(&cm.stop) != 0 || c.Feeler {
 		return
 	}
 	if c.Permanent {
@@ -204,10 +224,10 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 				"-- retrying connection in: %v", maxFailedAttempts,
 				cm.cfg.RetryDuration)
 			time.AfterFunc(cm.cfg.RetryDuration, func() {
-				cm.NewConnReq(context.TODO())
+				cm.newConnReq(context.TODO(), c.BlockRelayOnly)
 			})
 		} else {
-			go cm.NewConnReq(context.TODO())
+			go cm.newConnReq(context.TODO(), c.BlockRelayOnly)
 		}
 	}
 }
@@ -252,7 +272,11 @@ out:
 						go cm.cfg.OnDisconnection(connReq)
 					}
 
-					if int32(len(conns)) < cm.cfg.TargetOutbound && msg.retry {
+					target := cm.cfg.TargetOutbound
+					if connReq.BlockRelayOnly {
+						target = cm.cfg.TargetBlockRelayOnly
+					}
+					if countConns(conns, connReq.BlockRelayOnly) < target && msg.retry {
 						cm.handleFailedConn(connReq)
 					}
 				} else {
@@ -277,9 +301,27 @@ out:
 	log.Trace("Connection handler done")
 }
 
+// countConns returns the number of connections in conns which are, or are
+// not, block-relay-only.  Feelers are not counted.
+func countConns(conns map[uint64]*ConnReq, blockRelayOnly bool) int32 {
+	var n int32
+	for _, c := range conns {
+		if c.BlockRelayOnly == blockRelayOnly && !c.Feeler {
+			n++
+		}
+	}
+	return n
+}
+
 // NewConnReq creates a new connection request and connects to the
 // corresponding address.
 func (cm *ConnManager) NewConnReq(ctx context.Context) {
+	cm.newConnReq(ctx, false)
+}
+
+// newConnReq creates a new full-relay or block-relay-only connection request
+// and connects to the corresponding address.
+func (cm *ConnManager) newConnReq(ctx context.Context, blockRelayOnly bool) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
@@ -287,7 +329,7 @@ func (cm *ConnManager) NewConnReq(ctx context.Context) {
 		return
 	}
 
-	c := &ConnReq{}
+	c := &ConnReq{BlockRelayOnly: blockRelayOnly}
 	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
 
 	addr, err := cm.cfg.GetNewAddress()
@@ -378,9 +420,25 @@ func (cm *ConnManager) Start(ctx context.Context) {
 		}
 	}
 
+	// Requests already made count toward the full-relay target, so take
+	// the count before any block-relay-only connection is attempted.
 	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
 		go cm.NewConnReq(ctx)
 	}
+
+	// Reconnect to the anchors first so that a restart does not give an
+	// attacker the chance to replace all of our block-relay-only peers.
+	var blockRelayOnly int32
+	for _, addr := range cm.cfg.Anchors {
+		if blockRelayOnly >= cm.cfg.TargetBlockRelayOnly {
+			break
+		}
+		blockRelayOnly++
+		go cm.Connect(ctx, &ConnReq{Addr: addr, BlockRelayOnly: true})
+	}
+	for ; blockRelayOnly < cm.cfg.TargetBlockRelayOnly; blockRelayOnly++ {
+		go cm.newConnReq(ctx, true)
+	}
 }
 
 // Wait blocks until the connection manager halts gracefully.
@@ -420,6 +478,9 @@ func New(cfg *Config) (*ConnManager, error) {
 	if cfg.TargetOutbound < 0 {
 		cfg.TargetOutbound = defaultTargetOutbound
 	}
+	if cfg.TargetBlockRelayOnly < 0 {
+		cfg.TargetBlockRelayOnly = 0
+	}
 	cm := ConnManager{
 		cfg:      *cfg, // Copy so caller can't mutate
 		requests: make(chan interface{}),
@@ -216,6 +216,148 @@ func TestTargetOutbound(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestTargetBlockRelayOnly tests the target number of block-relay-only
+// outbound connections, which are maintained on top of the full-relay ones.
+//
+// We wait until all connections are established, then test there are
+// only as many as configured of each type.
+func TestTargetBlockRelayOnly(t *testing.T) {
+	targetOutbound := int32(4)
+	targetBlockRelayOnly := int32(2)
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound:       targetOutbound,
+		TargetBlockRelayOnly: targetBlockRelayOnly,
+		Dial:                 mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnect: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start(context.TODO())
+	var blockRelayOnly int32
+	for i := int32(0); i < targetOutbound+targetBlockRelayOnly; i++ {
+		if c := <-connected; c.BlockRelayOnly {
+			blockRelayOnly++
+		}
+	}
+	if blockRelayOnly != targetBlockRelayOnly {
+		t.Fatalf("target block relay only: got %d connections, want %d",
+			blockRelayOnly, targetBlockRelayOnly)
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("target block relay only: got unexpected connection - %v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestAnchors tests that anchors are dialed as block-relay-only connections
+// and that no more than the target number of them are used.
+func TestAnchors(t *testing.T) {
+	anchors := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.4"), Port: 18555},
+	}
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetBlockRelayOnly: 2,
+		Anchors:              anchors,
+		Dial:                 mockDialer,
+		OnConnect: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start(context.TODO())
+	seen := make(map[string]struct{})
+	for i := 0; i < 2; i++ {
+		c := <-connected
+		if !c.BlockRelayOnly {
+			t.Fatalf("anchors: connection to %v is not block relay only", c.Addr)
+		}
+		seen[c.Addr.String()] = struct{}{}
+	}
+	for _, addr := range anchors[:2] {
+		if _, ok := seen[addr.String()]; !ok {
+			t.Fatalf("anchors: anchor %v was not dialed", addr)
+		}
+	}
+
+	select {
+	case c := <-connected:
+		t.Fatalf("anchors: got unexpected connection - %v", c.Addr)
+	case <-time.After(time.Millisecond):
+		break
+	}
+	cmgr.Stop()
+}
+
+// TestFeeler tests that feeler connections are neither retried nor replaced.
+//
+// We start with no outbound target so that only the feeler is dialed, then
+// disconnect it and make sure no other connection is attempted.  A feeler
+// which fails to connect must not be retried either.
+func TestFeeler(t *testing.T) {
+	var dials uint32
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		RetryDuration: time.Millisecond,
+		Dial: func(ctx context.Context, addr net.Addr) (net.Conn, error) {
+			if atomic.AddUint32(&dials, 1) > 1 {
+				return nil, errors.New("unreachable")
+			}
+			return mockDialer(ctx, addr)
+		},
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnect: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start(context.TODO())
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555}
+	go cmgr.Connect(context.TODO(), &ConnReq{Addr: addr, Feeler: true})
+	c := <-connected
+	if !c.Feeler {
+		t.Fatalf("feeler: connection to %v is not a feeler", c.Addr)
+	}
+	cmgr.Disconnect(c.ID())
+
+	cmgr.Connect(context.TODO(), &ConnReq{Addr: addr, Feeler: true})
+	select {
+	case c := <-connected:
+		t.Fatalf("feeler: got unexpected connection - %v", c.Addr)
+	case <-time.After(10 * time.Millisecond):
+		break
+	}
+	if got := atomic.LoadUint32(&dials); got != 2 {
+		t.Fatalf("feeler: got %d dials, want 2", got)
+	}
+	cmgr.Stop()
+}
+
 // TestRetryPermanent tests that permanent connection requests are retried.
 //
 // We make a permanent connection request using Connect, disconnect it using
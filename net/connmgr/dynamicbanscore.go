@@ -87,6 +87,16 @@ func (s *DynamicBanScore) Int() uint32 {
 	return r
 }
 
+// Transient returns the current value of the decaying part of the ban score.
+//
+// This function is safe for concurrent access.
+func (s *DynamicBanScore) Transient() uint32 {
+	s.mtx.Lock()
+	r := s.int(time.Now()) - s.persistent
+	s.mtx.Unlock()
+	return r
+}
+
 // Increase increases both the persistent and decaying scores by the values
 // passed as parameters. The resulting score is returned.
 //
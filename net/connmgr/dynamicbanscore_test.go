@@ -26,6 +26,12 @@ func TestDynamicBanScoreDecay(t *testing.T) {
 		t.Errorf("Halflife check failed - %d instead of 125", r)
 	}
 
+	bs.lastUnix = time.Now().Add(-time.Minute).Unix()
+	if r := bs.Transient(); r != 25 {
+		t.Errorf("Transient score after halflife - %d instead of 25", r)
+	}
+	bs.lastUnix = base.Unix()
+
 	r = bs.int(base.Add(7 * time.Minute))
 	if r != 100 {
 		t.Errorf("Decay after 7m - %d instead of 100", r)
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/util"
+)
+
+// banFileVersion is the version of the format of the ban list file.  Files
+// written before the format was versioned hold a bare array of entries.
+const banFileVersion = 1
+
+const (
+	// discourageDuration is how long, in seconds, a misbehaving peer stays
+	// discouraged.
+	discourageDuration = 24 * 60 * 60
+
+	// maxDiscouraged is the maximum number of discouraged addresses
+	// remembered.
+	maxDiscouraged = 50000
+)
+
+// banFile is the on-disk format of the ban list.
+type banFile struct {
+	Version int
+	Banned  []*BannedInfo
+}
+
+// decodeBanFile reads a ban list file, in the versioned format or in the
+// legacy one.
+func decodeBanFile(r io.Reader) ([]*BannedInfo, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var bannedList []*BannedInfo
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &bannedList)
+		return bannedList, err
+	}
+
+	var file banFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version < 1 || file.Version > banFileVersion {
+		return nil, fmt.Errorf("unsupported ban list version %d",
+			file.Version)
+	}
+	return file.Banned, nil
+}
+
+// peerIP returns the IP address of the peer, or nil if its address is not an
+// IP address.
+func peerIP(sp *serverPeer) net.IP {
+	host, _, err := net.SplitHostPort(sp.Addr())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// bannedEntry returns the ban, of the address itself or of a subnet, covering
+// ip if any.  Expired bans found on the way are removed.
+func (ps *peerState) bannedEntry(ip net.IP, now int64) *BannedInfo {
+	if ip == nil {
+		return nil
+	}
+
+	host := ip.String()
+	if info, ok := ps.bannedAddr[host]; ok {
+		if now < info.BanUntil {
+			return info
+		}
+		log.Info("Peer %s is no longer banned", host)
+		delete(ps.bannedAddr, host)
+	}
+	for netCIDR, info := range ps.bannedIPNet {
+		_, ipNet, err := net.ParseCIDR(netCIDR)
+		if err != nil || !ipNet.Contains(ip) {
+			continue
+		}
+		if now < info.BanUntil {
+			return info
+		}
+		log.Info("ipNet %s is no longer banned", netCIDR)
+		delete(ps.bannedIPNet, netCIDR)
+	}
+	return nil
+}
+
+// isDiscouraged returns whether ip belongs to a peer which recently
+// misbehaved.
+func (ps *peerState) isDiscouraged(ip net.IP, now int64) bool {
+	if ip == nil {
+		return false
+	}
+	until, ok := ps.discouraged[ip.String()]
+	if ok && now >= until {
+		delete(ps.discouraged, ip.String())
+		return false
+	}
+	return ok
+}
+
+// discourage remembers ip as belonging to a misbehaving peer.  Unlike a ban,
+// a discouraged address is merely deprioritized: no outbound connections are
+// made to it and it only gets inbound slots nobody else wants.
+func (ps *peerState) discourage(ip net.IP, now int64) {
+	if ip == nil {
+		return
+	}
+	if ps.discouraged == nil {
+		ps.discouraged = make(map[string]int64)
+	}
+	if len(ps.discouraged) >= maxDiscouraged {
+		for host, until := range ps.discouraged {
+			if now >= until {
+				delete(ps.discouraged, host)
+			}
+		}
+		for host := range ps.discouraged {
+			if len(ps.discouraged) < maxDiscouraged {
+				break
+			}
+			delete(ps.discouraged, host)
+		}
+	}
+	ps.discouraged[ip.String()] = now + discourageDuration
+}
+
+// isAvoided returns whether no outbound connection should be made to ip
+// because it is banned or discouraged.
+func (ps *peerState) isAvoided(ip net.IP, now int64) bool {
+	return ps.bannedEntry(ip, now) != nil || ps.isDiscouraged(ip, now)
+}
+
+// acceptInbound returns whether a new inbound connection from ip may go on.
+// Banned addresses are refused, and discouraged ones only take free slots.
+// It is invoked from the peerHandler goroutine.
+func (s *Server) acceptInbound(state *peerState, ip net.IP, now int64) bool {
+	if info := state.bannedEntry(ip, now); info != nil {
+		log.Debug("Inbound connection from banned address %s refused, "+
+			"ban (%s) lasts another %ds", ip, info.Address,
+			info.BanUntil-now)
+		return false
+	}
+	if state.isDiscouraged(ip, now) &&
+		state.Count() >= conf.Cfg.P2PNet.MaxPeers {
+		log.Debug("Inbound connection from discouraged address %s "+
+			"refused, no slot is free", ip)
+		return false
+	}
+	return true
+}
+
+// handleDiscouragePeerMsg discourages the address of a misbehaving peer and
+// disconnects it.  It is invoked from the peerHandler goroutine.
+func (s *Server) handleDiscouragePeerMsg(state *peerState, sp *serverPeer) {
+	ip := peerIP(sp)
+	if ip == nil {
+		log.Debug("can't discourage peer %s: not an IP address", sp.Addr())
+	} else {
+		log.Info("Discouraged peer %s (inBound:%v)", ip, sp.Inbound())
+		state.discourage(ip, util.GetTimeSec())
+	}
+
+	sp.Disconnect()
+	delete(s.connectedPeers, sp.Addr())
+}
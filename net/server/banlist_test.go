@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBanTestState() *peerState {
+	return &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		bannedAddr:      make(map[string]*BannedInfo),
+		bannedIPNet:     make(map[string]*BannedInfo),
+		outboundGroups:  make(map[string]int),
+	}
+}
+
+func TestBannedEntry(t *testing.T) {
+	state := newBanTestState()
+	now := int64(1000)
+	state.bannedIPNet["10.1.0.0/16"] = &BannedInfo{
+		Address:  "10.1.0.0/16",
+		BanUntil: now + 60,
+	}
+	state.bannedIPNet["10.2.0.0/16"] = &BannedInfo{
+		Address:  "10.2.0.0/16",
+		BanUntil: now - 60,
+	}
+	state.bannedAddr["2001:db8::1"] = &BannedInfo{
+		Address:  "2001:db8::1",
+		BanUntil: now + 60,
+	}
+
+	info := state.bannedEntry(net.ParseIP("10.1.2.3"), now)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "10.1.0.0/16", info.Address)
+	}
+	assert.NotNil(t, state.bannedEntry(net.ParseIP("2001:0db8:0::1"), now))
+	assert.Nil(t, state.bannedEntry(net.ParseIP("10.3.2.3"), now))
+	assert.Nil(t, state.bannedEntry(nil, now))
+
+	// Expired bans are dropped.
+	assert.Nil(t, state.bannedEntry(net.ParseIP("10.2.2.3"), now))
+	assert.Equal(t, 1, len(state.bannedIPNet))
+}
+
+func TestDiscourage(t *testing.T) {
+	oldMaxPeers := conf.Cfg.P2PNet.MaxPeers
+	defer func() { conf.Cfg.P2PNet.MaxPeers = oldMaxPeers }()
+	conf.Cfg.P2PNet.MaxPeers = 1
+
+	state := newBanTestState()
+	now := int64(1000)
+	ip := net.ParseIP("10.1.2.3")
+	assert.True(t, s.acceptInbound(state, ip, now))
+
+	state.discourage(ip, now)
+	assert.True(t, state.isDiscouraged(ip, now))
+	assert.True(t, state.isAvoided(ip, now))
+
+	// Discouraged addresses only take free slots.
+	assert.True(t, s.acceptInbound(state, ip, now))
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{}, false)
+	state.inboundPeers[0] = sp
+	assert.False(t, s.acceptInbound(state, ip, now))
+	assert.True(t, s.acceptInbound(state, net.ParseIP("10.1.2.4"), now))
+
+	// Discouragement expires.
+	later := now + discourageDuration
+	assert.False(t, state.isDiscouraged(ip, later))
+	assert.Equal(t, 0, len(state.discouraged))
+
+	// Banned addresses are always refused.
+	delete(state.inboundPeers, 0)
+	state.bannedIPNet["10.1.0.0/16"] = &BannedInfo{
+		Address:  "10.1.0.0/16",
+		BanUntil: now + 60,
+	}
+	assert.False(t, s.acceptInbound(state, ip, now))
+	assert.True(t, state.isAvoided(ip, now))
+}
+
+func TestHandleBanAddressMsgSubnet(t *testing.T) {
+	state := newBanTestState()
+	out, err := peer.NewOutboundPeer(&peer.Config{}, "10.5.6.7:8333", false)
+	assert.Nil(t, err)
+	sp := newServerPeer(s, false)
+	sp.Peer = out
+	state.outboundPeers[0] = sp
+	s.connectedPeers[sp.Addr()] = sp
+	defer delete(s.connectedPeers, sp.Addr())
+
+	bmsg := &banAddressMsg{
+		address:      "10.5.0.0/16",
+		endTime:      1 << 40,
+		hasBannedChn: make(chan bool, 1),
+	}
+	s.handleBanAddressMsg(state, bmsg)
+	assert.False(t, <-bmsg.hasBannedChn)
+	_, connected := s.connectedPeers[sp.Addr()]
+	assert.False(t, connected)
+
+	// Addresses inside a banned subnet are already banned.
+	bmsg = &banAddressMsg{
+		address:      "10.5.1.1",
+		endTime:      1 << 40,
+		hasBannedChn: make(chan bool, 1),
+	}
+	s.handleBanAddressMsg(state, bmsg)
+	assert.True(t, <-bmsg.hasBannedChn)
+}
+
+func TestDecodeBanFile(t *testing.T) {
+	banned := []*BannedInfo{{
+		Address:    "10.1.0.0/16",
+		BanUntil:   2000,
+		CreateTime: 1000,
+		Reason:     BanReasonManuallyAdded,
+	}}
+
+	legacy, err := json.Marshal(banned)
+	assert.Nil(t, err)
+	got, err := decodeBanFile(bytes.NewReader(legacy))
+	assert.Nil(t, err)
+	assert.Equal(t, banned, got)
+
+	versioned, err := json.Marshal(&banFile{
+		Version: banFileVersion,
+		Banned:  banned,
+	})
+	assert.Nil(t, err)
+	got, err = decodeBanFile(bytes.NewReader(versioned))
+	assert.Nil(t, err)
+	assert.Equal(t, banned, got)
+
+	_, err = decodeBanFile(strings.NewReader(`{"Version":99,"Banned":[]}`))
+	assert.NotNil(t, err)
+	_, err = decodeBanFile(strings.NewReader(`{`))
+	assert.NotNil(t, err)
+}
+
+func TestSaveBannedInfo(t *testing.T) {
+	state := newBanTestState()
+	state.bannedAddr["10.1.2.3"] = &BannedInfo{
+		Address:  "10.1.2.3",
+		BanUntil: 1 << 40,
+	}
+	s.saveBannedInfo(state)
+
+	data, err := ioutil.ReadFile(s.banPeerFile)
+	assert.Nil(t, err)
+	var file banFile
+	assert.Nil(t, json.Unmarshal(data, &file))
+	assert.Equal(t, banFileVersion, file.Version)
+	if assert.Equal(t, 1, len(file.Banned)) {
+		assert.Equal(t, "10.1.2.3", file.Banned[0].Address)
+	}
+
+	s.saveBannedInfo(newBanTestState())
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/net/capture"
+	"github.com/copernet/copernicus/peer"
+)
+
+// captureMessage records the raw bytes of a message exchanged with the peer,
+// header included, when message capture is enabled.
+func (sp *serverPeer) captureMessage(dir capture.Direction, raw []byte) {
+	if sp.server.captureDir == "" {
+		return
+	}
+
+	sp.captureOnce.Do(func() {
+		w, err := capture.Create(sp.server.captureDir, sp.Addr(),
+			sp.server.chainParams.BitcoinNet)
+		if err != nil {
+			log.Error("Cannot capture the messages of peer %s: %v", sp, err)
+			return
+		}
+		sp.capture = w
+	})
+	if sp.capture == nil {
+		return
+	}
+	if err := sp.capture.WriteRaw(time.Now(), dir, sp.ProtocolVersion(), raw); err != nil {
+		log.Warn("Cannot capture %s message of peer %s: %v", dir, sp, err)
+	}
+}
+
+// OnReadRaw is invoked with the raw bytes of each message received from the
+// peer, and it is used to capture them.
+func (sp *serverPeer) OnReadRaw(_ *peer.Peer, raw []byte) {
+	sp.captureMessage(capture.Received, raw)
+}
+
+// OnWriteRaw is invoked with the raw bytes of each message sent to the peer,
+// and it is used to capture them.
+func (sp *serverPeer) OnWriteRaw(_ *peer.Peer, raw []byte) {
+	sp.captureMessage(capture.Sent, raw)
+}
+
+// closeCapture closes the capture file of the peer, if any.
+func (sp *serverPeer) closeCapture() {
+	// Opening the file once the peer is done is prevented as well.
+	sp.captureOnce.Do(func() {})
+	if sp.capture != nil {
+		sp.capture.Close()
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/copernet/copernicus/net/capture"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// encode returns msg as sent on the wire.
+func encode(t *testing.T, msg wire.Message) []byte {
+	var buf bytes.Buffer
+	err := wire.WriteMessage(&buf, msg, peer.MaxProtocolVersion, s.chainParams.BitcoinNet)
+	assert.Nil(t, err)
+	return buf.Bytes()
+}
+
+func TestCaptureMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// Nothing is recorded unless message capture is enabled.
+	srv := &Server{chainParams: s.chainParams}
+	sp := newServerPeer(srv, false)
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{}, "10.0.0.1:8333", false)
+	assert.Nil(t, err)
+	sp.captureMessage(capture.Sent, encode(t, wire.NewMsgPing(1)))
+	assert.Nil(t, sp.capture)
+	assert.Nil(t, newPeerConfig(sp).Listeners.OnReadRaw)
+
+	srv.captureDir = dir
+	sp = newServerPeer(srv, false)
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{}, "10.0.0.1:8333", false)
+	assert.Nil(t, err)
+	assert.NotNil(t, newPeerConfig(sp).Listeners.OnReadRaw)
+	ping := encode(t, wire.NewMsgPing(1))
+	sp.captureMessage(capture.Sent, ping)
+
+	// A message which does not decode is recorded as received.
+	pong := encode(t, wire.NewMsgPong(1))
+	pong[len(pong)-1]++
+	sp.captureMessage(capture.Received, pong)
+	sp.captureMessage(capture.Received, pong[:10])
+	sp.closeCapture()
+
+	f, err := os.Open(filepath.Join(dir, "10.0.0.1_8333.dat"))
+	assert.Nil(t, err)
+	defer f.Close()
+	r := capture.NewReader(f, s.chainParams.BitcoinNet)
+	rec, err := r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, capture.Sent, rec.Direction)
+	assert.Equal(t, wire.NewMsgPing(1), rec.Msg)
+	assert.Equal(t, ping, rec.Raw)
+	rec, err = r.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, capture.Received, rec.Direction)
+	assert.Equal(t, wire.CmdPong, rec.Command)
+	assert.Equal(t, pong, rec.Raw)
+	assert.Nil(t, rec.Msg)
+	assert.NotNil(t, rec.DecodeErr)
+	_, err = r.Next()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/net/wire"
+)
+
+const (
+	// evictProtectNetGroups is the number of inbound peers with distinct,
+	// deterministically-chosen network groups protected from eviction.  An
+	// attacker cannot cheaply choose which groups are kept since the
+	// selection is keyed with a per-node secret.
+	evictProtectNetGroups = 4
+
+	// evictProtectPing is the number of inbound peers with the lowest ping
+	// time protected from eviction.
+	evictProtectPing = 8
+
+	// evictProtectTx is the number of inbound peers which most recently
+	// relayed a novel transaction protected from eviction.
+	evictProtectTx = 4
+
+	// evictProtectBlock is the number of inbound peers which most recently
+	// relayed a novel block protected from eviction.
+	evictProtectBlock = 4
+)
+
+// evictionCandidate is a snapshot of the properties of an inbound peer which
+// are considered when a slot has to be freed for a new inbound connection.
+type evictionCandidate struct {
+	sp            *serverPeer
+	timeConnected time.Time
+	pingMicros    int64
+	lastBlockTime time.Time
+	lastTxTime    time.Time
+	netGroup      string
+	keyedNetGroup uint64
+}
+
+// keyedNetGroup returns the network group of the given key mixed with the
+// passed secret, so that the ordering of network groups is not predictable by
+// remote peers.
+func keyedNetGroup(secret []byte, netGroup string) uint64 {
+	h := sha256.New()
+	h.Write(secret)
+	h.Write([]byte(netGroup))
+	return binary.LittleEndian.Uint64(h.Sum(nil))
+}
+
+// newEvictionCandidate snapshots the eviction related state of the passed
+// peer.  groupKey returns the network group of an address.
+func newEvictionCandidate(sp *serverPeer, secret []byte,
+	groupKey func(*wire.NetAddress) string) *evictionCandidate {
+
+	netGroup := ""
+	if na := sp.NA(); na != nil {
+		netGroup = groupKey(na)
+	}
+
+	// A peer which never answered a ping is considered to be the slowest.
+	ping := sp.LastPingMicros()
+	if ping <= 0 {
+		ping = math.MaxInt64
+	}
+
+	return &evictionCandidate{
+		sp:            sp,
+		timeConnected: sp.TimeConnected(),
+		pingMicros:    ping,
+		lastBlockTime: sp.LastBlockTime(),
+		lastTxTime:    sp.LastTxTime(),
+		netGroup:      netGroup,
+		keyedNetGroup: keyedNetGroup(secret, netGroup),
+	}
+}
+
+// protectCandidates sorts the candidates with less so that the peers most
+// worth keeping end up at the back, then drops up to n of them from the
+// returned slice.
+func protectCandidates(candidates []*evictionCandidate, n int,
+	less func(a, b *evictionCandidate) bool) []*evictionCandidate {
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	return candidates[:len(candidates)-n]
+}
+
+// selectPeerToEvict picks the inbound peer which should be disconnected to
+// make room for a new one, or nil when every candidate is protected.
+//
+// Peers are protected, in order, for having a distinct keyed network group,
+// the lowest ping time, most recently relaying novel transactions and blocks,
+// and for having been connected the longest.  The victim is then the youngest
+// peer of the network group with the most remaining connections, which makes
+// it expensive for an attacker to occupy all inbound slots.
+func selectPeerToEvict(candidates []*evictionCandidate) *evictionCandidate {
+	// Work on a copy so the caller's ordering is left untouched.
+	candidates = append([]*evictionCandidate(nil), candidates...)
+
+	candidates = protectCandidates(candidates, evictProtectNetGroups,
+		func(a, b *evictionCandidate) bool {
+			return a.keyedNetGroup < b.keyedNetGroup
+		})
+	candidates = protectCandidates(candidates, evictProtectPing,
+		func(a, b *evictionCandidate) bool {
+			return a.pingMicros > b.pingMicros
+		})
+	candidates = protectCandidates(candidates, evictProtectTx,
+		func(a, b *evictionCandidate) bool {
+			return a.lastTxTime.Before(b.lastTxTime)
+		})
+	candidates = protectCandidates(candidates, evictProtectBlock,
+		func(a, b *evictionCandidate) bool {
+			return a.lastBlockTime.Before(b.lastBlockTime)
+		})
+
+	// Protect the half of the remaining peers which have been connected the
+	// longest.  This also leaves the youngest peers at the front.
+	candidates = protectCandidates(candidates, len(candidates)/2,
+		func(a, b *evictionCandidate) bool {
+			return a.timeConnected.After(b.timeConnected)
+		})
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Find the network group with the most connections.  Ties are broken
+	// in favor of the group holding the youngest connection.
+	groups := make(map[string][]*evictionCandidate)
+	var mostConnected string
+	var mostConnections int
+	var mostRecent time.Time
+	for _, c := range candidates {
+		group := append(groups[c.netGroup], c)
+		groups[c.netGroup] = group
+
+		youngest := group[0].timeConnected
+		if len(group) > mostConnections ||
+			(len(group) == mostConnections && youngest.After(mostRecent)) {
+
+			mostConnected = c.netGroup
+			mostConnections = len(group)
+			mostRecent = youngest
+		}
+	}
+
+	// Candidates are ordered youngest first, so evict the youngest peer in
+	// that group.
+	return groups[mostConnected][0]
+}
+
+// evictInboundPeer disconnects an inbound peer to free a slot for a new
+// inbound connection.  Whitelisted peers are never evicted.  It returns false
+// when no peer could be chosen.  It is invoked from the peerHandler
+// goroutine.
+func (s *Server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]*evictionCandidate, 0, len(state.inboundPeers))
+	for _, sp := range state.inboundPeers {
+		if sp.IsWhitelisted() || !sp.Connected() {
+			continue
+		}
+		candidate := newEvictionCandidate(sp, s.evictionSecret,
+			s.addrManager.GroupKey)
+		candidates = append(candidates, candidate)
+	}
+
+	victim := selectPeerToEvict(candidates)
+	if victim == nil {
+		return false
+	}
+
+	log.Debug("Evicting inbound peer %s (netgroup %s) to make room for "+
+		"a new connection", victim.sp, victim.netGroup)
+	delete(state.inboundPeers, victim.sp.ID())
+	victim.sp.Disconnect()
+	return true
+}
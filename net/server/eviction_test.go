@@ -0,0 +1,134 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeEvictionCandidates simulates a set of n inbound server peers.  Every
+// peer gets its own network group, a distinct ping, and connection times
+// spaced one minute apart with the first peer being the oldest.
+func makeEvictionCandidates(n int, secret []byte) []*evictionCandidate {
+	now := time.Now()
+	candidates := make([]*evictionCandidate, 0, n)
+	for i := 0; i < n; i++ {
+		sp := newServerPeer(nil, false)
+		sp.Peer = peer.NewInboundPeer(&peer.Config{}, false)
+		netGroup := fmt.Sprintf("10.%d", i)
+		candidates = append(candidates, &evictionCandidate{
+			sp:            sp,
+			timeConnected: now.Add(time.Duration(i-n) * time.Minute),
+			pingMicros:    int64(1000 + i),
+			netGroup:      netGroup,
+			keyedNetGroup: keyedNetGroup(secret, netGroup),
+		})
+	}
+	return candidates
+}
+
+func TestSelectPeerToEvictAllProtected(t *testing.T) {
+	assert.Nil(t, selectPeerToEvict(nil))
+
+	protected := evictProtectNetGroups + evictProtectPing +
+		evictProtectTx + evictProtectBlock
+	assert.Nil(t, selectPeerToEvict(makeEvictionCandidates(protected, []byte("secret"))))
+	assert.NotNil(t, selectPeerToEvict(makeEvictionCandidates(protected+1, []byte("secret"))))
+}
+
+func TestSelectPeerToEvictProtectsUsefulPeers(t *testing.T) {
+	candidates := makeEvictionCandidates(40, []byte("secret"))
+	now := time.Now()
+
+	// The youngest peers are the most likely victims, so make them useful
+	// in every protected category.
+	fastest := candidates[39]
+	fastest.pingMicros = 1
+	txRelayer := candidates[38]
+	txRelayer.lastTxTime = now
+	blockRelayer := candidates[37]
+	blockRelayer.lastBlockTime = now
+
+	for i := 0; i < 10; i++ {
+		victim := selectPeerToEvict(candidates)
+		if !assert.NotNil(t, victim) {
+			return
+		}
+		assert.NotEqual(t, fastest, victim)
+		assert.NotEqual(t, txRelayer, victim)
+		assert.NotEqual(t, blockRelayer, victim)
+
+		for j, c := range candidates {
+			if c == victim {
+				candidates = append(candidates[:j], candidates[j+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func TestSelectPeerToEvictMostRepresentedNetGroup(t *testing.T) {
+	// An attacker controlling a single netgroup has recently filled ten
+	// slots.  Whatever the secret, one of its peers must be evicted.
+	for i := 0; i < 20; i++ {
+		secret := []byte(fmt.Sprintf("secret%d", i))
+		candidates := makeEvictionCandidates(30, secret)
+		attackers := make(map[*evictionCandidate]struct{})
+		for _, c := range candidates[20:] {
+			c.netGroup = "192.168"
+			c.keyedNetGroup = keyedNetGroup(secret, c.netGroup)
+			attackers[c] = struct{}{}
+		}
+
+		victim := selectPeerToEvict(candidates)
+		if !assert.NotNil(t, victim) {
+			return
+		}
+		_, ok := attackers[victim]
+		assert.True(t, ok, "expected a peer from the most represented netgroup")
+	}
+}
+
+func TestSelectPeerToEvictKeepsOrder(t *testing.T) {
+	candidates := makeEvictionCandidates(30, []byte("secret"))
+	first := candidates[0]
+	selectPeerToEvict(candidates)
+	assert.Equal(t, first, candidates[0])
+}
+
+func TestNewEvictionCandidate(t *testing.T) {
+	out, err := peer.NewOutboundPeer(&peer.Config{}, "173.194.115.66:8333", false)
+	assert.Nil(t, err)
+	sp := newServerPeer(nil, false)
+	sp.Peer = out
+
+	c := newEvictionCandidate(sp, []byte("secret"), addrmgr.GroupKey)
+	assert.Equal(t, sp, c.sp)
+	assert.Equal(t, addrmgr.GroupKey(out.NA()), c.netGroup)
+	assert.Equal(t, keyedNetGroup([]byte("secret"), c.netGroup), c.keyedNetGroup)
+	assert.Equal(t, int64(math.MaxInt64), c.pingMicros)
+	assert.NotEqual(t, c.keyedNetGroup, keyedNetGroup([]byte("other"), c.netGroup))
+}
+
+func TestEvictInboundPeer(t *testing.T) {
+	ps := peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		bannedAddr:      make(map[string]*BannedInfo),
+		bannedIPNet:     make(map[string]*BannedInfo),
+		outboundGroups:  make(map[string]int),
+	}
+
+	// Peers which are not connected are never considered.
+	for i, c := range makeEvictionCandidates(30, []byte("secret")) {
+		ps.inboundPeers[int32(i)] = c.sp
+	}
+	assert.False(t, s.evictInboundPeer(&ps))
+	assert.Equal(t, 30, len(ps.inboundPeers))
+}
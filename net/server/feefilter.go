@@ -0,0 +1,192 @@
+package server
+
+import (
+	mrand "math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/service"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
+)
+
+const (
+	// avgFeeFilterBroadcastInterval is the average delay between feefilter
+	// messages sent to a peer.
+	avgFeeFilterBroadcastInterval = 10 * time.Minute
+
+	// maxFeeFilterChangeDelay is the maximum delay before a significant
+	// change of our minimum fee is announced to a peer.
+	maxFeeFilterChangeDelay = 5 * time.Minute
+
+	// feeFilterCheckInterval is how often a peer is checked for a feefilter
+	// message to send.
+	feeFilterCheckInterval = 10 * time.Second
+
+	// maxFeeFilter is the highest fee rate, in satoshis per kilobyte, we ever
+	// advertise.  It is also sent during initial block download to ask peers
+	// not to send us any transaction.
+	maxFeeFilter = util.MaxFee
+)
+
+// feeFilterRounder quantizes fee rates to a fixed set of exponentially spaced
+// values so that the exact minimum fee of our mempool, which could be used to
+// fingerprint the node, is not revealed.
+type feeFilterRounder struct {
+	feeSet []int64
+}
+
+// newFeeFilterRounder returns a rounder whose values start at half of the
+// given minimum incremental fee rate.
+func newFeeFilterRounder(minIncrementalFee int64) *feeFilterRounder {
+	minFee := minIncrementalFee / 2
+	if minFee < 1 {
+		minFee = 1
+	}
+
+	feeSet := []int64{0}
+	for fee := float64(minFee); fee <= float64(maxFeeFilter); fee *= util.FeeSpacing {
+		feeSet = append(feeSet, int64(fee))
+	}
+	return &feeFilterRounder{feeSet: feeSet}
+}
+
+// round returns one of the quantized fee rates close to fee.  Two times out
+// of three the value just below fee is picked, so that the result stays
+// randomized around bucket boundaries.
+func (r *feeFilterRounder) round(fee int64) int64 {
+	i := sort.Search(len(r.feeSet), func(i int) bool {
+		return r.feeSet[i] >= fee
+	})
+	if (i != 0 && mrand.Intn(3) != 0) || i == len(r.feeSet) {
+		i--
+	}
+	return r.feeSet[i]
+}
+
+// currentFeeFilter returns the fee rate below which transactions would be
+// rejected by our mempool anyway.
+func currentFeeFilter() int64 {
+	if lchain.IsInitialBlockDownload() {
+		return maxFeeFilter
+	}
+
+	minFee := mempool.GetInstance().GetMinFeeRate().SataoshisPerK
+	if minFee < conf.Cfg.Mempool.MinFeeRate {
+		minFee = conf.Cfg.Mempool.MinFeeRate
+	}
+	return minFee
+}
+
+// maybeSendFeeFilter sends a feefilter message to the peer when its timer
+// expired and the rounded fee rate changed since the last one, given the fee
+// rate currently wanted.  A significant change of the fee rate brings the
+// next send forward.  It returns whether a message was queued.
+func (sp *serverPeer) maybeSendFeeFilter(now time.Time, current int64) bool {
+	if sp.ProtocolVersion() < wire.FeeFilterVersion ||
+		conf.Cfg.P2PNet.BlocksOnly || sp.blockRelayOnly {
+		return false
+	}
+
+	sent := atomic.LoadInt64(&sp.feeFilterSent)
+
+	// Periodic broadcasts are suppressed during initial block download,
+	// peers are instead asked once not to send any transaction.
+	if current == maxFeeFilter {
+		if sent == maxFeeFilter {
+			return false
+		}
+		sp.queueFeeFilter(maxFeeFilter)
+		return true
+	}
+
+	if !now.Before(sp.nextFeeFilterSend) {
+		sp.nextFeeFilterSend = poissonNextSend(now, avgFeeFilterBroadcastInterval)
+		filter := sp.server.feeFilterRounder.round(current)
+		if filter < conf.Cfg.Mempool.MinFeeRate {
+			filter = conf.Cfg.Mempool.MinFeeRate
+		}
+		if filter == sent {
+			return false
+		}
+		sp.queueFeeFilter(filter)
+		return true
+	}
+
+	// Announce a significant change sooner, at a random time so that the
+	// change cannot be used to link our connections together.
+	if sp.nextFeeFilterSend.After(now.Add(maxFeeFilterChangeDelay)) &&
+		(current < 3*sent/4 || current > 4*sent/3) {
+
+		delay := time.Duration(mrand.Int63n(int64(maxFeeFilterChangeDelay)))
+		sp.nextFeeFilterSend = now.Add(delay)
+	}
+	return false
+}
+
+// queueFeeFilter sends a feefilter message with the given fee rate to the
+// peer and records it.
+func (sp *serverPeer) queueFeeFilter(filter int64) {
+	log.Debug("Sending feefilter of %d satoshis/kB to %v", filter, sp)
+	atomic.StoreInt64(&sp.feeFilterSent, filter)
+	atomic.AddUint64(&sp.server.feeFiltersSent, 1)
+	sp.server.feeFilteredPeers.Store(int64(sp.ID()), struct{}{})
+	sp.QueueMessage(wire.NewMsgFeeFilter(filter), nil)
+}
+
+// feeFilterHandler keeps the peer informed of the minimum fee rate of the
+// transactions we are interested in until the peer disconnects.  It must be
+// run as a goroutine.
+func (sp *serverPeer) feeFilterHandler() {
+	ticker := time.NewTicker(feeFilterCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if sp.Connected() && sp.VersionKnown() {
+				sp.maybeSendFeeFilter(now, currentFeeFilter())
+			}
+
+		case <-sp.quit:
+			sp.server.feeFilteredPeers.Delete(int64(sp.ID()))
+			return
+		}
+	}
+}
+
+// processTransaction processes a transaction from a peer for the sync
+// manager.  It counts the bytes of the transactions received from peers
+// before and after we sent them a feefilter, and of those refused for the
+// mempool min fee, so that the share of the traffic our feefilter stops shows
+// in getnettotals.
+func (s *Server) processTransaction(txn *tx.Tx, recentRejects *bloom.RollingFilter,
+	nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
+
+	acceptTxs, missTxs, rejectTxs, err := service.ProcessTransaction(txn, recentRejects, nodeID)
+	s.countFeeFilterTraffic(txn, nodeID, err)
+	return acceptTxs, missTxs, rejectTxs, err
+}
+
+// countFeeFilterTraffic counts the bytes of a transaction from a peer, and
+// whether the mempool refused it for its min fee.
+func (s *Server) countFeeFilterTraffic(txn *tx.Tx, nodeID int64, err error) {
+	// The inventory vector announcing the transaction counts with it.
+	size := uint64(4+util.Hash256Size) + uint64(txn.EncodeSize())
+	received, lowFee := &s.txRecvBeforeFilter, &s.lowFeeBeforeFilter
+	if _, ok := s.feeFilteredPeers.Load(nodeID); ok {
+		received, lowFee = &s.txRecvAfterFilter, &s.lowFeeAfterFilter
+	}
+	atomic.AddUint64(received, size)
+	if code, _, ok := errcode.IsRejectCode(err); ok && code == errcode.RejectInsufficientFee {
+		atomic.AddUint64(lowFee, size)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/errcode"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeFilterRounder(t *testing.T) {
+	r := newFeeFilterRounder(1000)
+	assert.Equal(t, int64(0), r.feeSet[0])
+	assert.Equal(t, int64(500), r.feeSet[1])
+	for i := 2; i < len(r.feeSet); i++ {
+		assert.True(t, r.feeSet[i] > r.feeSet[i-1])
+	}
+
+	// Rounding picks the bucket just above or just below the fee, which
+	// hides the exact value.
+	above := 0
+	for r.feeSet[above] < 1234 {
+		above++
+	}
+	for i := 0; i < 100; i++ {
+		rounded := r.round(1234)
+		assert.True(t, rounded == r.feeSet[above] || rounded == r.feeSet[above-1],
+			"unexpected rounded fee %d", rounded)
+	}
+	assert.Equal(t, int64(0), r.round(0))
+	assert.Equal(t, r.feeSet[len(r.feeSet)-1], r.round(maxFeeFilter*2))
+}
+
+func TestMaybeSendFeeFilter(t *testing.T) {
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp), false)
+	now := time.Now()
+
+	// The maximum fee rate is sent once during initial block download.
+	assert.True(t, sp.maybeSendFeeFilter(now, maxFeeFilter))
+	assert.Equal(t, int64(maxFeeFilter), atomic.LoadInt64(&sp.feeFilterSent))
+	assert.False(t, sp.maybeSendFeeFilter(now, maxFeeFilter))
+
+	// Once synced, the rounded minimum fee is sent right away and the next
+	// send is scheduled.
+	assert.True(t, sp.maybeSendFeeFilter(now, 100000))
+	sent := atomic.LoadInt64(&sp.feeFilterSent)
+	assert.True(t, sent < 110000 && sent > 90000, "unexpected filter %d", sent)
+	assert.True(t, sp.nextFeeFilterSend.After(now))
+
+	// A significant change brings the next send forward.
+	sp.nextFeeFilterSend = now.Add(time.Hour)
+	assert.False(t, sp.maybeSendFeeFilter(now, 1000))
+	assert.False(t, sp.nextFeeFilterSend.After(now.Add(maxFeeFilterChangeDelay)))
+
+	// A small one does not.
+	sp.nextFeeFilterSend = now.Add(time.Hour)
+	assert.False(t, sp.maybeSendFeeFilter(now, sent+1))
+	assert.Equal(t, now.Add(time.Hour), sp.nextFeeFilterSend)
+
+	// Block-relay-only peers never get a feefilter.
+	sp.blockRelayOnly = true
+	sp.nextFeeFilterSend = time.Time{}
+	assert.False(t, sp.maybeSendFeeFilter(now, 1000))
+
+	// Nor does anyone in blocks only mode.
+	sp.blockRelayOnly = false
+	conf.Cfg.P2PNet.BlocksOnly = true
+	assert.False(t, sp.maybeSendFeeFilter(now, 1000))
+	conf.Cfg.P2PNet.BlocksOnly = false
+}
+
+func TestCountFeeFilterTraffic(t *testing.T) {
+	srv := &Server{}
+	txn := tx.NewTx(0, tx.DefaultVersion)
+	size := uint64(4+util.Hash256Size) + uint64(txn.EncodeSize())
+	lowFee := errcode.NewError(errcode.RejectInsufficientFee, "mempool min fee not met")
+
+	// Before we send the peer a feefilter.
+	srv.countFeeFilterTraffic(txn, 1, nil)
+	srv.countFeeFilterTraffic(txn, 1, lowFee)
+	assert.Equal(t, 2*size, srv.txRecvBeforeFilter)
+	assert.Equal(t, size, srv.lowFeeBeforeFilter)
+
+	// After it, and other refusals don't count as low fee.
+	srv.feeFilteredPeers.Store(int64(1), struct{}{})
+	srv.countFeeFilterTraffic(txn, 1, errcode.NewError(errcode.RejectInvalid, "bad-txns"))
+	assert.Equal(t, size, srv.txRecvAfterFilter)
+	assert.Equal(t, uint64(0), srv.lowFeeAfterFilter)
+	assert.Equal(t, 2*size, srv.txRecvBeforeFilter)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/connmgr"
+	"github.com/copernet/copernicus/util"
+)
+
+// feelerInterval is the average time between two feeler connections.
+const feelerInterval = 2 * time.Minute
+
+// feelerMsg asks the peer handler to make a feeler connection.
+type feelerMsg struct{}
+
+// handleFeelerMsg makes a short-lived connection to an address which either
+// collides with a tried entry, in which case the tried entry is tested, or
+// comes from the new table, so that reachable addresses are moved to the
+// tried table.  Feelers are only made once the outbound slots are filled.  It
+// is invoked from the peerHandler goroutine.
+func (s *Server) handleFeelerMsg(state *peerState) {
+	if conf.Cfg.AddrMgr.SimNet || len(conf.Cfg.AddrMgr.ConnectPeers) != 0 ||
+		state.fullRelayOutboundCount() < conf.Cfg.P2PNet.TargetOutbound {
+		return
+	}
+
+	s.addrManager.ResolveCollisions()
+	ka := s.addrManager.SelectTriedCollision()
+	if ka == nil {
+		ka = s.addrManager.GetNewTableAddress()
+	}
+	if ka == nil {
+		return
+	}
+
+	// Feelers stay off the network groups we are already connected to and
+	// off banned or discouraged addresses, as outbound connections do.
+	na := ka.NetAddress()
+	if state.outboundGroups[s.addrManager.GroupKey(na)] != 0 ||
+		state.isAvoided(na.IP, util.GetTimeSec()) {
+		return
+	}
+	addr, err := addrStringToNetAddr(addrmgr.NetAddressKey(na))
+	if err != nil {
+		log.Debug("Cannot make feeler connection to %v: %v", na.IP, err)
+		return
+	}
+
+	log.Debug("Making feeler connection to %v", addr)
+	s.addrManager.Attempt(na)
+	go s.connManager.Connect(context.TODO(), &connmgr.ConnReq{
+		Addr:   addr,
+		Feeler: true,
+	})
+}
+
+// feelerHandler asks the peer handler for feeler connections at Poisson
+// distributed intervals.  It must be run as a goroutine.
+func (s *Server) feelerHandler() {
+	timer := time.NewTimer(time.Until(poissonNextSend(time.Now(), feelerInterval)))
+	defer timer.Stop()
+
+out:
+	for {
+		select {
+		case <-timer.C:
+			select {
+			case s.query <- feelerMsg{}:
+			case <-s.quit:
+				break out
+			}
+			timer.Reset(time.Until(poissonNextSend(time.Now(), feelerInterval)))
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	log.Trace("Feeler handler done")
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/connmgr"
+	"github.com/copernet/copernicus/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleFeelerMsg(t *testing.T) {
+	oldTarget := conf.Cfg.P2PNet.TargetOutbound
+	defer func() { conf.Cfg.P2PNet.TargetOutbound = oldTarget }()
+	conf.Cfg.P2PNet.TargetOutbound = 1
+
+	dialed := make(chan *connmgr.ConnReq, 1)
+	cmgr, err := connmgr.New(&connmgr.Config{
+		Dial: func(ctx context.Context, addr net.Addr) (net.Conn, error) {
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+		OnConnect: func(c *connmgr.ConnReq, conn net.Conn) {
+			conn.Close()
+			dialed <- c
+		},
+	})
+	assert.Nil(t, err)
+	cmgr.Start(context.TODO())
+	defer cmgr.Stop()
+
+	amgr := addrmgr.New(t.Name(), nil)
+	assert.Nil(t, amgr.AddAddressByIP("173.194.115.66:8333"))
+	srv := &Server{addrManager: amgr, connManager: cmgr}
+	state := &peerState{
+		outboundPeers:  make(map[int32]*serverPeer),
+		outboundGroups: make(map[string]int),
+	}
+	noDial := func() {
+		select {
+		case c := <-dialed:
+			t.Fatalf("unexpected feeler connection to %v", c.Addr)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// No feelers until the outbound slots are filled.
+	srv.handleFeelerMsg(state)
+	noDial()
+
+	sp := newServerPeer(srv, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{}, false)
+	state.outboundPeers[1] = sp
+	srv.handleFeelerMsg(state)
+	select {
+	case c := <-dialed:
+		assert.True(t, c.Feeler)
+		assert.Equal(t, "173.194.115.66:8333", c.Addr.String())
+	case <-time.After(time.Second):
+		t.Fatal("no feeler connection was made")
+	}
+
+	// Network groups we are connected to are left alone.
+	state.outboundGroups["173.194.0.0"] = 1
+	srv.handleFeelerMsg(state)
+	noDial()
+
+	// Tried addresses are not probed unless they collide.
+	delete(state.outboundGroups, "173.194.0.0")
+	na, err := amgr.UnserializeNetAddress("173.194.115.66:8333")
+	assert.Nil(t, err)
+	amgr.Good(na)
+	srv.handleFeelerMsg(state)
+	noDial()
+}
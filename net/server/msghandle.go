@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/copernet/copernicus/conf"
 	"github.com/copernet/copernicus/errcode"
@@ -296,8 +298,8 @@ func ProcessForRPC(message interface{}) (rsp interface{}, err error) {
 		//case *btcjson.GetAddedNodeInfoCmd:
 		//	return msgHandle.connManager.PersistentPeers(), nil
 
-	case *service.GetNetTotalsRequest:
-		return
+	case *service.GetNetTotalsRequest, *btcjson.GetNetTotalsCmd:
+		return handleGetNetTotals(), nil
 
 	case *btcjson.GetNetworkInfoCmd:
 		return handleGetNetworkInfo()
@@ -348,6 +350,46 @@ func ProcessForRPC(message interface{}) (rsp interface{}, err error) {
 	return nil, errors.New("unknown rpc request")
 }
 
+func handleGetNetTotals() *btcjson.GetNetTotalsResult {
+	bytesRecv, bytesSent := msgHandle.NetTotals()
+	target := msgHandle.uploadTarget.status()
+	available, throttled := msgHandle.uploadBucket.available()
+	var rateLimit uint64
+	if msgHandle.uploadBucket != nil {
+		rateLimit = uint64(msgHandle.uploadBucket.rate)
+	}
+	return &btcjson.GetNetTotalsResult{
+		TotalBytesRecv: bytesRecv,
+		TotalBytesSent: bytesSent,
+		TimeMillis:     time.Now().UnixNano() / int64(time.Millisecond),
+		Uploadtarget: btcjson.Uploadtarget{
+			TimeFrame:             uint64(uploadTargetTimeframe / time.Second),
+			Target:                target.target,
+			TargetReached:         target.targetReached,
+			ServeHistoricalBlocks: target.serveHistoricalBlocks,
+			BytesLeftInCycle:      target.bytesLeftInCycle,
+			TimeLeftInCycle:       uint64(target.timeLeftInCycle / time.Second),
+		},
+		UploadRate: btcjson.UploadRate{
+			Limit:          rateLimit,
+			AvailableBytes: available,
+			ThrottledTime:  uint64(throttled / time.Millisecond),
+		},
+		FeeFilter: btcjson.FeeFilter{
+			FeeRate: valueFromAmount(currentFeeFilter()),
+			Sent:    atomic.LoadUint64(&msgHandle.feeFiltersSent),
+			BeforeSent: btcjson.FeeFilterTraffic{
+				Bytes:       atomic.LoadUint64(&msgHandle.txRecvBeforeFilter),
+				LowFeeBytes: atomic.LoadUint64(&msgHandle.lowFeeBeforeFilter),
+			},
+			AfterSent: btcjson.FeeFilterTraffic{
+				Bytes:       atomic.LoadUint64(&msgHandle.txRecvAfterFilter),
+				LowFeeBytes: atomic.LoadUint64(&msgHandle.lowFeeAfterFilter),
+			},
+		},
+	}
+}
+
 func handleGetNetworkInfo() (*btcjson.GetNetworkInfoResult, error) {
 	verNum := conf.AppMajor*1000000 + conf.AppMinor*1000 + conf.AppPatch
 	userAgent := conf.GetUserAgent(userAgentName, userAgentVersion, conf.Cfg.P2PNet.UserAgentComments...)
@@ -376,7 +418,7 @@ func handleGetNetworkInfo() (*btcjson.GetNetworkInfoResult, error) {
 		RelayFee:         valueFromAmount(util.NewFeeRate(util.DefaultMinRelayTxFeePerK).GetFeePerK()),
 		ExcessUtxoCharge: 0,
 		LocalAddresses:   rpcLocalAddrList,
-		Warnings:         "", // TODO: network warnings
+		Warnings:         util.GetWarnings(),
 	}
 	return chainInfo, nil
 }
@@ -58,6 +58,33 @@ func TestHandleGetNetworkInfo(t *testing.T) {
 	assert.Equal(t, ret.NetworkActive, true)
 }
 
+func TestHandleGetNetTotals(t *testing.T) {
+	totals := handleGetNetTotals()
+	recv, sent := s.NetTotals()
+	assert.Equal(t, recv, totals.TotalBytesRecv)
+	assert.Equal(t, sent, totals.TotalBytesSent)
+	assert.Equal(t, uint64(86400), totals.Uploadtarget.TimeFrame)
+	assert.False(t, totals.Uploadtarget.TargetReached)
+	assert.True(t, totals.Uploadtarget.ServeHistoricalBlocks)
+	assert.Equal(t, uint64(0), totals.UploadRate.Limit)
+
+	// With a target, what is left of it is reported.
+	defer func(target *uploadTarget, bucket *tokenBucket) {
+		msgHandle.uploadTarget = target
+		msgHandle.uploadBucket = bucket
+	}(msgHandle.uploadTarget, msgHandle.uploadBucket)
+	msgHandle.uploadTarget = newUploadTarget(1<<30, 10*time.Minute)
+	msgHandle.uploadTarget.addBytesSent(1 << 29)
+	msgHandle.uploadBucket = newTokenBucket(1000)
+	totals = handleGetNetTotals()
+	assert.Equal(t, uint64(1<<30), totals.Uploadtarget.Target)
+	assert.Equal(t, uint64(1<<29), totals.Uploadtarget.BytesLeftInCycle)
+	assert.True(t, totals.Uploadtarget.TimeLeftInCycle > 86000)
+	assert.False(t, totals.Uploadtarget.TargetReached)
+	assert.Equal(t, uint64(1000), totals.UploadRate.Limit)
+	assert.Equal(t, uint64(1000), totals.UploadRate.AvailableBytes)
+}
+
 func TestProcessForRPC(t *testing.T) {
 	getConnCountReq := &service.GetConnectionCountRequest{}
 	getConnCountRsp, err := ProcessForRPC(getConnCountReq)
@@ -81,10 +108,10 @@ func TestProcessForRPC(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, netWorkInfo, getNetworkInfoCmdRsp)
 
-	// unused message
 	getNetTotalsReq := &service.GetNetTotalsRequest{}
-	_, err = ProcessForRPC(getNetTotalsReq)
+	getNetTotalsRsp, err := ProcessForRPC(getNetTotalsReq)
 	assert.Nil(t, err)
+	assert.NotNil(t, getNetTotalsRsp)
 	setBanCmdReq := &btcjson.SetBanCmd{}
 	_, err = ProcessForRPC(setBanCmdReq)
 	assert.NotNil(t, err)
@@ -29,9 +29,21 @@ type RPCServerPeer interface {
 	// the peer is to being banned.
 	BanScore() uint32
 
+	// TransientBanScore returns the part of the ban score which decays
+	// over time.
+	TransientBanScore() uint32
+
 	// FeeFilter returns the requested current minimum fee rate for which
 	// transactions should be announced.
 	FeeFilter() int64
+
+	// Traffic returns the bytes and messages exchanged with the peer per
+	// message command.
+	Traffic() *TrafficSnap
+
+	// MappedAS returns the number of the autonomous system the asmap
+	// assigns the peer address, or 0 if it is not mapped.
+	MappedAS() uint32
 }
 
 // rpcPeer provides a peer for use with the RPC server and implements the
@@ -69,6 +81,14 @@ func (p *rpcPeer) BanScore() uint32 {
 	return (*serverPeer)(p).banScore.Int()
 }
 
+// TransientBanScore returns the part of the ban score which decays over time.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) TransientBanScore() uint32 {
+	return (*serverPeer)(p).banScore.Transient()
+}
+
 // FeeFilter returns the requested current minimum fee rate for which
 // transactions should be announced.
 //
@@ -78,6 +98,28 @@ func (p *rpcPeer) FeeFilter() int64 {
 	return atomic.LoadInt64(&(*serverPeer)(p).feeFilter)
 }
 
+// Traffic returns the bytes and messages exchanged with the peer per message
+// command.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) Traffic() *TrafficSnap {
+	return (*serverPeer)(p).traffic.snapshot()
+}
+
+// MappedAS returns the number of the autonomous system the asmap assigns the
+// peer address, or 0 if it is not mapped.
+//
+// This function is safe for concurrent access and is part of the rpcserverPeer
+// interface implementation.
+func (p *rpcPeer) MappedAS() uint32 {
+	sp := (*serverPeer)(p)
+	if sp.NA() == nil {
+		return 0
+	}
+	return sp.server.addrManager.MappedAS(sp.NA())
+}
+
 // RPCConnManager provides a connection manager for use with the RPC server and
 // implements the rpcserverConnManager interface.
 type RPCConnManager struct {
@@ -282,7 +324,11 @@ func (cm *RPCConnManager) ListBanned() (*btcjson.ListBannedResult, *btcjson.RPCE
 	for _, info := range bannedInfoList {
 		address := info.Address
 		if !strings.Contains(address, "/") {
-			address += "/32"
+			if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+				address += "/128"
+			} else {
+				address += "/32"
+			}
 		}
 		bannedInfo := btcjson.BannedInfo{
 			Address:     address,
@@ -29,7 +29,6 @@ import (
 	"github.com/copernet/copernicus/log"
 	"github.com/copernet/copernicus/logic/lblock"
 	"github.com/copernet/copernicus/logic/lchain"
-	"github.com/copernet/copernicus/logic/lmempool"
 	"github.com/copernet/copernicus/model"
 	"github.com/copernet/copernicus/model/block"
 	"github.com/copernet/copernicus/model/blockindex"
@@ -37,6 +36,7 @@ import (
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/net/addrmgr"
+	"github.com/copernet/copernicus/net/capture"
 	"github.com/copernet/copernicus/net/connmgr"
 	"github.com/copernet/copernicus/net/syncmanager"
 	"github.com/copernet/copernicus/net/upnp"
@@ -186,6 +186,16 @@ type peerState struct {
 	bannedAddr      map[string]*BannedInfo
 	bannedIPNet     map[string]*BannedInfo
 	outboundGroups  map[string]int
+
+	// staleTip is whether the last check found the tip stale, and
+	// extraOutboundPending whether an extra outbound connection was
+	// requested because of it and is not connected yet.
+	staleTip             bool
+	extraOutboundPending bool
+
+	// discouraged maps the addresses of recently misbehaving peers to the
+	// time, in seconds, their discouragement ends.
+	discouraged map[string]int64
 }
 
 type banScoreMsg struct {
@@ -242,6 +252,11 @@ type Server struct {
 	// Putting the uint64s first makes them 64-bit aligned for 32-bit systems.
 	bytesReceived        uint64 // Total bytes received from all peers since start.
 	bytesSent            uint64 // Total bytes sent by all peers since start.
+	feeFiltersSent       uint64 // Total feefilter messages sent since start.
+	txRecvBeforeFilter   uint64 // Tx bytes from peers not sent a feefilter yet.
+	lowFeeBeforeFilter   uint64 // Bytes of those txs below the mempool min fee.
+	txRecvAfterFilter    uint64 // Tx bytes from peers sent a feefilter.
+	lowFeeAfterFilter    uint64 // Bytes of those txs below the mempool min fee.
 	started              int32
 	shutdown             int32
 	shutdownSched        int32
@@ -254,6 +269,7 @@ type Server struct {
 	newPeers             chan *serverPeer
 	donePeers            chan *serverPeer
 	banPeers             chan *serverPeer
+	discouragePeers      chan *serverPeer
 	banAddress           chan *banAddressMsg
 	unbanAddress         chan *banAddressMsg
 	getBannedInfo        chan *getBannedInfoMsg
@@ -272,6 +288,26 @@ type Server struct {
 	banScoreChn          chan *banScoreMsg
 	connectedPeers       map[string]*serverPeer
 	banPeerFile          string
+	anchorsFile          string
+	captureDir           string
+	evictionSecret       []byte
+
+	// nextInboundTxInv is when transaction inventory is next announced
+	// to inbound peers.  It is protected by txInvMtx.
+	txInvMtx         sync.Mutex
+	nextInboundTxInv time.Time
+
+	feeFilterRounder *feeFilterRounder
+
+	// feeFilteredPeers holds the IDs of the peers we sent a feefilter to,
+	// for the transactions they send us to be counted apart.
+	feeFilteredPeers sync.Map
+
+	// uploadTarget limits the bytes sent to peers per day and uploadBucket
+	// the rate at which they are sent.  uploadBucket is nil when the rate
+	// is not limited.
+	uploadTarget *uploadTarget
+	uploadBucket *tokenBucket
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
@@ -285,13 +321,16 @@ type Server struct {
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter     int64
+	feeFilterSent int64
 
 	*peer.Peer
 
 	connReq        *connmgr.ConnReq
 	server         *Server
 	persistent     bool
+	blockRelayOnly bool
+	feeler         bool
 	continueHash   *util.Hash
 	relayMtx       sync.Mutex
 	disableRelayTx bool
@@ -300,6 +339,16 @@ type serverPeer struct {
 	knownAddresses map[string]struct{}
 	banScore       connmgr.DynamicBanScore
 	quit           chan struct{}
+	// The transactions waiting to be announced to the peer.
+	txInvMtx   sync.Mutex
+	txInvQueue map[util.Hash]struct{}
+	// nextFeeFilterSend is only used by the feeFilterHandler goroutine.
+	nextFeeFilterSend time.Time
+	traffic           *msgTraffic
+	// The capture file of the messages exchanged with the peer, opened on
+	// the first message when message capture is enabled.
+	captureOnce sync.Once
+	capture     *capture.Writer
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
 	blockProcessed chan struct{}
@@ -314,6 +363,8 @@ func newServerPeer(s *Server, isPersistent bool) *serverPeer {
 		filter:         bloom.LoadFilter(nil),
 		knownAddresses: make(map[string]struct{}),
 		quit:           make(chan struct{}),
+		txInvQueue:     make(map[util.Hash]struct{}),
+		traffic:        newMsgTraffic(),
 		txProcessed:    make(chan struct{}, 1),
 		blockProcessed: make(chan struct{}, 1),
 	}
@@ -389,7 +440,7 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 // addBanScore increases the persistent and decaying ban score fields by the
 // values passed as parameters. If the resulting score exceeds half of the ban
 // threshold, a warning is logged including the reason provided. Further, if
-// the score is above the ban threshold, the peer will be banned and
+// the score is above the ban threshold, the peer will be discouraged and
 // disconnected.
 func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 	// No warning is logged and no score is calculated if banning is disabled.
@@ -417,9 +468,9 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 		log.Warn("Misbehaving peer %s: %s -- ban score increased to %d",
 			sp, reason, score)
 		if score >= conf.Cfg.P2PNet.BanThreshold {
-			log.Warn("Misbehaving peer %s -- banning and disconnecting",
-				sp)
-			sp.server.BanPeer(sp)
+			log.Warn("Misbehaving peer %s -- discouraging and "+
+				"disconnecting", sp)
+			sp.server.DiscouragePeer(sp)
 		}
 	}
 }
@@ -433,8 +484,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
 	sp.server.timeSource.AddTimeSample(sp.Addr(), time.Unix(msg.Timestamp.Unix(), 0))
 
 	// Choose whether or not to relay transactions before a filter command
-	// is received.
-	sp.setDisableRelayTx(msg.DisableRelayTx)
+	// is received.  Transactions are never relayed to block-relay-only
+	// peers.
+	sp.setDisableRelayTx(msg.DisableRelayTx || sp.blockRelayOnly || sp.feeler)
 
 	// Update the address manager and request known addresses from the
 	// remote peer for outbound connections.  This is skipped when running
@@ -447,8 +499,9 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
 		// Outbound connections.
 		if !sp.Inbound() {
 			// TODO(davec): Only do this if not doing the initial block
-			// download and the local address is routable.
-			if !conf.Cfg.P2PNet.DisableListen /* && isCurrent? */ {
+			// download and the local address is routable.  Addresses are
+			// not exchanged with block-relay-only peers.
+			if !conf.Cfg.P2PNet.DisableListen && !sp.blockRelayOnly && !sp.feeler /* && isCurrent? */ {
 				// Get address that best matches.
 				lna := addrManager.GetBestLocalAddress(sp.NA())
 				if addrmgr.IsRoutable(lna) {
@@ -463,6 +516,14 @@ func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
 		}
 	}
 
+	// A feeler only finds out whether the address is reachable, so it is
+	// done once the version is received.
+	if sp.feeler {
+		log.Debug("Feeler connection to %s succeeded", sp)
+		sp.Disconnect()
+		return
+	}
+
 	// Add valid peer to the server.
 	sp.server.AddPeer(sp)
 }
@@ -525,6 +586,14 @@ func (sp *serverPeer) OnTx(_ *peer.Peer, msg *wire.MsgTx, done chan<- struct{})
 		return
 	}
 
+	// Block-relay-only peers were told not to send transactions.
+	if sp.blockRelayOnly {
+		log.Info("Block relay only peer %v sent tx %v -- disconnecting",
+			sp, txn.GetHash())
+		sp.Disconnect()
+		return
+	}
+
 	// Add the transaction to the known inventory for the peer.
 	// Convert the raw MsgTx to a btcutil.Tx which provides some convenience
 	// methods and things such as hash caching.
@@ -585,7 +654,7 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte, done
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
-	if !conf.Cfg.P2PNet.BlocksOnly {
+	if !conf.Cfg.P2PNet.BlocksOnly && !sp.blockRelayOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.syncManager.QueueInv(msg, sp.Peer)
 		}
@@ -879,7 +948,11 @@ func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *wire.MsgFilterLoad) {
 		return
 	}
 
-	sp.setDisableRelayTx(false)
+	// Loading a filter must not enable transaction relay to a
+	// block-relay-only peer.
+	if !sp.blockRelayOnly {
+		sp.setDisableRelayTx(false)
+	}
 
 	sp.filter.Reload(msg)
 }
@@ -936,6 +1009,12 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
+	// Addresses are not exchanged with block-relay-only peers.
+	if sp.blockRelayOnly {
+		log.Debug("Ignoring addr message from block relay only peer %v", sp)
+		return
+	}
+
 	// A message that has no addresses is invalid.
 	if len(msg.AddrList) == 0 {
 		log.Error("Command [%s] from %s does not contain any addresses",
@@ -974,12 +1053,14 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 // the bytes received by the server.
 func (sp *serverPeer) OnRead(_ *peer.Peer, bytesRead int, msg wire.Message, err error) {
 	sp.server.AddBytesReceived(uint64(bytesRead))
+	sp.traffic.addRecv(msg, bytesRead)
 }
 
 // OnWrite is invoked when a peer sends a message and it is used to update
 // the bytes sent by the server.
 func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message, err error) {
 	sp.server.AddBytesSent(uint64(bytesWritten))
+	sp.traffic.addSent(msg, bytesWritten)
 }
 
 // randomUint16Number returns a random uint16 in a specified input range.  Note
@@ -1095,6 +1176,21 @@ func (s *Server) pushBlockMsg(sp *serverPeer, hash *util.Hash, doneChan chan<- s
 	waitChan <-chan struct{}, encoding wire.MessageEncoding) error {
 
 	blkIndex, send := findBlockIndex(hash)
+
+	// Once the upload target is near, historical blocks are only served to
+	// whitelisted peers so that recent blocks can still be served.
+	if send && !sp.IsWhitelisted() && s.uploadTarget.reached(true) {
+		tip := chain.GetInstance().Tip()
+		if tip != nil && isHistoricalBlock(blkIndex.GetBlockTime(), tip.GetBlockTime()) {
+			log.Info("Historical block serving limit reached, disconnecting peer %s", sp)
+			sp.Disconnect()
+			if doneChan != nil {
+				doneChan <- struct{}{}
+			}
+			return fmt.Errorf("historical block serving limit reached")
+		}
+	}
+
 	if send && blkIndex.HasData() {
 		// Fetch the raw block bytes from the database.
 		bl, err := lblock.GetBlockByIndex(blkIndex, s.chainParams)
@@ -1279,47 +1375,30 @@ func (s *Server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.bannedAddr[host]; ok {
-		if now < banEnd.BanUntil {
-			log.Debug("Peer %s is banned for another %v - disconnecting",
-				host, banEnd.BanUntil-now)
-			sp.Disconnect()
-			return false
-		}
-
-		log.Info("Peer %s is no longer banned", host)
-		delete(state.bannedAddr, host)
-	}
 	ip := net.ParseIP(host)
-	if ip != nil {
-		for netCIDR, banEnd := range state.bannedIPNet {
-			_, ipNet, err := net.ParseCIDR(netCIDR)
-			if err != nil || !ipNet.Contains(ip) {
-				continue
-			}
-			if now < banEnd.BanUntil {
-				log.Debug("IP Net %s that contains host %s is banned for another %v - disconnecting",
-					ipNet.String(), host, banEnd.BanUntil-now)
-				sp.Disconnect()
-				return false
-			}
-
-			log.Info("ipNet %s is no longer banned", ipNet.String())
-			delete(state.bannedIPNet, netCIDR)
-			break
-		}
+	if banEnd := state.bannedEntry(ip, now); banEnd != nil {
+		log.Debug("Peer %s is banned (%s) for another %v - disconnecting",
+			host, banEnd.Address, banEnd.BanUntil-now)
+		sp.Disconnect()
+		return false
 	}
 
 	// TODO: Check for max peers from a single IP.
 
-	// Limit max number of total peers.
+	// Limit max number of total peers.  A new inbound peer may take the
+	// slot of an existing inbound peer which is less useful to us, so an
+	// attacker cannot lock out honest peers by filling all slots.
+	// Discouraged peers only get free slots.
 	if state.Count() >= conf.Cfg.P2PNet.MaxPeers {
-		log.Info("Max peers reached [%d] - disconnecting peer %s",
-			conf.Cfg.P2PNet.MaxPeers, sp)
-		sp.Disconnect()
-		// TODO: how to handle permanent peers here?
-		// they should be rescheduled.
-		return false
+		if !sp.Inbound() || state.isDiscouraged(ip, now) ||
+			!s.evictInboundPeer(state) {
+			log.Info("Max peers reached [%d] - disconnecting peer %s",
+				conf.Cfg.P2PNet.MaxPeers, sp)
+			sp.Disconnect()
+			// TODO: how to handle permanent peers here?
+			// they should be rescheduled.
+			return false
+		}
 	}
 
 	// Add the new peer and start it.
@@ -1327,7 +1406,7 @@ func (s *Server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 	if sp.Inbound() {
 		state.inboundPeers[sp.ID()] = sp
 	} else {
-		state.outboundGroups[addrmgr.GroupKey(sp.NA())]++
+		state.outboundGroups[s.addrManager.GroupKey(sp.NA())]++
 		if sp.persistent {
 			state.persistentPeers[sp.ID()] = sp
 		} else {
@@ -1351,7 +1430,7 @@ func (s *Server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 	}
 	if _, ok := list[sp.ID()]; ok {
 		if !sp.Inbound() && sp.VersionKnown() {
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		}
 		if !sp.Inbound() && sp.connReq != nil {
 			s.connManager.Disconnect(sp.connReq.ID())
@@ -1421,7 +1500,7 @@ func (s *Server) handleBanAddressMsg(state *peerState, bmsg *banAddressMsg) {
 		}
 
 		state.forAllPeers(func(sp *serverPeer) {
-			ip := net.ParseIP(sp.Addr())
+			ip := peerIP(sp)
 			if ip != nil && bannedNet.Contains(ip) {
 				log.Info("Ban peer %s (is inbound:%v) until %d", sp.Addr(), sp.Inbound(), bmsg.endTime)
 				sp.Disconnect()
@@ -1430,39 +1509,31 @@ func (s *Server) handleBanAddressMsg(state *peerState, bmsg *banAddressMsg) {
 		})
 
 	} else {
-		_, ok := state.bannedAddr[bmsg.address]
-		if ok {
-			bmsg.hasBannedChn <- true
-			return
-		}
 		ip := net.ParseIP(bmsg.address)
 		if ip == nil {
 			log.Error("Ban address %s is invalid", bmsg.address)
+			bmsg.hasBannedChn <- false
 			return
 		}
-		for bannedCIDR := range state.bannedIPNet {
-			_, bannedNet, err := net.ParseCIDR(bannedCIDR)
-			if err != nil {
-				continue
-			}
-			if bannedNet.Contains(ip) {
-				bmsg.hasBannedChn <- true
-				return
-			}
+		// Addresses are keyed in their canonical form so that every
+		// spelling of an address finds its ban.
+		address := ip.String()
+		if state.bannedEntry(ip, util.GetTimeSec()) != nil {
+			bmsg.hasBannedChn <- true
+			return
 		}
 		bmsg.hasBannedChn <- false
 
-		log.Info("Ban peer %s until %d", bmsg.address, bmsg.endTime)
-		state.bannedAddr[bmsg.address] = &BannedInfo{
-			Address:    bmsg.address,
+		log.Info("Ban peer %s until %d", address, bmsg.endTime)
+		state.bannedAddr[address] = &BannedInfo{
+			Address:    address,
 			BanUntil:   bmsg.endTime,
 			CreateTime: bmsg.startTime,
 			Reason:     bmsg.reason,
 		}
 
 		state.forAllPeers(func(sp *serverPeer) {
-			host, _, err := net.SplitHostPort(sp.Addr())
-			if err == nil && host == bmsg.address {
+			if peerIP(sp).Equal(ip) {
 				log.Info("Ban peer %s (is inbound:%v) until %d", sp.Addr(), sp.Inbound(), bmsg.endTime)
 				sp.Disconnect()
 				delete(s.connectedPeers, sp.Addr())
@@ -1485,18 +1556,23 @@ func (s *Server) handleUnbanAddressMsg(state *peerState, bmsg *banAddressMsg) {
 		delete(state.bannedIPNet, bmsg.address)
 
 	} else {
-		_, ok := state.bannedAddr[bmsg.address]
+		address := bmsg.address
+		if ip := net.ParseIP(address); ip != nil {
+			address = ip.String()
+		}
+		_, ok := state.bannedAddr[address]
 		if !ok {
 			bmsg.hasBannedChn <- false
 			return
 		}
 		bmsg.hasBannedChn <- true
 
-		log.Info("Unban peer %s", bmsg.address)
-		delete(state.bannedAddr, bmsg.address)
+		log.Info("Unban peer %s", address)
+		delete(state.bannedAddr, address)
 	}
 	s.saveBannedInfo(state)
 }
+
 func (s *Server) getBannedList(state *peerState) []*BannedInfo {
 	bannedInfoList := make([]*BannedInfo, 0)
 	now := util.GetTimeSec()
@@ -1525,8 +1601,13 @@ func (s *Server) handleClearBannedMsg(state *peerState) {
 	s.saveBannedInfo(state)
 }
 
+// saveBannedInfo writes the ban list file.  It is invoked from the
+// peerHandler goroutine.
 func (s *Server) saveBannedInfo(state *peerState) {
-	bannedList := s.getBannedList(state)
+	file := banFile{
+		Version: banFileVersion,
+		Banned:  s.getBannedList(state),
+	}
 
 	w, err := os.Create(s.banPeerFile)
 	if err != nil {
@@ -1536,12 +1617,14 @@ func (s *Server) saveBannedInfo(state *peerState) {
 
 	enc := json.NewEncoder(w)
 	defer w.Close()
-	if err := enc.Encode(&bannedList); err != nil {
+	if err := enc.Encode(&file); err != nil {
 		log.Error("Failed to encode file %s: %v", s.banPeerFile, err)
 		return
 	}
 }
 
+// loadBannedInfo restores the bans of the ban list file which are still in
+// force.
 func (s *Server) loadBannedInfo() error {
 	_, err := os.Stat(s.banPeerFile)
 	if os.IsNotExist(err) {
@@ -1553,20 +1636,86 @@ func (s *Server) loadBannedInfo() error {
 	}
 	defer r.Close()
 
-	var bannedList []*BannedInfo
-	dec := json.NewDecoder(r)
-	err = dec.Decode(&bannedList)
+	bannedList, err := decodeBanFile(r)
 	if err != nil {
 		return fmt.Errorf("error reading %s: %v", s.banPeerFile, err)
 	}
 
+	now := util.GetTimeSec()
 	for _, info := range bannedList {
+		if info.BanUntil <= now {
+			continue
+		}
 		s.BanAddr(info.Address, info.CreateTime, info.BanUntil, info.Reason)
 	}
 
 	return nil
 }
 
+// saveAnchors writes the addresses of the connected block-relay-only outbound
+// peers to the anchors file, up to the configured maximum.  It is invoked from
+// the peerHandler goroutine on shutdown.
+func (s *Server) saveAnchors(state *peerState) {
+	anchors := make([]string, 0, conf.Cfg.P2PNet.MaxAnchors)
+	state.forAllOutboundPeers(func(sp *serverPeer) {
+		if !sp.blockRelayOnly || !sp.Connected() ||
+			len(anchors) >= conf.Cfg.P2PNet.MaxAnchors {
+			return
+		}
+		anchors = append(anchors, sp.Addr())
+	})
+	if len(anchors) == 0 {
+		return
+	}
+
+	w, err := os.Create(s.anchorsFile)
+	if err != nil {
+		log.Error("Error opening file %s: %v", s.anchorsFile, err)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	defer w.Close()
+	if err := enc.Encode(&anchors); err != nil {
+		log.Error("Failed to encode file %s: %v", s.anchorsFile, err)
+		return
+	}
+}
+
+// loadAnchors reads the anchors saved on the last shutdown, if any, and
+// removes the file.
+func (s *Server) loadAnchors() ([]net.Addr, error) {
+	_, err := os.Stat(s.anchorsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	r, err := os.Open(s.anchorsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s error opening file: %v", s.anchorsFile, err)
+	}
+	defer os.Remove(s.anchorsFile)
+	defer r.Close()
+
+	var anchors []string
+	dec := json.NewDecoder(r)
+	err = dec.Decode(&anchors)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", s.anchorsFile, err)
+	}
+
+	addrs := make([]net.Addr, 0, len(anchors))
+	for _, anchor := range anchors {
+		addr, err := addrStringToNetAddr(anchor)
+		if err != nil {
+			log.Warn("Ignoring anchor %s: %v", anchor, err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
 // known to have it.  It is invoked from the peerHandler goroutine.
 func (s *Server) handleRelayInvMsg(state *peerState, msg relayMsg) {
@@ -1602,28 +1751,12 @@ func (s *Server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			txD := lmempool.FindTxInMempool(msg.invVect.Hash)
-			if txD == nil {
-				log.Warn("not found TxEntry for tx(%v) while relaying", txD)
-				return
-			}
-
-			// Don't relay the transaction if the transaction fee-per-kb
-			// is less than the peer's feefilter.
-			feeFilter := atomic.LoadInt64(&sp.feeFilter)
-			feePerKB := util.NewFeeRateWithSize(txD.TxFee, int64(txD.TxSize))
-			if feeFilter > 0 && feePerKB.SataoshisPerK < feeFilter {
-				return
-			}
-
-			// Don't relay the transaction if there is a bloom
-			// filter loaded and the transaction doesn't match it.
-			if sp.filter.IsLoaded() {
-
-				if !sp.filter.MatchTxAndUpdate(txD.Tx) {
-					return
-				}
-			}
+			// Transactions are announced in batches on a random
+			// timer so that observers cannot tell which peer
+			// relayed them first.  The fee and bloom filters of the
+			// peer are checked when the batch is sent.
+			sp.queueTxInv(msg.invVect.Hash)
+			return
 		}
 
 		// Queue the inventory to be relayed with the next batch.
@@ -1668,6 +1801,16 @@ type getOutboundGroup struct {
 	reply chan int
 }
 
+type acceptInboundMsg struct {
+	ip    net.IP
+	reply chan bool
+}
+
+type isAvoidedMsg struct {
+	ip    net.IP
+	reply chan bool
+}
+
 type getAddedNodesMsg struct {
 	reply chan []*serverPeer
 }
@@ -1692,6 +1835,12 @@ type removeNodeMsg struct {
 // goroutines related to peer state.
 func (s *Server) handleQuery(state *peerState, querymsg interface{}) {
 	switch msg := querymsg.(type) {
+	case staleTipMsg:
+		s.handleStaleTipMsg(state, msg, time.Now())
+
+	case feelerMsg:
+		s.handleFeelerMsg(state)
+
 	case getConnCountMsg:
 		nconnected := int32(0)
 		state.forAllPeers(func(sp *serverPeer) {
@@ -1750,7 +1899,7 @@ func (s *Server) handleQuery(state *peerState, querymsg interface{}) {
 		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 
 		if found {
@@ -1765,6 +1914,13 @@ func (s *Server) handleQuery(state *peerState, querymsg interface{}) {
 		} else {
 			msg.reply <- 0
 		}
+
+	case acceptInboundMsg:
+		msg.reply <- s.acceptInbound(state, msg.ip, util.GetTimeSec())
+
+	case isAvoidedMsg:
+		msg.reply <- state.isAvoided(msg.ip, util.GetTimeSec())
+
 		// Request a list of the persistent (added) peers.
 	case getAddedNodesMsg:
 		// Respond with a slice of the relevant peers.
@@ -1786,7 +1942,7 @@ func (s *Server) handleQuery(state *peerState, querymsg interface{}) {
 		found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
 			// Keep group counts ok since we remove from
 			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+			state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 		})
 		if found {
 			// If there are multiple outbound connections to the same
@@ -1794,7 +1950,7 @@ func (s *Server) handleQuery(state *peerState, querymsg interface{}) {
 			// peers are found.
 			for found {
 				found = disconnectPeer(state.outboundPeers, msg.cmp, func(sp *serverPeer) {
-					state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
+					state.outboundGroups[s.addrManager.GroupKey(sp.NA())]--
 				})
 			}
 			msg.reply <- nil
@@ -1841,7 +1997,7 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
-	return &peer.Config{
+	cfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:    sp.OnVersion,
 			OnMemPool:    sp.OnMemPool,
@@ -1876,9 +2032,16 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		UserAgentComments: conf.Cfg.P2PNet.UserAgentComments,
 		ChainParams:       sp.server.chainParams,
 		Services:          sp.server.services,
-		DisableRelayTx:    conf.Cfg.P2PNet.BlocksOnly,
+		DisableRelayTx:    conf.Cfg.P2PNet.BlocksOnly || sp.blockRelayOnly || sp.feeler,
 		ProtocolVersion:   peer.MaxProtocolVersion,
 	}
+
+	// The raw bytes of the messages are only kept for message capture.
+	if sp.server.captureDir != "" {
+		cfg.Listeners.OnReadRaw = sp.OnReadRaw
+		cfg.Listeners.OnWriteRaw = sp.OnWriteRaw
+	}
+	return cfg
 }
 
 // inboundPeerConnected is invoked by the connection manager when a new inbound
@@ -1886,13 +2049,23 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // instance, associates it with the connection, and starts a goroutine to wait
 // for disconnection.
 func (s *Server) inboundPeerConnected(conn net.Conn) {
-	sp := newServerPeer(s, false)
 	isWhitelisted := isWhitelisted(conn.RemoteAddr())
+	if !isWhitelisted {
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err == nil && !s.AcceptInbound(net.ParseIP(host)) {
+			conn.Close()
+			return
+		}
+	}
+
+	sp := newServerPeer(s, false)
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp), isWhitelisted)
-	sp.AssociateConnection(conn, s.MsgChan, func(peer *peer.Peer) {
+	sp.AssociateConnection(s.limitConn(conn), s.MsgChan, func(peer *peer.Peer) {
 		s.syncManager.NewPeer(peer)
 	})
 	go s.peerDoneHandler(sp)
+	go sp.txInvHandler()
+	go sp.feeFilterHandler()
 
 	s.connectPeerChn <- sp
 	// if version msg is not received when connecting, add ban score
@@ -1913,6 +2086,8 @@ func (s *Server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *Server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
+	sp.blockRelayOnly = c.BlockRelayOnly
+	sp.feeler = c.Feeler
 	isWhitelisted := isWhitelisted(conn.RemoteAddr())
 	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String(), isWhitelisted)
 	if err != nil {
@@ -1921,20 +2096,28 @@ func (s *Server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	}
 	sp.Peer = p
 	sp.connReq = c
-	sp.AssociateConnection(conn, s.MsgChan, func(peer *peer.Peer) {
+	sp.AssociateConnection(s.limitConn(conn), s.MsgChan, func(peer *peer.Peer) {
+		// Feelers are disconnected as soon as the version is received.
+		if sp.feeler {
+			return
+		}
+
 		// Request known addresses if the server address manager needs
 		// more and the peer has a protocol version new enough to
-		// include a timestamp with addresses.
+		// include a timestamp with addresses.  Block-relay-only peers
+		// are never asked for addresses.
 		addrManager := sp.server.addrManager
 		hasTimestamp := sp.ProtocolVersion() >=
 			wire.NetAddressTimeVersion
-		if addrManager.NeedMoreAddresses() && hasTimestamp {
+		if addrManager.NeedMoreAddresses() && hasTimestamp && !sp.blockRelayOnly {
 			sp.QueueMessage(wire.NewMsgGetAddr(), nil)
 		}
 
 		s.syncManager.NewPeer(peer)
 	})
 	go s.peerDoneHandler(sp)
+	go sp.txInvHandler()
+	go sp.feeFilterHandler()
 	s.addrManager.Attempt(sp.NA())
 
 	s.connectPeerChn <- sp
@@ -1954,9 +2137,10 @@ func (s *Server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 func (s *Server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
 	s.donePeers <- sp
+	sp.closeCapture()
 
 	// Only tell sync manager we are gone if we ever told it we existed.
-	if sp.VersionKnown() {
+	if sp.VersionKnown() && !sp.feeler {
 		s.syncManager.DonePeer(sp.Peer)
 
 		// Evict any remaining orphans that were sent by the peer.
@@ -1988,6 +2172,7 @@ func (s *Server) cycle() {
 		bannedAddr:      make(map[string]*BannedInfo),
 		bannedIPNet:     make(map[string]*BannedInfo),
 		outboundGroups:  make(map[string]int),
+		discouraged:     make(map[string]int64),
 	}
 
 	if !conf.Cfg.P2PNet.DisableDNSSeed {
@@ -2023,6 +2208,10 @@ out:
 		case p := <-s.banPeers:
 			s.handleBanPeerMsg(state, p)
 
+			// Misbehaving peer to discourage.
+		case p := <-s.discouragePeers:
+			s.handleDiscouragePeerMsg(state, p)
+
 		case bmsg := <-s.banAddress:
 			s.handleBanAddressMsg(state, bmsg)
 
@@ -2056,6 +2245,10 @@ out:
 			s.handleBanScore(state, bmsg)
 
 		case <-s.quit:
+			// Remember the block-relay-only peers so they are
+			// reconnected first on the next start.
+			s.saveAnchors(state)
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				log.Trace("Shutdown peer %s", sp)
@@ -2098,6 +2291,12 @@ func (s *Server) BanPeer(sp *serverPeer) {
 	s.banPeers <- sp
 }
 
+// DiscouragePeer discourages the address of a misbehaving peer and
+// disconnects it.
+func (s *Server) DiscouragePeer(sp *serverPeer) {
+	s.discouragePeers <- sp
+}
+
 func (s *Server) BanAddr(addr string, startTime int64, endTime int64, reason int) bool {
 	hasBannedChn := make(chan bool)
 	bmsg := &banAddressMsg{
@@ -2195,10 +2394,28 @@ func (s *Server) OutboundGroupCount(key string) int {
 	return <-replyChan
 }
 
+// AcceptInbound returns whether an inbound connection from the given address
+// may go on: banned addresses are refused and discouraged ones only get free
+// slots.
+func (s *Server) AcceptInbound(ip net.IP) bool {
+	replyChan := make(chan bool)
+	s.query <- acceptInboundMsg{ip: ip, reply: replyChan}
+	return <-replyChan
+}
+
+// IsAvoided returns whether outbound connections to the given address are
+// avoided because it is banned or discouraged.
+func (s *Server) IsAvoided(ip net.IP) bool {
+	replyChan := make(chan bool)
+	s.query <- isAvoidedMsg{ip: ip, reply: replyChan}
+	return <-replyChan
+}
+
 // AddBytesSent adds the passed number of bytes to the total bytes sent counter
 // for the server.  It is safe for concurrent access.
 func (s *Server) AddBytesSent(bytesSent uint64) {
 	atomic.AddUint64(&s.bytesSent, bytesSent)
+	s.uploadTarget.addBytesSent(bytesSent)
 }
 
 // AddBytesReceived adds the passed number of bytes to the total bytes received
@@ -2307,6 +2524,12 @@ func (s *Server) Start() {
 		go s.upnpUpdateThread()
 	}
 
+	s.wg.Add(1)
+	go s.staleTipHandler()
+
+	s.wg.Add(1)
+	go s.feelerHandler()
+
 	if err := s.loadBannedInfo(); err != nil {
 		log.Error("loadBannedInfo error:%s", err.Error())
 	}
@@ -2495,6 +2718,18 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 	}
 
 	amgr := addrmgr.New(cfg.DataDir, net.LookupIP)
+	if cfg.P2PNet.Asmap != "" {
+		path := cfg.P2PNet.Asmap
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.DataDir, path)
+		}
+		asmap, err := addrmgr.LoadAsmap(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load asmap %s: %v", path, err)
+		}
+		log.Info("Using asmap %s to group peers", path)
+		amgr.SetAsmap(asmap)
+	}
 
 	var listeners []net.Listener
 	var nat upnp.NAT
@@ -2507,6 +2742,11 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 		return nil, errors.New("no valid listen address")
 	}
 
+	evictionSecret := make([]byte, 32)
+	if _, err := rand.Read(evictionSecret); err != nil {
+		return nil, err
+	}
+
 	msgChan := make(chan *peer.PeerMessage, 1024)
 	// FIXME: remove useless member
 	s := &Server{
@@ -2515,6 +2755,7 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 		newPeers:             make(chan *serverPeer, cfg.P2PNet.MaxPeers),
 		donePeers:            make(chan *serverPeer, cfg.P2PNet.MaxPeers),
 		banPeers:             make(chan *serverPeer, cfg.P2PNet.MaxPeers),
+		discouragePeers:      make(chan *serverPeer, cfg.P2PNet.MaxPeers),
 		banAddress:           make(chan *banAddressMsg),
 		unbanAddress:         make(chan *banAddressMsg),
 		getBannedInfo:        make(chan *getBannedInfoMsg),
@@ -2534,6 +2775,14 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 		banScoreChn:          make(chan *banScoreMsg),
 		connectedPeers:       make(map[string]*serverPeer),
 		banPeerFile:          filepath.Join(cfg.DataDir, "banpeers.json"),
+		anchorsFile:          filepath.Join(cfg.DataDir, "anchors.json"),
+		feeFilterRounder:     newFeeFilterRounder(util.DefaultMinRelayTxFeePerK),
+		uploadTarget:         newUploadTarget(cfg.P2PNet.MaxUploadTarget*1024*1024, chainParams.TargetTimePerBlock*time.Second),
+		uploadBucket:         newTokenBucket(cfg.P2PNet.MaxUploadRate * 1024),
+		evictionSecret:       evictionSecret,
+	}
+	if cfg.P2PNet.CaptureMessages {
+		s.captureDir = filepath.Join(cfg.DataDir, "message_capture")
 	}
 
 	if cfg.P2PNet.TargetOutbound < 0 {
@@ -2542,6 +2791,19 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 	if cfg.P2PNet.MaxPeers < cfg.P2PNet.TargetOutbound {
 		cfg.P2PNet.TargetOutbound = cfg.P2PNet.MaxPeers
 	}
+	if cfg.P2PNet.BlockRelayOnly < 0 {
+		cfg.P2PNet.BlockRelayOnly = 0
+	}
+	if cfg.P2PNet.MaxPeers < cfg.P2PNet.TargetOutbound+cfg.P2PNet.BlockRelayOnly {
+		cfg.P2PNet.BlockRelayOnly = cfg.P2PNet.MaxPeers - cfg.P2PNet.TargetOutbound
+	}
+
+	// The anchors file is removed once read so that a crash does not make
+	// us reconnect to the same peers forever.
+	anchors, err := s.loadAnchors()
+	if err != nil {
+		log.Error("loadAnchors error:%s", err.Error())
+	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
 	// todo:please qiwei fix me Checkpoint. now question:where is the Checkpoint is used ?
@@ -2551,9 +2813,11 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 	//}
 
 	cmgr, err := connmgr.New(&connmgr.Config{
-		Listeners:      listeners,
-		RetryDuration:  connectionRetryInterval,
-		TargetOutbound: int32(cfg.P2PNet.TargetOutbound),
+		Listeners:            listeners,
+		RetryDuration:        connectionRetryInterval,
+		TargetOutbound:       int32(cfg.P2PNet.TargetOutbound),
+		TargetBlockRelayOnly: int32(cfg.P2PNet.BlockRelayOnly),
+		Anchors:              anchors,
 
 		Dial: func(ctx context.Context, netaddr net.Addr) (net.Conn, error) {
 			var d net.Dialer
@@ -2562,8 +2826,9 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 		OnAccept:  s.inboundPeerConnected,
 		OnConnect: s.outboundPeerConnected,
 		GetNewAddress: func() (net.Addr, error) {
-			addr, err := amgr.NewAddress(func(groupKey string) bool {
-				return s.OutboundGroupCount(groupKey) != 0
+			addr, err := amgr.NewAddress(func(na *wire.NetAddress, groupKey string) bool {
+				return s.OutboundGroupCount(groupKey) != 0 ||
+					s.IsAvoided(na.IP)
 			})
 			if err != nil {
 				return nil, err
@@ -2598,7 +2863,7 @@ func NewServer(chainParams *model.BitcoinParams, ts *util.MedianTime, interrupt
 	}
 	s.syncManager.ProcessBlockCallBack = service.ProcessBlock
 	s.syncManager.ProcessBlockHeadCallBack = service.ProcessBlockHeader
-	s.syncManager.ProcessTransactionCallBack = service.ProcessTransaction
+	s.syncManager.ProcessTransactionCallBack = s.processTransaction
 	s.syncManager.AddBanScoreCallBack = s.AddBanScore
 
 	return s, nil
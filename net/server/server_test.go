@@ -539,6 +539,70 @@ func TestOutboundPeerConnected(t *testing.T) {
 
 }
 
+func TestOutboundBlockRelayOnlyPeerConnected(t *testing.T) {
+	cq := &connmgr.ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 18556,
+		},
+		BlockRelayOnly: true,
+	}
+	inConn, _ := pipe(
+		&conn{raddr: "10.0.0.3:8333"},
+		&conn{raddr: "10.0.0.4:8333"},
+	)
+	s.outboundPeerConnected(cq, inConn)
+}
+
+func TestBlockRelayOnlyDisablesTxRelay(t *testing.T) {
+	sp := newServerPeer(s, false)
+	sp.blockRelayOnly = true
+	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp), false)
+
+	sp.OnVersion(sp.Peer, wire.NewMsgVersion(
+		wire.NewNetAddressIPPort(net.ParseIP("10.0.0.5"), 8333, 0),
+		wire.NewNetAddressIPPort(net.ParseIP("10.0.0.6"), 8333, 0),
+		0, 0))
+	assert.True(t, sp.relayTxDisabled())
+
+	sp.OnFilterLoad(sp.Peer, wire.NewMsgFilterLoad(nil, 0, 0, wire.BloomUpdateNone))
+	assert.True(t, sp.relayTxDisabled())
+}
+
+func TestLoadAnchors(t *testing.T) {
+	anchorsDir, err := ioutil.TempDir("", "anchors")
+	assert.Nil(t, err)
+	defer os.RemoveAll(anchorsDir)
+	srv := &Server{anchorsFile: filepath.Join(anchorsDir, "anchors.json")}
+
+	// A missing anchors file is not an error.
+	anchors, err := srv.loadAnchors()
+	assert.Nil(t, err)
+	assert.Nil(t, anchors)
+
+	// Nothing is written when there are no block-relay-only peers.
+	srv.saveAnchors(&peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+	})
+	_, err = os.Stat(srv.anchorsFile)
+	assert.True(t, os.IsNotExist(err))
+
+	data := []byte(`["127.0.0.1:8333","invalid","[::1]:18333"]`)
+	assert.Nil(t, ioutil.WriteFile(srv.anchorsFile, data, 0644))
+	anchors, err = srv.loadAnchors()
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(anchors)) {
+		assert.Equal(t, "127.0.0.1:8333", anchors[0].String())
+		assert.Equal(t, "[::1]:18333", anchors[1].String())
+	}
+
+	// The anchors are only used once.
+	_, err = os.Stat(srv.anchorsFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestPushAddrMsg(t *testing.T) {
 	sp := newServerPeer(nil, true)
 	config := peer.Config{}
@@ -937,6 +1001,19 @@ func TestOnReadWrite(t *testing.T) {
 	if r, w := sp.server.NetTotals(); r != 10 || w != 20 {
 		t.Errorf("set read write number failed")
 	}
+
+	sp.OnRead(nil, 30, wire.NewMsgPing(1), nil)
+	sp.OnRead(nil, 30, wire.NewMsgPing(2), nil)
+	sp.OnWrite(nil, 40, wire.NewMsgPong(1), nil)
+	traffic := (*rpcPeer)(sp).Traffic()
+	assert.Equal(t, map[string]uint64{otherMsgCmd: 10, wire.CmdPing: 60}, traffic.BytesRecvPerMsg)
+	assert.Equal(t, map[string]uint64{otherMsgCmd: 1, wire.CmdPing: 2}, traffic.MsgsRecvPerMsg)
+	assert.Equal(t, map[string]uint64{otherMsgCmd: 20, wire.CmdPong: 40}, traffic.BytesSentPerMsg)
+	assert.Equal(t, map[string]uint64{otherMsgCmd: 1, wire.CmdPong: 1}, traffic.MsgsSentPerMsg)
+
+	// The snapshot is not affected by later traffic.
+	sp.OnWrite(nil, 40, wire.NewMsgPong(2), nil)
+	assert.Equal(t, uint64(40), traffic.BytesSentPerMsg[wire.CmdPong])
 }
 
 func TestRandomUint16Number(t *testing.T) {
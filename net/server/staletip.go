@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// staleTipCheckInterval is how often the tip is checked for staleness
+	// and extra outbound peers are considered for eviction.
+	staleTipCheckInterval = 45 * time.Second
+
+	// minExtraPeerConnectTime is how long an outbound peer is given to
+	// announce a block before it may be evicted as an extra peer.
+	minExtraPeerConnectTime = 30 * time.Second
+
+	// staleTipWarningSubsystem is the subsystem under which the stale tip
+	// warning is raised.
+	staleTipWarningSubsystem = "staletip"
+
+	staleTipWarning = "Warning: the chain tip has not advanced for a long " +
+		"time, this node may be connected only to lagging or misbehaving peers."
+)
+
+// staleTipMsg reports the outcome of a stale tip check to the peer handler.
+type staleTipMsg struct {
+	stale      bool
+	syncPeerID int32
+}
+
+// fullRelayOutboundCount returns the number of automatic outbound peers which
+// relay transactions as well as blocks.
+func (ps *peerState) fullRelayOutboundCount() int {
+	n := 0
+	for _, sp := range ps.outboundPeers {
+		if !sp.blockRelayOnly {
+			n++
+		}
+	}
+	return n
+}
+
+// evictExtraOutboundPeer disconnects, when there are more full-relay outbound
+// peers than targeted, the one which least recently announced a block unknown
+// to us.  Between peers which announced at the same time, the most recently
+// connected one goes.  The sync peer is spared, and the chosen peer is only
+// evicted once it was given some time to announce blocks.  It returns the
+// evicted peer, if any.  It is invoked from the peerHandler goroutine.
+func (s *Server) evictExtraOutboundPeer(state *peerState, syncPeerID int32, now time.Time) *serverPeer {
+	if state.fullRelayOutboundCount() <= conf.Cfg.P2PNet.TargetOutbound {
+		return nil
+	}
+	// The extra peer was connected, so another one may be tried if the
+	// tip is still stale after this eviction.
+	state.extraOutboundPending = false
+
+	var worst *serverPeer
+	var worstID int32
+	var worstAnnounce time.Time
+	for id, sp := range state.outboundPeers {
+		if sp.blockRelayOnly || id == syncPeerID {
+			continue
+		}
+		announce := sp.LastBlockAnnouncement()
+		if worst == nil || announce.Before(worstAnnounce) ||
+			(announce.Equal(worstAnnounce) && id > worstID) {
+			worst, worstID, worstAnnounce = sp, id, announce
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+	if now.Sub(worst.TimeConnected()) < minExtraPeerConnectTime {
+		log.Debug("Keeping outbound peer %s which was just connected", worst)
+		return nil
+	}
+
+	log.Info("Disconnecting extra outbound peer %s (last block announcement %v)",
+		worst, worstAnnounce)
+	worst.Disconnect()
+	return worst
+}
+
+// handleStaleTipMsg evicts an extra outbound peer if there is one, and opens
+// one more outbound connection when the tip looks stale.  The eviction then
+// rotates away whichever outbound peer is the least useful, so a node
+// partially eclipsed or connected to lagging peers gets a chance to find
+// honest ones.  It is invoked from the peerHandler goroutine.
+func (s *Server) handleStaleTipMsg(state *peerState, msg staleTipMsg, now time.Time) {
+	s.evictExtraOutboundPeer(state, msg.syncPeerID, now)
+
+	if !msg.stale {
+		if state.staleTip {
+			log.Info("The chain tip is advancing again")
+			util.SetWarning(staleTipWarningSubsystem, "")
+		}
+		state.staleTip = false
+		return
+	}
+
+	state.staleTip = true
+	util.SetWarning(staleTipWarningSubsystem, staleTipWarning)
+	log.Warn("Potential stale tip detected, will try using extra outbound "+
+		"peer (last tip update: %v ago)",
+		now.Sub(s.syncManager.LastTipUpdate()).Truncate(time.Second))
+
+	if state.fullRelayOutboundCount() <= conf.Cfg.P2PNet.TargetOutbound &&
+		!state.extraOutboundPending {
+
+		state.extraOutboundPending = true
+		go s.connManager.NewConnReq(context.TODO())
+	}
+}
+
+// staleTipHandler periodically checks whether the tip may be stale and reports
+// the outcome to the peer handler.  The sync manager is queried from this
+// goroutine rather than the peer handler since the sync manager may itself be
+// waiting on the peer handler.  It must be run as a goroutine.
+func (s *Server) staleTipHandler() {
+	ticker := time.NewTicker(staleTipCheckInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			msg := staleTipMsg{
+				stale:      s.syncManager.TipMayBeStale(),
+				syncPeerID: s.syncManager.SyncPeerID(),
+			}
+			select {
+			case s.query <- msg:
+			case <-s.quit:
+				break out
+			}
+
+		case <-s.quit:
+			break out
+		}
+	}
+
+	s.wg.Done()
+	log.Trace("Stale tip handler done")
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeOutboundPeers simulates n outbound server peers, the peer of ID i having
+// last announced a block i minutes ago.
+func makeOutboundPeers(n int, now time.Time) (*peerState, []*serverPeer) {
+	state := &peerState{outboundPeers: make(map[int32]*serverPeer)}
+	peers := make([]*serverPeer, 0, n)
+	for i := 0; i < n; i++ {
+		sp := newServerPeer(s, false)
+		sp.Peer = peer.NewInboundPeer(&peer.Config{}, false)
+		sp.UpdateLastBlockAnnouncement(now.Add(-time.Duration(i) * time.Minute))
+		state.outboundPeers[int32(i)] = sp
+		peers = append(peers, sp)
+	}
+	return state, peers
+}
+
+func TestEvictExtraOutboundPeer(t *testing.T) {
+	oldTarget := conf.Cfg.P2PNet.TargetOutbound
+	defer func() { conf.Cfg.P2PNet.TargetOutbound = oldTarget }()
+	conf.Cfg.P2PNet.TargetOutbound = 2
+	now := time.Now()
+
+	// Nothing happens at the target.
+	state, _ := makeOutboundPeers(2, now)
+	state.extraOutboundPending = true
+	assert.Nil(t, s.evictExtraOutboundPeer(state, -1, now))
+	assert.True(t, state.extraOutboundPending)
+
+	// Block-relay-only peers do not count towards the target.
+	state, peers := makeOutboundPeers(3, now)
+	peers[0].blockRelayOnly = true
+	assert.Nil(t, s.evictExtraOutboundPeer(state, -1, now))
+
+	// The peer which least recently announced a block goes, unless it is
+	// the sync peer.
+	state, peers = makeOutboundPeers(4, now)
+	state.extraOutboundPending = true
+	assert.Equal(t, peers[3], s.evictExtraOutboundPeer(state, -1, now))
+	assert.False(t, state.extraOutboundPending)
+	assert.Equal(t, peers[2], s.evictExtraOutboundPeer(state, 3, now))
+
+	// Ties go to the most recently connected peer.
+	state, peers = makeOutboundPeers(3, now)
+	for _, sp := range peers {
+		sp.UpdateLastBlockAnnouncement(now)
+	}
+	assert.Equal(t, peers[2], s.evictExtraOutboundPeer(state, -1, now))
+}
+
+func TestHandleStaleTipMsg(t *testing.T) {
+	oldTarget := conf.Cfg.P2PNet.TargetOutbound
+	defer func() { conf.Cfg.P2PNet.TargetOutbound = oldTarget }()
+	conf.Cfg.P2PNet.TargetOutbound = 2
+	now := time.Now()
+
+	// A stale tip raises a warning and asks for an extra peer only once.
+	state, _ := makeOutboundPeers(2, now)
+	s.handleStaleTipMsg(state, staleTipMsg{stale: true, syncPeerID: -1}, now)
+	assert.True(t, state.staleTip)
+	assert.True(t, state.extraOutboundPending)
+	assert.True(t, strings.Contains(util.GetWarnings(), staleTipWarning))
+	s.handleStaleTipMsg(state, staleTipMsg{stale: true, syncPeerID: -1}, now)
+	assert.True(t, state.extraOutboundPending)
+
+	// The warning is cleared once the tip advances.
+	s.handleStaleTipMsg(state, staleTipMsg{syncPeerID: -1}, now)
+	assert.False(t, state.staleTip)
+	assert.False(t, strings.Contains(util.GetWarnings(), staleTipWarning))
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/copernet/copernicus/net/wire"
+)
+
+// otherMsgCmd is the command under which messages that could not be decoded
+// are accounted.
+const otherMsgCmd = "*other*"
+
+// TrafficSnap is a snapshot of the traffic exchanged with a peer, keyed by
+// message command.
+type TrafficSnap struct {
+	BytesSentPerMsg map[string]uint64
+	BytesRecvPerMsg map[string]uint64
+	MsgsSentPerMsg  map[string]uint64
+	MsgsRecvPerMsg  map[string]uint64
+}
+
+// msgTraffic counts the bytes and messages exchanged with a peer per message
+// command.  It is safe for concurrent access.
+type msgTraffic struct {
+	mtx  sync.Mutex
+	snap TrafficSnap
+}
+
+// newMsgTraffic returns an empty msgTraffic.
+func newMsgTraffic() *msgTraffic {
+	return &msgTraffic{
+		snap: TrafficSnap{
+			BytesSentPerMsg: make(map[string]uint64),
+			BytesRecvPerMsg: make(map[string]uint64),
+			MsgsSentPerMsg:  make(map[string]uint64),
+			MsgsRecvPerMsg:  make(map[string]uint64),
+		},
+	}
+}
+
+// msgCommand returns the command msg is accounted under.
+func msgCommand(msg wire.Message) string {
+	if msg == nil {
+		return otherMsgCmd
+	}
+	return msg.Command()
+}
+
+// addSent accounts for a message of n bytes sent to the peer.
+func (t *msgTraffic) addSent(msg wire.Message, n int) {
+	cmd := msgCommand(msg)
+	t.mtx.Lock()
+	t.snap.BytesSentPerMsg[cmd] += uint64(n)
+	t.snap.MsgsSentPerMsg[cmd]++
+	t.mtx.Unlock()
+}
+
+// addRecv accounts for a message of n bytes received from the peer.
+func (t *msgTraffic) addRecv(msg wire.Message, n int) {
+	cmd := msgCommand(msg)
+	t.mtx.Lock()
+	t.snap.BytesRecvPerMsg[cmd] += uint64(n)
+	t.snap.MsgsRecvPerMsg[cmd]++
+	t.mtx.Unlock()
+}
+
+// snapshot returns a copy of the traffic counted so far.
+func (t *msgTraffic) snapshot() *TrafficSnap {
+	copyMap := func(m map[string]uint64) map[string]uint64 {
+		c := make(map[string]uint64, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		return c
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return &TrafficSnap{
+		BytesSentPerMsg: copyMap(t.snap.BytesSentPerMsg),
+		BytesRecvPerMsg: copyMap(t.snap.BytesRecvPerMsg),
+		MsgsSentPerMsg:  copyMap(t.snap.MsgsSentPerMsg),
+		MsgsRecvPerMsg:  copyMap(t.snap.MsgsRecvPerMsg),
+	}
+}
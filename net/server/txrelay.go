@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	mrand "math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// inboundTxInvInterval is the average delay between transaction
+	// inventory announcements to inbound peers.  All inbound peers share
+	// the same timer so that an attacker opening many connections learns
+	// nothing more than with a single one.
+	inboundTxInvInterval = 5 * time.Second
+
+	// outboundTxInvInterval is the average delay between transaction
+	// inventory announcements to each outbound peer.  Outbound peers are
+	// chosen by us, so they are trusted with a shorter delay.
+	outboundTxInvInterval = 2 * time.Second
+
+	// maxTxInvBroadcast is the maximum number of transactions announced to a
+	// peer at once.  The rest are kept for the next announcement.
+	maxTxInvBroadcast = 1000
+)
+
+// poissonNextSend returns the time of the next event of a Poisson process
+// with the given average interval, which makes announcement times
+// unpredictable to remote peers.
+func poissonNextSend(now time.Time, average time.Duration) time.Time {
+	return now.Add(time.Duration(-math.Log(1.0-mrand.Float64()) * float64(average)))
+}
+
+// nextTxInvSend returns when the transaction inventory queued for a peer
+// should next be announced.  It is safe for concurrent access.
+func (s *Server) nextTxInvSend(inbound bool) time.Time {
+	now := time.Now()
+	if !inbound {
+		return poissonNextSend(now, outboundTxInvInterval)
+	}
+
+	s.txInvMtx.Lock()
+	defer s.txInvMtx.Unlock()
+	if !s.nextInboundTxInv.After(now) {
+		s.nextInboundTxInv = poissonNextSend(now, inboundTxInvInterval)
+	}
+	return s.nextInboundTxInv
+}
+
+// txInv is a transaction to announce, with the fields of its mempool entry
+// it is sorted and filtered by.  They are copied under the mempool lock, as
+// the mempool updates its entries in place.
+type txInv struct {
+	tx    *tx.Tx
+	hash  util.Hash
+	depth int
+	fee   int64
+	size  int
+}
+
+// txInvsInMempool returns the transactions of the hashes which are still in
+// the mempool.
+func txInvsInMempool(hashes map[util.Hash]struct{}) []txInv {
+	pool := mempool.GetInstance()
+	pool.RLock()
+	defer pool.RUnlock()
+
+	invs := make([]txInv, 0, len(hashes))
+	for hash := range hashes {
+		if txD := pool.FindTxWithoutLock(hash); txD != nil {
+			invs = append(invs, txInv{
+				tx:    txD.Tx,
+				hash:  hash,
+				depth: txD.Depth,
+				fee:   txD.TxFee,
+				size:  txD.TxSize,
+			})
+		}
+	}
+	return invs
+}
+
+// sortTxInv orders transactions for announcement.  A transaction is always
+// shallower in the mempool than its descendants, so parents come before
+// their children, and transactions paying a higher fee rate come first
+// otherwise.
+func sortTxInv(invs []txInv) {
+	sort.Slice(invs, func(i, j int) bool {
+		a, b := &invs[i], &invs[j]
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		feeA := a.fee * int64(b.size)
+		feeB := b.fee * int64(a.size)
+		if feeA != feeB {
+			return feeA > feeB
+		}
+		return bytes.Compare(a.hash[:], b.hash[:]) < 0
+	})
+}
+
+// queueTxInv adds a transaction to the inventory announced to the peer on
+// its next Poisson timer.  It is safe for concurrent access.
+func (sp *serverPeer) queueTxInv(hash util.Hash) {
+	sp.txInvMtx.Lock()
+	sp.txInvQueue[hash] = struct{}{}
+	sp.txInvMtx.Unlock()
+}
+
+// flushTxInv announces the queued transactions which are still in the
+// mempool and wanted by the peer in a single inv message.  The fee filter and
+// bloom filter of the peer are checked now rather than when the transaction
+// was queued, since either may have changed in the meantime.
+func (sp *serverPeer) flushTxInv() {
+	if !sp.Connected() || !sp.VersionKnown() {
+		return
+	}
+
+	sp.txInvMtx.Lock()
+	queue := sp.txInvQueue
+	sp.txInvQueue = make(map[util.Hash]struct{})
+	sp.txInvMtx.Unlock()
+
+	if len(queue) == 0 || sp.relayTxDisabled() {
+		return
+	}
+
+	// Transactions mined or evicted in the meantime are dropped.
+	entries := txInvsInMempool(queue)
+	sortTxInv(entries)
+
+	feeFilter := atomic.LoadInt64(&sp.feeFilter)
+	invMsg := wire.NewMsgInvSizeHint(uint(len(entries)))
+	for i, txD := range entries {
+		if len(invMsg.InvList) >= maxTxInvBroadcast {
+			// Keep the rest for the next announcement.
+			sp.txInvMtx.Lock()
+			for _, rest := range entries[i:] {
+				sp.txInvQueue[rest.hash] = struct{}{}
+			}
+			sp.txInvMtx.Unlock()
+			break
+		}
+
+		hash := txD.hash
+		iv := wire.NewInvVect(wire.InvTypeTx, &hash)
+		if sp.HasKnownInventory(iv) {
+			continue
+		}
+
+		// Don't relay the transaction if the transaction fee-per-kb
+		// is less than the peer's feefilter.
+		feePerKB := util.NewFeeRateWithSize(txD.fee, int64(txD.size))
+		if feeFilter > 0 && feePerKB.SataoshisPerK < feeFilter {
+			continue
+		}
+
+		// Don't relay the transaction if there is a bloom filter loaded
+		// and the transaction doesn't match it.
+		if sp.filter.IsLoaded() && !sp.filter.MatchTxAndUpdate(txD.tx) {
+			continue
+		}
+
+		invMsg.AddInvVect(iv)
+		sp.AddKnownInventory(iv)
+	}
+
+	if len(invMsg.InvList) > 0 {
+		sp.QueueMessage(invMsg, nil)
+	}
+}
+
+// txInvHandler announces the transactions queued for the peer on
+// Poisson-distributed timers until the peer disconnects.  It must be run as a
+// goroutine.
+func (sp *serverPeer) txInvHandler() {
+	for {
+		timer := time.NewTimer(time.Until(sp.server.nextTxInvSend(sp.Inbound())))
+		select {
+		case <-timer.C:
+			sp.flushTxInv()
+
+		case <-sp.quit:
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoissonNextSend(t *testing.T) {
+	now := time.Now()
+	var total time.Duration
+	for i := 0; i < 10000; i++ {
+		next := poissonNextSend(now, time.Second)
+		assert.False(t, next.Before(now))
+		total += next.Sub(now)
+	}
+
+	// The mean of the samples should be close to the average interval.
+	mean := total / 10000
+	assert.True(t, mean > 900*time.Millisecond && mean < 1100*time.Millisecond,
+		"unexpected mean delay %v", mean)
+}
+
+func TestNextTxInvSend(t *testing.T) {
+	srv := &Server{}
+
+	// Inbound peers share a single timer.
+	first := srv.nextTxInvSend(true)
+	assert.Equal(t, first, srv.nextTxInvSend(true))
+	assert.False(t, first.Before(time.Now().Add(-time.Second)))
+
+	// A timer in the past is replaced.
+	srv.nextInboundTxInv = time.Now().Add(-time.Minute)
+	assert.True(t, srv.nextTxInvSend(true).After(time.Now().Add(-time.Second)))
+}
+
+func TestSortTxInv(t *testing.T) {
+	newInv := func(lockTime uint32, fee int64, depth int) txInv {
+		txn := tx.NewTx(lockTime, 1)
+		return txInv{tx: txn, hash: txn.GetHash(), size: 1000, fee: fee, depth: depth}
+	}
+
+	parent := newInv(1, 100, 1)
+	child := newInv(2, 10000, 2)
+	rich := newInv(3, 5000, 1)
+	poor := newInv(4, 10, 1)
+
+	invs := []txInv{child, poor, parent, rich}
+	sortTxInv(invs)
+	assert.Equal(t, []txInv{rich, parent, poor, child}, invs)
+}
+
+func TestFlushTxInvNotConnected(t *testing.T) {
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp), false)
+
+	sp.queueTxInv(util.HashZero)
+	sp.flushTxInv()
+
+	// Nothing is sent, or dropped, before the peer is connected.
+	sp.txInvMtx.Lock()
+	_, ok := sp.txInvQueue[util.HashZero]
+	sp.txInvMtx.Unlock()
+	assert.True(t, ok)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/copernet/copernicus/model/consensus"
+)
+
+const (
+	// uploadTargetTimeframe is the window over which the upload target
+	// applies.
+	uploadTargetTimeframe = 24 * time.Hour
+
+	// historicalBlockAge is how much older than the tip a block must be to
+	// count as historical.  Historical blocks are the first to stop being
+	// served once the upload target is near.
+	historicalBlockAge = 7 * 24 * time.Hour
+)
+
+// uploadTarget tracks the bytes sent to peers in the current cycle against a
+// maximum.  A zero target means no limit.  It is safe for concurrent access.
+type uploadTarget struct {
+	mtx          sync.Mutex
+	target       uint64
+	cycleStart   time.Time
+	sentInCycle  uint64
+	blockReserve uint64
+	targetPeriod time.Duration
+}
+
+// newUploadTarget returns an upload target of target bytes per
+// uploadTargetTimeframe.  The blocks found every targetPeriod are kept room
+// for until the end of the cycle.
+func newUploadTarget(target uint64, targetPeriod time.Duration) *uploadTarget {
+	if targetPeriod <= 0 {
+		targetPeriod = 10 * time.Minute
+	}
+	return &uploadTarget{
+		target:       target,
+		cycleStart:   time.Now(),
+		blockReserve: consensus.LegacyMaxBlockSize,
+		targetPeriod: targetPeriod,
+	}
+}
+
+// maybeNewCycle starts a new cycle once the current one is over.  It must be
+// called with the mutex held.
+func (u *uploadTarget) maybeNewCycle(now time.Time) {
+	if now.Sub(u.cycleStart) >= uploadTargetTimeframe {
+		u.cycleStart = now
+		u.sentInCycle = 0
+	}
+}
+
+// addBytesSent accounts for n bytes sent to a peer.
+func (u *uploadTarget) addBytesSent(n uint64) {
+	u.mtx.Lock()
+	u.maybeNewCycle(time.Now())
+	u.sentInCycle += n
+	u.mtx.Unlock()
+}
+
+// timeLeftInCycle returns the time until the current cycle ends.  It must be
+// called with the mutex held.
+func (u *uploadTarget) timeLeftInCycle(now time.Time) time.Duration {
+	return u.cycleStart.Add(uploadTargetTimeframe).Sub(now)
+}
+
+// reached returns whether the target is reached.  When historical is set, the
+// room needed to serve the blocks expected until the end of the cycle is kept
+// aside, so historical blocks stop being served before recent ones.
+func (u *uploadTarget) reached(historical bool) bool {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if u.target == 0 {
+		return false
+	}
+	now := time.Now()
+	u.maybeNewCycle(now)
+	if historical {
+		reserve := uint64(u.timeLeftInCycle(now)/u.targetPeriod) * u.blockReserve
+		return reserve >= u.target || u.sentInCycle >= u.target-reserve
+	}
+	return u.sentInCycle >= u.target
+}
+
+// uploadTargetStatus is a snapshot of the upload target.
+type uploadTargetStatus struct {
+	target                uint64
+	targetReached         bool
+	serveHistoricalBlocks bool
+	bytesLeftInCycle      uint64
+	timeLeftInCycle       time.Duration
+}
+
+// status returns a snapshot of the upload target.
+func (u *uploadTarget) status() *uploadTargetStatus {
+	targetReached := u.reached(false)
+	serveHistoricalBlocks := !u.reached(true)
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	status := &uploadTargetStatus{
+		target:                u.target,
+		targetReached:         targetReached,
+		serveHistoricalBlocks: serveHistoricalBlocks,
+	}
+	if u.target > 0 {
+		if u.sentInCycle < u.target {
+			status.bytesLeftInCycle = u.target - u.sentInCycle
+		}
+		status.timeLeftInCycle = u.timeLeftInCycle(time.Now())
+	}
+	return status
+}
+
+// tokenBucket limits the rate at which bytes are written to peers.  A write
+// larger than the bucket goes out once the tokens it lacks have accrued, so a
+// block larger than a second worth of bytes is still sent.  A nil bucket does
+// not limit anything.  It is safe for concurrent access.
+type tokenBucket struct {
+	mtx       sync.Mutex
+	rate      float64 // bytes per second
+	burst     float64
+	tokens    float64
+	last      time.Time
+	throttled time.Duration
+}
+
+// newTokenBucket returns a bucket allowing rate bytes per second with bursts
+// of up to a second worth of bytes.  A zero rate returns nil.
+func newTokenBucket(rate uint64) *tokenBucket {
+	if rate == 0 {
+		return nil
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accrued since the last call.  It must be called
+// with the mutex held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// reserve takes n tokens and returns how long to wait before writing them.
+func (b *tokenBucket) reserve(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	wait := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.throttled += wait
+	return wait
+}
+
+// available returns the bytes which may be written right away and the total
+// time writes were held back.
+func (b *tokenBucket) available() (uint64, time.Duration) {
+	if b == nil {
+		return 0, 0
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.refill(time.Now())
+	if b.tokens < 0 {
+		return 0, b.throttled
+	}
+	return uint64(b.tokens), b.throttled
+}
+
+// rateLimitedConn is a connection whose writes are limited by a token bucket.
+type rateLimitedConn struct {
+	net.Conn
+	bucket *tokenBucket
+}
+
+// Write waits for the bucket to allow len(p) bytes before writing them.
+func (c *rateLimitedConn) Write(p []byte) (int, error) {
+	if wait := c.bucket.reserve(len(p)); wait > 0 {
+		time.Sleep(wait)
+	}
+	return c.Conn.Write(p)
+}
+
+// limitConn returns conn with its writes limited by the upload rate of the
+// server.  Whitelisted peers are not limited.
+func (s *Server) limitConn(conn net.Conn) net.Conn {
+	if s.uploadBucket == nil || isWhitelisted(conn.RemoteAddr()) {
+		return conn
+	}
+	return &rateLimitedConn{Conn: conn, bucket: s.uploadBucket}
+}
+
+// isHistoricalBlock returns whether a block of the given time is old enough
+// to count as historical with respect to the tip time.
+func isHistoricalBlock(blockTime, tipTime uint32) bool {
+	return int64(tipTime)-int64(blockTime) > int64(historicalBlockAge/time.Second)
+}
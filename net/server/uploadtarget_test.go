@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/model/consensus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadTarget(t *testing.T) {
+	// No target is never reached.
+	u := newUploadTarget(0, 10*time.Minute)
+	u.addBytesSent(1 << 40)
+	assert.False(t, u.reached(false))
+	assert.False(t, u.reached(true))
+
+	// Room for the blocks expected in the rest of the cycle is kept aside
+	// from historical blocks.
+	target := uint64(200 * consensus.OneMegaByte)
+	u = newUploadTarget(target, 10*time.Minute)
+	reserve := uint64(u.timeLeftInCycle(time.Now())/(10*time.Minute)) * consensus.LegacyMaxBlockSize
+	u.addBytesSent(target - reserve - consensus.OneMegaByte)
+	assert.False(t, u.reached(true))
+	u.addBytesSent(consensus.OneMegaByte)
+	assert.True(t, u.reached(true))
+	assert.False(t, u.reached(false))
+
+	status := u.status()
+	assert.Equal(t, target, status.target)
+	assert.False(t, status.targetReached)
+	assert.False(t, status.serveHistoricalBlocks)
+	assert.Equal(t, reserve, status.bytesLeftInCycle)
+
+	u.addBytesSent(reserve)
+	assert.True(t, u.reached(false))
+	assert.Equal(t, uint64(0), u.status().bytesLeftInCycle)
+
+	// A new cycle starts afresh.
+	u.cycleStart = time.Now().Add(-uploadTargetTimeframe)
+	assert.False(t, u.reached(false))
+	assert.False(t, u.reached(true))
+
+	// A target smaller than the reserve stops historical blocks right away.
+	u = newUploadTarget(consensus.OneMegaByte, 10*time.Minute)
+	assert.True(t, u.reached(true))
+	assert.False(t, u.reached(false))
+}
+
+func TestIsHistoricalBlock(t *testing.T) {
+	week := uint32(historicalBlockAge / time.Second)
+	assert.False(t, isHistoricalBlock(1000, 1000+week))
+	assert.True(t, isHistoricalBlock(1000, 1001+week))
+	assert.False(t, isHistoricalBlock(1000+week, 1000))
+}
+
+func TestTokenBucket(t *testing.T) {
+	var nilBucket *tokenBucket
+	assert.Nil(t, newTokenBucket(0))
+	assert.Equal(t, time.Duration(0), nilBucket.reserve(1<<20))
+
+	b := newTokenBucket(1000)
+	assert.Equal(t, time.Duration(0), b.reserve(600))
+	available, throttled := b.available()
+	assert.True(t, available >= 400 && available < 500)
+	assert.Equal(t, time.Duration(0), throttled)
+
+	// Writes beyond the bucket wait for the missing tokens.
+	wait := b.reserve(1400)
+	assert.True(t, wait > 900*time.Millisecond && wait <= time.Second)
+	available, throttled = b.available()
+	assert.Equal(t, uint64(0), available)
+	assert.Equal(t, wait, throttled)
+
+	// Tokens never accrue past the burst.
+	b.last = time.Now().Add(-time.Hour)
+	available, _ = b.available()
+	assert.Equal(t, uint64(1000), available)
+}
+
+func TestRateLimitedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	limited := &rateLimitedConn{Conn: client, bucket: newTokenBucket(1000)}
+	go func() {
+		buf := make([]byte, 2000)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	n, err := limited.Write(make([]byte, 1200))
+	assert.Nil(t, err)
+	assert.Equal(t, 1200, n)
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+
+	// Connections are left alone without a rate.
+	srv := &Server{}
+	assert.Equal(t, client, srv.limitConn(client))
+	srv.uploadBucket = newTokenBucket(1000)
+	_, ok := srv.limitConn(client).(*rateLimitedConn)
+	assert.True(t, ok)
+}
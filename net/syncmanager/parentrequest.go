@@ -0,0 +1,97 @@
+package syncmanager
+
+import (
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/net/wire"
+	"github.com/copernet/copernicus/peer"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// parentRequestTimeout is how long a missing parent of orphans is
+	// waited for from a peer before it is asked from another.
+	parentRequestTimeout = time.Minute
+
+	// maxParentRequestPeers is the number of peers a missing parent is
+	// asked from at most.
+	maxParentRequestPeers = 3
+
+	// maxParentRequests is the number of missing parents fetched at once
+	// at most.
+	maxParentRequests = wire.MaxInvPerMsg
+)
+
+// parentRequest is the fetch of a missing parent of orphans: the peers it was
+// asked from and when it was last asked.
+type parentRequest struct {
+	peers       map[*peer.Peer]struct{}
+	lastRequest time.Time
+}
+
+// fetchMissingParents asks the peer which sent an orphan for its missing
+// parents, but those already being fetched.  It must only be called from the
+// messagesHandler.
+func (sm *SyncManager) fetchMissingParents(missTxs []util.Hash, p *peer.Peer, now time.Time) {
+	hashes := make([]util.Hash, 0, len(missTxs))
+	for _, hash := range missTxs {
+		if _, ok := sm.parentRequests[hash]; ok {
+			continue
+		}
+		if len(sm.parentRequests) >= maxParentRequests {
+			break
+		}
+		sm.parentRequests[hash] = &parentRequest{
+			peers:       map[*peer.Peer]struct{}{p: {}},
+			lastRequest: now,
+		}
+		hashes = append(hashes, hash)
+	}
+	fetchMissingTx(hashes, p)
+}
+
+// retryParentRequests asks another peer for the missing parents which were
+// not received in time, and gives up on those asked from
+// maxParentRequestPeers peers or no longer needed.  It must only be called
+// from the messagesHandler.
+func (sm *SyncManager) retryParentRequests(now time.Time) {
+	pool := mempool.GetInstance()
+	retries := make(map[*peer.Peer][]util.Hash)
+	for hash, request := range sm.parentRequests {
+		if now.Sub(request.lastRequest) < parentRequestTimeout {
+			continue
+		}
+		if !pool.HasOrphanSpending(hash) || len(request.peers) >= maxParentRequestPeers {
+			delete(sm.parentRequests, hash)
+			continue
+		}
+		next := sm.nextParentPeer(request)
+		if next == nil {
+			log.Debug("No peer left to ask for missing parent %s", hash)
+			delete(sm.parentRequests, hash)
+			continue
+		}
+		request.peers[next] = struct{}{}
+		request.lastRequest = now
+		retries[next] = append(retries[next], hash)
+	}
+
+	for p, hashes := range retries {
+		log.Debug("Asking %s for %d missing parents", p.Addr(), len(hashes))
+		fetchMissingTx(hashes, p)
+	}
+}
+
+// nextParentPeer returns a connected peer the parent was not asked from, nil
+// if there is none.
+func (sm *SyncManager) nextParentPeer(request *parentRequest) *peer.Peer {
+	for p := range sm.peerStates {
+		if _, ok := request.peers[p]; ok || !p.Connected() {
+			continue
+		}
+		return p
+	}
+	return nil
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/peer"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 )
 
 const (
@@ -34,9 +35,13 @@ const (
 	// more.
 	minInFlightBlocks = 10
 
-	// maxRejectedTxns is the maximum number of rejected transactions
-	// hashes to store in memory.
-	maxRejectedTxns = 1000
+	// maxRejectedTxns is the number of rejected transactions hashes the
+	// filter of recent rejects remembers at least.
+	maxRejectedTxns = 120000
+
+	// rejectedTxnsFPRate is the false positive rate of the filter of
+	// recent rejects.
+	rejectedTxnsFPRate = 0.000001
 
 	// maxRequestedBlocks is the maximum number of requested block
 	// hashes to store in memory.
@@ -47,6 +52,14 @@ const (
 	maxRequestedTxns = wire.MaxInvPerMsg
 
 	blockRequestTimeoutTime = 20 * time.Minute
+
+	// staleTipFactor is how many target block intervals the tip may go
+	// without advancing before it is considered potentially stale.
+	staleTipFactor = 3
+
+	// maxHeadersAnnouncement is the number of headers a peer announcing
+	// new blocks with a headers message sends at most.
+	maxHeadersAnnouncement = 8
 )
 
 // zeroHash is the zero value hash (all zeros).  It is defined as a convenience.
@@ -150,6 +163,12 @@ type isCurrentMsg struct {
 	reply chan bool
 }
 
+// tipMayBeStaleMsg is a message type to be sent across the message channel for
+// requesting whether the tip may be stale.
+type tipMayBeStaleMsg struct {
+	reply chan bool
+}
+
 // pauseMsg is a message type to be sent across the message channel for
 // pausing the sync manager.  This effectively provides the caller with
 // exclusive access over the manager until a receive is performed on the
@@ -180,6 +199,10 @@ type peerSyncState struct {
 // chain is in sync, the SyncManager handles incoming block and header
 // notifications and relays announcements of new blocks to peers.
 type SyncManager struct {
+	// lastTipUpdate is the time, in nanoseconds since the epoch, at which
+	// the tip last changed.  It must only be used atomically.
+	lastTipUpdate int64
+
 	peerNotifier        PeerNotifier
 	started             int32
 	shutdown            int32
@@ -190,11 +213,12 @@ type SyncManager struct {
 	quit                chan struct{}
 
 	// These fields should only be accessed from the messagesHandler
-	rejectedTxns    map[util.Hash]struct{}
+	recentRejects   *bloom.RollingFilter
 	requestedTxns   map[util.Hash]struct{}
 	requestedBlocks map[util.Hash]struct{}
 	syncPeer        *peer.Peer
 	peerStates      map[*peer.Peer]*peerSyncState
+	parentRequests  map[util.Hash]*parentRequest
 
 	// The following fields are used for headers-first mode.
 	headersFirstMode bool
@@ -203,7 +227,7 @@ type SyncManager struct {
 	nextCheckpoint   *model.Checkpoint
 
 	// callback for transaction And block process
-	ProcessTransactionCallBack func(*tx.Tx, map[util.Hash]struct{}, int64) ([]*tx.Tx, []util.Hash, []util.Hash, error)
+	ProcessTransactionCallBack func(*tx.Tx, *bloom.RollingFilter, int64) ([]*tx.Tx, []util.Hash, []util.Hash, error)
 	ProcessBlockCallBack       func(*block.Block, bool) (bool, error)
 	ProcessBlockHeadCallBack   func([]*block.BlockHeader, *blockindex.BlockIndex) error
 	AddBanScoreCallBack        func(string, uint32, uint32, string)
@@ -463,7 +487,7 @@ func (sm *SyncManager) alreadyHave(txHash *util.Hash) bool {
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
 	// rejected, the transaction was unsolicited.
-	if _, exists := sm.rejectedTxns[*txHash]; exists {
+	if sm.recentRejects.ContainsHash(txHash) {
 		log.Debug("Ignoring unsolicited previously rejected transaction %v", txHash)
 		return true
 	}
@@ -490,11 +514,12 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 	}
 
 	// Process the transaction to include validation, insertion in the memory pool, orphan handling, etc.
-	acceptTxs, missTxs, rejectTxs, err := sm.ProcessTransactionCallBack(tmsg.tx, sm.rejectedTxns, int64(peer.ID()))
+	acceptTxs, missTxs, rejectTxs, err := sm.ProcessTransactionCallBack(tmsg.tx, sm.recentRejects, int64(peer.ID()))
 
 	sm.updateTxRequestState(state, txHash, rejectTxs)
 
-	fetchMissingTx(missTxs, peer)
+	delete(sm.parentRequests, txHash)
+	sm.fetchMissingParents(missTxs, peer, time.Now())
 
 	if err != nil {
 		if rejectCode, reason, ok := errcode.IsRejectCode(err); ok {
@@ -507,6 +532,12 @@ func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
+	// Remember when this peer last gave us something new; inbound eviction
+	// protects peers that are useful for transaction relay.
+	if len(acceptTxs) > 0 {
+		peer.UpdateLastTxTime(time.Now())
+	}
+
 	txentrys := make([]*mempool.TxEntry, 0, len(acceptTxs))
 	for _, tx := range acceptTxs {
 		if entry := lmempool.FindTxInMempool(tx.GetHash()); entry != nil {
@@ -527,20 +558,19 @@ func (sm *SyncManager) updateTxRequestState(state *peerSyncState, txHash util.Ha
 	delete(sm.requestedTxns, txHash)
 
 	// Do not request these transactions again until a new block has been processed.
-	for _, rejectTx := range rejectTxs {
-		sm.rejectedTxns[rejectTx] = struct{}{}
+	for i := range rejectTxs {
+		sm.recentRejects.AddHash(&rejectTxs[i])
 	}
-	sm.limitMap(sm.rejectedTxns, maxRejectedTxns)
 }
 
 func fetchMissingTx(missTxs []util.Hash, peer *peer.Peer) {
-	invMsg := wire.NewMsgInvSizeHint(uint(len(missTxs)))
-	for _, hash := range missTxs {
-		iv := wire.NewInvVect(wire.InvTypeTx, &hash)
-		invMsg.AddInvVect(iv)
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(len(missTxs)))
+	for i := range missTxs {
+		iv := wire.NewInvVect(wire.InvTypeTx, &missTxs[i])
+		gdmsg.AddInvVect(iv)
 	}
 	if len(missTxs) > 0 {
-		peer.QueueMessage(invMsg, nil)
+		peer.QueueMessage(gdmsg, nil)
 	}
 }
 
@@ -626,7 +656,7 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	_, err := sm.ProcessBlockCallBack(bmsg.block, requested || fromWhitelist)
+	isNewBlock, err := sm.ProcessBlockCallBack(bmsg.block, requested || fromWhitelist)
 	if err != nil {
 		// When the error is a rule error, it means the block was simply
 		// rejected as opposed to something actually going wrong, so log
@@ -673,6 +703,13 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	var heightUpdate int32
 	var blkHashUpdate *util.Hash
 
+	// Remember when this peer last delivered a block new to us, so that
+	// peers keeping us up to date are protected from inbound eviction.
+	// Replaying blocks we already have earns no protection.
+	if isNewBlock {
+		peer.UpdateLastBlockTime(time.Now())
+	}
+
 	// When the block is not an orphan, log information about it and
 	// update the chain state.
 	sm.progressLogger.LogBlockHeight(bmsg.block)
@@ -683,9 +720,6 @@ func (sm *SyncManager) handleBlockMsg(bmsg *blockMsg) {
 	heightUpdate = best.Height
 	blkHashUpdate = best.GetBlockHash()
 
-	// Clear the rejected transactions.
-	sm.rejectedTxns = make(map[util.Hash]struct{})
-
 	// Update the block height for this peer. But only send a message to
 	// the server for updating peer heights if this is an orphan or our
 	// chain is "current". This avoids sending a spammy amount of messages
@@ -836,10 +870,22 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 		return
 	}
 
-	// The remote peer is misbehaving if we didn't request headers.
+	// Peers which were sent sendheaders announce new blocks with their
+	// headers instead of invs.
 	msg := hmsg.headers
 	numHeaders := len(msg.Headers)
+	announced := announcesNewHeaders(msg.Headers)
+	if announced {
+		peer.UpdateLastBlockAnnouncement(time.Now())
+	}
+
+	// The remote peer is misbehaving if we didn't request headers, and
+	// they don't announce new blocks.
 	if !sm.headersFirstMode {
+		if announced && numHeaders <= maxHeadersAnnouncement {
+			sm.fetchAnnouncedBlocks(peer, msg.Headers)
+			return
+		}
 		log.Warn("Got %d unrequested headers from %s -- "+
 			"disconnecting", numHeaders, peer.Addr())
 		peer.Disconnect()
@@ -944,6 +990,43 @@ func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
 	}
 }
 
+// announcesNewHeaders tells whether the headers connect to each other and to a
+// block we know, and the last one is new to us.
+func announcesNewHeaders(headers []*block.BlockHeader) bool {
+	if len(headers) == 0 {
+		return false
+	}
+	activeChain := chain.GetInstance()
+	if activeChain.FindBlockIndex(headers[0].HashPrevBlock) == nil {
+		return false
+	}
+	for i := 1; i < len(headers); i++ {
+		prevHash := headers[i-1].GetHash()
+		if !headers[i].HashPrevBlock.IsEqual(&prevHash) {
+			return false
+		}
+	}
+	return activeChain.FindBlockIndex(headers[len(headers)-1].GetHash()) == nil
+}
+
+// fetchAnnouncedBlocks accepts the headers a peer announced new blocks with,
+// and requests the blocks as if the peer announced them with an inv.
+func (sm *SyncManager) fetchAnnouncedBlocks(peer *peer.Peer, headers []*block.BlockHeader) {
+	var lastBlkIndex blockindex.BlockIndex
+	if err := sm.ProcessBlockHeadCallBack(headers, &lastBlkIndex); err != nil {
+		log.Warn("processblockheader of headers announced by %s error : %s",
+			peer.Addr(), err.Error())
+		return
+	}
+
+	inv := wire.NewMsgInv()
+	for _, header := range headers {
+		hash := header.GetHash()
+		inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	}
+	sm.handleInvMsg(&invMsg{inv: inv, peer: peer})
+}
+
 // haveInventory returns whether or not the inventory represented by the passed
 // inventory vector is known.  This includes checking all of the various places
 // inventory can be when it is in different states such as blocks that are part
@@ -965,6 +1048,12 @@ func (sm *SyncManager) haveInventory(invVect *wire.InvVect) (bool, error) {
 		return false, nil
 
 	case wire.InvTypeTx:
+		// A transaction rejected since the tip last changed is known
+		// to be invalid, so it is not downloaded and checked again.
+		if sm.recentRejects.ContainsHash(&invVect.Hash) {
+			return true, nil
+		}
+
 		// Ask the transaction memory pool if the transaction is known
 		// to it in any form (main pool or orphan).
 		if lmempool.FindTxInMempool(invVect.Hash) != nil {
@@ -1074,14 +1163,9 @@ func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
 			continue
 		}
 		if !haveInv {
-			if iv.Type == wire.InvTypeTx {
-				// Skip the transaction if it has already been
-				// rejected.
-				if _, exists := sm.rejectedTxns[iv.Hash]; exists {
-					continue
-				}
+			if iv.Type == wire.InvTypeBlock {
+				peer.UpdateLastBlockAnnouncement(time.Now())
 			}
-
 			// Add it to the request queue.
 			state.requestQueue = append(state.requestQueue, iv)
 			continue
@@ -1187,9 +1271,15 @@ func (sm *SyncManager) limitMap(m map[util.Hash]struct{}, limit int) {
 // important because the sync manager controls which blocks are needed and how
 // the fetching should proceed.
 func (sm *SyncManager) messagesHandler() {
+	parentRetryTicker := time.NewTicker(parentRequestTimeout / 2)
+	defer parentRetryTicker.Stop()
+
 out:
 	for {
 		select {
+		case now := <-parentRetryTicker.C:
+			sm.retryParentRequests(now)
+
 		case m := <-sm.processBusinessChan:
 			switch msg := m.(type) {
 			case *newPeerMsg:
@@ -1238,6 +1328,9 @@ out:
 			case isCurrentMsg:
 				msg.reply <- sm.current()
 
+			case tipMayBeStaleMsg:
+				msg.reply <- sm.tipMayBeStale(time.Now())
+
 			case pauseMsg:
 				// Wait until the sender unpauses the manager.
 				<-msg.unpause
@@ -1269,6 +1362,10 @@ func (sm *SyncManager) handleBlockchainNotification(notification *chain.Notifica
 		if !ok {
 			panic("TipUpdatedEvent: malformed event payload")
 		}
+		atomic.StoreInt64(&sm.lastTipUpdate, time.Now().UnixNano())
+
+		// The transactions rejected may be valid on the new tip.
+		sm.recentRejects.Reset()
 
 		sm.peerNotifier.RelayUpdatedTipBlocks(event)
 
@@ -1487,6 +1584,29 @@ func (sm *SyncManager) IsCurrent() bool {
 	return <-reply
 }
 
+// LastTipUpdate returns the time at which the tip last changed, or the time the
+// sync manager was created if it never did.
+func (sm *SyncManager) LastTipUpdate() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&sm.lastTipUpdate))
+}
+
+// tipMayBeStale returns whether the tip has not advanced for several target
+// block intervals while no block is being downloaded, which hints that the
+// peers may be lagging or withholding blocks.  It must only be called from the
+// messagesHandler.
+func (sm *SyncManager) tipMayBeStale(now time.Time) bool {
+	targetSpacing := sm.chainParams.TargetTimePerBlock * time.Second
+	return now.Sub(sm.LastTipUpdate()) > staleTipFactor*targetSpacing &&
+		len(sm.requestedBlocks) == 0
+}
+
+// TipMayBeStale returns whether the tip may be stale.  See tipMayBeStale.
+func (sm *SyncManager) TipMayBeStale() bool {
+	reply := make(chan bool)
+	sm.processBusinessChan <- tipMayBeStaleMsg{reply: reply}
+	return <-reply
+}
+
 // Pause pauses the sync manager until the returned channel is closed.
 //
 // Note that while paused, all peer and block processing is halted.  The
@@ -1505,12 +1625,14 @@ func (sm *SyncManager) misbehaving(peerAddr string, banScore uint32, reason stri
 // block, tx, and inv updates.
 func New(config *Config) (*SyncManager, error) {
 	sm := SyncManager{
+		lastTipUpdate:       time.Now().UnixNano(),
 		peerNotifier:        config.PeerNotifier,
 		chainParams:         config.ChainParams,
-		rejectedTxns:        make(map[util.Hash]struct{}),
+		recentRejects:       bloom.NewRollingFilter(maxRejectedTxns, rejectedTxnsFPRate),
 		requestedTxns:       make(map[util.Hash]struct{}),
 		requestedBlocks:     make(map[util.Hash]struct{}),
 		peerStates:          make(map[*peer.Peer]*peerSyncState),
+		parentRequests:      make(map[util.Hash]*parentRequest),
 		progressLogger:      newBlockProgressLogger("Processed", log.GetLogger()),
 		processBusinessChan: make(chan interface{}, config.MaxPeers*3),
 		headerList:          list.New(),
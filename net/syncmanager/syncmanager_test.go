@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -27,9 +28,11 @@ import (
 	"github.com/copernet/copernicus/model/chain"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
 	"github.com/copernet/copernicus/model/pow"
 	"github.com/copernet/copernicus/model/script"
 	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/net/wire"
 	"github.com/copernet/copernicus/peer"
@@ -39,6 +42,7 @@ import (
 	"github.com/copernet/copernicus/service"
 	"github.com/copernet/copernicus/service/mining"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -176,6 +180,29 @@ func TestIsCurrent(t *testing.T) {
 	sm.Stop()
 }
 
+func TestTipMayBeStale(t *testing.T) {
+	sm, dir, err := makeSyncManager()
+	if err != nil {
+		t.Fatalf("construct syncmanager failed :%v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	sm.Start()
+	defer sm.Stop()
+
+	// A freshly started node gives the tip time to advance.
+	assert.False(t, sm.TipMayBeStale())
+
+	spacing := sm.chainParams.TargetTimePerBlock * time.Second
+	atomic.StoreInt64(&sm.lastTipUpdate, time.Now().Add(-4*spacing).UnixNano())
+	assert.True(t, sm.TipMayBeStale())
+
+	// Not while a block is being downloaded.
+	hash := util.Hash{1}
+	sm.requestedBlocks[hash] = struct{}{}
+	assert.False(t, sm.tipMayBeStale(time.Now()))
+	delete(sm.requestedBlocks, hash)
+}
+
 func TestQueueInv(t *testing.T) {
 	sm, dir, err := makeSyncManager()
 	if err != nil {
@@ -634,11 +661,17 @@ func TestSyncManager_alreadyHave(t *testing.T) {
 	ret := sm.alreadyHave(hash1)
 	assert.Equal(t, ret, false)
 
-	rejectedTxns := make(map[util.Hash]struct{})
-	rejectedTxns[*hash1] = struct{}{}
-	sm.rejectedTxns = rejectedTxns
+	sm.recentRejects.AddHash(hash1)
 	ret = sm.alreadyHave(hash1)
 	assert.Equal(t, ret, true)
+
+	// The rejects are forgotten once the tip changes.
+	sm.handleBlockchainNotification(&chain.Notification{
+		Type: chain.NTChainTipUpdated,
+		Data: &chain.TipUpdatedEvent{},
+	})
+	ret = sm.alreadyHave(hash1)
+	assert.Equal(t, ret, false)
 }
 
 func TestSyncManager_handleInvMsg(t *testing.T) {
@@ -804,6 +837,40 @@ func TestSyncManager_handleHeadersMsg(t *testing.T) {
 	sm.handleHeadersMsg(hmsg3)
 }
 
+func TestSyncManager_handleHeadersAnnouncement(t *testing.T) {
+	cleanup := initTestEnv()
+	defer cleanup()
+
+	sm, err := New(&Config{
+		PeerNotifier:       &mockPeerNotifier{},
+		ChainParams:        model.ActiveNetParams,
+		DisableCheckpoints: true,
+		MaxPeers:           8,
+	})
+	assert.Nil(t, err)
+	sm.ProcessBlockHeadCallBack = service.ProcessBlockHeader
+
+	inpeer := peer.NewInboundPeer(peer1Cfg, false)
+	sm.peerStates[inpeer] = getpeerState()
+
+	blks, err := generateBlocks(t, 1, 10000, false)
+	assert.Nil(t, err)
+	header := blks[0].Header
+	hash := header.GetHash()
+	headerMsg := wire.NewMsgHeaders()
+	assert.Nil(t, headerMsg.AddBlockHeader(&header))
+
+	// A new block announced with its header is requested, and the peer
+	// counts as announcing blocks.
+	sm.handleHeadersMsg(&headersMsg{headers: headerMsg, peer: inpeer})
+	assert.False(t, inpeer.LastBlockAnnouncement().IsZero())
+	_, requested := sm.requestedBlocks[hash]
+	assert.True(t, requested)
+
+	// The header is known now, so announcing it again counts for nothing.
+	assert.False(t, announcesNewHeaders(headerMsg.Headers))
+}
+
 func TestSyncManager_fetchHeaderBlocks(t *testing.T) {
 	sm, dir, err := makeSyncManager()
 	if err != nil {
@@ -853,12 +920,11 @@ func TestSyncManager_updateTxRequestState(t *testing.T) {
 	sm.peerStates[inpeer] = syncState
 	hash1 := util.HashFromString("00000000000001bcd6b635a1249dfbe76c0d001592a7219a36cd9bbd002c7238")
 
-	sm.rejectedTxns[*hash1] = struct{}{}
-
 	rejectedTxns := make([]util.Hash, 10)
 	rejectedTxns = append(rejectedTxns, *hash1)
 
 	sm.updateTxRequestState(syncState, *hash1, rejectedTxns)
+	assert.True(t, sm.recentRejects.ContainsHash(hash1))
 }
 
 func TestSyncManager_fetchMissingTx(t *testing.T) {
@@ -878,6 +944,37 @@ func TestSyncManager_fetchMissingTx(t *testing.T) {
 	fetchMissingTx(missTxs, inpeer)
 }
 
+func TestSyncManager_retryParentRequests(t *testing.T) {
+	sm, dir, err := makeSyncManager()
+	if err != nil {
+		t.Fatalf("construct syncmanager failed :%v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pool := mempool.NewTxMempool()
+	mempool.SetInstance(pool)
+	hash1 := util.HashFromString("00000000000001bcd6b635a1249dfbe76c0d001592a7219a36cd9bbd002c7238")
+	hash2 := util.HashFromString("00000000000001bcd6b635a1249dfbe76c0d001592a7219a36cd9bbd002c7239")
+	orphan := tx.NewTx(0, tx.TxVersion)
+	orphan.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(*hash1, 0), script.NewEmptyScript(), 0))
+	pool.AddOrphanTx(orphan, 1)
+
+	inpeer := peer.NewInboundPeer(peer1Cfg, false)
+	sm.peerStates[inpeer] = getpeerState()
+	now := time.Now()
+	sm.fetchMissingParents([]util.Hash{*hash1, *hash2}, inpeer, now)
+	sm.fetchMissingParents([]util.Hash{*hash1}, inpeer, now)
+	assert.Equal(t, 2, len(sm.parentRequests))
+	assert.Equal(t, 1, len(sm.parentRequests[*hash1].peers))
+
+	sm.retryParentRequests(now.Add(parentRequestTimeout / 2))
+	assert.Equal(t, 2, len(sm.parentRequests))
+
+	// No orphan waits for hash2 and no other peer may be asked for hash1.
+	sm.retryParentRequests(now.Add(parentRequestTimeout))
+	assert.Equal(t, 0, len(sm.parentRequests))
+}
+
 func TestSyncManager_handleBlockMsg(t *testing.T) {
 	cleanup := initTestEnv()
 	defer cleanup()
@@ -956,12 +1053,49 @@ func TestSyncManager_handleBlockMsg(t *testing.T) {
 	sm.handleBlockMsg(bmsg2)
 }
 
-func ProcessTxAcceptAll(txn *tx.Tx, recentRejects map[util.Hash]struct{}, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
+func TestSyncManager_handleBlockMsgLastBlockTime(t *testing.T) {
+	cleanup := initTestEnv()
+	defer cleanup()
+
+	sm, err := New(&Config{
+		PeerNotifier:       &mockPeerNotifier{},
+		ChainParams:        model.ActiveNetParams,
+		DisableCheckpoints: true,
+		MaxPeers:           8,
+	})
+	assert.Nil(t, err)
+
+	inpeer := peer.NewInboundPeer(peer1Cfg, false)
+	sm.peerStates[inpeer] = getpeerState()
+
+	blks, err := generateBlocks(t, 1, 10000, false)
+	assert.Nil(t, err)
+	bmsg := &blockMsg{
+		block: blks[0],
+		buf:   make([]byte, 10),
+		peer:  inpeer,
+	}
+
+	// A block we already had earns no eviction protection.
+	sm.ProcessBlockCallBack = func(*block.Block, bool) (bool, error) {
+		return false, nil
+	}
+	sm.handleBlockMsg(bmsg)
+	assert.True(t, inpeer.LastBlockTime().IsZero())
+
+	sm.ProcessBlockCallBack = func(*block.Block, bool) (bool, error) {
+		return true, nil
+	}
+	sm.handleBlockMsg(bmsg)
+	assert.False(t, inpeer.LastBlockTime().IsZero())
+}
+
+func ProcessTxAcceptAll(txn *tx.Tx, recentRejects *bloom.RollingFilter, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
 	acceptedTxs := []*tx.Tx{txn}
 	return acceptedTxs, nil, nil, nil
 }
 
-func ProcessTxReturnErr(txn *tx.Tx, recentRejects map[util.Hash]struct{}, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
+func ProcessTxReturnErr(txn *tx.Tx, recentRejects *bloom.RollingFilter, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
 	return nil, nil, nil, errors.New("test error")
 }
 
@@ -118,6 +118,12 @@ func sanitizeString(str string, maxLength uint) string {
 	return str
 }
 
+// MessageSummary returns a human-readable string which summarizes a message,
+// or an empty string for the messages which need none.
+func MessageSummary(msg wire.Message) string {
+	return messageSummary(msg)
+}
+
 // messageSummary returns a human-readable string which summarizes a message.
 // Not all messages have or need a summary.  This is used for debug logging.
 func messageSummary(msg wire.Message) string {
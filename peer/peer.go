@@ -5,7 +5,7 @@
 package peer
 
 import (
-	//"bytes"
+	"bytes"
 	"container/list"
 	"errors"
 	"fmt"
@@ -213,6 +213,15 @@ type MessageListeners struct {
 	// circumstances such as keeping track of server-wide byte counts.
 	OnWrite func(p *Peer, bytesWritten int, msg wire.Message, err error)
 
+	// OnReadRaw is invoked with the bytes of each message read from the
+	// peer, header included, as they were received.  Unlike OnRead, it is
+	// invoked for the messages which could not be decoded as well.
+	OnReadRaw func(p *Peer, raw []byte)
+
+	// OnWriteRaw is invoked with the bytes of each message written to the
+	// peer, header included.
+	OnWriteRaw func(p *Peer, raw []byte)
+
 	OnTransferMsgToBusinessPro func(msg *PeerMessage, done chan<- struct{})
 }
 
@@ -357,33 +366,31 @@ type stallControlMsg struct {
 
 // StatsSnap is a snapshot of peer stats at a point in time.
 type StatsSnap struct {
-	ID                    int32
-	Addr                  string
-	Services              wire.ServiceFlag
-	LastSend              time.Time
-	LastRecv              time.Time
-	BytesSent             uint64
-	BytesRecv             uint64
-	ConnTime              time.Time
-	TimeOffset            int64
-	Version               uint32
-	UserAgent             string
-	Inbound               bool
-	StartingHeight        int32
-	LastBlock             int32
-	LastPingNonce         uint64
-	LastPingTime          time.Time
-	LastPingMicros        int64
-	AddNode               bool
-	MingPing              float64
-	PingWait              float64
-	SyncedHeaders         int
-	SyncedBlocks          int
-	Inflight              []int
-	WhiteListed           bool
-	UsesCashMagic         bool
-	MapSendBytesPerMsgCmd map[string]uint64
-	MapRecvBytesPerMsgCmd map[string]uint64
+	ID             int32
+	Addr           string
+	Services       wire.ServiceFlag
+	LastSend       time.Time
+	LastRecv       time.Time
+	BytesSent      uint64
+	BytesRecv      uint64
+	ConnTime       time.Time
+	TimeOffset     int64
+	Version        uint32
+	UserAgent      string
+	Inbound        bool
+	StartingHeight int32
+	LastBlock      int32
+	LastPingNonce  uint64
+	LastPingTime   time.Time
+	LastPingMicros int64
+	AddNode        bool
+	MingPing       float64
+	PingWait       float64
+	SyncedHeaders  int
+	SyncedBlocks   int
+	Inflight       []int
+	WhiteListed    bool
+	UsesCashMagic  bool
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -474,6 +481,9 @@ type Peer struct {
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
+	lastBlockTime      time.Time // Time a novel block was last received.
+	lastTxTime         time.Time // Time a novel transaction was last received.
+	lastBlockAnnounce  time.Time // Time a block unknown to us was last announced.
 
 	stallControl      chan stallControlMsg
 	outputQueue       chan outMsg
@@ -532,6 +542,36 @@ func (p *Peer) UpdateLastAnnouncedBlock(blkHash *util.Hash) {
 	p.statsMtx.Unlock()
 }
 
+// UpdateLastBlockAnnouncement records the time at which the peer last
+// announced a block unknown to us.
+//
+// This function is safe for concurrent access.
+func (p *Peer) UpdateLastBlockAnnouncement(t time.Time) {
+	p.statsMtx.Lock()
+	p.lastBlockAnnounce = t
+	p.statsMtx.Unlock()
+}
+
+// UpdateLastBlockTime records the time at which the peer last delivered a
+// block that was new to us and connected successfully.
+//
+// This function is safe for concurrent access.
+func (p *Peer) UpdateLastBlockTime(t time.Time) {
+	p.statsMtx.Lock()
+	p.lastBlockTime = t
+	p.statsMtx.Unlock()
+}
+
+// UpdateLastTxTime records the time at which the peer last delivered a
+// transaction that was new to us and accepted to the mempool.
+//
+// This function is safe for concurrent access.
+func (p *Peer) UpdateLastTxTime(t time.Time) {
+	p.statsMtx.Lock()
+	p.lastTxTime = t
+	p.statsMtx.Unlock()
+}
+
 // AddKnownInventory adds the passed inventory to the cache of known inventory
 // for the peer.
 //
@@ -540,6 +580,14 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// HasKnownInventory returns whether the passed inventory is already known to
+// the peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) HasKnownInventory(invVect *wire.InvVect) bool {
+	return p.knownInventory.Exists(invVect)
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -683,6 +731,42 @@ func (p *Peer) LastPingMicros() int64 {
 	return lastPingMicros
 }
 
+// LastBlockAnnouncement returns the time at which the peer last announced a
+// block unknown to us.  The zero time is returned if it never did.
+//
+// This function is safe for concurrent access.
+func (p *Peer) LastBlockAnnouncement() time.Time {
+	p.statsMtx.RLock()
+	lastBlockAnnounce := p.lastBlockAnnounce
+	p.statsMtx.RUnlock()
+
+	return lastBlockAnnounce
+}
+
+// LastBlockTime returns the time at which the peer last delivered a novel
+// block.  The zero time is returned if it never did.
+//
+// This function is safe for concurrent access.
+func (p *Peer) LastBlockTime() time.Time {
+	p.statsMtx.RLock()
+	lastBlockTime := p.lastBlockTime
+	p.statsMtx.RUnlock()
+
+	return lastBlockTime
+}
+
+// LastTxTime returns the time at which the peer last delivered a novel
+// transaction.  The zero time is returned if it never did.
+//
+// This function is safe for concurrent access.
+func (p *Peer) LastTxTime() time.Time {
+	p.statsMtx.RLock()
+	lastTxTime := p.lastTxTime
+	p.statsMtx.RUnlock()
+
+	return lastTxTime
+}
+
 // VersionKnown returns the whether or not the version of a peer is known
 // locally.
 //
@@ -1205,9 +1289,17 @@ func (p *Peer) readMessage(encoding wire.MessageEncoding) (wire.Message, []byte,
 		}
 	}()
 
-	n, msg, buf, err := wire.ReadMessageWithEncodingN(p.conn,
+	var r io.Reader = p.conn
+	var raw bytes.Buffer
+	if p.Cfg.Listeners.OnReadRaw != nil {
+		r = io.TeeReader(p.conn, &raw)
+	}
+	n, msg, buf, err := wire.ReadMessageWithEncodingN(r,
 		p.ProtocolVersion(), p.Cfg.ChainParams.BitcoinNet, encoding)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	if p.Cfg.Listeners.OnReadRaw != nil && raw.Len() != 0 {
+		p.Cfg.Listeners.OnReadRaw(p, raw.Bytes())
+	}
 	if p.Cfg.Listeners.OnRead != nil {
 		p.Cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1234,9 +1326,17 @@ func (p *Peer) writeMessage(msg wire.Message, enc wire.MessageEncoding) error {
 	log.Debug("write summary %v (%s) to %s", msg.Command(), messageSummary(msg), p)
 
 	// Write the message to the peer.
-	n, err := wire.WriteMessageWithEncodingN(p.conn, msg,
+	var w io.Writer = p.conn
+	var raw bytes.Buffer
+	if p.Cfg.Listeners.OnWriteRaw != nil {
+		w = io.MultiWriter(p.conn, &raw)
+	}
+	n, err := wire.WriteMessageWithEncodingN(w, msg,
 		p.ProtocolVersion(), p.Cfg.ChainParams.BitcoinNet, enc)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	if p.Cfg.Listeners.OnWriteRaw != nil && raw.Len() != 0 {
+		p.Cfg.Listeners.OnWriteRaw(p, raw.Bytes())
+	}
 	if p.Cfg.Listeners.OnWrite != nil {
 		p.Cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -384,6 +384,43 @@ func NewGetMempoolEntryCmd(txHash string) *GetMempoolEntryCmd {
 	}
 }
 
+// GetMempoolEventsCmd defines the getmempoolevents JSON-RPC command.
+type GetMempoolEventsCmd struct {
+	Since   *uint64 `jsonrpcdefault:"0"`
+	Timeout *int    `jsonrpcdefault:"0"`
+}
+
+// NewGetMempoolEventsCmd returns a new instance which can be used to issue a
+// getmempoolevents JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolEventsCmd(since *uint64, timeout *int) *GetMempoolEventsCmd {
+	return &GetMempoolEventsCmd{
+		Since:   since,
+		Timeout: timeout,
+	}
+}
+
+// GetMempoolFeeHistogramCmd defines the getmempoolfeehistogram JSON-RPC
+// command.
+type GetMempoolFeeHistogramCmd struct {
+	Boundaries *[]float64
+	Ancestor   *bool `jsonrpcdefault:"false"`
+}
+
+// NewGetMempoolFeeHistogramCmd returns a new instance which can be used to
+// issue a getmempoolfeehistogram JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetMempoolFeeHistogramCmd(boundaries *[]float64, ancestor *bool) *GetMempoolFeeHistogramCmd {
+	return &GetMempoolFeeHistogramCmd{
+		Boundaries: boundaries,
+		Ancestor:   ancestor,
+	}
+}
+
 // GetMempoolInfoCmd defines the getmempoolinfo JSON-RPC command.
 type GetMempoolInfoCmd struct{}
 
@@ -393,6 +430,46 @@ func NewGetMempoolInfoCmd() *GetMempoolInfoCmd {
 	return &GetMempoolInfoCmd{}
 }
 
+// GetMempoolPolicyCmd defines the getmempoolpolicy JSON-RPC command.
+type GetMempoolPolicyCmd struct{}
+
+// NewGetMempoolPolicyCmd returns a new instance which can be used to issue a
+// getmempoolpolicy JSON-RPC command.
+func NewGetMempoolPolicyCmd() *GetMempoolPolicyCmd {
+	return &GetMempoolPolicyCmd{}
+}
+
+// MempoolPolicy models the settings of a mempool policy changed by the
+// setmempoolpolicy command.  The nil settings are left as they are.
+type MempoolPolicy struct {
+	Name                  string   `json:"name"`
+	EnableRules           []string `json:"enablerules,omitempty"`
+	DisableRules          []string `json:"disablerules,omitempty"`
+	MinTxSize             *uint    `json:"mintxsize,omitempty"`
+	MaxTxSize             *uint    `json:"maxtxsize,omitempty"`
+	ScriptTemplates       []string `json:"scripttemplates,omitempty"`
+	MaxDataCarrierOutputs *int     `json:"maxdatacarrieroutputs,omitempty"`
+	MaxDataCarrierBytes   *uint    `json:"maxdatacarrierbytes,omitempty"`
+	DustRelayFee          *float64 `json:"dustrelayfee,omitempty"`
+	MinRelayFee           *float64 `json:"minrelayfee,omitempty"`
+}
+
+// SetMempoolPolicyCmd defines the setmempoolpolicy JSON-RPC command.
+type SetMempoolPolicyCmd struct {
+	Policy *MempoolPolicy
+}
+
+// NewSetMempoolPolicyCmd returns a new instance which can be used to issue a
+// setmempoolpolicy JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetMempoolPolicyCmd(policy *MempoolPolicy) *SetMempoolPolicyCmd {
+	return &SetMempoolPolicyCmd{
+		Policy: policy,
+	}
+}
+
 // GetMiningInfoCmd defines the getmininginfo JSON-RPC command.
 type GetMiningInfoCmd struct{}
 
@@ -438,6 +515,22 @@ func NewGetNetworkHashPSCmd(numBlocks *int32, height *int32) *GetNetworkHashPSCm
 	}
 }
 
+// GetOrphanTxsCmd defines the getorphantxs JSON-RPC command.
+type GetOrphanTxsCmd struct {
+	Verbosity *int `jsonrpcdefault:"0"`
+}
+
+// NewGetOrphanTxsCmd returns a new instance which can be used to issue a
+// getorphantxs JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetOrphanTxsCmd(verbosity *int) *GetOrphanTxsCmd {
+	return &GetOrphanTxsCmd{
+		Verbosity: verbosity,
+	}
+}
+
 // GetPeerInfoCmd defines the getpeerinfo JSON-RPC command.
 type GetPeerInfoCmd struct{}
 
@@ -664,6 +757,37 @@ func NewSendRawTransactionCmd(hexTx string, allowHighFees *bool) *SendRawTransac
 	}
 }
 
+// TestMempoolAcceptCmd defines the testmempoolaccept JSON-RPC command.
+type TestMempoolAcceptCmd struct {
+	RawTxs        []string `json:"rawtxs"`
+	AllowHighFees *bool    `json:"allowhighfees" jsonrpcdefault:"false"`
+}
+
+// NewTestMempoolAcceptCmd returns a new instance which can be used to issue a
+// testmempoolaccept JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewTestMempoolAcceptCmd(rawTxs []string, allowHighFees *bool) *TestMempoolAcceptCmd {
+	return &TestMempoolAcceptCmd{
+		RawTxs:        rawTxs,
+		AllowHighFees: allowHighFees,
+	}
+}
+
+// SubmitPackageCmd defines the submitpackage JSON-RPC command.
+type SubmitPackageCmd struct {
+	RawTxs []string `json:"package"`
+}
+
+// NewSubmitPackageCmd returns a new instance which can be used to issue a
+// submitpackage JSON-RPC command.
+func NewSubmitPackageCmd(rawTxs []string) *SubmitPackageCmd {
+	return &SubmitPackageCmd{
+		RawTxs: rawTxs,
+	}
+}
+
 // StopCmd defines the stop JSON-RPC command.
 type StopCmd struct{}
 
@@ -795,6 +919,24 @@ func NewPruneBlockChainCmd(height int) *PruneBlockChainCmd {
 	}
 }
 
+// SaveMempoolCmd defines the savemempool JSON-RPC command.
+type SaveMempoolCmd struct{}
+
+// NewSaveMempoolCmd returns a new instance which can be used to issue a
+// savemempool JSON-RPC command.
+func NewSaveMempoolCmd() *SaveMempoolCmd {
+	return &SaveMempoolCmd{}
+}
+
+// LoadMempoolCmd defines the loadmempool JSON-RPC command.
+type LoadMempoolCmd struct{}
+
+// NewLoadMempoolCmd returns a new instance which can be used to issue a
+// loadmempool JSON-RPC command.
+func NewLoadMempoolCmd() *LoadMempoolCmd {
+	return &LoadMempoolCmd{}
+}
+
 type GetMempoolAncestorsCmd struct {
 	TxID    string `json:"txid"`
 	Verbose *bool  `json:"verbose" jsonrpcdefault:"false"`
@@ -1042,11 +1184,15 @@ func init() {
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
+	MustRegisterCmd("getmempoolevents", (*GetMempoolEventsCmd)(nil), flags)
+	MustRegisterCmd("getmempoolfeehistogram", (*GetMempoolFeeHistogramCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
+	MustRegisterCmd("getmempoolpolicy", (*GetMempoolPolicyCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
 	MustRegisterCmd("getnetworkinfo", (*GetNetworkInfoCmd)(nil), flags)
 	MustRegisterCmd("getnettotals", (*GetNetTotalsCmd)(nil), flags)
 	MustRegisterCmd("getnetworkhashps", (*GetNetworkHashPSCmd)(nil), flags)
+	MustRegisterCmd("getorphantxs", (*GetOrphanTxsCmd)(nil), flags)
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
@@ -1062,6 +1208,8 @@ func init() {
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("testmempoolaccept", (*TestMempoolAcceptCmd)(nil), flags)
+	MustRegisterCmd("submitpackage", (*SubmitPackageCmd)(nil), flags)
 	MustRegisterCmd("signmessagewithprivkey", (*SignMessageWithPrivkeyCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
@@ -1071,9 +1219,12 @@ func init() {
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
 	MustRegisterCmd("getmempoolancestors", (*GetMempoolAncestorsCmd)(nil), flags)
 	MustRegisterCmd("getmempooldescendants", (*GetMempoolDescendantsCmd)(nil), flags)
+	MustRegisterCmd("savemempool", (*SaveMempoolCmd)(nil), flags)
+	MustRegisterCmd("loadmempool", (*LoadMempoolCmd)(nil), flags)
 	MustRegisterCmd("signrawtransaction", (*SignRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("verifytxoutproof", (*VerifyTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("setmocktime", (*SetMocktimeCmd)(nil), flags)
+	MustRegisterCmd("setmempoolpolicy", (*SetMempoolPolicyCmd)(nil), flags)
 
 	MustRegisterCmd("disconnectnode", (*DisconnectNodeCmd)(nil), flags)
 	MustRegisterCmd("setnetworkactive", (*SetNetWorkActiveCmd)(nil), flags)
@@ -1086,6 +1237,9 @@ func init() {
 	MustRegisterCmd("pruneblockchain", (*PruneBlockChainCmd)(nil), flags)
 	MustRegisterCmd("createmultisig", (*CreateMultiSigCmd)(nil), flags)
 	MustRegisterCmd("estimatefee", (*EstimateFeeCmd)(nil), flags)
+	MustRegisterCmd("estimatesmartfee", (*EstimateSmartFeeCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
+	MustRegisterCmd("getprioritisedtransactions", (*GetPrioritisedTransactionsCmd)(nil), flags)
 
 	MustRegisterCmd("waitforblockheight", (*WaitForBlockHeightCmd)(nil), flags)
 	MustRegisterCmd("echo", (*EchoCmd)(nil), flags)
@@ -394,6 +394,62 @@ func TestChainSvrCmds(t *testing.T) {
 				TxID: "txhash",
 			},
 		},
+		{
+			name: "getmempoolevents",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getmempoolevents")
+			},
+			staticCmd: func() interface{} {
+				return NewGetMempoolEventsCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolevents","params":[],"id":1}`,
+			unmarshalled: &GetMempoolEventsCmd{
+				Since:   Uint64(0),
+				Timeout: Int(0),
+			},
+		},
+		{
+			name: "getmempoolevents optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getmempoolevents", 12, 30)
+			},
+			staticCmd: func() interface{} {
+				return NewGetMempoolEventsCmd(Uint64(12), Int(30))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolevents","params":[12,30],"id":1}`,
+			unmarshalled: &GetMempoolEventsCmd{
+				Since:   Uint64(12),
+				Timeout: Int(30),
+			},
+		},
+		{
+			name: "getmempoolfeehistogram",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getmempoolfeehistogram")
+			},
+			staticCmd: func() interface{} {
+				return NewGetMempoolFeeHistogramCmd(nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolfeehistogram","params":[],"id":1}`,
+			unmarshalled: &GetMempoolFeeHistogramCmd{
+				Boundaries: nil,
+				Ancestor:   Bool(false),
+			},
+		},
+		{
+			name: "getmempoolfeehistogram optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getmempoolfeehistogram", []float64{1, 2.5, 10}, true)
+			},
+			staticCmd: func() interface{} {
+				return NewGetMempoolFeeHistogramCmd(&[]float64{1, 2.5, 10}, Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getmempoolfeehistogram","params":[[1,2.5,10],true],"id":1}`,
+			unmarshalled: &GetMempoolFeeHistogramCmd{
+				Boundaries: &[]float64{1, 2.5, 10},
+				Ancestor:   Bool(true),
+			},
+		},
 		{
 			name: "getmempoolinfo",
 			newCmd: func() (interface{}, error) {
@@ -405,6 +461,51 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getmempoolinfo","params":[],"id":1}`,
 			unmarshalled: &GetMempoolInfoCmd{},
 		},
+		{
+			name: "getmempoolpolicy",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getmempoolpolicy")
+			},
+			staticCmd: func() interface{} {
+				return NewGetMempoolPolicyCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getmempoolpolicy","params":[],"id":1}`,
+			unmarshalled: &GetMempoolPolicyCmd{},
+		},
+		{
+			name: "setmempoolpolicy",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("setmempoolpolicy")
+			},
+			staticCmd: func() interface{} {
+				return NewSetMempoolPolicyCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setmempoolpolicy","params":[],"id":1}`,
+			unmarshalled: &SetMempoolPolicyCmd{
+				Policy: nil,
+			},
+		},
+		{
+			name: "setmempoolpolicy optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("setmempoolpolicy", `{"name":"relaxed","disablerules":["dust"],"maxdatacarrieroutputs":2}`)
+			},
+			staticCmd: func() interface{} {
+				return NewSetMempoolPolicyCmd(&MempoolPolicy{
+					Name:                  "relaxed",
+					DisableRules:          []string{"dust"},
+					MaxDataCarrierOutputs: Int(2),
+				})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setmempoolpolicy","params":[{"name":"relaxed","disablerules":["dust"],"maxdatacarrieroutputs":2}],"id":1}`,
+			unmarshalled: &SetMempoolPolicyCmd{
+				Policy: &MempoolPolicy{
+					Name:                  "relaxed",
+					DisableRules:          []string{"dust"},
+					MaxDataCarrierOutputs: Int(2),
+				},
+			},
+		},
 		{
 			name: "getmininginfo",
 			newCmd: func() (interface{}, error) {
@@ -491,6 +592,32 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getpeerinfo","params":[],"id":1}`,
 			unmarshalled: &GetPeerInfoCmd{},
 		},
+		{
+			name: "getorphantxs",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getorphantxs")
+			},
+			staticCmd: func() interface{} {
+				return NewGetOrphanTxsCmd(nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getorphantxs","params":[],"id":1}`,
+			unmarshalled: &GetOrphanTxsCmd{
+				Verbosity: Int(0),
+			},
+		},
+		{
+			name: "getorphantxs optional",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getorphantxs", 2)
+			},
+			staticCmd: func() interface{} {
+				return NewGetOrphanTxsCmd(Int(2))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getorphantxs","params":[2],"id":1}`,
+			unmarshalled: &GetOrphanTxsCmd{
+				Verbosity: Int(2),
+			},
+		},
 		{
 			name: "getrawmempool",
 			newCmd: func() (interface{}, error) {
@@ -705,6 +832,28 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "savemempool",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("savemempool")
+			},
+			staticCmd: func() interface{} {
+				return NewSaveMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"savemempool","params":[],"id":1}`,
+			unmarshalled: &SaveMempoolCmd{},
+		},
+		{
+			name: "loadmempool",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("loadmempool")
+			},
+			staticCmd: func() interface{} {
+				return NewLoadMempoolCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"loadmempool","params":[],"id":1}`,
+			unmarshalled: &LoadMempoolCmd{},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -871,6 +1020,33 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: Bool(false),
 			},
 		},
+		{
+			name: "testmempoolaccept",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("testmempoolaccept", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return NewTestMempoolAcceptCmd([]string{"1122", "3344"}, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"testmempoolaccept","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &TestMempoolAcceptCmd{
+				RawTxs:        []string{"1122", "3344"},
+				AllowHighFees: Bool(false),
+			},
+		},
+		{
+			name: "submitpackage",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("submitpackage", []string{"1122", "3344"})
+			},
+			staticCmd: func() interface{} {
+				return NewSubmitPackageCmd([]string{"1122", "3344"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"submitpackage","params":[["1122","3344"]],"id":1}`,
+			unmarshalled: &SubmitPackageCmd{
+				RawTxs: []string{"1122", "3344"},
+			},
+		},
 		{
 			name: "sendrawtransaction optional",
 			newCmd: func() (interface{}, error) {
@@ -1226,6 +1402,45 @@ func TestChainSvrCmds(t *testing.T) {
 				NumBlocks: 123,
 			},
 		},
+		{
+			name: "estimatesmartfee",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("estimatesmartfee", 6)
+			},
+			staticCmd: func() interface{} {
+				return NewEstimateSmartFeeCmd(6)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6],"id":1}`,
+			unmarshalled: &EstimateSmartFeeCmd{
+				NumBlocks: 6,
+			},
+		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("prioritisetransaction", "123", 0.0, 10000)
+			},
+			staticCmd: func() interface{} {
+				return NewPrioritiseTransactionCmd("123", 0.0, 10000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",0,10000],"id":1}`,
+			unmarshalled: &PrioritiseTransactionCmd{
+				TxID:          "123",
+				PriorityDelta: 0.0,
+				FeeDelta:      10000,
+			},
+		},
+		{
+			name: "getprioritisedtransactions",
+			newCmd: func() (interface{}, error) {
+				return NewCmd("getprioritisedtransactions")
+			},
+			staticCmd: func() interface{} {
+				return NewGetPrioritisedTransactionsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getprioritisedtransactions","params":[],"id":1}`,
+			unmarshalled: &GetPrioritisedTransactionsCmd{},
+		},
 		{
 			name: "getbestblock",
 			newCmd: func() (interface{}, error) {
@@ -72,6 +72,46 @@ func NewEstimateFeeCmd(numBlocks int64) *EstimateFeeCmd {
 	}
 }
 
+// EstimateSmartFeeCmd defines the estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeCmd struct {
+	NumBlocks int64
+}
+
+// NewEstimateSmartFeeCmd returns a new instance which can be used to issue a
+// estimatesmartfee JSON-RPC command.
+func NewEstimateSmartFeeCmd(numBlocks int64) *EstimateSmartFeeCmd {
+	return &EstimateSmartFeeCmd{
+		NumBlocks: numBlocks,
+	}
+}
+
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+type PrioritiseTransactionCmd struct {
+	TxID          string
+	PriorityDelta float64
+	FeeDelta      int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to
+// issue a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txID string, priorityDelta float64, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		TxID:          txID,
+		PriorityDelta: priorityDelta,
+		FeeDelta:      feeDelta,
+	}
+}
+
+// GetPrioritisedTransactionsCmd defines the getprioritisedtransactions
+// JSON-RPC command.
+type GetPrioritisedTransactionsCmd struct{}
+
+// NewGetPrioritisedTransactionsCmd returns a new instance which can be used to
+// issue a getprioritisedtransactions JSON-RPC command.
+func NewGetPrioritisedTransactionsCmd() *GetPrioritisedTransactionsCmd {
+	return &GetPrioritisedTransactionsCmd{}
+}
+
 // GenerateToAddressCmd defines the generatetoaddress JSON-RPC command.
 type GenerateToAddressCmd struct {
 	NumBlocks uint32  `json:"nblocks"`
@@ -125,6 +125,7 @@ type GetBlockChainInfoResult struct {
 	ChainWork            string                              `json:"chainwork,omitempty"`
 	SoftForks            []*SoftForkDescription              `json:"softforks"`
 	Bip9SoftForks        map[string]*Bip9SoftForkDescription `json:"bip9_softforks"`
+	Warnings             string                              `json:"warnings"`
 }
 
 // GetBlockTemplateResultTx models the transactions field of the
@@ -208,14 +209,89 @@ type GetMempoolEntryResult struct {
 	Depends          []string `json:"depends"`
 }
 
+// MempoolEventResult models a mempool event returned by the
+// getmempoolevents command.
+type MempoolEventResult struct {
+	Sequence   uint64 `json:"sequence"`
+	Type       string `json:"type"`
+	TxID       string `json:"txid"`
+	Time       int64  `json:"time"`
+	Reason     string `json:"reason,omitempty"`
+	ReplacedBy string `json:"replaced_by,omitempty"`
+}
+
+// GetMempoolEventsResult models the data returned from the getmempoolevents
+// command.
+type GetMempoolEventsResult struct {
+	Events   []*MempoolEventResult `json:"events"`
+	Sequence uint64                `json:"sequence"`
+	Dropped  uint64                `json:"dropped"`
+}
+
+// MempoolFeeHistogramBucket models a fee rate band returned by the
+// getmempoolfeehistogram command.
+type MempoolFeeHistogramBucket struct {
+	FeeRate         float64 `json:"feerate"`
+	Count           int     `json:"count"`
+	VSize           int64   `json:"vsize"`
+	CumulativeVSize int64   `json:"cumulative_vsize"`
+}
+
+// GetMempoolFeeHistogramResult models the data returned from the
+// getmempoolfeehistogram command.
+type GetMempoolFeeHistogramResult struct {
+	Ancestor bool                         `json:"ancestor"`
+	Buckets  []*MempoolFeeHistogramBucket `json:"buckets"`
+}
+
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size          int     `json:"size"`
-	Bytes         uint64  `json:"bytes"`
-	Usage         int64   `json:"usage"`
-	MaxMempool    int     `json:"maxmempool"`
-	MempoolMinFee float64 `json:"mempoolminfee"`
+	Size          int               `json:"size"`
+	Bytes         uint64            `json:"bytes"`
+	Usage         int64             `json:"usage"`
+	MaxMempool    int               `json:"maxmempool"`
+	MempoolMinFee float64           `json:"mempoolminfee"`
+	Rejected      map[string]uint64 `json:"rejected"`
+}
+
+// GetMempoolPolicyResult models the data returned from the getmempoolpolicy
+// and setmempoolpolicy commands.
+type GetMempoolPolicyResult struct {
+	Name                  string          `json:"name"`
+	Rules                 map[string]bool `json:"rules"`
+	MinTxSize             uint            `json:"mintxsize"`
+	MaxTxSize             uint            `json:"maxtxsize"`
+	ScriptTemplates       []string        `json:"scripttemplates"`
+	MaxDataCarrierOutputs int             `json:"maxdatacarrieroutputs"`
+	MaxDataCarrierBytes   uint            `json:"maxdatacarrierbytes"`
+	DustRelayFee          float64         `json:"dustrelayfee"`
+	MinRelayFee           float64         `json:"minrelayfee"`
+	MaxTxSigOps           uint            `json:"maxtxsigops"`
+	MaxP2SHSigOps         uint            `json:"maxp2shsigops"`
+}
+
+// EstimateSmartFeeResult models the data returned from the estimatesmartfee
+// command.
+type EstimateSmartFeeResult struct {
+	FeeRate float64 `json:"feerate"`
+	Blocks  int64   `json:"blocks"`
+}
+
+// PrioritisedTransactionResult models a transaction of the data returned from
+// the getprioritisedtransactions command.
+type PrioritisedTransactionResult struct {
+	FeeDelta    int64  `json:"fee_delta"`
+	InMempool   bool   `json:"in_mempool"`
+	ModifiedFee *int64 `json:"modified_fee,omitempty"`
+}
+
+// LoadMempoolResult models the data returned from the loadmempool command.
+type LoadMempoolResult struct {
+	Loaded       int `json:"loaded"`
+	Failed       int `json:"failed"`
+	Expired      int `json:"expired"`
+	AlreadyThere int `json:"alreadythere"`
 }
 
 // NetworksResult models the networks data from the getnetworkinfo command.
@@ -258,6 +334,7 @@ type GetPeerInfoResult struct {
 	ID              int32             `json:"id"`
 	Addr            string            `json:"addr"`
 	AddrLocal       string            `json:"addrlocal,omitempty"`
+	MappedAS        uint32            `json:"mapped_as,omitempty"`
 	Services        string            `json:"services"`
 	RelayTxes       bool              `json:"relaytxes"`
 	LastSend        int64             `json:"lastsend"`
@@ -275,6 +352,7 @@ type GetPeerInfoResult struct {
 	AddNode         bool              `json:"addnode"`
 	StartingHeight  int32             `json:"startingheight"`
 	BanScore        int32             `json:"banscore,omitempty"`
+	BanScoreDecay   uint32            `json:"banscore_decaying,omitempty"`
 	SyncedHeaders   int               `json:"synced_headers,omitempty"`
 	SyncedBlocks    int               `json:"synced_blocks,omitempty"`
 	Inflight        []int             `json:"inflight,omitempty"`
@@ -282,6 +360,21 @@ type GetPeerInfoResult struct {
 	CashMagic       bool              `json:"cashmagic"`
 	BytesSendPerMsg map[string]uint64 `json:"bytessent_per_msg"`
 	BytesRecvPerMsg map[string]uint64 `json:"bytesrecv_per_msg"`
+	MsgsSendPerMsg  map[string]uint64 `json:"msgssent_per_msg"`
+	MsgsRecvPerMsg  map[string]uint64 `json:"msgsrecv_per_msg"`
+}
+
+// GetOrphanTxsResult models an orphan returned by the getorphantxs command
+// when the verbosity is 1 or 2.  When the verbosity is 0, getorphantxs
+// returns an array of transaction hashes.
+type GetOrphanTxsResult struct {
+	TxID           string   `json:"txid"`
+	Size           int      `json:"bytes"`
+	Time           int64    `json:"entry"`
+	Expiration     int64    `json:"expiration"`
+	From           int64    `json:"from"`
+	MissingParents []string `json:"missing_parents"`
+	Hex            string   `json:"hex,omitempty"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
@@ -335,7 +428,9 @@ type GetNetTotalsResult struct {
 	TotalBytesRecv uint64       `json:"totalbytesrecv"`
 	TotalBytesSent uint64       `json:"totalbytessent"`
 	TimeMillis     int64        `json:"timemillis"`
-	Uploadtarget   Uploadtarget `json:"pploadtarget"`
+	Uploadtarget   Uploadtarget `json:"uploadtarget"`
+	UploadRate     UploadRate   `json:"uploadrate"`
+	FeeFilter      FeeFilter    `json:"feefilter"`
 }
 
 type Uploadtarget struct {
@@ -347,6 +442,28 @@ type Uploadtarget struct {
 	TimeLeftInCycle       uint64 `json:"time_left_in_cycle"`
 }
 
+// UploadRate models the upload rate limit status returned by getnettotals.
+type UploadRate struct {
+	Limit          uint64 `json:"limit"`
+	AvailableBytes uint64 `json:"available_bytes"`
+	ThrottledTime  uint64 `json:"throttled_time"`
+}
+
+// FeeFilter models the feefilter statistics returned by getnettotals.
+type FeeFilter struct {
+	FeeRate    float64          `json:"feerate"`
+	Sent       uint64           `json:"sent"`
+	BeforeSent FeeFilterTraffic `json:"before_sent"`
+	AfterSent  FeeFilterTraffic `json:"after_sent"`
+}
+
+// FeeFilterTraffic models the transactions received from peers before or
+// after we sent them a feefilter, returned by getnettotals.
+type FeeFilterTraffic struct {
+	Bytes       uint64 `json:"bytes"`
+	LowFeeBytes uint64 `json:"low_fee_bytes"`
+}
+
 // ScriptSig models a signature script.  It is defined separately since it only
 // applies to non-coinbase.  Therefore the field in the Vin structure needs
 // to be a pointer.
@@ -588,6 +705,32 @@ type SignRawTransactionResult struct {
 	Errors   []*SignRawTransactionError `json:"errors,omitempty"`
 }
 
+// TestMempoolAcceptResult models a transaction of the data returned from the
+// testmempoolaccept command.
+type TestMempoolAcceptResult struct {
+	TxID         string  `json:"txid"`
+	Allowed      bool    `json:"allowed"`
+	Size         int     `json:"size,omitempty"`
+	Fee          float64 `json:"fee,omitempty"`
+	RejectCode   string  `json:"reject-code,omitempty"`
+	RejectReason string  `json:"reject-reason,omitempty"`
+}
+
+// SubmitPackageTxResult models a transaction of the data returned from the
+// submitpackage command.
+type SubmitPackageTxResult struct {
+	TxID  string  `json:"txid"`
+	Size  int     `json:"size,omitempty"`
+	Fee   float64 `json:"fee,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// SubmitPackageResult models the data returned from the submitpackage command.
+type SubmitPackageResult struct {
+	PackageMsg string                   `json:"package_msg"`
+	TxResults  []*SubmitPackageTxResult `json:"tx-results"`
+}
+
 type GetChainTipsResult []ChainTipsInfo
 
 type ChainTipsInfo struct {
@@ -35,32 +35,41 @@ const (
 )
 
 var allMethodHelp = map[string]helpDescInfo{
-	"getblockchaininfo":     {BlockChainCmd, getblockchaininfoDesc},
-	"getbestblockhash":      {BlockChainCmd, getbestblockhashDesc},
-	"getblockcount":         {BlockChainCmd, getblockcountDesc},
-	"getblock":              {BlockChainCmd, getblockDesc},
-	"getblockhash":          {BlockChainCmd, getblockhashDesc},
-	"getblockheader":        {BlockChainCmd, getblockheader},
-	"getchaintips":          {BlockChainCmd, getchaintipsDesc},
-	"getchaintxstats":       {BlockChainCmd, getchaintxstatsDesc},
-	"getdifficulty":         {BlockChainCmd, getdifficultyDesc},
-	"getmempoolancestors":   {BlockChainCmd, getmempoolancestorsDesc},
-	"getmempooldescendants": {BlockChainCmd, getmempooldescendantsDesc},
-	"getmempoolentry":       {BlockChainCmd, getmempoolentryDesc},
-	"getmempoolinfo":        {BlockChainCmd, getmempoolinfoDesc},
-	"getrawmempool":         {BlockChainCmd, getrawmempoolDesc},
-	"gettxout":              {BlockChainCmd, gettxoutDesc},
-	"gettxoutsetinfo":       {BlockChainCmd, gettxoutsetinfoDesc},
-	"pruneblockchain":       {BlockChainCmd, pruneblockchainDesc},
-	"verifychain":           {BlockChainCmd, verifychainDesc},
-	"preciousblock":         {BlockChainCmd, preciousblockDesc},
-	"gettxoutproof":         {BlockChainCmd, gettxoutproofDesc},
-	"verifytxoutproof":      {BlockChainCmd, verifytxoutproofDesc},
-
-	"getnetworkhashps": {MiningCmd, getnetworkhashpsDesc},
-	"getmininginfo":    {MiningCmd, getmininginfoDesc},
-	"getblocktemplate": {MiningCmd, getblocktemplateDesc},
-	"submitblock":      {MiningCmd, submitblockDesc},
+	"getblockchaininfo":      {BlockChainCmd, getblockchaininfoDesc},
+	"getbestblockhash":       {BlockChainCmd, getbestblockhashDesc},
+	"getblockcount":          {BlockChainCmd, getblockcountDesc},
+	"getblock":               {BlockChainCmd, getblockDesc},
+	"getblockhash":           {BlockChainCmd, getblockhashDesc},
+	"getblockheader":         {BlockChainCmd, getblockheader},
+	"getchaintips":           {BlockChainCmd, getchaintipsDesc},
+	"getchaintxstats":        {BlockChainCmd, getchaintxstatsDesc},
+	"getdifficulty":          {BlockChainCmd, getdifficultyDesc},
+	"getmempoolancestors":    {BlockChainCmd, getmempoolancestorsDesc},
+	"getmempooldescendants":  {BlockChainCmd, getmempooldescendantsDesc},
+	"getmempoolentry":        {BlockChainCmd, getmempoolentryDesc},
+	"getmempoolevents":       {BlockChainCmd, getmempooleventsDesc},
+	"getmempoolfeehistogram": {BlockChainCmd, getmempoolfeehistogramDesc},
+	"getmempoolinfo":         {BlockChainCmd, getmempoolinfoDesc},
+	"getmempoolpolicy":       {BlockChainCmd, getmempoolpolicyDesc},
+	"setmempoolpolicy":       {BlockChainCmd, setmempoolpolicyDesc},
+	"getrawmempool":          {BlockChainCmd, getrawmempoolDesc},
+	"getorphantxs":           {BlockChainCmd, getorphantxsDesc},
+	"gettxout":               {BlockChainCmd, gettxoutDesc},
+	"gettxoutsetinfo":        {BlockChainCmd, gettxoutsetinfoDesc},
+	"pruneblockchain":        {BlockChainCmd, pruneblockchainDesc},
+	"verifychain":            {BlockChainCmd, verifychainDesc},
+	"preciousblock":          {BlockChainCmd, preciousblockDesc},
+	"savemempool":            {BlockChainCmd, savemempoolDesc},
+	"loadmempool":            {BlockChainCmd, loadmempoolDesc},
+	"gettxoutproof":          {BlockChainCmd, gettxoutproofDesc},
+	"verifytxoutproof":       {BlockChainCmd, verifytxoutproofDesc},
+
+	"getnetworkhashps":           {MiningCmd, getnetworkhashpsDesc},
+	"getmininginfo":              {MiningCmd, getmininginfoDesc},
+	"getblocktemplate":           {MiningCmd, getblocktemplateDesc},
+	"submitblock":                {MiningCmd, submitblockDesc},
+	"prioritisetransaction":      {MiningCmd, prioritisetransactionDesc},
+	"getprioritisedtransactions": {MiningCmd, getprioritisedtransactionsDesc},
 
 	"generate":          {GeneratingCmd, generateDesc},
 	"generatetoaddress": {GeneratingCmd, generatetoaddressDesc},
@@ -83,6 +92,8 @@ var allMethodHelp = map[string]helpDescInfo{
 	"decoderawtransaction": {RawTransactionsCmd, decoderawtransactionDesc},
 	"decodescript":         {RawTransactionsCmd, decodescriptDesc},
 	"sendrawtransaction":   {RawTransactionsCmd, sendrawtransactionDesc},
+	"testmempoolaccept":    {RawTransactionsCmd, testmempoolacceptDesc},
+	"submitpackage":        {RawTransactionsCmd, submitpackageDesc},
 	"signrawtransaction":   {RawTransactionsCmd, signrawtransactionDesc},
 
 	"getinfo": {ControlCmd, getinfoDesc},
@@ -90,8 +101,10 @@ var allMethodHelp = map[string]helpDescInfo{
 	"stop":    {ControlCmd, stopDesc},
 	"uptime":  {ControlCmd, uptimeDesc},
 
-	"validateaddress": {UtilCmd, validateaddressDesc},
-	"createmultisig":  {UtilCmd, createmultisigDesc},
+	"validateaddress":  {UtilCmd, validateaddressDesc},
+	"createmultisig":   {UtilCmd, createmultisigDesc},
+	"estimatefee":      {UtilCmd, estimatefeeDesc},
+	"estimatesmartfee": {UtilCmd, estimatesmartfeeDesc},
 
 	"getexcessiveblock":  {DebugCmd, getexcessiveblockDesc},
 	"setexcessiveblock":  {DebugCmd, setexcessiveblockDesc},
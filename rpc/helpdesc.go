@@ -100,7 +100,9 @@ var (
 		"        \"since\": xx            (numeric) height of the first " +
 		"block to which the status applies\n" +
 		"     }\n" +
-		"  }\n" +
+		"  },\n" +
+		"  \"warnings\": \"...\"        (string) any network and blockchain " +
+		"warnings\n" +
 		"}\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("getblockchaininfo") +
@@ -440,6 +442,73 @@ var (
 		HelpExampleCli("getmempoolentry", "\"mytxid\"") +
 		HelpExampleRPC("getmempoolentry", "\"mytxid\"")
 
+	getmempooleventsDesc = "getmempoolevents ( since timeout )\n" +
+		"\nReturns the changes of the mempool after an event, waiting for " +
+		"one if there is none yet. The events are kept from the first call " +
+		"on, the last 10000 at most.\n" +
+		"\nArguments:\n" +
+		"1. since   (numeric, optional, default=0) The sequence of the last " +
+		"event already known\n" +
+		"2. timeout (numeric, optional, default=0) The seconds to wait for " +
+		"an event at most, 600 at most, 0 to return at once\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"events\": [                 (array) The events after since\n" +
+		"    {\n" +
+		"      \"sequence\": n,          (numeric) The sequence of the event\n" +
+		"      \"type\": \"type\",         (string) \"added\" or \"removed\"\n" +
+		"      \"txid\": \"id\",           (string) The transaction id\n" +
+		"      \"time\": n,              (numeric) The time of the event in " +
+		"seconds since 1 Jan 1970 GMT\n" +
+		"      \"reason\": \"reason\",     (string) Why a removed transaction " +
+		"left: \"expiry\", \"sizelimit\", \"reorg\", \"block\", \"conflict\", " +
+		"\"replaced\" or \"unknown\"\n" +
+		"      \"replaced_by\": \"id\"     (string, optional) The transaction " +
+		"spending the inputs of a transaction removed for a conflict\n" +
+		"    }, ...\n" +
+		"  ],\n" +
+		"  \"sequence\": n,              (numeric) The sequence of the last " +
+		"event kept, to pass as since next\n" +
+		"  \"dropped\": n                (numeric) The events missed as they " +
+		"arrived too fast\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getmempoolevents", "0 30") +
+		HelpExampleRPC("getmempoolevents", "0, 30")
+
+	getmempoolfeehistogramDesc = "getmempoolfeehistogram ( [boundary,...] ancestor )\n" +
+		"\nReturns the size of the mempool transactions by fee rate band. " +
+		"The bands are updated as the mempool changes.\n" +
+		"\nArguments:\n" +
+		"1. boundaries (array, optional) The increasing fee rates starting " +
+		"the bands, in satoshis per byte. Transactions paying less than the " +
+		"first one count in the first band. Defaults to 1 up to 1000\n" +
+		"2. ancestor   (boolean, optional, default=false) Sort the " +
+		"transactions by the fee rate of their package with their " +
+		"in-mempool ancestors instead of their own\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"ancestor\": true|false,       (boolean) Whether the ancestor fee " +
+		"rate was used\n" +
+		"  \"buckets\": [                 (array) The bands from the " +
+		"highest fee rate down\n" +
+		"    {\n" +
+		"      \"feerate\": n,            (numeric) The lowest fee rate of " +
+		"the band, in satoshis per byte\n" +
+		"      \"count\": n,              (numeric) The number of " +
+		"transactions in the band\n" +
+		"      \"vsize\": n,              (numeric) The size of the " +
+		"transactions in the band\n" +
+		"      \"cumulative_vsize\": n    (numeric) The size of the " +
+		"transactions in this band and the higher ones\n" +
+		"    }, ...\n" +
+		"  ]\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getmempoolfeehistogram") +
+		HelpExampleCli("getmempoolfeehistogram", "\"[1, 2, 5, 10]\" true") +
+		HelpExampleRPC("getmempoolfeehistogram", "[1, 2, 5, 10], true")
+
 	getmempoolinfoDesc = "getmempoolinfo\n" +
 		"\nReturns details on the active state of the TX memory pool.\n" +
 		"\nResult:\n" +
@@ -450,13 +519,89 @@ var (
 		"the mempool\n" +
 		"  \"maxmempool\": xxxxx,         (numeric) Maximum memory usage " +
 		"for the mempool\n" +
-		"  \"mempoolminfee\": xxxxx       (numeric) Minimum fee for tx to " +
+		"  \"mempoolminfee\": xxxxx,      (numeric) Minimum fee for tx to " +
 		"be accepted\n" +
+		"  \"rejected\": {                (json object) The number of " +
+		"transactions refused since startup by reason\n" +
+		"    \"reason\": n,               (numeric) The number refused " +
+		"for the reason\n" +
+		"    ...\n" +
+		"  }\n" +
 		"}\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("getmempoolinfo") +
 		HelpExampleRPC("getmempoolinfo")
 
+	getmempoolpolicyDesc = "getmempoolpolicy\n" +
+		"\nReturns the standardness policy the mempool applies.\n" +
+		"\nResult:\n" +
+		mempoolPolicyResultDesc +
+		"\nExamples:\n" +
+		HelpExampleCli("getmempoolpolicy") +
+		HelpExampleRPC("getmempoolpolicy")
+
+	setmempoolpolicyDesc = "setmempoolpolicy ( policy )\n" +
+		"\nChanges the standardness policy the mempool applies from then " +
+		"on, or goes back to the one of the config.\n" +
+		"\nArguments:\n" +
+		"1. policy       (json object, optional) The changes to the current " +
+		"policy, the config one when omitted\n" +
+		"{\n" +
+		"  \"name\": \"name\",                 (string, required) The name " +
+		"of the policy, reported in reject messages\n" +
+		"  \"enablerules\": [\"rule\",...],    (array, optional) The rules " +
+		"to check\n" +
+		"  \"disablerules\": [\"rule\",...],   (array, optional) The rules " +
+		"not to check\n" +
+		"  \"mintxsize\": n,                  (numeric, optional) The min " +
+		"tx size in bytes\n" +
+		"  \"maxtxsize\": n,                  (numeric, optional) The max " +
+		"tx size in bytes\n" +
+		"  \"scripttemplates\": [\"name\",...], (array, optional) The " +
+		"scriptPubKey templates allowed\n" +
+		"  \"maxdatacarrieroutputs\": n,      (numeric, optional) The " +
+		"OP_RETURN outputs allowed per tx\n" +
+		"  \"maxdatacarrierbytes\": n,        (numeric, optional) The " +
+		"bytes shared by the OP_RETURN outputs of a tx\n" +
+		"  \"dustrelayfee\": x.xxx,           (numeric, optional) The fee " +
+		"rate in " + util.CurrencyUnit + "/kB defining dust\n" +
+		"  \"minrelayfee\": x.xxx             (numeric, optional) The min " +
+		"fee rate in " + util.CurrencyUnit + "/kB of a tx\n" +
+		"}\n" +
+		"\nResult:\n" +
+		mempoolPolicyResultDesc +
+		"\nExamples:\n" +
+		HelpExampleCli("setmempoolpolicy", "'{\"name\":\"relaxed\",\"disablerules\":[\"dust\"]}'") +
+		HelpExampleRPC("setmempoolpolicy", "{\"name\":\"relaxed\",\"disablerules\":[\"dust\"]}")
+
+	mempoolPolicyResultDesc = "{\n" +
+		"  \"name\": \"name\",                 (string) The name of the " +
+		"policy\n" +
+		"  \"rules\": {                       (json object) Whether each " +
+		"rule is checked\n" +
+		"    \"rule\": true|false,\n" +
+		"    ...\n" +
+		"  },\n" +
+		"  \"mintxsize\": n,                  (numeric) The min tx size in " +
+		"bytes\n" +
+		"  \"maxtxsize\": n,                  (numeric) The max tx size in " +
+		"bytes\n" +
+		"  \"scripttemplates\": [\"name\",...], (array) The scriptPubKey " +
+		"templates allowed\n" +
+		"  \"maxdatacarrieroutputs\": n,      (numeric) The OP_RETURN " +
+		"outputs allowed per tx\n" +
+		"  \"maxdatacarrierbytes\": n,        (numeric) The bytes shared " +
+		"by the OP_RETURN outputs of a tx\n" +
+		"  \"dustrelayfee\": x.xxx,           (numeric) The fee rate in " +
+		util.CurrencyUnit + "/kB defining dust\n" +
+		"  \"minrelayfee\": x.xxx,            (numeric) The min fee rate " +
+		"in " + util.CurrencyUnit + "/kB of a tx\n" +
+		"  \"maxtxsigops\": n,                (numeric) The max sigops of " +
+		"a tx\n" +
+		"  \"maxp2shsigops\": n               (numeric) The max sigops of " +
+		"a P2SH input\n" +
+		"}\n"
+
 	getrawmempoolDesc = "getrawmempool ( verbose )\n" +
 		"\nReturns all transaction ids in memory pool as a json array of " +
 		"string transaction ids.\n" +
@@ -506,6 +651,40 @@ var (
 		HelpExampleCli("getrawmempool") +
 		HelpExampleRPC("getrawmempool")
 
+	getorphantxsDesc = "getorphantxs ( verbosity )\n" +
+		"\nReturns the transactions in the orphan pool, which miss inputs.\n" +
+		"\nArguments:\n" +
+		"1. verbosity (numeric, optional, default=0) 0 for an array of " +
+		"transaction ids, 1 for an array of json objects, 2 for json " +
+		"objects with the transaction hex\n" +
+		"\nResult: (for verbosity = 0):\n" +
+		"[                     (json array of string)\n" +
+		"  \"transactionid\"     (string) The transaction id\n" +
+		"  ,...\n" +
+		"]\n" +
+		"\nResult: (for verbosity = 1 or 2):\n" +
+		"[                            (json array of objects)\n" +
+		"  {\n" +
+		"    \"txid\" : \"id\",          (string) The transaction id\n" +
+		"    \"bytes\" : n,             (numeric) The serialized transaction size\n" +
+		"    \"entry\" : n,             (numeric) The time the orphan was " +
+		"added in seconds since 1 Jan 1970 GMT\n" +
+		"    \"expiration\" : n,        (numeric) The time the orphan " +
+		"expires in seconds since 1 Jan 1970 GMT\n" +
+		"    \"from\" : n,              (numeric) The id of the peer which " +
+		"sent it, 0 if none did\n" +
+		"    \"missing_parents\" : [    (array) The transactions it spends " +
+		"which are neither in the mempool nor in the utxo set\n" +
+		"        \"transactionid\",     (string) parent transaction id\n" +
+		"       ... ],\n" +
+		"    \"hex\" : \"hex\"           (string) The serialized transaction, " +
+		"only for verbosity = 2\n" +
+		"  }, ...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getorphantxs", "2") +
+		HelpExampleRPC("getorphantxs", "2")
+
 	gettxoutDesc = "gettxout \"txid\" n ( include_mempool )\n" +
 		"\nReturns details about an unspent transaction output.\n" +
 		"\nArguments:\n" +
@@ -604,6 +783,30 @@ var (
 		HelpExampleCli("preciousblock", "\"blockhash\"") +
 		HelpExampleRPC("preciousblock", "\"blockhash\"")
 
+	savemempoolDesc = "savemempool\n" +
+		"\nDumps the mempool to disk.\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("savemempool") +
+		HelpExampleRPC("savemempool")
+
+	loadmempoolDesc = "loadmempool\n" +
+		"\nLoads the mempool dumped to disk. Transactions already in the " +
+		"mempool or older than the mempool expiry are skipped.\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"loaded\": xxxxx,         (numeric) Transactions accepted to " +
+		"the mempool\n" +
+		"  \"failed\": xxxxx,         (numeric) Transactions rejected by " +
+		"the mempool\n" +
+		"  \"expired\": xxxxx,        (numeric) Transactions older than " +
+		"the mempool expiry\n" +
+		"  \"alreadythere\": xxxxx    (numeric) Transactions already in " +
+		"the mempool\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("loadmempool") +
+		HelpExampleRPC("loadmempool")
+
 	waitforblockheightDesc = "waitforblockheight \"height\" (timeout)\n" +
 		"\nWaits for (at least) block height and returns the height and " +
 		"hash\n" +
@@ -668,24 +871,40 @@ var (
 		"priority\n" +
 		"\nArguments:\n" +
 		"1. \"txid\"       (string, required) The transaction id.\n" +
-		"2. priority_delta (numeric, required) The priority to add or " +
-		"subtract.\n" +
-		"                  The transaction selection algorithm considers " +
-		"the tx as it would have a higher priority.\n" +
-		"                  (priority of a transaction is calculated: " +
-		"coinage * value_in_satoshis / txsize) \n" +
+		"2. priority_delta (numeric, required) Ignored, as transactions " +
+		"have no priority. Must be 0.\n" +
 		"3. fee_delta      (numeric, required) The fee value (in satoshis) " +
 		"to add (or subtract, if negative).\n" +
 		"                  The fee is not actually paid, only the " +
 		"algorithm for selecting transactions into a block\n" +
-		"                  considers the transaction as it would have paid " +
-		"a higher (or lower) fee.\n" +
+		"                  and for evicting them from the mempool " +
+		"considers the transaction as it would have paid a higher (or " +
+		"lower) fee.\n" +
+		"                  The transaction need not be in the mempool " +
+		"yet.\n" +
 		"\nResult:\n" +
 		"true              (boolean) Returns true\n" +
 		"\nExamples:\n" +
 		HelpExampleCli("prioritisetransaction", "\"txid\"", "0.0", "10000") +
 		HelpExampleRPC("prioritisetransaction", "\"txid\"", "0.0", "10000")
 
+	getprioritisedtransactionsDesc = "getprioritisedtransactions\n" +
+		"Returns a map of all user-created fee deltas by transaction id.\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"txid\" : {               (json object) the transaction id\n" +
+		"    \"fee_delta\" : n,       (numeric) transaction fee delta in " +
+		"satoshis\n" +
+		"    \"in_mempool\" : true|false, (boolean) whether this " +
+		"transaction is currently in the mempool\n" +
+		"    \"modified_fee\" : n     (numeric, optional) modified fee in " +
+		"satoshis, only returned if in_mempool is true\n" +
+		"  }, ...\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("getprioritisedtransactions") +
+		HelpExampleRPC("getprioritisedtransactions")
+
 	getblocktemplateDesc = "getblocktemplate ( TemplateRequest )\n" +
 		"\nIf the request parameters include a 'mode' key, that is used to " +
 		"explicitly select between the default 'template' request or a " +
@@ -719,7 +938,10 @@ var (
 		"           \"support\"          (string) client side supported " +
 		"softfork deployment\n" +
 		"           ,...\n" +
-		"       ]\n" +
+		"       ],\n" +
+		"       \"longpollid\":\"id\"  (string, optional) The longpollid " +
+		"of a previous result, to wait until the chain tip changes, or a " +
+		"minute passed and there are new mempool transactions\n" +
 		"     }\n" +
 		"\n" +
 		"\nResult:\n" +
@@ -890,6 +1112,8 @@ var (
 		"    \"addr\":\"host:port\",      (string) The ip address and port " +
 		"of the peer\n" +
 		"    \"addrlocal\":\"ip:port\",   (string) local address\n" +
+		"    \"mapped_as\": n,            (numeric) The AS in the asmap " +
+		"used to group the peer (only if an asmap is loaded)\n" +
 		"    \"services\":\"xxxxxxxxxxxxxxxx\",   (string) The services " +
 		"offered\n" +
 		"    \"relaytxes\":true|false,    (boolean) Whether peer has asked " +
@@ -922,6 +1146,8 @@ var (
 		"    \"startingheight\": n,       (numeric) The starting height " +
 		"(block) of the peer\n" +
 		"    \"banscore\": n,             (numeric) The ban score\n" +
+		"    \"banscore_decaying\": n,    (numeric) The part of the ban " +
+		"score which decays over time\n" +
 		"    \"synced_headers\": n,       (numeric) The last header we " +
 		"have in common with this peer\n" +
 		"    \"synced_blocks\": n,        (numeric) The last block we have " +
@@ -942,6 +1168,16 @@ var (
 		"       \"addr\": n,              (numeric) The total bytes " +
 		"received aggregated by message type\n" +
 		"       ...\n" +
+		"    },\n" +
+		"    \"msgssent_per_msg\": {\n" +
+		"       \"addr\": n,              (numeric) The number of " +
+		"messages sent aggregated by message type\n" +
+		"       ...\n" +
+		"    },\n" +
+		"    \"msgsrecv_per_msg\": {\n" +
+		"       \"addr\": n,              (numeric) The number of " +
+		"messages received aggregated by message type\n" +
+		"       ...\n" +
 		"    }\n" +
 		"  }\n" +
 		"  ,...\n" +
@@ -1033,6 +1269,33 @@ var (
 		"left in current time cycle\n" +
 		"    \"time_left_in_cycle\": t                 (numeric) Seconds " +
 		"left in current time cycle\n" +
+		"  },\n" +
+		"  \"uploadrate\":\n" +
+		"  {\n" +
+		"    \"limit\": n,            (numeric) Bytes per second written to " +
+		"non-whitelisted peers, 0 if unlimited\n" +
+		"    \"available_bytes\": n,  (numeric) Bytes which may be written " +
+		"right away\n" +
+		"    \"throttled_time\": n    (numeric) Milliseconds writes were held " +
+		"back since start\n" +
+		"  },\n" +
+		"  \"feefilter\":\n" +
+		"  {\n" +
+		"    \"feerate\": x.xxx,  (numeric) Minimum fee rate in " + util.CurrencyUnit +
+		"/kB we ask peers to relay\n" +
+		"    \"sent\": n,         (numeric) Number of feefilter messages sent\n" +
+		"    \"before_sent\":       (object) Transactions received from " +
+		"peers before we sent them a feefilter\n" +
+		"    {\n" +
+		"      \"bytes\": n,         (numeric) Bytes of the transactions " +
+		"and their inventory\n" +
+		"      \"low_fee_bytes\": n  (numeric) Bytes of those refused for " +
+		"the mempool min fee\n" +
+		"    },\n" +
+		"    \"after_sent\":        (object) Transactions received from " +
+		"peers after we sent them a feefilter,\n" +
+		"                        as above. The bandwidth saved shows as a " +
+		"lower share of low_fee_bytes\n" +
 		"  }\n" +
 		"}\n" +
 		"\nExamples:\n" +
@@ -1353,6 +1616,67 @@ var (
 		"\nAs a json rpc call\n" +
 		HelpExampleRPC("sendrawtransaction", "\"signedhex\"")
 
+	testmempoolacceptDesc = "testmempoolaccept [\"rawtxs\"] ( allowhighfees )\n" +
+		"\nReturns if raw transactions (serialized, hex-encoded) would be " +
+		"accepted by mempool.\n" +
+		"\nThe transactions are checked in order, each as if those accepted " +
+		"before it were in the mempool, so that a chain of dependent " +
+		"transactions can be tested. Nothing is added to the mempool.\n" +
+		"\nArguments:\n" +
+		"1. [\"rawtxs\"]       (array, required) An array of hex strings of " +
+		"raw transactions.\n" +
+		"2. allowhighfees    (boolean, optional, default=false) Allow high " +
+		"fees\n" +
+		"\nResult:\n" +
+		"[                   (array) The result of the mempool acceptance " +
+		"test for each raw transaction in the input array.\n" +
+		"  {\n" +
+		"    \"txid\"          (string) The transaction hash in hex\n" +
+		"    \"allowed\"       (boolean) If the mempool allows this tx to " +
+		"be inserted\n" +
+		"    \"size\"          (numeric) The transaction size, if allowed\n" +
+		"    \"fee\"           (numeric) The transaction fee in BCH, if " +
+		"allowed\n" +
+		"    \"reject-code\"   (string) The reject code, if rejected\n" +
+		"    \"reject-reason\" (string) Rejection string, if rejected\n" +
+		"  }, ...\n" +
+		"]\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("testmempoolaccept", "'[\"signedhex\"]'") +
+		"\nAs a json rpc call\n" +
+		HelpExampleRPC("testmempoolaccept", "[\"signedhex\"]")
+
+	submitpackageDesc = "submitpackage [\"rawtx\",...]\n" +
+		"\nSubmit a package of raw transactions (serialized, hex-encoded) to " +
+		"local node and network.\n" +
+		"\nThe package is accepted to the mempool as a whole or not at all. " +
+		"Each transaction must pass the mempool checks, except for the " +
+		"mempool min fee which the package must pay as a whole, so that a " +
+		"child can pay for a parent whose fee is too low.\n" +
+		"\nArguments:\n" +
+		"1. [\"rawtx\",...]    (array, required) An array of raw " +
+		"transactions, each spending only the transactions before it in the " +
+		"package.\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"package_msg\"     (string) The transaction package result " +
+		"message. \"success\" indicates all transactions were accepted " +
+		"into or are already in the mempool.\n" +
+		"  \"tx-results\" : [  (array) The result of each transaction\n" +
+		"    {\n" +
+		"      \"txid\"        (string) The transaction hash in hex\n" +
+		"      \"size\"        (numeric) The transaction size, if valid\n" +
+		"      \"fee\"         (numeric) The transaction fee in BCH, if " +
+		"valid\n" +
+		"      \"error\"       (string) The transaction error, if invalid\n" +
+		"    }, ...\n" +
+		"  ]\n" +
+		"}\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("submitpackage", "'[\"rawtx1\", \"rawtx2\"]'") +
+		"\nAs a json rpc call\n" +
+		HelpExampleRPC("submitpackage", "[\"rawtx1\", \"rawtx2\"]")
+
 	signrawtransactionDesc = "signrawtransaction \"hexstring\" ( " +
 		"[{\"txid\":\"id\",\"vout\":n,\"scriptPubKey\":\"hex\"," +
 		"\"redeemScript\":\"hex\"},...] [\"privatekey1\",...] sighashtype " +
@@ -1583,6 +1907,42 @@ var (
 		HelpExampleRPC("createmultisig", "2",
 			"\"[\\\"16sSauSf5pF2UkUwvKGq4qjNRzBZYqgEL5\\\",\\\"171sgjn4YtPu27adkKGrdDwzRTxnRkBfKV\\\"]\"")
 
+	estimatefeeDesc = "estimatefee nblocks\n" +
+		"\nEstimates the approximate fee per kilobyte needed for a " +
+		"transaction to begin confirmation within nblocks blocks.\n" +
+		"\nArguments:\n" +
+		"1. nblocks     (numeric, required)\n" +
+		"\nResult:\n" +
+		"n              (numeric) estimated fee-per-kilobyte\n" +
+		"\nA negative value is returned if not enough transactions and " +
+		"blocks have been observed to make an estimate.\n" +
+		"-1 is always returned for nblocks == 1 as it is impossible to " +
+		"calculate a fee that is high enough to get reliably included in " +
+		"the next block.\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("estimatefee", "6")
+
+	estimatesmartfeeDesc = "estimatesmartfee nblocks\n" +
+		"\nEstimates the approximate fee per kilobyte needed for a " +
+		"transaction to begin confirmation within nblocks blocks if " +
+		"possible and return the number of blocks for which the estimate " +
+		"is valid.\n" +
+		"\nArguments:\n" +
+		"1. nblocks     (numeric, required)\n" +
+		"\nResult:\n" +
+		"{\n" +
+		"  \"feerate\" : x.x,     (numeric) estimate fee-per-kilobyte (in " +
+		"BCH)\n" +
+		"  \"blocks\" : n         (numeric) block number where estimate " +
+		"was found\n" +
+		"}\n" +
+		"\nA negative value is returned if not enough transactions and " +
+		"blocks have been observed to make an estimate for any number of " +
+		"blocks.\n" +
+		"However it will not return a value below the mempool reject fee.\n" +
+		"\nExamples:\n" +
+		HelpExampleCli("estimatesmartfee", "6")
+
 	echoDesc = "echo \"message\" ...\n" +
 		"\nSimply echo back the input arguments. This command is for testing."
 
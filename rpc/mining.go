@@ -27,6 +27,9 @@ import (
 	"github.com/copernet/copernicus/util"
 	"gopkg.in/fatih/set.v0"
 	"math/big"
+	"strconv"
+	"sync"
+	"time"
 )
 
 var miningHandlers = map[string]commandHandler{
@@ -36,7 +39,11 @@ var miningHandlers = map[string]commandHandler{
 	"submitblock":       handleSubmitBlock,
 	"generatetoaddress": handleGenerateToAddress,
 	"generate":          handleGenerate,
-	//"estimatefee":       handleEstimateFee,
+	"estimatefee":       handleEstimateFee,
+	"estimatesmartfee":  handleEstimateSmartFee,
+
+	"prioritisetransaction":      handlePrioritiseTransaction,
+	"getprioritisedtransactions": handleGetPrioritisedTransactions,
 }
 
 func GetNetworkHashPS(lookup int32, height int32) float64 {
@@ -163,27 +170,26 @@ func handleGetBlockTemplateRequest(s *Server, request *btcjson.TemplateRequest,
 		}
 	}
 
-	//if request != nil && request.LongPollID != "" {
-	// Wait to respond until either the best block changes, OR a minute has
-	// passed and there are more transactions
-	//var hashWatchedChain utils.Hash
-	//checktxtime := time.Now()
-	//transactionsUpdatedLastLP := 0
-	// todo complete
-	//}
+	if request != nil && request.LongPollID != "" {
+		// Wait to respond until either the best block changes, OR a minute has
+		// passed and there are more transactions
+		if err := waitLongPoll(request.LongPollID, closeChan); err != nil {
+			return nil, err
+		}
+	}
 
 	persist.CsMain.Lock() //lock chain tip for CreateNewBlock
 	defer persist.CsMain.Unlock()
 
 	if indexPrev != chain.GetInstance().Tip() ||
-		mempool.GetInstance().TransactionsUpdated != transactionsUpdatedLast &&
+		mempool.GetInstance().GetTransactionsUpdated() != transactionsUpdatedLast &&
 			util.GetTimeSec()-start > 5 {
 
 		// Clear pindexPrev so future calls make a new block, despite any
 		// failures from here on
 		indexPrev = nil
 		// Store the pindexBest used before CreateNewBlock, to avoid races
-		transactionsUpdatedLast = mempool.GetInstance().TransactionsUpdated
+		transactionsUpdatedLast = mempool.GetInstance().GetTransactionsUpdated()
 		indexPrevNew := chain.GetInstance().Tip()
 		start = util.GetTimeSec()
 
@@ -211,6 +217,107 @@ func handleGetBlockTemplateRequest(s *Server, request *btcjson.TemplateRequest,
 	return res, err
 }
 
+const (
+	// longPollTxWait is how long a long poll waits before it returns for new
+	// mempool transactions.
+	longPollTxWait = time.Minute
+	// longPollTxRecheck is how often a long poll then checks for new mempool
+	// transactions.
+	longPollTxRecheck = 10 * time.Second
+)
+
+// tipWatcher tells the long polls of getblocktemplate that the chain tip
+// changed, from the first long poll on.
+type tipWatcher struct {
+	once    sync.Once
+	lock    sync.Mutex
+	changed chan struct{}
+}
+
+var chainTip = &tipWatcher{}
+
+func (w *tipWatcher) start() {
+	w.once.Do(func() {
+		w.changed = make(chan struct{})
+		chain.GetInstance().Subscribe(w.handleBlockChainNotification)
+	})
+}
+
+func (w *tipWatcher) handleBlockChainNotification(notification *chain.Notification) {
+	if notification.Type != chain.NTChainTipUpdated {
+		return
+	}
+	w.lock.Lock()
+	close(w.changed)
+	w.changed = make(chan struct{})
+	w.lock.Unlock()
+}
+
+// next returns a channel closed when the chain tip changes next.
+func (w *tipWatcher) next() <-chan struct{} {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.changed
+}
+
+// parseLongPollID returns the tip hash and the mempool TransactionsUpdated
+// of the longpollid blockTemplateResult returns.
+func parseLongPollID(longPollID string) (*util.Hash, uint64, error) {
+	if len(longPollID) <= 2*util.Hash256Size {
+		return nil, 0, fmt.Errorf("invalid length %d", len(longPollID))
+	}
+	hash, err := util.GetHashFromStr(longPollID[:2*util.Hash256Size])
+	if err != nil {
+		return nil, 0, err
+	}
+	transactionsUpdated, err := strconv.ParseUint(longPollID[2*util.Hash256Size:], 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, transactionsUpdated, nil
+}
+
+// waitLongPoll waits until the chain tip is not the one of the longpollid, or
+// a minute passed and the mempool has new transactions. It must not be called
+// with persist.CsMain held, as it would block the chain, and only holds it to
+// read the tip.
+func waitLongPoll(longPollID string, closeChan <-chan struct{}) error {
+	hashWatched, transactionsUpdatedWatched, err := parseLongPollID(longPollID)
+	if err != nil {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid longpollid: " + err.Error(),
+		}
+	}
+
+	chainTip.start()
+	checkTxTime := time.Now().Add(longPollTxWait)
+	for {
+		// Take the channel before looking at the tip, not to miss a change.
+		tipChanged := chainTip.next()
+		persist.CsMain.RLock()
+		tip := chain.GetInstance().Tip()
+		persist.CsMain.RUnlock()
+		if !tip.GetBlockHash().IsEqual(hashWatched) {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(checkTxTime))
+		select {
+		case <-tipChanged:
+		case <-timer.C:
+			if mempool.GetInstance().GetTransactionsUpdated() != transactionsUpdatedWatched {
+				return nil
+			}
+			checkTxTime = checkTxTime.Add(longPollTxRecheck)
+		case <-closeChan:
+			timer.Stop()
+			return ErrClientQuit
+		}
+		timer.Stop()
+	}
+}
+
 // blockTemplateResult returns the current block template associated with the
 // state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
 // and returned to the caller.
@@ -554,26 +661,75 @@ func createBlockForCPUMining(ba *mining.BlockAssembler, scriptPK *script.Script,
 }
 
 // handleEstimateFee handles estimatefee commands.
-//func handleEstimateFee(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-//	c := cmd.(*btcjson.EstimateFeeCmd)
-//
-//	if s.cfg.FeeEstimator == nil {
-//		return nil, errors.New("Fee estimation disabled")
-//	}
-//
-//	if c.NumBlocks <= 0 {
-//		return -1.0, errors.New("Parameter NumBlocks must be positive")
-//	}
-//
-//	feeRate, err := s.cfg.FeeEstimator.EstimateFee(uint32(c.NumBlocks))
-//
-//	if err != nil {
-//		return -1.0, err
-//	}
-//
-//	// Convert to satoshis per kb.
-//	return float64(feeRate), nil
-//}
+func handleEstimateFee(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateFeeCmd)
+
+	numBlocks := c.NumBlocks
+	if numBlocks < 1 {
+		numBlocks = 1
+	}
+
+	feeRate := mempool.GetFeeEstimator().EstimateFee(int(numBlocks))
+	if feeRate.SataoshisPerK == 0 {
+		return -1.0, nil
+	}
+
+	return valueFromAmount(feeRate.GetFeePerK()), nil
+}
+
+// handleEstimateSmartFee handles estimatesmartfee commands.
+func handleEstimateSmartFee(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+
+	feeRate, answerFound := mempool.GetFeeEstimator().EstimateSmartFee(int(c.NumBlocks),
+		mempool.GetInstance())
+	result := &btcjson.EstimateSmartFeeResult{
+		FeeRate: -1,
+		Blocks:  int64(answerFound),
+	}
+	if feeRate.SataoshisPerK > 0 {
+		result.FeeRate = valueFromAmount(feeRate.GetFeePerK())
+	}
+
+	return result, nil
+}
+
+// handlePrioritiseTransaction handles prioritisetransaction commands.
+func handlePrioritiseTransaction(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+
+	hash, err := util.GetHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+	if c.PriorityDelta != 0 {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Priority is no longer supported, priority_delta must be 0",
+		}
+	}
+
+	mempool.GetInstance().PrioritiseTransaction(*hash, c.FeeDelta)
+	return true, nil
+}
+
+// handleGetPrioritisedTransactions handles getprioritisedtransactions commands.
+func handleGetPrioritisedTransactions(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	pool := mempool.GetInstance()
+
+	result := make(map[string]*btcjson.PrioritisedTransactionResult)
+	for hash, delta := range pool.GetAllFeeDeltas() {
+		item := &btcjson.PrioritisedTransactionResult{FeeDelta: delta}
+		if entry := pool.FindTx(hash); entry != nil {
+			modifiedFee := entry.GetModifiedFee()
+			item.InMempool = true
+			item.ModifiedFee = &modifiedFee
+		}
+		result[hash.String()] = item
+	}
+
+	return result, nil
+}
 
 func registerMiningRPCCommands() {
 	for name, handler := range miningHandlers {
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/blockindex"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/rpc/btcjson"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLongPollID(t *testing.T) {
+	hashStr := util.HashOne.String()
+
+	hash, transactionsUpdated, err := parseLongPollID(hashStr + "42")
+	assert.Nil(t, err)
+	assert.Equal(t, util.HashOne, *hash)
+	assert.Equal(t, uint64(42), transactionsUpdated)
+
+	for _, longPollID := range []string{
+		hashStr,
+		hashStr[:10] + "42",
+		"zz" + hashStr[2:] + "42",
+		hashStr + "4x",
+	} {
+		_, _, err := parseLongPollID(longPollID)
+		assert.NotNil(t, err, "longpollid %s", longPollID)
+	}
+}
+
+func TestWaitLongPoll(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	chain.InitGlobalChain()
+	gChain := chain.GetInstance()
+	genesis := blockindex.NewBlockIndex(&model.ActiveNetParams.GenesisBlock.Header)
+	gChain.SetTip(genesis)
+	defer gChain.SetTip(nil)
+	longPollID := genesis.GetBlockHash().String() + "0"
+
+	// An invalid longpollid is refused.
+	_, ok := waitLongPoll("0", nil).(*btcjson.RPCError)
+	assert.True(t, ok)
+
+	wait := func(closeChan <-chan struct{}) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- waitLongPoll(longPollID, closeChan)
+		}()
+		return done
+	}
+	result := func(done <-chan error) error {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("the long poll did not return")
+			return nil
+		}
+	}
+
+	// The long poll returns when the tip changes.
+	chainTip.start()
+	done := wait(nil)
+	// Let the long poll wait for the notification.
+	time.Sleep(50 * time.Millisecond)
+	header := model.ActiveNetParams.GenesisBlock.Header
+	header.Nonce++
+	next := blockindex.NewBlockIndex(&header)
+	next.Prev = genesis
+	next.Height = 1
+	persist.CsMain.Lock()
+	gChain.SetTip(next)
+	persist.CsMain.Unlock()
+	gChain.SendNotification(chain.NTChainTipUpdated, next)
+	assert.Nil(t, result(done))
+
+	// Or when the client leaves.
+	persist.CsMain.Lock()
+	gChain.SetTip(genesis)
+	persist.CsMain.Unlock()
+	closeChan := make(chan struct{})
+	done = wait(closeChan)
+	close(closeChan)
+	assert.Equal(t, ErrClientQuit, result(done))
+}
@@ -70,10 +70,12 @@ func handleGetPeerInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (i
 	infos := make([]*btcjson.GetPeerInfoResult, 0, len(peers))
 	for _, item := range peers {
 		statsSnap := item.ToPeer().StatsSnapshot()
+		traffic := item.Traffic()
 		info := &btcjson.GetPeerInfoResult{
 			ID:              statsSnap.ID,
 			Addr:            statsSnap.Addr,
 			AddrLocal:       item.ToPeer().LocalAddr().String(),
+			MappedAS:        item.MappedAS(),
 			Services:        fmt.Sprintf("%016x", statsSnap.Services),
 			RelayTxes:       !item.IsTxRelayDisabled(),
 			LastSend:        statsSnap.LastSend.Unix(),
@@ -89,14 +91,17 @@ func handleGetPeerInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (i
 			Inbound:         statsSnap.Inbound,
 			AddNode:         statsSnap.AddNode,
 			StartingHeight:  statsSnap.StartingHeight,
-			BanScore:        int32(item.BanScore()), // TODO
+			BanScore:        int32(item.BanScore()),
+			BanScoreDecay:   item.TransientBanScore(),
 			SyncedHeaders:   statsSnap.SyncedHeaders,
 			SyncedBlocks:    statsSnap.SyncedBlocks,
 			Inflight:        statsSnap.Inflight,
 			WhiteListed:     statsSnap.WhiteListed,
 			CashMagic:       statsSnap.UsesCashMagic,
-			BytesSendPerMsg: statsSnap.MapSendBytesPerMsgCmd,
-			BytesRecvPerMsg: statsSnap.MapRecvBytesPerMsgCmd,
+			BytesSendPerMsg: traffic.BytesSentPerMsg,
+			BytesRecvPerMsg: traffic.BytesRecvPerMsg,
+			MsgsSendPerMsg:  traffic.MsgsSentPerMsg,
+			MsgsRecvPerMsg:  traffic.MsgsRecvPerMsg,
 		}
 		if item.ToPeer().LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -46,6 +46,9 @@ var rawTransactionHandlers = map[string]commandHandler{
 	"signrawtransaction":   handleSignRawTransaction,   // partial complete
 	"gettxoutproof":        handleGetTxoutProof,        // complete
 	"verifytxoutproof":     handleVerifyTxoutProof,     // complete
+
+	"testmempoolaccept": handleTestMempoolAccept,
+	"submitpackage":     handleSubmitPackage,
 }
 
 func handleGetRawTransaction(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -587,6 +590,115 @@ func handleSendRawTransaction(s *Server, cmd interface{}, closeChan <-chan struc
 	return hash.String(), nil
 }
 
+// decodeRawTxs decodes the hex-encoded transactions of a package, of which
+// there are between 1 and lmempool.MaxPackageCount.
+func decodeRawTxs(rawTxs []string) ([]*tx.Tx, error) {
+	if len(rawTxs) == 0 || len(rawTxs) > lmempool.MaxPackageCount {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter,
+			fmt.Sprintf("Array must contain between 1 and %d transactions.", lmempool.MaxPackageCount))
+	}
+
+	txs := make([]*tx.Tx, 0, len(rawTxs))
+	for _, rawTx := range rawTxs {
+		b, err := hex.DecodeString(rawTx)
+		if err != nil {
+			return nil, rpcDecodeHexError(rawTx)
+		}
+		txn := tx.NewEmptyTx()
+		if err := txn.Unserialize(bytes.NewReader(b)); err != nil {
+			return nil, rpcDecodeHexError(rawTx)
+		}
+		txs = append(txs, txn)
+	}
+	return txs, nil
+}
+
+func handleTestMempoolAccept(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.TestMempoolAcceptCmd)
+
+	txs, err := decodeRawTxs(c.RawTxs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := lmempool.TestAcceptTxsToMemPool(txs)
+	ret := make([]*btcjson.TestMempoolAcceptResult, 0, len(results))
+	for i, result := range results {
+		item := &btcjson.TestMempoolAcceptResult{
+			TxID:    txs[i].GetHash().String(),
+			Allowed: result.Err == nil,
+		}
+		if result.Err == nil {
+			item.Size = result.Entry.TxSize
+			item.Fee = valueFromAmount(result.Entry.TxFee)
+		} else {
+			item.RejectCode, item.RejectReason = rejectOfAcceptTx(result.Err)
+		}
+		ret = append(ret, item)
+	}
+
+	return ret, nil
+}
+
+func handleSubmitPackage(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SubmitPackageCmd)
+
+	txs, err := decodeRawTxs(c.RawTxs)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := lmempool.AcceptPackageToMemPool(txs)
+	if results == nil {
+		return nil, rpcErrorOfAcceptTx(err)
+	}
+
+	ret := &btcjson.SubmitPackageResult{
+		PackageMsg: "success",
+		TxResults:  make([]*btcjson.SubmitPackageTxResult, 0, len(results)),
+	}
+	if err != nil {
+		_, ret.PackageMsg = rejectOfAcceptTx(err)
+	}
+	for i, result := range results {
+		item := &btcjson.SubmitPackageTxResult{TxID: txs[i].GetHash().String()}
+		if result.Err == nil {
+			item.Size = result.Entry.TxSize
+			item.Fee = valueFromAmount(result.Entry.TxFee)
+		} else {
+			_, item.Error = rejectOfAcceptTx(result.Err)
+		}
+		ret.TxResults = append(ret.TxResults, item)
+	}
+	if err != nil {
+		return ret, nil
+	}
+
+	for _, txn := range txs {
+		hash := txn.GetHash()
+		if _, err := server.ProcessForRPC(wire.NewInvVect(wire.InvTypeTx, &hash)); err != nil {
+			log.Info("handleSubmitPackage process InvTypeTx msg error:%s", err.Error())
+			return nil, btcjson.ErrRPCInternal
+		}
+	}
+
+	return ret, nil
+}
+
+// rejectOfAcceptTx returns the reject code and the reason of the error of a
+// transaction refused by the mempool.
+func rejectOfAcceptTx(err error) (string, string) {
+	if errcode.IsErrorCode(err, errcode.TxErrNoPreviousOut) {
+		return "", "missing-inputs"
+	}
+
+	if e, ok := err.(errcode.ProjectError); ok && e.ErrorCode != nil {
+		return e.ErrorCode.String(), e.Desc
+	}
+
+	return "", err.Error()
+}
+
 func rpcErrorOfAcceptTx(err error) *btcjson.RPCError {
 	missingInputs := errcode.IsErrorCode(err, errcode.TxErrNoPreviousOut)
 	if missingInputs {
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/copernet/copernicus/conf"
@@ -21,6 +22,7 @@ import (
 	"github.com/copernet/copernicus/model/consensus"
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/policy"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/model/versionbits"
@@ -28,29 +30,37 @@ import (
 	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/rpc/btcjson"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
 	"gopkg.in/fatih/set.v0"
 )
 
 var blockchainHandlers = map[string]commandHandler{
-	"getblockchaininfo":     handleGetBlockChainInfo,
-	"getbestblockhash":      handleGetBestBlockHash,      // complete
-	"getblockcount":         handleGetBlockCount,         // complete
-	"getblock":              handleGetBlock,              // complete
-	"getblockhash":          handleGetBlockHash,          // complete
-	"getblockheader":        handleGetBlockHeader,        // complete
-	"getchaintips":          handleGetChainTips,          // partial complete
-	"getdifficulty":         handleGetDifficulty,         //complete
-	"getchaintxstats":       handleGetChainTxStats,       // complete
-	"getmempoolancestors":   handleGetMempoolAncestors,   // complete
-	"getmempooldescendants": handleGetMempoolDescendants, //complete
-	"getmempoolentry":       handleGetMempoolEntry,       // complete
-	"getmempoolinfo":        handleGetMempoolInfo,        // complete
-	"getrawmempool":         handleGetRawMempool,         // complete
-	"gettxout":              handleGetTxOut,              // complete
-	"gettxoutsetinfo":       handleGetTxoutSetInfo,
-	"pruneblockchain":       handlePruneBlockChain, //complete
-	"verifychain":           handleVerifyChain,     //complete
-	"preciousblock":         handlePreciousblock,   //complete
+	"getblockchaininfo":      handleGetBlockChainInfo,
+	"getbestblockhash":       handleGetBestBlockHash,       // complete
+	"getblockcount":          handleGetBlockCount,          // complete
+	"getblock":               handleGetBlock,               // complete
+	"getblockhash":           handleGetBlockHash,           // complete
+	"getblockheader":         handleGetBlockHeader,         // complete
+	"getchaintips":           handleGetChainTips,           // partial complete
+	"getdifficulty":          handleGetDifficulty,          //complete
+	"getchaintxstats":        handleGetChainTxStats,        // complete
+	"getmempoolancestors":    handleGetMempoolAncestors,    // complete
+	"getmempooldescendants":  handleGetMempoolDescendants,  //complete
+	"getmempoolentry":        handleGetMempoolEntry,        // complete
+	"getmempoolinfo":         handleGetMempoolInfo,         // complete
+	"getmempoolevents":       handleGetMempoolEvents,       // complete
+	"getmempoolfeehistogram": handleGetMempoolFeeHistogram, // complete
+	"getmempoolpolicy":       handleGetMempoolPolicy,       // complete
+	"setmempoolpolicy":       handleSetMempoolPolicy,       // complete
+	"getrawmempool":          handleGetRawMempool,          // complete
+	"gettxout":               handleGetTxOut,               // complete
+	"gettxoutsetinfo":        handleGetTxoutSetInfo,
+	"pruneblockchain":        handlePruneBlockChain, //complete
+	"verifychain":            handleVerifyChain,     //complete
+	"preciousblock":          handlePreciousblock,   //complete
+	"savemempool":            handleSaveMempool,
+	"loadmempool":            handleLoadMempool,
+	"getorphantxs":           handleGetOrphanTxs,
 
 	/*not shown in help*/
 	"invalidateblock":    handleInvalidateBlock, //complete
@@ -76,6 +86,7 @@ func handleGetBlockChainInfo(s *Server, cmd interface{}, closeChan <-chan struct
 		ChainWork:            fmt.Sprintf("%064x", &tip.ChainWork),
 		Pruned:               false,
 		Bip9SoftForks:        make(map[string]*btcjson.Bip9SoftForkDescription),
+		Warnings:             util.GetWarnings(),
 	}
 
 	// Next, populate the response with information describing the current
@@ -558,18 +569,20 @@ func entryToJSON(entry *mempool.TxEntry) *btcjson.GetMempoolEntryRelativeInfoVer
 	result := btcjson.GetMempoolEntryRelativeInfoVerbose{}
 	result.Size = entry.TxSize
 	result.Fee = valueFromAmount(entry.TxFee)
-	result.ModifiedFee = valueFromAmount(entry.SumTxFeeWithAncestors) // todo check: GetModifiedFee() is equal to SumFeeWithAncestors
+	result.ModifiedFee = valueFromAmount(entry.GetModifiedFee())
 	result.Time = entry.GetTime()
 	result.Height = entry.TxHeight
 	// remove priority at current version
 	result.StartingPriority = 0
 	result.CurrentPriority = 0
-	result.DescendantCount = entry.SumTxCountWithDescendants
-	result.DescendantSize = entry.SumTxSizeWithDescendants
-	result.DescendantFees = entry.SumTxFeeWithDescendants
-	result.AncestorCount = entry.SumTxCountWithAncestors
-	result.AncestorSize = entry.SumTxSizeWitAncestors
-	result.AncestorFees = entry.SumTxFeeWithAncestors
+	descendants := mempool.GetInstance().GetDescendantStats(entry)
+	result.DescendantCount = descendants.Count
+	result.DescendantSize = descendants.Size
+	result.DescendantFees = descendants.Fee
+	ancestors := mempool.GetInstance().GetAncestorStats(entry)
+	result.AncestorCount = ancestors.Count
+	result.AncestorSize = ancestors.Size
+	result.AncestorFees = ancestors.Fee
 
 	setDepends := make([]string, 0)
 	for _, in := range entry.Tx.GetIns() {
@@ -638,6 +651,449 @@ func handleGetMempoolEntry(s *Server, cmd interface{}, closeChan <-chan struct{}
 	return entryToJSON(entry), nil
 }
 
+// mempoolEventsKept is the number of mempool events kept for
+// getmempoolevents at most.
+const mempoolEventsKept = 10000
+
+// maxMempoolEventsTimeout is the seconds getmempoolevents waits at most.
+const maxMempoolEventsTimeout = 600
+
+// mempoolEventLog keeps the last mempool events for getmempoolevents, from
+// its first call on.
+type mempoolEventLog struct {
+	once    sync.Once
+	lock    sync.Mutex
+	sub     *mempool.Subscription
+	events  []*mempool.Event
+	arrived chan struct{}
+}
+
+var mempoolEvents = &mempoolEventLog{}
+
+func (l *mempoolEventLog) start() {
+	l.once.Do(func() {
+		l.arrived = make(chan struct{})
+		l.sub = mempool.GetInstance().Subscribe(mempoolEventsKept)
+		go l.run()
+	})
+}
+
+func (l *mempoolEventLog) run() {
+	for event := range l.sub.Events() {
+		l.lock.Lock()
+		l.events = append(l.events, event)
+		if len(l.events) > mempoolEventsKept {
+			l.events = l.events[len(l.events)-mempoolEventsKept:]
+		}
+		close(l.arrived)
+		l.arrived = make(chan struct{})
+		l.lock.Unlock()
+	}
+}
+
+// after returns the events following since, and a channel closed when the
+// next event arrives.
+func (l *mempoolEventLog) after(since uint64) ([]*mempool.Event, <-chan struct{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	i := sort.Search(len(l.events), func(i int) bool {
+		return l.events[i].Sequence > since
+	})
+	events := make([]*mempool.Event, len(l.events)-i)
+	copy(events, l.events[i:])
+	return events, l.arrived
+}
+
+// last returns the sequence of the last event kept.
+func (l *mempoolEventLog) last() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.events) == 0 {
+		return 0
+	}
+	return l.events[len(l.events)-1].Sequence
+}
+
+func handleGetMempoolEvents(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEventsCmd)
+
+	timeout := *c.Timeout
+	if timeout < 0 || timeout > maxMempoolEventsTimeout {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid timeout, must be between 0 and %d", maxMempoolEventsTimeout),
+		}
+	}
+
+	mempoolEvents.start()
+	events, arrived := mempoolEvents.after(*c.Since)
+	if len(events) == 0 && timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout) * time.Second)
+		defer timer.Stop()
+		select {
+		case <-arrived:
+			events, _ = mempoolEvents.after(*c.Since)
+		case <-timer.C:
+		case <-closeChan:
+			return nil, ErrClientQuit
+		}
+	}
+
+	ret := &btcjson.GetMempoolEventsResult{
+		Events:   make([]*btcjson.MempoolEventResult, 0, len(events)),
+		Sequence: mempoolEvents.last(),
+		Dropped:  mempoolEvents.sub.Dropped(),
+	}
+	for _, event := range events {
+		result := &btcjson.MempoolEventResult{
+			Sequence: event.Sequence,
+			Type:     event.Type.String(),
+			TxID:     event.Tx.GetHash().String(),
+			Time:     event.Time.Unix(),
+		}
+		if event.Type == mempool.TxRemoved {
+			result.Reason = event.Reason.String()
+			if event.ReplacedBy != nil {
+				result.ReplacedBy = event.ReplacedBy.String()
+			}
+		}
+		ret.Events = append(ret.Events, result)
+	}
+	return ret, nil
+}
+
+// defaultFeeHistogramBoundaries are the lower bounds of the fee rate bands of
+// getmempoolfeehistogram, in satoshis per byte.
+var defaultFeeHistogramBoundaries = []float64{1, 2, 3, 4, 5, 6, 8, 10, 12, 15, 20, 25, 30, 40,
+	50, 60, 80, 100, 120, 150, 200, 250, 300, 400, 500, 600, 800, 1000}
+
+// maxFeeHistogramBuckets is the number of bands of a histogram at most.
+const maxFeeHistogramBuckets = 1000
+
+// feeHistogramsKept is the number of histograms kept at most, by fee rate
+// kind.
+const feeHistogramsKept = 16
+
+// feeRateRecord is the fee and size a transaction is sorted into a band by,
+// its own or with its ancestors, with its own size counted in the band.
+type feeRateRecord struct {
+	fee   int64
+	size  int64
+	vsize int64
+}
+
+// feeHistogramBands are the counts and sizes of the transactions in the fee
+// rate bands starting at the boundaries. The transactions paying less than
+// the lowest boundary count in the lowest band.
+type feeHistogramBands struct {
+	boundaries []float64
+	counts     []int
+	vsizes     []int64
+}
+
+func newFeeHistogramBands(boundaries []float64) *feeHistogramBands {
+	return &feeHistogramBands{
+		boundaries: boundaries,
+		counts:     make([]int, len(boundaries)),
+		vsizes:     make([]int64, len(boundaries)),
+	}
+}
+
+// add counts the transaction of the record in its band, or takes it out of
+// its band when sign is -1.
+func (b *feeHistogramBands) add(record feeRateRecord, sign int) {
+	feeRate := float64(record.fee) / float64(record.size)
+	i := sort.Search(len(b.boundaries), func(i int) bool {
+		return b.boundaries[i] > feeRate
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	b.counts[i] += sign
+	b.vsizes[i] += int64(sign) * record.vsize
+}
+
+// result returns the bands from the highest fee rate down, each with the size
+// of the transactions paying at least its fee rate.
+func (b *feeHistogramBands) result(ancestor bool) *btcjson.GetMempoolFeeHistogramResult {
+	result := &btcjson.GetMempoolFeeHistogramResult{
+		Ancestor: ancestor,
+		Buckets:  make([]*btcjson.MempoolFeeHistogramBucket, 0, len(b.boundaries)),
+	}
+	cumulative := int64(0)
+	for i := len(b.boundaries) - 1; i >= 0; i-- {
+		cumulative += b.vsizes[i]
+		result.Buckets = append(result.Buckets, &btcjson.MempoolFeeHistogramBucket{
+			FeeRate:         b.boundaries[i],
+			Count:           b.counts[i],
+			VSize:           b.vsizes[i],
+			CumulativeVSize: cumulative,
+		})
+	}
+	return result
+}
+
+// feeHistogramEventBuffer is the number of mempool events waiting for a
+// histogram at most. The histogram is made again when some are dropped.
+const feeHistogramEventBuffer = 10000
+
+// feeHistogram keeps the records of the transactions of a mempool, of one fee
+// rate kind, with the bands of the boundaries asked for. It follows the
+// events of the mempool to tell which records changed.
+type feeHistogram struct {
+	pool     *mempool.TxMempool
+	ancestor bool
+	sub      *mempool.Subscription
+	dropped  uint64
+	deltas   map[util.Hash]int64
+	records  map[util.Hash]feeRateRecord
+	bands    map[string]*feeHistogramBands
+}
+
+func newFeeHistogram(pool *mempool.TxMempool, ancestor bool) *feeHistogram {
+	h := &feeHistogram{
+		pool:     pool,
+		ancestor: ancestor,
+		sub:      pool.Subscribe(feeHistogramEventBuffer),
+		bands:    make(map[string]*feeHistogramBands),
+	}
+	h.deltas = pool.GetAllFeeDeltas()
+	pool.RLock()
+	h.records = feeRateRecords(pool, ancestor)
+	pool.RUnlock()
+	return h
+}
+
+// close stops following the events of the mempool.
+func (h *feeHistogram) close() {
+	h.sub.Unsubscribe()
+}
+
+// update brings the bands up to date with the mempool. Only the transactions
+// added, removed or prioritised since the last update, with their
+// descendants for the ancestor fee rates, move between the bands, unless
+// events were dropped.
+func (h *feeHistogram) update() {
+	changed := make(map[util.Hash]*tx.Tx)
+out:
+	for {
+		select {
+		case event := <-h.sub.Events():
+			changed[event.Tx.GetHash()] = event.Tx
+		default:
+			break out
+		}
+	}
+	deltas := h.pool.GetAllFeeDeltas()
+	for hash, delta := range deltas {
+		if h.deltas[hash] != delta {
+			changed[hash] = nil
+		}
+	}
+	for hash := range h.deltas {
+		if _, ok := deltas[hash]; !ok {
+			changed[hash] = nil
+		}
+	}
+	h.deltas = deltas
+
+	if dropped := h.sub.Dropped(); dropped != h.dropped {
+		h.dropped = dropped
+		h.pool.RLock()
+		records := feeRateRecords(h.pool, h.ancestor)
+		h.pool.RUnlock()
+		for hash, record := range h.records {
+			h.move(hash, record, false)
+		}
+		for hash, record := range records {
+			h.move(hash, record, true)
+		}
+		return
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	h.pool.RLock()
+	defer h.pool.RUnlock()
+	stale := make(map[*mempool.TxEntry]struct{})
+	for hash, txn := range changed {
+		if entry := h.pool.FindTxWithoutLock(hash); entry != nil {
+			h.staleWith(entry, stale)
+			continue
+		}
+		if record, ok := h.records[hash]; ok {
+			h.move(hash, record, false)
+		}
+		// The children of a removed transaction lose an ancestor.
+		for i := 0; txn != nil && h.ancestor && i < txn.GetOutsCount(); i++ {
+			out := outpoint.OutPoint{Hash: hash, Index: uint32(i)}
+			if child := h.pool.HasSPentOutWithoutLock(&out); child != nil {
+				h.staleWith(child, stale)
+			}
+		}
+	}
+
+	entries := make([]*mempool.TxEntry, 0, len(stale))
+	for entry := range stale {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Depth < entries[j].Depth
+	})
+	for _, entry := range entries {
+		hash := entry.Tx.GetHash()
+		if old, ok := h.records[hash]; ok {
+			h.move(hash, old, false)
+		}
+		h.move(hash, feeRateRecordOf(h.pool, entry, h.records, h.ancestor), true)
+	}
+}
+
+// staleWith adds the entry to the entries whose record must be made again,
+// with its descendants for the ancestor fee rates.
+func (h *feeHistogram) staleWith(entry *mempool.TxEntry, stale map[*mempool.TxEntry]struct{}) {
+	if !h.ancestor {
+		stale[entry] = struct{}{}
+		return
+	}
+	h.pool.CalculateDescendants(entry, stale)
+}
+
+// move counts the record of the transaction in the bands and keeps it, or
+// takes it out of the bands and forgets it.
+func (h *feeHistogram) move(hash util.Hash, record feeRateRecord, in bool) {
+	sign := -1
+	if in {
+		sign = 1
+		h.records[hash] = record
+	} else {
+		delete(h.records, hash)
+	}
+	for _, bands := range h.bands {
+		bands.add(record, sign)
+	}
+}
+
+// get returns the histogram of the boundaries, counting the records in new
+// bands the first time the boundaries are asked for.
+func (h *feeHistogram) get(boundaries []float64) *btcjson.GetMempoolFeeHistogramResult {
+	key := fmt.Sprint(boundaries)
+	bands, ok := h.bands[key]
+	if !ok {
+		if len(h.bands) >= feeHistogramsKept {
+			h.bands = make(map[string]*feeHistogramBands)
+		}
+		bands = newFeeHistogramBands(boundaries)
+		for _, record := range h.records {
+			bands.add(record, 1)
+		}
+		h.bands[key] = bands
+	}
+	return bands.result(h.ancestor)
+}
+
+// feeRateRecords returns the records of the transactions of the mempool, whose
+// lock is held. The mempool keeps no sums over the ancestors, so they are
+// summed here in the order of depth.
+func feeRateRecords(pool *mempool.TxMempool, ancestor bool) map[util.Hash]feeRateRecord {
+	all := pool.GetAllTxEntryWithoutLock()
+	entries := make([]*mempool.TxEntry, 0, len(all))
+	for _, entry := range all {
+		entries = append(entries, entry)
+	}
+	if ancestor {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Depth < entries[j].Depth
+		})
+	}
+
+	records := make(map[util.Hash]feeRateRecord, len(entries))
+	for _, entry := range entries {
+		records[entry.Tx.GetHash()] = feeRateRecordOf(pool, entry, records, ancestor)
+	}
+	return records
+}
+
+// feeRateRecordOf returns the record of the entry of the mempool, whose lock
+// is held. A transaction with a single parent adds its own to the record of
+// the parent, which must be up to date, the others walk their ancestors.
+func feeRateRecordOf(pool *mempool.TxMempool, entry *mempool.TxEntry,
+	records map[util.Hash]feeRateRecord, ancestor bool) feeRateRecord {
+
+	record := feeRateRecord{
+		fee:   entry.GetModifiedFee(),
+		size:  int64(entry.TxSize),
+		vsize: int64(entry.TxSize),
+	}
+	if ancestor && len(entry.ParentTx) == 1 {
+		for parent := range entry.ParentTx {
+			record.fee += records[parent.Tx.GetHash()].fee
+			record.size += records[parent.Tx.GetHash()].size
+		}
+	} else if ancestor && len(entry.ParentTx) > 1 {
+		for other := range pool.CalculateMemPoolAncestors(entry.Tx) {
+			record.fee += other.GetModifiedFee()
+			record.size += int64(other.TxSize)
+		}
+	}
+	return record
+}
+
+// feeHistogramCache keeps the histograms of the mempool by fee rate kind,
+// made again when the mempool is.
+type feeHistogramCache struct {
+	lock       sync.Mutex
+	histograms map[bool]*feeHistogram
+}
+
+var feeHistograms = &feeHistogramCache{}
+
+func (c *feeHistogramCache) get(boundaries []float64, ancestor bool) *btcjson.GetMempoolFeeHistogramResult {
+	pool := mempool.GetInstance()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.histograms == nil {
+		c.histograms = make(map[bool]*feeHistogram)
+	}
+	h, ok := c.histograms[ancestor]
+	if ok && h.pool == pool {
+		h.update()
+	} else {
+		if ok {
+			h.close()
+		}
+		h = newFeeHistogram(pool, ancestor)
+		c.histograms[ancestor] = h
+	}
+	return h.get(boundaries)
+}
+
+func handleGetMempoolFeeHistogram(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolFeeHistogramCmd)
+
+	boundaries := defaultFeeHistogramBoundaries
+	if c.Boundaries != nil {
+		boundaries = *c.Boundaries
+	}
+	if len(boundaries) == 0 || len(boundaries) > maxFeeHistogramBuckets {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid boundaries, must be between 1 and %d fee rates", maxFeeHistogramBuckets),
+		}
+	}
+	for i, boundary := range boundaries {
+		if boundary < 0 || (i > 0 && boundary <= boundaries[i-1]) {
+			return nil, btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid boundaries, must be increasing fee rates of at least 0",
+			}
+		}
+	}
+
+	return feeHistograms.get(boundaries, *c.Ancestor), nil
+}
+
 func handleGetMempoolInfo(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	pool := mempool.GetInstance()
 	ret := &btcjson.GetMempoolInfoResult{
@@ -646,10 +1102,128 @@ func handleGetMempoolInfo(s *Server, cmd interface{}, closeChan <-chan struct{})
 		Usage:         pool.GetPoolUsage(),
 		MaxMempool:    int(conf.Cfg.Mempool.MaxPoolSize),
 		MempoolMinFee: valueFromAmount(pool.GetMinFeeRate().SataoshisPerK),
+		Rejected:      lmempool.RejectStats(),
 	}
 	return ret, nil
 }
 
+func mempoolPolicyToJSON(p *policy.Policy) *btcjson.GetMempoolPolicyResult {
+	rules := make(map[string]bool, len(policy.Rules))
+	for _, rule := range policy.Rules {
+		rules[rule] = p.Enabled(rule)
+	}
+	return &btcjson.GetMempoolPolicyResult{
+		Name:                  p.Name,
+		Rules:                 rules,
+		MinTxSize:             p.MinTxSize,
+		MaxTxSize:             p.MaxTxSize,
+		ScriptTemplates:       p.ScriptTemplates,
+		MaxDataCarrierOutputs: p.MaxDataCarrierOutputs,
+		MaxDataCarrierBytes:   p.MaxDataCarrierBytes,
+		DustRelayFee:          valueFromAmount(p.DustRelayFee),
+		MinRelayFee:           valueFromAmount(p.MinRelayFee),
+		MaxTxSigOps:           p.MaxTxSigOps,
+		MaxP2SHSigOps:         p.MaxP2SHSigOps,
+	}
+}
+
+func handleGetMempoolPolicy(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return mempoolPolicyToJSON(policy.GetInstance()), nil
+}
+
+func handleSetMempoolPolicy(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetMempoolPolicyCmd)
+
+	if c.Policy == nil {
+		policy.SetInstance(nil)
+		return mempoolPolicyToJSON(policy.GetInstance()), nil
+	}
+
+	invalidParameter := func(msg string) error {
+		return btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid parameter, " + msg,
+		}
+	}
+	if c.Policy.Name == "" {
+		return nil, invalidParameter("name is required")
+	}
+
+	p := policy.GetInstance().Copy()
+	p.Name = c.Policy.Name
+	for _, rule := range c.Policy.EnableRules {
+		p.Disabled[rule] = false
+	}
+	for _, rule := range c.Policy.DisableRules {
+		p.Disabled[rule] = true
+	}
+	if c.Policy.MinTxSize != nil {
+		p.MinTxSize = *c.Policy.MinTxSize
+	}
+	if c.Policy.MaxTxSize != nil {
+		p.MaxTxSize = *c.Policy.MaxTxSize
+	}
+	if len(c.Policy.ScriptTemplates) != 0 {
+		p.ScriptTemplates = c.Policy.ScriptTemplates
+	}
+	if c.Policy.MaxDataCarrierOutputs != nil {
+		if *c.Policy.MaxDataCarrierOutputs < 0 {
+			return nil, invalidParameter("maxdatacarrieroutputs must not be negative")
+		}
+		p.MaxDataCarrierOutputs = *c.Policy.MaxDataCarrierOutputs
+	}
+	if c.Policy.MaxDataCarrierBytes != nil {
+		p.MaxDataCarrierBytes = *c.Policy.MaxDataCarrierBytes
+	}
+	if c.Policy.DustRelayFee != nil {
+		amt, err := amount.NewAmount(*c.Policy.DustRelayFee)
+		if err != nil || !amount.MoneyRange(amt) {
+			return nil, invalidParameter("dustrelayfee out of range")
+		}
+		p.DustRelayFee = int64(amt)
+	}
+	if c.Policy.MinRelayFee != nil {
+		amt, err := amount.NewAmount(*c.Policy.MinRelayFee)
+		if err != nil || !amount.MoneyRange(amt) {
+			return nil, invalidParameter("minrelayfee out of range")
+		}
+		p.MinRelayFee = int64(amt)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, invalidParameter(err.Error())
+	}
+
+	policy.SetInstance(p)
+	log.Info("mempool policy set to %s", p.Name)
+	return mempoolPolicyToJSON(p), nil
+}
+
+func handleSaveMempool(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	if err := lmempool.DumpMempool(); err != nil {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Unable to dump mempool to disk: " + err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func handleLoadMempool(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats, err := lmempool.LoadMempool()
+	if err != nil {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Unable to load mempool from disk: " + err.Error(),
+		}
+	}
+	return &btcjson.LoadMempoolResult{
+		Loaded:       stats.Loaded,
+		Failed:       stats.Failed,
+		Expired:      stats.Expired,
+		AlreadyThere: stats.AlreadyThere,
+	}, nil
+}
+
 func valueFromAmount(sizeLimit int64) float64 {
 	var nAbs int64
 	var strFormat string
@@ -696,6 +1270,56 @@ func handleGetRawMempool(s *Server, cmd interface{}, closeChan <-chan struct{})
 	return txIds, nil
 }
 
+func handleGetOrphanTxs(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetOrphanTxsCmd)
+
+	verbosity := 0
+	if c.Verbosity != nil {
+		verbosity = *c.Verbosity
+	}
+	if verbosity < 0 || verbosity > 2 {
+		return nil, btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Invalid verbosity value %d", verbosity),
+		}
+	}
+
+	orphans := mempool.GetInstance().GetOrphanTxs()
+	if verbosity == 0 {
+		txIds := make([]string, 0, len(orphans))
+		for _, orphan := range orphans {
+			txIds = append(txIds, orphan.Tx.GetHash().String())
+		}
+		return txIds, nil
+	}
+
+	results := make([]*btcjson.GetOrphanTxsResult, 0, len(orphans))
+	for _, orphan := range orphans {
+		parents := lmempool.MissingParents(orphan.Tx)
+		missingParents := make([]string, 0, len(parents))
+		for _, parent := range parents {
+			missingParents = append(missingParents, parent.String())
+		}
+		result := &btcjson.GetOrphanTxsResult{
+			TxID:           orphan.Tx.GetHash().String(),
+			Size:           orphan.Size,
+			Time:           orphan.Time.Unix(),
+			Expiration:     orphan.Expiration.Unix(),
+			From:           orphan.NodeID,
+			MissingParents: missingParents,
+		}
+		if verbosity == 2 {
+			buf := bytes.NewBuffer(nil)
+			if err := orphan.Tx.Serialize(buf); err != nil {
+				return nil, btcjson.ErrRPCInternal
+			}
+			result.Hex = hex.EncodeToString(buf.Bytes())
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 func handleGetTxOut(s *Server, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
 
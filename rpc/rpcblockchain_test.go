@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"os"
+	"testing"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/model/utxo"
+	"github.com/copernet/copernicus/persist/db"
+	"github.com/copernet/copernicus/rpc/btcjson"
+	"github.com/copernet/copernicus/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeeHistogram(t *testing.T) {
+	conf.Cfg = conf.InitConfig([]string{})
+	dataDir, err := conf.SetUnitTestDataDir(conf.Cfg)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	// The mempool uncaches the coins of the txs it evicts.
+	utxo.InitUtxoLruTip(&utxo.UtxoConfig{Do: &db.DBOption{
+		FilePath:  dataDir + "/chainstate",
+		CacheSize: 1 << 20,
+	}})
+
+	pool := mempool.NewTxMempool()
+	// addTx adds a tx paying the fee rate, in satoshis per byte.
+	addTx := func(prevout *outpoint.OutPoint, feeRate int64) *mempool.TxEntry {
+		txn := tx.NewTx(0, tx.TxVersion)
+		txn.AddTxIn(txin.NewTxIn(prevout, script.NewScriptRaw([]byte{opcodes.OP_11}), script.SequenceFinal))
+		txn.AddTxOut(txout.NewTxOut(33000, script.NewScriptRaw([]byte{opcodes.OP_11, opcodes.OP_EQUAL})))
+		fee := feeRate * int64(txn.EncodeSize())
+		entry := mempool.NewTxentry(txn, fee, util.GetTimeSec(), 1, mempool.LockPoints{}, 0, false)
+		assert.Nil(t, pool.AddTx(entry))
+		return entry
+	}
+	bucket := func(feeRate float64, count int, vsize, cumulative int64) *btcjson.MempoolFeeHistogramBucket {
+		return &btcjson.MempoolFeeHistogramBucket{
+			FeeRate:         feeRate,
+			Count:           count,
+			VSize:           vsize,
+			CumulativeVSize: cumulative,
+		}
+	}
+
+	parent := addTx(outpoint.NewOutPoint(util.HashOne, 0), 0)
+	child := addTx(outpoint.NewOutPoint(parent.Tx.GetHash(), 0), 20)
+	other := addTx(outpoint.NewOutPoint(util.HashOne, 1), 3)
+	p, c, o := int64(parent.TxSize), int64(child.TxSize), int64(other.TxSize)
+	boundaries := []float64{1, 2, 5}
+
+	// The tx paying less than the lowest boundary counts in the lowest band.
+	individual := newFeeHistogram(pool, false)
+	defer individual.close()
+	assert.Equal(t, []*btcjson.MempoolFeeHistogramBucket{
+		bucket(5, 1, c, c),
+		bucket(2, 1, o, c+o),
+		bucket(1, 1, p, c+o+p),
+	}, individual.get(boundaries).Buckets)
+
+	// The child pays for its parent, still above the highest boundary.
+	ancestor := newFeeHistogram(pool, true)
+	defer ancestor.close()
+	result := ancestor.get(boundaries)
+	assert.True(t, result.Ancestor)
+	assert.Equal(t, []*btcjson.MempoolFeeHistogramBucket{
+		bucket(5, 1, c, c),
+		bucket(2, 1, o, c+o),
+		bucket(1, 1, p, c+o+p),
+	}, result.Buckets)
+
+	// The bands follow the changes of the mempool.
+	pool.PrioritiseTransaction(parent.Tx.GetHash(), 3*p)
+	pool.RemoveTxRecursive(other.Tx, mempool.UNKNOWN)
+	individual.update()
+	ancestor.update()
+	assert.Equal(t, []*btcjson.MempoolFeeHistogramBucket{
+		bucket(5, 1, c, c),
+		bucket(2, 1, p, c+p),
+		bucket(1, 0, 0, c+p),
+	}, individual.get(boundaries).Buckets)
+	fresh := func(ancestor bool) *btcjson.GetMempoolFeeHistogramResult {
+		h := newFeeHistogram(pool, ancestor)
+		defer h.close()
+		return h.get(boundaries)
+	}
+	assert.Equal(t, fresh(false), individual.get(boundaries))
+	assert.Equal(t, fresh(true), ancestor.get(boundaries))
+
+	// The child left without parent is sorted by its own fee rate.
+	pool.RemoveTxSelf([]*tx.Tx{parent.Tx})
+	ancestor.update()
+	assert.Equal(t, []*btcjson.MempoolFeeHistogramBucket{
+		bucket(5, 1, c, c),
+		bucket(2, 0, 0, c),
+		bucket(1, 0, 0, c),
+	}, ancestor.get(boundaries).Buckets)
+	assert.Equal(t, fresh(true), ancestor.get(boundaries))
+
+	// The records are made again when events are dropped.
+	individual.close()
+	individual.sub = pool.Subscribe(0)
+	addTx(outpoint.NewOutPoint(util.HashOne, 2), 3)
+	individual.update()
+	assert.Equal(t, fresh(false), individual.get(boundaries))
+	assert.Equal(t, 2, len(individual.records))
+}
@@ -34,6 +34,10 @@ const (
 	rpcAuthTimeoutSeconds = 10
 )
 
+// ErrClientQuit describes the error where a client send is not processed due
+// to the client having already been disconnected or dropped.
+var ErrClientQuit = errors.New("client quit")
+
 func internalRPCError(errStr, context string) *btcjson.RPCError {
 	logStr := errStr
 	if context != "" {
@@ -1,7 +1,6 @@
 package mining
 
 import (
-	"math"
 	"sort"
 	"strconv"
 
@@ -27,7 +26,6 @@ import (
 	"github.com/copernet/copernicus/model/utxo"
 	"github.com/copernet/copernicus/model/versionbits"
 	"github.com/copernet/copernicus/util"
-	"github.com/copernet/copernicus/util/algorithm/mapcontainer"
 	"github.com/copernet/copernicus/util/amount"
 )
 
@@ -148,14 +146,6 @@ func computeMaxGeneratedBlockSize() uint64 {
 	return maxGeneratedBlockSize
 }
 
-type ByAncsCount []*mempool.TxEntry
-
-func (a ByAncsCount) Len() int      { return len(a) }
-func (a ByAncsCount) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a ByAncsCount) Less(i, j int) bool {
-	return a[i].SumTxCountWithAncestors < a[j].SumTxCountWithAncestors
-}
-
 type sortTxs []*tx.Tx
 
 func (s sortTxs) Len() int {
@@ -170,24 +160,19 @@ func (s sortTxs) Less(i, j int) bool {
 	return pow.HashToBig(&h1).Cmp(pow.HashToBig(&h2)) < 0
 }
 
-func sortTxsByAncestorCount(ancestors map[*mempool.TxEntry]struct{}) (result []*mempool.TxEntry) {
-
-	result = make([]*mempool.TxEntry, 0, len(ancestors))
-	for item := range ancestors {
-		result = append(result, item)
-	}
-
-	sort.Sort(ByAncsCount(result))
-	return result
+// sortByDepth sorts the entries parents first.
+func sortByDepth(entries []*mempool.TxEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Depth < entries[j].Depth
+	})
 }
 
-// This transaction selection algorithm orders the mempool based on feerate of a
-// transaction including all unconfirmed ancestors. Since we don't remove
-// transactions from the mempool as we select them for block inclusion, we need
-// an alternate method of updating the feerate of a transaction with its
-// not-yet-selected ancestors as we go.
-func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) int {
-	descendantsUpdated := 0
+// This transaction selection algorithm orders the mempool based on fee or
+// feerate of a transaction including all its ancestors not in the block yet,
+// so that a child pays for its parents. The mempool only links the txs with
+// their parents and children, so the stats of the packages are computed here,
+// and updated for the descendants of the txs entering the block.
+func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) {
 	pool := mempool.GetInstance() // todo use global variable
 	pool.RLock()
 	defer pool.RUnlock()
@@ -195,44 +180,25 @@ func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) int {
 
 	consecutiveFailed := 0
 
-	var txSet mapcontainer.MapContainer
-	switch tmpStrategy {
-	case sortByFee:
-		txSet = sortedByFeeWithAncestors()
-	case sortByFeeRate:
-		txSet = sortedByFeeRateWithAncestors()
+	entries := make([]*mempool.TxEntry, 0, pool.Size())
+	for _, entry := range pool.GetAllTxEntryWithoutLock() {
+		entries = append(entries, entry)
+	}
+	sortByDepth(entries)
+	packages := newPackageSet(tmpStrategy)
+	for _, entry := range entries {
+		packages.update(entry, packages.ancestorStats(entry, ba.inBlock))
 	}
 
-	//pendingTx := make(map[util.Hash]mempool.TxEntry)
-	failedTx := make(map[util.Hash]mempool.TxEntry)
-	for txSet.Len() > 0 {
-		// select the max value item, and delete it. select strategy is descent.
-		var entry mempool.TxEntry
-
-		switch tmpStrategy {
-		case sortByFee:
-			less, _ := txSet.Max()
-			entry = mempool.TxEntry(less.(EntryFeeSort))
-			txSet.DeleteMax()
-		case sortByFeeRate:
-			less, _ := txSet.Max()
-			entry = mempool.TxEntry(less.(EntryAncestorFeeRateSort))
-			txSet.DeleteMax()
-		}
-		// if inBlock has the item, continue next loop
-		if _, ok := ba.inBlock[entry.Tx.GetHash()]; ok {
-			continue
-		}
-		// if the item has failed in packing into the block, continue next loop
-		if _, ok := failedTx[entry.Tx.GetHash()]; ok {
-			continue
-		}
-
-		packageSize := entry.SumTxSizeWitAncestors
-		packageFee := entry.SumTxFeeWithAncestors
-		packageSigOps := entry.SumTxSigOpCountWithAncestors
+	for packages.Len() > 0 {
+		// select the best package, and delete it.
+		pkg := packages.popBest()
+		packageSize := pkg.stats.Size
+		packageFee := pkg.stats.Fee
+		packageSigOps := pkg.stats.SigOps
 
-		// deal with several different mining strategies
+		// deal with several different mining strategies. The stats of all
+		// the packages are up to date, so none of the others is better.
 		isEnd := false
 		switch tmpStrategy {
 		case sortByFee:
@@ -260,37 +226,72 @@ func (ba *BlockAssembler) addPackageTxs(sortRecord map[util.Hash]int) int {
 			}
 			continue
 		}
-		// add the ancestors of the current item to block
-		noLimit := uint64(math.MaxUint64)
-
-		mempoolAncestors, _ := pool.CalculateMemPoolAncestors(entry.Tx, noLimit, noLimit, noLimit, noLimit, true)
-		ancestors := make(map[*mempool.TxEntry]struct{})
-		for en := range mempoolAncestors {
-			newentry := *en
-			ancestors[&newentry] = struct{}{}
-		}
-
-		ancestors[&entry] = struct{}{} // add current item
-		ancestorsList := sortTxsByAncestorCount(ancestors)
-		ancestorsList = ba.onlyUnconfirmed(ancestorsList)
 
+		ancestorsList := ba.packageTxs(pkg.entry)
 		if !ba.testPackageTransactions(ancestorsList) {
 			continue
 		}
 
-		// This transaction will make it in; reset the failed counter.
+		// This package will make it in; reset the failed counter.
 		consecutiveFailed = 0
-		addset := make(map[util.Hash]mempool.TxEntry)
-
 		for _, item := range ancestorsList {
 			ba.addToBlock(item)
 			sortRecord[item.Tx.GetHash()] = len(ba.bt.TxFees) - 1
-			addset[item.Tx.GetHash()] = *item
+			packages.remove(item)
 		}
 
-		descendantsUpdated += ba.updatePackagesForAdded(txSet, ancestorsList)
+		ba.updatePackagesForAdded(packages, ancestorsList)
+	}
+}
+
+// packageTxs returns the tx with its ancestors not in the block yet, parents
+// first.
+func (ba *BlockAssembler) packageTxs(entry *mempool.TxEntry) []*mempool.TxEntry {
+	seen := map[*mempool.TxEntry]struct{}{entry: {}}
+	list := []*mempool.TxEntry{entry}
+	for i := 0; i < len(list); i++ {
+		for parent := range list[i].ParentTx {
+			if _, ok := seen[parent]; ok {
+				continue
+			}
+			if _, ok := ba.inBlock[parent.Tx.GetHash()]; ok {
+				continue
+			}
+			seen[parent] = struct{}{}
+			list = append(list, parent)
+		}
+	}
+	sortByDepth(list)
+	return list
+}
+
+// updatePackagesForAdded computes again the packages of the descendants of
+// the txs added to the block, which are not part of them any more.
+func (ba *BlockAssembler) updatePackagesForAdded(packages *packageSet, added []*mempool.TxEntry) {
+	seen := make(map[*mempool.TxEntry]struct{})
+	var descendants []*mempool.TxEntry
+	stage := append([]*mempool.TxEntry(nil), added...)
+	for len(stage) > 0 {
+		entry := stage[len(stage)-1]
+		stage = stage[:len(stage)-1]
+		for child := range entry.ChildTx {
+			if _, ok := seen[child]; ok {
+				continue
+			}
+			seen[child] = struct{}{}
+			stage = append(stage, child)
+			if _, ok := ba.inBlock[child.Tx.GetHash()]; !ok {
+				descendants = append(descendants, child)
+			}
+		}
+	}
+
+	// The parents are updated before their children, whose stats derive
+	// from them.
+	sortByDepth(descendants)
+	for _, entry := range descendants {
+		packages.update(entry, packages.ancestorStats(entry, ba.inBlock))
 	}
-	return descendantsUpdated
 }
 
 func BasicScriptSig() *script.Script {
@@ -339,7 +340,7 @@ func (ba *BlockAssembler) CreateNewBlock(scriptPubKey, scriptSig *script.Script)
 		ba.lockTimeCutoff = int64(ba.bt.Block.GetBlockHeader().Time)
 	}
 	sortRecord := make(map[util.Hash]int)
-	descendantsUpdated := ba.addPackageTxs(sortRecord)
+	ba.addPackageTxs(sortRecord)
 
 	if model.IsMagneticAnomalyEnabled(indexPrev.GetMedianTimePast()) {
 		// If magnetic anomaly is enabled, we make sure transaction are
@@ -407,23 +408,13 @@ func (ba *BlockAssembler) CreateNewBlock(scriptPubKey, scriptSig *script.Script)
 	}
 
 	time2 := util.GetTimeMicroSec()
-	log.Print("bench", "debug", "CreateNewBlock() packages: %.2fms (%d packages, %d "+
-		"updated descendants), validity: %.2fms (total %.2fms)\n", 0.001*float64(time1-timeStart),
-		ba.blockTx, descendantsUpdated, 0.001*float64(time2-time1), 0.001*float64(time2-timeStart))
+	log.Print("bench", "debug", "CreateNewBlock() txs: %.2fms (%d txs), validity: %.2fms "+
+		"(total %.2fms)\n", 0.001*float64(time1-timeStart),
+		ba.blockTx, 0.001*float64(time2-time1), 0.001*float64(time2-timeStart))
 
 	return ba.bt
 }
 
-func (ba *BlockAssembler) onlyUnconfirmed(entryList []*mempool.TxEntry) []*mempool.TxEntry {
-	result := make([]*mempool.TxEntry, 0)
-	for _, entry := range entryList {
-		if _, ok := ba.inBlock[entry.Tx.GetHash()]; !ok {
-			result = append(result, entry)
-		}
-	}
-	return result
-}
-
 // Perform transaction-level checks before adding to block:
 // - transaction finality (locktime)
 // - serialized size (in case -blockmaxsize is in use)
@@ -444,46 +435,6 @@ func (ba *BlockAssembler) testPackageTransactions(entrySet []*mempool.TxEntry) b
 	return true
 }
 
-func (ba *BlockAssembler) updatePackagesForAdded(txSet mapcontainer.MapContainer, alreadyAdded []*mempool.TxEntry) int {
-	descendantUpdate := 0
-	mpool := mempool.GetInstance()
-	tmpStrategy := *getStrategy()
-
-	for _, entry := range alreadyAdded {
-		descendants := make(map[*mempool.TxEntry]struct{})
-		mpool.CalculateDescendants(entry, descendants)
-
-		// Insert all descendants (not yet in block) into the modified set.
-		// use reflect function if there are so many strategies
-		for desc := range descendants {
-			descendantUpdate++
-			switch tmpStrategy {
-			case sortByFee:
-				item := EntryFeeSort(*desc)
-				// remove the old one
-				txSet.Delete(item)
-				// update origin data
-				item.SumTxSizeWitAncestors -= entry.SumTxSizeWitAncestors
-				item.SumTxFeeWithAncestors -= entry.SumTxFeeWithAncestors
-				item.SumTxSigOpCountWithAncestors -= entry.SumTxSigOpCountWithAncestors
-				// insert the modified one
-				txSet.ReplaceOrInsert(item)
-			case sortByFeeRate:
-				item := EntryAncestorFeeRateSort(*desc)
-				// remove the old one
-				txSet.Delete(item)
-				// update origin data
-				item.SumTxSizeWitAncestors -= entry.SumTxSizeWitAncestors
-				item.SumTxFeeWithAncestors -= entry.SumTxFeeWithAncestors
-				item.SumTxSigOpCountWithAncestors -= entry.SumTxSigOpCountWithAncestors
-				// insert the modified one
-				txSet.ReplaceOrInsert(item)
-			}
-		}
-	}
-	return descendantUpdate
-}
-
 func CoinbaseScriptSig(extraNonce uint) *script.Script {
 	scriptSig := script.NewEmptyScript()
 
@@ -35,7 +35,7 @@ import (
 	"testing"
 )
 
-func initTestEnv(t *testing.T, initScriptVerify bool) (dirpath string, err error) {
+func initTestEnv(t testing.TB, initScriptVerify bool) (dirpath string, err error) {
 	args := []string{"--regtest"}
 	conf.Cfg = conf.InitConfig(args)
 
@@ -301,7 +301,6 @@ func createTx(tt *testing.T, baseTx *tx.Tx, pubKey *script.Script) []*mempool.Tx
 	//coinsMap.AddCoin(outpointK, utxo.NewFreshCoin(tx2.GetTxOut(0), 0, false), false)
 	//ltx.SignRawTransaction([]*tx.Tx{tx2}, nil, keyStore, coinsMap, crypto.SigHashAll|crypto.SigHashForkID)
 	txEntry2 := testEntryHelp.SetTime(util.GetTimeSec()).SetFee(amount.Amount(1 * util.COIN)).FromTxToEntry(tx2)
-	txEntry2.ParentTx[txEntry1] = struct{}{}
 
 	//  modify tx3's content to avoid to get the same hash with tx2
 	tx3 := tx.NewTx(0, 0x02)
@@ -317,7 +316,6 @@ func createTx(tt *testing.T, baseTx *tx.Tx, pubKey *script.Script) []*mempool.Tx
 	//coinsMap.AddCoin(outpointK, utxo.NewFreshCoin(tx3.GetTxOut(0), 0, false), false)
 	//ltx.SignRawTransaction([]*tx.Tx{tx3}, nil, keyStore, coinsMap, crypto.SigHashAll|crypto.SigHashForkID)
 	txEntry3 := testEntryHelp.SetTime(util.GetTimeSec()).SetFee(amount.Amount(2 * util.COIN)).FromTxToEntry(tx3)
-	txEntry3.ParentTx[txEntry1] = struct{}{}
 
 	tx4 := tx.NewTx(0, 0x02)
 	// reference relation(tx4 -> tx3 -> tx1)
@@ -333,9 +331,6 @@ func createTx(tt *testing.T, baseTx *tx.Tx, pubKey *script.Script) []*mempool.Tx
 	//ltx.SignRawTransaction([]*tx.Tx{tx4}, nil, keyStore, coinsMap, crypto.SigHashAll|crypto.SigHashForkID)
 	txEntry4 := testEntryHelp.SetTime(util.GetTimeSec()).SetFee(amount.Amount(1 * util.COIN)).FromTxToEntry(tx4)
 
-	txEntry4.ParentTx[txEntry1] = struct{}{}
-	txEntry4.ParentTx[txEntry3] = struct{}{}
-
 	t := make([]*mempool.TxEntry, 4)
 	t[0] = txEntry1
 	t[1] = txEntry2
@@ -351,7 +346,6 @@ func TestCTORAndSortByFee(t *testing.T) {
 
 	// clear mempool data
 	mempool.InitMempool()
-	pool := mempool.GetInstance()
 
 	//chainParams := model.ActiveNetParams
 	//signBox, err := newSignBox(chainParams)
@@ -364,6 +358,9 @@ func TestCTORAndSortByFee(t *testing.T) {
 
 	_, err = generateBlocks(pubKey, 101, 1000000)
 	assert.Nil(t, err)
+	// The mempool is made again when the chain crosses the activation of a
+	// fork, so it is only got now.
+	pool := mempool.GetInstance()
 
 	gChain := chain.GetInstance()
 	bl1Index := gChain.GetIndex(1)
@@ -375,7 +372,7 @@ func TestCTORAndSortByFee(t *testing.T) {
 	txSet := createTx(t, block1.Txs[0], pubKey)
 
 	for _, entry := range txSet {
-		err := pool.AddTx(entry, entry.ParentTx)
+		err := pool.AddTx(entry)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -430,7 +427,6 @@ func TestCreateNewBlockByFeeRate(t *testing.T) {
 
 	// clear mempool data
 	mempool.InitMempool()
-	pool := mempool.GetInstance()
 
 	//chainParams := model.ActiveNetParams
 	//signBox, err := newSignBox(chainParams)
@@ -443,6 +439,9 @@ func TestCreateNewBlockByFeeRate(t *testing.T) {
 
 	_, err = generateBlocks(pubKey, 101, 1000000)
 	assert.Nil(t, err)
+	// The mempool is made again when the chain crosses the activation of a
+	// fork, so it is only got now.
+	pool := mempool.GetInstance()
 
 	bl1Index := gChain.GetIndex(1)
 	assert.NotNil(t, bl1Index)
@@ -453,7 +452,7 @@ func TestCreateNewBlockByFeeRate(t *testing.T) {
 	txSet := createTx(t, block1.Txs[0], pubKey)
 
 	for _, entry := range txSet {
-		pool.AddTx(entry, entry.ParentTx)
+		pool.AddTx(entry)
 	}
 
 	if pool.Size() != 4 {
@@ -475,3 +474,91 @@ func TestCreateNewBlockByFeeRate(t *testing.T) {
 		t.Error("some transactions are inserted to block error")
 	}
 }
+
+func TestAddPackageTxsChildPaysForParent(t *testing.T) {
+	tempDir, err := initTestEnv(t, true)
+	assert.Nil(t, err)
+	defer os.RemoveAll(tempDir)
+	pool := mempool.GetInstance()
+	*getStrategy() = sortByFeeRate
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	testEntryHelp := NewTestMemPoolEntry()
+	newEntry := func(prevout *outpoint.OutPoint, fee amount.Amount) *mempool.TxEntry {
+		txn := tx.NewTx(0, tx.DefaultVersion)
+		txn.AddTxIn(txin.NewTxIn(prevout, script.NewEmptyScript(), math.MaxUint32-1))
+		txn.AddTxOut(txout.NewTxOut(amount.Amount(util.COIN), pubKey))
+		entry := testEntryHelp.SetTime(util.GetTimeSec()).SetFee(fee).FromTxToEntry(txn)
+		assert.Nil(t, pool.AddTx(entry))
+		return entry
+	}
+
+	// The parent pays nothing, its child pays for both.
+	parent := newEntry(outpoint.NewOutPoint(util.HashOne, 0), 0)
+	child := newEntry(outpoint.NewOutPoint(parent.Tx.GetHash(), 0), 10000)
+	// A tx paying less than the min fee rate is left out, whatever the order
+	// it is met in.
+	cheap := newEntry(outpoint.NewOutPoint(util.HashOne, 1), 1)
+	other := newEntry(outpoint.NewOutPoint(util.HashOne, 2), 1000)
+
+	ba := NewBlockAssembler(model.ActiveNetParams)
+	ba.blockMinFeeRate = *util.NewFeeRate(1000)
+	ba.bt = newBlockTemplate()
+	ba.resetBlockAssembler()
+	ba.addPackageTxs(make(map[util.Hash]int))
+
+	for _, entry := range []*mempool.TxEntry{parent, child, other} {
+		_, ok := ba.inBlock[entry.Tx.GetHash()]
+		assert.True(t, ok)
+	}
+	_, ok := ba.inBlock[cheap.Tx.GetHash()]
+	assert.False(t, ok)
+
+	// The parent comes before its child, and the package before the other tx
+	// paying a lower fee rate.
+	if assert.Equal(t, 3, len(ba.bt.Block.Txs)) {
+		assert.Equal(t, parent.Tx.GetHash(), ba.bt.Block.Txs[0].GetHash())
+		assert.Equal(t, child.Tx.GetHash(), ba.bt.Block.Txs[1].GetHash())
+		assert.Equal(t, other.Tx.GetHash(), ba.bt.Block.Txs[2].GetHash())
+	}
+}
+
+func BenchmarkAddPackageTxsChain(b *testing.B) {
+	tempDir, err := initTestEnv(b, true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	pool := mempool.GetInstance()
+
+	pubKey := script.NewEmptyScript()
+	pubKey.PushOpCode(opcodes.OP_TRUE)
+	// One sigop a tx keeps the whole chain within the sigops of a block.
+	testEntryHelp := NewTestMemPoolEntry().SetSigOpsCost(1)
+
+	// A chain of 5000 txs, each spending the output of the one before.
+	const chainLength = 5000
+	prevHash := util.HashOne
+	for i := 0; i < chainLength; i++ {
+		txn := tx.NewTx(0, tx.DefaultVersion)
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(prevHash, 0), script.NewEmptyScript(), math.MaxUint32-1))
+		txn.AddTxOut(txout.NewTxOut(amount.Amount(chainLength-i)*1000, pubKey))
+		prevHash = txn.GetHash()
+		entry := testEntryHelp.SetTime(util.GetTimeSec()).SetFee(1000).FromTxToEntry(txn)
+		if err := pool.AddTx(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	ba := NewBlockAssembler(model.ActiveNetParams)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ba.bt = newBlockTemplate()
+		ba.resetBlockAssembler()
+		ba.addPackageTxs(make(map[util.Hash]int))
+		if ba.blockTx != chainLength {
+			b.Fatalf("%d txs of the chain in the block", ba.blockTx)
+		}
+	}
+}
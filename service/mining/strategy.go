@@ -25,54 +25,172 @@ var strategies = map[string]sortType{
 	"ancestorfeerate": sortByFeeRate,
 }
 
-// EntryFeeSort TxEntry sorted by feeWithAncestors
-type EntryFeeSort mempool.TxEntry
-
-func (e EntryFeeSort) Less(than mapcontainer.Lesser) bool {
-	t := than.(EntryFeeSort)
-	if e.SumTxFeeWithAncestors == t.SumTxFeeWithAncestors {
-		eHash := e.Tx.GetHash()
-		tHash := t.Tx.GetHash()
-		return eHash.Cmp(&tHash) > 0
-	}
-	return e.SumTxFeeWithAncestors < than.(EntryFeeSort).SumTxFeeWithAncestors
+// txPackage is a tx not in the block yet, with the stats of its package: the
+// tx with its ancestors not in the block yet, which are added along with it.
+type txPackage struct {
+	entry *mempool.TxEntry
+	stats mempool.PackageStats
+	// queued tells whether the package is still a candidate of the set.
+	queued bool
 }
 
-func sortedByFeeWithAncestors() mapcontainer.MapContainer {
-	sk := skiplist.New(1 << 32)
-	mpool := mempool.GetInstance()
+// PackageFeeSort txPackage sorted by the modified fee of the package
+type PackageFeeSort txPackage
 
-	for _, txEntry := range mpool.GetAllTxEntry() {
-		sk.ReplaceOrInsert(EntryFeeSort(*txEntry))
+func (p *PackageFeeSort) Less(than mapcontainer.Lesser) bool {
+	t := than.(*PackageFeeSort)
+	if p.stats.Fee == t.stats.Fee {
+		pHash := p.entry.Tx.GetHash()
+		tHash := t.entry.Tx.GetHash()
+		return pHash.Cmp(&tHash) > 0
 	}
-
-	return sk
+	return p.stats.Fee < t.stats.Fee
 }
 
-// EntryAncestorFeeRateSort TxEntry sorted by feeRateWithAncestors
-type EntryAncestorFeeRateSort mempool.TxEntry
+// PackageFeeRateSort txPackage sorted by the modified fee rate of the package
+type PackageFeeRateSort txPackage
 
-func (r EntryAncestorFeeRateSort) Less(than mapcontainer.Lesser) bool {
-	t := than.(EntryAncestorFeeRateSort)
-	b1 := util.NewFeeRateWithSize((r).SumTxFeeWithAncestors, r.SumTxSizeWitAncestors).SataoshisPerK
-	b2 := util.NewFeeRateWithSize(t.SumTxFeeWithAncestors, t.SumTxSizeWitAncestors).SataoshisPerK
+func (p *PackageFeeRateSort) Less(than mapcontainer.Lesser) bool {
+	t := than.(*PackageFeeRateSort)
+	b1 := util.NewFeeRateWithSize(p.stats.Fee, p.stats.Size).SataoshisPerK
+	b2 := util.NewFeeRateWithSize(t.stats.Fee, t.stats.Size).SataoshisPerK
 	if b1 == b2 {
-		rHash := r.Tx.GetHash()
-		tHash := t.Tx.GetHash()
-		return rHash.Cmp(&tHash) > 0
+		pHash := p.entry.Tx.GetHash()
+		tHash := t.entry.Tx.GetHash()
+		return pHash.Cmp(&tHash) > 0
 	}
 	return b1 < b2
 }
 
-func sortedByFeeRateWithAncestors() mapcontainer.MapContainer {
-	sk := skiplist.New(1 << 32)
-	mpool := mempool.GetInstance()
+// packageSet holds the packages of the txs not in the block yet, sorted by
+// the strategy. The mempool keeps no sums over the ancestors, so the stats of
+// the packages are computed here, and updated when txs enter the block.
+type packageSet struct {
+	strategy sortType
+	txs      mapcontainer.MapContainer
+	packages map[*mempool.TxEntry]*txPackage
+}
+
+func newPackageSet(strategy sortType) *packageSet {
+	return &packageSet{
+		strategy: strategy,
+		txs:      skiplist.New(1 << 32),
+		packages: make(map[*mempool.TxEntry]*txPackage),
+	}
+}
 
-	for _, txEntry := range mpool.GetAllTxEntry() {
-		sk.ReplaceOrInsert(EntryAncestorFeeRateSort(*txEntry))
+func (s *packageSet) lesser(p *txPackage) mapcontainer.Lesser {
+	if s.strategy == sortByFee {
+		return (*PackageFeeSort)(p)
+	}
+	return (*PackageFeeRateSort)(p)
+}
+
+// score returns what the packages are sorted by, but the hash of the tx.
+func (s *packageSet) score(stats mempool.PackageStats) int64 {
+	if s.strategy == sortByFee {
+		return stats.Fee
+	}
+	return util.NewFeeRateWithSize(stats.Fee, stats.Size).SataoshisPerK
+}
+
+// ancestorStats returns the stats of the package of the entry, whose parents
+// not in the block have their package in the set already.
+func (s *packageSet) ancestorStats(entry *mempool.TxEntry, inBlock map[util.Hash]struct{}) mempool.PackageStats {
+	var parents []*mempool.TxEntry
+	for parent := range entry.ParentTx {
+		if _, ok := inBlock[parent.Tx.GetHash()]; !ok {
+			parents = append(parents, parent)
+		}
+	}
+
+	stats := mempool.PackageStats{
+		Count:  1,
+		Size:   int64(entry.TxSize),
+		Fee:    entry.GetModifiedFee(),
+		SigOps: int64(entry.SigOpCount),
+	}
+	switch len(parents) {
+	case 0:
+		return stats
+	case 1:
+		// The ancestors are the parent and its own, as in a chain.
+		parentStats := s.packages[parents[0]].stats
+		stats.Count += parentStats.Count
+		stats.Size += parentStats.Size
+		stats.Fee += parentStats.Fee
+		stats.SigOps += parentStats.SigOps
+		return stats
 	}
 
-	return sk
+	// Several parents may share ancestors, so they are walked.
+	ancestors := make(map[*mempool.TxEntry]struct{})
+	for len(parents) > 0 {
+		ancestor := parents[len(parents)-1]
+		parents = parents[:len(parents)-1]
+		if _, ok := ancestors[ancestor]; ok {
+			continue
+		}
+		ancestors[ancestor] = struct{}{}
+		stats.Count++
+		stats.Size += int64(ancestor.TxSize)
+		stats.Fee += ancestor.GetModifiedFee()
+		stats.SigOps += int64(ancestor.SigOpCount)
+		for parent := range ancestor.ParentTx {
+			if _, ok := inBlock[parent.Tx.GetHash()]; !ok {
+				parents = append(parents, parent)
+			}
+		}
+	}
+	return stats
+}
+
+// update sets the stats of the package of the entry, and queues it unless it
+// was popped already.
+func (s *packageSet) update(entry *mempool.TxEntry, stats mempool.PackageStats) {
+	p, ok := s.packages[entry]
+	if !ok {
+		p = &txPackage{entry: entry, stats: stats, queued: true}
+		s.packages[entry] = p
+		s.txs.ReplaceOrInsert(s.lesser(p))
+		return
+	}
+	if !p.queued || s.score(p.stats) == s.score(stats) {
+		// The package keeps its place in the set.
+		p.stats = stats
+		return
+	}
+	s.txs.Delete(s.lesser(p))
+	p.stats = stats
+	s.txs.ReplaceOrInsert(s.lesser(p))
+}
+
+// remove takes the package of the entry out of the candidates.
+func (s *packageSet) remove(entry *mempool.TxEntry) {
+	if p, ok := s.packages[entry]; ok && p.queued {
+		s.txs.Delete(s.lesser(p))
+		p.queued = false
+	}
+}
+
+// popBest removes and returns the best package of the set.
+func (s *packageSet) popBest() *txPackage {
+	best, _ := s.txs.DeleteMax()
+	var p *txPackage
+	switch item := best.(type) {
+	case *PackageFeeSort:
+		p = (*txPackage)(item)
+	case *PackageFeeRateSort:
+		p = (*txPackage)(item)
+	default:
+		return nil
+	}
+	p.queued = false
+	return p
+}
+
+func (s *packageSet) Len() int {
+	return s.txs.Len()
 }
 
 func getStrategy() *sortType {
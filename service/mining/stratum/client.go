@@ -0,0 +1,380 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// maxRequestSize is the size of a request line at most.
+	maxRequestSize = 16 * 1024
+	// idleTimeout is how long a connection may send nothing.
+	idleTimeout = 10 * time.Minute
+	// writeTimeout is how long a write to a connection may take.
+	writeTimeout = 10 * time.Second
+	// maxFutureTime is how far the time of a share may be in the future.
+	maxFutureTime = 2 * 60 * 60
+
+	// vardiffShares is the number of shares after which vardiff retargets.
+	// It also retargets when a new job comes after as many share intervals.
+	vardiffShares = 10
+	// vardiffMaxChange is the factor by which the difficulty changes at most.
+	vardiffMaxChange = 4
+	// vardiffMinChange is the relative change below which the difficulty
+	// is kept.
+	vardiffMinChange = 0.1
+)
+
+// The error codes of stratum.
+const (
+	errOther         = 20
+	errJobNotFound   = 21
+	errDuplicate     = 22
+	errLowDifficulty = 23
+	errUnauthorized  = 24
+	errNotSubscribed = 25
+)
+
+type request struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+type notification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumError is an error returned to a miner.
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) toJSON() []interface{} {
+	return []interface{}{e.code, e.message, nil}
+}
+
+// client is the connection of a miner.
+type client struct {
+	server *Server
+	conn   net.Conn
+
+	writeLock sync.Mutex
+
+	lock        sync.Mutex
+	extraNonce1 []byte
+	subscribed  bool
+	workers     map[string]struct{}
+	started     bool
+	difficulty  float64
+	// prevDifficulty is also accepted until the next job, as the miner may
+	// still be sending shares found at it.
+	prevDifficulty float64
+	shares         int
+	retargetTime   time.Time
+}
+
+func (s *Server) newClient(conn net.Conn) *client {
+	extraNonce1 := make([]byte, extraNonce1Size)
+	binary.BigEndian.PutUint32(extraNonce1, atomic.AddUint32(&s.nextExtraNonce1, 1))
+	return &client{
+		server:         s,
+		conn:           conn,
+		extraNonce1:    extraNonce1,
+		workers:        make(map[string]struct{}),
+		difficulty:     s.difficulty,
+		prevDifficulty: s.difficulty,
+		retargetTime:   time.Now(),
+	}
+}
+
+// run reads the requests of the miner until the connection closes.
+func (c *client) run() {
+	defer c.conn.Close()
+	log.Debug("stratum: %s connected", c.conn.RemoteAddr())
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 1024), maxRequestSize)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			log.Debug("stratum: %s sent an invalid request: %v", c.conn.RemoteAddr(), err)
+			break
+		}
+		result, stratumErr := c.handleRequest(&req)
+		resp := &response{ID: req.ID, Result: result}
+		if stratumErr != nil {
+			resp.Error = stratumErr.toJSON()
+		}
+		if err := c.send(resp); err != nil {
+			break
+		}
+		c.start()
+	}
+	log.Debug("stratum: %s disconnected", c.conn.RemoteAddr())
+}
+
+func (c *client) send(msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = c.conn.Write(append(b, '\n'))
+	if err != nil {
+		log.Debug("stratum: write to %s failed: %v", c.conn.RemoteAddr(), err)
+		c.conn.Close()
+	}
+	return err
+}
+
+func (c *client) handleRequest(req *request) (interface{}, *stratumError) {
+	switch req.Method {
+	case "mining.subscribe":
+		return c.handleSubscribe()
+	case "mining.authorize":
+		return c.handleAuthorize(req.Params)
+	case "mining.submit":
+		return c.handleSubmit(req.Params)
+	}
+	return nil, &stratumError{errOther, "Unknown method " + req.Method}
+}
+
+func (c *client) handleSubscribe() (interface{}, *stratumError) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.subscribed = true
+	subscriptionID := hex.EncodeToString(c.extraNonce1)
+	return []interface{}{
+		[][]string{
+			{"mining.set_difficulty", subscriptionID},
+			{"mining.notify", subscriptionID},
+		},
+		hex.EncodeToString(c.extraNonce1),
+		extraNonce2Size,
+	}, nil
+}
+
+func (c *client) handleAuthorize(params []json.RawMessage) (interface{}, *stratumError) {
+	var worker, password string
+	if len(params) < 1 || json.Unmarshal(params[0], &worker) != nil || worker == "" {
+		return false, &stratumError{errOther, "Invalid worker"}
+	}
+	if len(params) > 1 {
+		json.Unmarshal(params[1], &password)
+	}
+	if c.server.password != "" && password != c.server.password {
+		return false, &stratumError{errUnauthorized, "Unauthorized worker"}
+	}
+
+	c.lock.Lock()
+	c.workers[worker] = struct{}{}
+	c.lock.Unlock()
+	log.Debug("stratum: %s authorized as %s", c.conn.RemoteAddr(), worker)
+	return true, nil
+}
+
+// start sends the difficulty and the current job once the miner subscribed
+// and authorized a worker.
+func (c *client) start() {
+	c.lock.Lock()
+	ready := c.subscribed && len(c.workers) > 0 && !c.started
+	if ready {
+		c.started = true
+	}
+	difficulty := c.difficulty
+	c.lock.Unlock()
+	if !ready {
+		return
+	}
+
+	c.sendDifficulty(difficulty)
+	if j := c.server.getCurrentJob(); j != nil {
+		c.send(&notification{Method: "mining.notify", Params: j.notifyParams(true)})
+	}
+}
+
+func (c *client) sendDifficulty(difficulty float64) {
+	c.send(&notification{Method: "mining.set_difficulty", Params: []interface{}{difficulty}})
+}
+
+// sendJob hands the job to the miner, after the difficulty vardiff set.
+func (c *client) sendJob(j *job, clean bool) {
+	c.lock.Lock()
+	if !c.started {
+		c.lock.Unlock()
+		return
+	}
+	c.prevDifficulty = c.difficulty
+	changed := c.retarget(time.Now())
+	difficulty := c.difficulty
+	c.lock.Unlock()
+
+	if changed {
+		c.sendDifficulty(difficulty)
+	}
+	c.send(&notification{Method: "mining.notify", Params: j.notifyParams(clean)})
+}
+
+// retarget sets the difficulty aiming at a share every share interval, and
+// tells whether it changed. It waits for vardiffShares shares, or as many
+// share intervals. It must be called with the lock held.
+func (c *client) retarget(now time.Time) bool {
+	elapsed := now.Sub(c.retargetTime)
+	if c.shares < vardiffShares && elapsed < vardiffShares*c.server.shareInterval {
+		return false
+	}
+	next := nextDifficulty(c.difficulty, c.shares, elapsed, c.server.shareInterval,
+		c.server.minDifficulty, c.server.maxDifficulty)
+	c.shares = 0
+	c.retargetTime = now
+	if next > c.difficulty*(1-vardiffMinChange) && next < c.difficulty*(1+vardiffMinChange) {
+		return false
+	}
+	c.prevDifficulty = c.difficulty
+	c.difficulty = next
+	return true
+}
+
+// nextDifficulty returns the difficulty at which shares found in elapsed at
+// difficulty come every interval, changed by vardiffMaxChange at most and
+// kept between min and max.
+func nextDifficulty(difficulty float64, shares int, elapsed, interval time.Duration, min, max float64) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	next := difficulty * float64(shares) * float64(interval) / float64(elapsed)
+	if next < difficulty/vardiffMaxChange {
+		next = difficulty / vardiffMaxChange
+	}
+	if next > difficulty*vardiffMaxChange {
+		next = difficulty * vardiffMaxChange
+	}
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next
+}
+
+// parseHex32 parses a big endian hex encoded uint32 of stratum.
+func parseHex32(s string) (uint32, error) {
+	if len(s) != 8 {
+		return 0, fmt.Errorf("invalid length %d", len(s))
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	return uint32(v), err
+}
+
+func (c *client) handleSubmit(params []json.RawMessage) (interface{}, *stratumError) {
+	var args [5]string
+	if len(params) < len(args) {
+		return false, &stratumError{errOther, "Invalid params"}
+	}
+	for i := range args {
+		if err := json.Unmarshal(params[i], &args[i]); err != nil {
+			return false, &stratumError{errOther, "Invalid params"}
+		}
+	}
+	worker, jobID := args[0], args[1]
+
+	c.lock.Lock()
+	subscribed := c.subscribed
+	_, authorized := c.workers[worker]
+	extraNonce1 := c.extraNonce1
+	c.lock.Unlock()
+	if !subscribed {
+		return false, &stratumError{errNotSubscribed, "Not subscribed"}
+	}
+	if !authorized {
+		return false, &stratumError{errUnauthorized, "Unauthorized worker"}
+	}
+
+	j := c.server.getJob(jobID)
+	if j == nil {
+		return false, &stratumError{errJobNotFound, "Job not found"}
+	}
+	extraNonce2, err := hex.DecodeString(args[2])
+	if err != nil || len(extraNonce2) != extraNonce2Size {
+		return false, &stratumError{errOther, "Invalid extranonce2"}
+	}
+	nTime, err := parseHex32(args[3])
+	if err != nil {
+		return false, &stratumError{errOther, "Invalid ntime"}
+	}
+	if int64(nTime) < j.minTime || int64(nTime) > util.GetAdjustedTimeSec()+maxFutureTime {
+		return false, &stratumError{errOther, "Ntime out of range"}
+	}
+	nonce, err := parseHex32(args[4])
+	if err != nil {
+		return false, &stratumError{errOther, "Invalid nonce"}
+	}
+
+	coinbase, err := j.coinbase(extraNonce1, extraNonce2)
+	if err != nil {
+		return false, &stratumError{errOther, "Invalid coinbase"}
+	}
+	header := j.header(coinbase, nTime, nonce)
+	hash := header.GetHash()
+
+	c.lock.Lock()
+	difficulty := c.difficulty
+	if c.prevDifficulty < difficulty {
+		difficulty = c.prevDifficulty
+	}
+	c.lock.Unlock()
+	if !meetsTarget(&hash, shareTarget(difficulty)) {
+		return false, &stratumError{errLowDifficulty, "Low difficulty share"}
+	}
+	key := hex.EncodeToString(extraNonce1) + args[2] + args[3] + args[4]
+	if !c.server.addShare(j, key) {
+		return false, &stratumError{errDuplicate, "Duplicate share"}
+	}
+
+	if meetsTarget(&hash, j.target) {
+		bk := j.block(coinbase, header)
+		if err := c.server.submitBlock(bk); err != nil {
+			log.Error("stratum: block %s found by %s rejected: %v", hash.String(), worker, err)
+		} else {
+			log.Info("stratum: block %s found by %s", hash.String(), worker)
+		}
+	}
+
+	c.lock.Lock()
+	c.shares++
+	changed := c.retarget(time.Now())
+	difficulty = c.difficulty
+	c.lock.Unlock()
+	if changed {
+		c.sendDifficulty(difficulty)
+	}
+	return true, nil
+}
@@ -0,0 +1,155 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/pow"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/service/mining"
+	"github.com/copernet/copernicus/util"
+)
+
+const (
+	// extraNonce1Size is the size of the part of the extra nonce set by the
+	// server, unique to each connection.
+	extraNonce1Size = 4
+	// extraNonce2Size is the size of the part of the extra nonce rolled by
+	// the miner.
+	extraNonce2Size = 4
+	extraNonceSize  = extraNonce1Size + extraNonce2Size
+)
+
+// diff1Target is the target of the shares of difficulty 1.
+var diff1Target = pow.CompactToBig(0x1d00ffff)
+
+// job is a block template handed to the miners. The coinbase is split around
+// the extra nonce, so the miners build their own coinbase and only need the
+// merkle branch of the coinbase to get the merkle root.
+type job struct {
+	id        string
+	template  *block.Block
+	coinbase1 []byte
+	coinbase2 []byte
+	branch    []util.Hash
+	minTime   int64
+	target    *big.Int
+	// shares are the shares submitted for the job, to refuse duplicates.
+	shares map[string]struct{}
+}
+
+// newJob builds the job of the block template, whose coinbase scriptSig holds
+// the extra nonce at extraNonceOffset.
+func newJob(id string, bt *mining.BlockTemplate, minTime int64, extraNonceOffset int) (*job, error) {
+	coinbase := bt.Block.Txs[0]
+	scriptSig := coinbase.GetIns()[0].GetScriptSig().GetData()
+	if extraNonceOffset+extraNonceSize > len(scriptSig) {
+		return nil, errors.New("the coinbase scriptSig has no room for the extra nonce")
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := coinbase.Serialize(buf); err != nil {
+		return nil, err
+	}
+	raw := buf.Bytes()
+	// The scriptSig of the only input follows the version, the input count
+	// and the null outpoint.
+	offset := 4 + 1 + util.Hash256Size + 4 + int(util.VarIntSerializeSize(uint64(len(scriptSig)))) +
+		extraNonceOffset
+
+	return &job{
+		id:        id,
+		template:  bt.Block,
+		coinbase1: raw[:offset],
+		coinbase2: raw[offset+extraNonceSize:],
+		branch:    lmerkleroot.BlockMerkleBranch(bt.Block.Txs, 0),
+		minTime:   minTime,
+		target:    pow.CompactToBig(bt.Block.Header.Bits),
+		shares:    make(map[string]struct{}),
+	}, nil
+}
+
+// notifyParams returns the params of the mining.notify of the job.
+func (j *job) notifyParams(clean bool) []interface{} {
+	branch := make([]string, 0, len(j.branch))
+	for _, hash := range j.branch {
+		branch = append(branch, hex.EncodeToString(hash[:]))
+	}
+	header := j.template.Header
+	return []interface{}{
+		j.id,
+		hex.EncodeToString(swapWords(header.HashPrevBlock[:])),
+		hex.EncodeToString(j.coinbase1),
+		hex.EncodeToString(j.coinbase2),
+		branch,
+		fmt.Sprintf("%08x", uint32(header.Version)),
+		fmt.Sprintf("%08x", header.Bits),
+		fmt.Sprintf("%08x", header.Time),
+		clean,
+	}
+}
+
+// swapWords reverses the bytes of each 4 byte word, as stratum sends the
+// previous block hash.
+func swapWords(b []byte) []byte {
+	swapped := make([]byte, len(b))
+	for i := 0; i+4 <= len(b); i += 4 {
+		binary.BigEndian.PutUint32(swapped[i:], binary.LittleEndian.Uint32(b[i:]))
+	}
+	return swapped
+}
+
+// coinbase returns the coinbase of the job with the extra nonce.
+func (j *job) coinbase(extraNonce1, extraNonce2 []byte) (*tx.Tx, error) {
+	raw := make([]byte, 0, len(j.coinbase1)+extraNonceSize+len(j.coinbase2))
+	raw = append(raw, j.coinbase1...)
+	raw = append(raw, extraNonce1...)
+	raw = append(raw, extraNonce2...)
+	raw = append(raw, j.coinbase2...)
+
+	coinbase := tx.NewEmptyTx()
+	if err := coinbase.Unserialize(bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	return coinbase, nil
+}
+
+// header returns the header of the block the miner worked on.
+func (j *job) header(coinbase *tx.Tx, time, nonce uint32) *block.BlockHeader {
+	coinbaseHash := coinbase.GetHash()
+	return &block.BlockHeader{
+		Version:       j.template.Header.Version,
+		HashPrevBlock: j.template.Header.HashPrevBlock,
+		MerkleRoot:    lmerkleroot.ComputeMerkleRootFromBranch(&coinbaseHash, j.branch, 0),
+		Time:          time,
+		Bits:          j.template.Header.Bits,
+		Nonce:         nonce,
+	}
+}
+
+// block returns the block of the job with the coinbase and header of a share.
+func (j *job) block(coinbase *tx.Tx, header *block.BlockHeader) *block.Block {
+	bk := block.NewBlock()
+	bk.Header = *header
+	bk.Txs = make([]*tx.Tx, 0, len(j.template.Txs))
+	bk.Txs = append(bk.Txs, coinbase)
+	bk.Txs = append(bk.Txs, j.template.Txs[1:]...)
+	return bk
+}
+
+// shareTarget returns the target of the shares of the difficulty.
+func shareTarget(difficulty float64) *big.Int {
+	target, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target), big.NewFloat(difficulty)).Int(nil)
+	return target
+}
+
+// meetsTarget tells whether the hash is at or below the target.
+func meetsTarget(hash *util.Hash, target *big.Int) bool {
+	return pow.HashToBig(hash).Cmp(target) <= 0
+}
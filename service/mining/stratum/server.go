@@ -0,0 +1,313 @@
+// Package stratum serves block templates of the mining package to miners
+// speaking stratum v1, and submits the blocks they find.
+package stratum
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/log"
+	"github.com/copernet/copernicus/logic/lchain"
+	"github.com/copernet/copernicus/model"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/chain"
+	"github.com/copernet/copernicus/model/mempool"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/net/server"
+	"github.com/copernet/copernicus/persist"
+	"github.com/copernet/copernicus/service/mining"
+	"github.com/copernet/copernicus/util/cashaddr"
+)
+
+// mempoolEventsBuffered is the number of mempool events buffered for the
+// server, which only needs to know that the mempool changed.
+const mempoolEventsBuffered = 16
+
+// Server is a stratum v1 server. It hands a new job to the miners when the
+// chain tip changes, and at most every job interval when the mempool changes.
+type Server struct {
+	listenAddr    string
+	payScript     *script.Script
+	password      string
+	difficulty    float64
+	minDifficulty float64
+	maxDifficulty float64
+	shareInterval time.Duration
+	jobInterval   time.Duration
+
+	// submitBlock submits the blocks found, as submitblock does.
+	submitBlock func(*block.Block) error
+
+	listener   net.Listener
+	tipChanged chan struct{}
+	quit       chan struct{}
+	wg         sync.WaitGroup
+
+	lock       sync.Mutex
+	jobs       map[string]*job
+	currentJob *job
+	clients    map[*client]struct{}
+
+	nextJobID       uint64
+	nextExtraNonce1 uint32
+}
+
+// NewServer returns the stratum server described by the config.
+func NewServer(cfg *conf.Configuration) (*Server, error) {
+	payScript, err := payToAddress(cfg.Stratum.PayAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stratum pay address %q: %v", cfg.Stratum.PayAddress, err)
+	}
+	if cfg.Stratum.Difficulty <= 0 || cfg.Stratum.MinDifficulty <= 0 ||
+		cfg.Stratum.MinDifficulty > cfg.Stratum.MaxDifficulty {
+		return nil, errors.New("invalid stratum difficulties")
+	}
+	if cfg.Stratum.ShareInterval <= 0 || cfg.Stratum.JobInterval <= 0 {
+		return nil, errors.New("invalid stratum intervals")
+	}
+	return newServer(cfg, payScript), nil
+}
+
+func newServer(cfg *conf.Configuration, payScript *script.Script) *Server {
+	return &Server{
+		listenAddr:    cfg.Stratum.Listen,
+		payScript:     payScript,
+		password:      cfg.Stratum.Password,
+		difficulty:    cfg.Stratum.Difficulty,
+		minDifficulty: cfg.Stratum.MinDifficulty,
+		maxDifficulty: cfg.Stratum.MaxDifficulty,
+		shareInterval: time.Duration(cfg.Stratum.ShareInterval) * time.Second,
+		jobInterval:   time.Duration(cfg.Stratum.JobInterval) * time.Second,
+		submitBlock: func(bk *block.Block) error {
+			_, err := server.ProcessForRPC(bk)
+			return err
+		},
+		tipChanged: make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+		jobs:       make(map[string]*job),
+		clients:    make(map[*client]struct{}),
+	}
+}
+
+// payToAddress returns the scriptPubKey paying to a legacy or cash address.
+func payToAddress(address string) (*script.Script, error) {
+	var addrType cashaddr.AddressType
+	var hash []byte
+	if legacyAddr, err := script.AddressFromString(address); err == nil {
+		switch legacyAddr.GetVersion() {
+		case script.AddressVerPubKey():
+			addrType = cashaddr.P2PKH
+		case script.AddressVerScript():
+			addrType = cashaddr.P2SH
+		}
+		hash = legacyAddr.EncodeToPubKeyHash()
+	} else if hash, _, addrType, err = cashaddr.CheckDecodeCashAddress(address); err != nil {
+		return nil, err
+	}
+
+	scriptPubKey := script.NewEmptyScript()
+	switch addrType {
+	case cashaddr.P2PKH:
+		scriptPubKey.PushOpCode(opcodes.OP_DUP)
+		scriptPubKey.PushOpCode(opcodes.OP_HASH160)
+		scriptPubKey.PushSingleData(hash)
+		scriptPubKey.PushOpCode(opcodes.OP_EQUALVERIFY)
+		scriptPubKey.PushOpCode(opcodes.OP_CHECKSIG)
+	case cashaddr.P2SH:
+		scriptPubKey.PushOpCode(opcodes.OP_HASH160)
+		scriptPubKey.PushSingleData(hash)
+		scriptPubKey.PushOpCode(opcodes.OP_EQUAL)
+	default:
+		return nil, errors.New("unsupported address type")
+	}
+	return scriptPubKey, nil
+}
+
+// Start listens for the miners and follows the chain and the mempool.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	log.Info("Stratum server listening on %s", listener.Addr())
+
+	chain.GetInstance().Subscribe(s.handleBlockChainNotification)
+	sub := mempool.GetInstance().Subscribe(mempoolEventsBuffered)
+
+	s.wg.Add(2)
+	go s.acceptClients()
+	go s.updateJobs(sub)
+	return nil
+}
+
+// Stop closes the listener and the connections of the miners.
+func (s *Server) Stop() {
+	close(s.quit)
+	s.listener.Close()
+
+	s.lock.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) handleBlockChainNotification(notification *chain.Notification) {
+	if notification.Type != chain.NTChainTipUpdated {
+		return
+	}
+	select {
+	case s.tipChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) acceptClients() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			log.Error("stratum: accept failed: %v", err)
+			continue
+		}
+		c := s.newClient(conn)
+		s.lock.Lock()
+		s.clients[c] = struct{}{}
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.run()
+			s.lock.Lock()
+			delete(s.clients, c)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+// updateJobs makes a clean job on each new chain tip, and a job taking the
+// new mempool transactions at most every job interval.
+func (s *Server) updateJobs(sub *mempool.Subscription) {
+	defer s.wg.Done()
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(s.jobInterval)
+	defer ticker.Stop()
+
+	s.makeJob(true)
+	mempoolChanged := false
+	for {
+		select {
+		case <-s.tipChanged:
+			s.makeJob(true)
+			mempoolChanged = false
+		case <-sub.Events():
+			mempoolChanged = true
+		case <-ticker.C:
+			if mempoolChanged {
+				s.makeJob(false)
+				mempoolChanged = false
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// coinbaseScriptSig returns the scriptSig of CoinbaseScriptSig with room for
+// the extra nonce, and the offset of the extra nonce in it.
+func coinbaseScriptSig() (*script.Script, int) {
+	scriptSig := mining.CoinbaseScriptSig(0)
+	// The extra nonce follows its push opcode.
+	offset := len(scriptSig.GetData()) + 1
+	scriptSig.PushSingleData(make([]byte, extraNonceSize))
+	return scriptSig, offset
+}
+
+// makeJob makes a job of a new block template and hands it to the miners.
+// A clean job replaces the previous ones, the shares of which are refused.
+func (s *Server) makeJob(clean bool) {
+	if lchain.IsInitialBlockDownload() {
+		log.Debug("stratum: no job during the initial block download")
+		return
+	}
+
+	persist.CsMain.Lock()
+	indexPrev := chain.GetInstance().Tip()
+	scriptSig, extraNonceOffset := coinbaseScriptSig()
+	ba := mining.NewBlockAssembler(model.ActiveNetParams)
+	bt := ba.CreateNewBlock(s.payScript, scriptSig)
+	persist.CsMain.Unlock()
+	if bt == nil {
+		log.Error("stratum: failed to create a block template")
+		return
+	}
+
+	id := fmt.Sprintf("%x", atomic.AddUint64(&s.nextJobID, 1))
+	j, err := newJob(id, bt, indexPrev.GetMedianTimePast()+1, extraNonceOffset)
+	if err != nil {
+		log.Error("stratum: failed to make job: %v", err)
+		return
+	}
+	s.addJob(j, clean)
+}
+
+// addJob makes the job the current one and hands it to the miners.
+func (s *Server) addJob(j *job, clean bool) {
+	s.lock.Lock()
+	if clean || s.currentJob == nil ||
+		s.currentJob.template.Header.HashPrevBlock != j.template.Header.HashPrevBlock {
+		clean = true
+		s.jobs = make(map[string]*job)
+	}
+	s.jobs[j.id] = j
+	s.currentJob = j
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.lock.Unlock()
+
+	log.Debug("stratum: job %s on %s with %d txs", j.id,
+		j.template.Header.HashPrevBlock.String(), len(j.template.Txs))
+	for _, c := range clients {
+		c.sendJob(j, clean)
+	}
+}
+
+func (s *Server) getJob(id string) *job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.jobs[id]
+}
+
+func (s *Server) getCurrentJob() *job {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.currentJob
+}
+
+// addShare records the share of the job, and tells whether it is new.
+func (s *Server) addShare(j *job, key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := j.shares[key]; ok {
+		return false
+	}
+	j.shares[key] = struct{}{}
+	return true
+}
@@ -0,0 +1,258 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/copernet/copernicus/conf"
+	"github.com/copernet/copernicus/logic/lmerkleroot"
+	"github.com/copernet/copernicus/model/block"
+	"github.com/copernet/copernicus/model/opcodes"
+	"github.com/copernet/copernicus/model/outpoint"
+	"github.com/copernet/copernicus/model/script"
+	"github.com/copernet/copernicus/model/tx"
+	"github.com/copernet/copernicus/model/txin"
+	"github.com/copernet/copernicus/model/txout"
+	"github.com/copernet/copernicus/service/mining"
+	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/amount"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPayScript() *script.Script {
+	payScript := script.NewEmptyScript()
+	payScript.PushOpCode(opcodes.OP_TRUE)
+	return payScript
+}
+
+// newTestCoinbase returns a coinbase with the extra nonce in its scriptSig,
+// and the offset of the extra nonce.
+func newTestCoinbase(extraNonce []byte) (*tx.Tx, int) {
+	scriptSig := script.NewEmptyScript()
+	scriptSig.PushScriptNum(script.NewScriptNum(101))
+	offset := len(scriptSig.GetData()) + 1
+	scriptSig.PushSingleData(extraNonce)
+	scriptSig.PushData([]byte("/copernicus/"))
+
+	coinbase := tx.NewTx(0, tx.DefaultVersion)
+	coinbase.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashZero, 0xffffffff), scriptSig, 0xffffffff))
+	coinbase.AddTxOut(txout.NewTxOut(amount.Amount(50*util.COIN), testPayScript()))
+	return coinbase, offset
+}
+
+func newTestJob(t *testing.T, id string) *job {
+	coinbase, offset := newTestCoinbase(make([]byte, extraNonceSize))
+	bt := &mining.BlockTemplate{Block: block.NewBlock()}
+	bt.Block.Txs = []*tx.Tx{coinbase}
+	for i := uint32(0); i < 2; i++ {
+		txn := tx.NewTx(0, tx.DefaultVersion)
+		txn.AddTxIn(txin.NewTxIn(outpoint.NewOutPoint(util.HashOne, i), script.NewEmptyScript(), 0xffffffff))
+		txn.AddTxOut(txout.NewTxOut(1000, testPayScript()))
+		bt.Block.Txs = append(bt.Block.Txs, txn)
+	}
+	bt.Block.Header.Version = 0x20000000
+	bt.Block.Header.HashPrevBlock = util.HashOne
+	bt.Block.Header.Bits = 0x207fffff
+	bt.Block.Header.Time = uint32(time.Now().Unix())
+
+	j, err := newJob(id, bt, time.Now().Unix()-600, offset)
+	assert.Nil(t, err)
+	return j
+}
+
+// mine returns a nonce of a block of the job.
+func mine(j *job, extraNonce1, extraNonce2 []byte, nTime uint32) (uint32, *block.BlockHeader) {
+	coinbase, _ := j.coinbase(extraNonce1, extraNonce2)
+	for nonce := uint32(0); ; nonce++ {
+		header := j.header(coinbase, nTime, nonce)
+		hash := header.GetHash()
+		if meetsTarget(&hash, j.target) {
+			return nonce, header
+		}
+	}
+}
+
+func TestSwapWords(t *testing.T) {
+	b := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	assert.Equal(t, []byte{3, 2, 1, 0, 7, 6, 5, 4}, swapWords(b))
+}
+
+func TestJob(t *testing.T) {
+	j := newTestJob(t, "1")
+	extraNonce1 := []byte{1, 2, 3, 4}
+	extraNonce2 := []byte{5, 6, 7, 8}
+
+	coinbase, err := j.coinbase(extraNonce1, extraNonce2)
+	assert.Nil(t, err)
+	expected, _ := newTestCoinbase(append(append([]byte{}, extraNonce1...), extraNonce2...))
+	assert.Equal(t, expected.GetHash(), coinbase.GetHash())
+
+	// The merkle root of the branch is the one of the block with the
+	// coinbase of the miner.
+	header := j.header(coinbase, 1, 2)
+	bk := j.block(coinbase, header)
+	assert.Equal(t, lmerkleroot.BlockMerkleRoot(bk.Txs, nil), header.MerkleRoot)
+	assert.Equal(t, len(j.template.Txs), len(bk.Txs))
+	assert.Equal(t, j.template.Txs[2].GetHash(), bk.Txs[2].GetHash())
+
+	params := j.notifyParams(true)
+	assert.Equal(t, "1", params[0])
+	assert.Equal(t, hex.EncodeToString(swapWords(util.HashOne[:])), params[1])
+	assert.Equal(t, hex.EncodeToString(j.coinbase1), params[2])
+	assert.Equal(t, 2, len(params[4].([]string)))
+	assert.Equal(t, "20000000", params[5])
+	assert.Equal(t, "207fffff", params[6])
+	assert.Equal(t, true, params[8])
+}
+
+func TestNextDifficulty(t *testing.T) {
+	interval := 10 * time.Second
+	tests := []struct {
+		difficulty float64
+		shares     int
+		elapsed    time.Duration
+		expected   float64
+	}{
+		{8, 10, 100 * time.Second, 8},
+		{8, 10, 50 * time.Second, 16},
+		{2, 10, 10 * time.Second, 8},
+		{8, 10, 200 * time.Second, 4},
+		{8, 0, 100 * time.Second, 2},
+		{1, 10, time.Second, 4},
+		{0.5, 1, 100 * time.Second, 0.25},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, nextDifficulty(test.difficulty, test.shares, test.elapsed, interval, 0.25, 16),
+			fmt.Sprintf("%v", test))
+	}
+}
+
+func TestPayToAddress(t *testing.T) {
+	_, err := payToAddress("not an address")
+	assert.NotNil(t, err)
+}
+
+type testMiner struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+func (m *testMiner) call(method string, params ...interface{}) map[string]interface{} {
+	m.nextID++
+	b, _ := json.Marshal(&request{ID: m.nextID, Method: method, Params: rawParams(params)})
+	_, err := m.conn.Write(append(b, '\n'))
+	assert.Nil(m.t, err)
+	return m.read()
+}
+
+func (m *testMiner) read() map[string]interface{} {
+	line, err := m.reader.ReadBytes('\n')
+	assert.Nil(m.t, err)
+	var msg map[string]interface{}
+	assert.Nil(m.t, json.Unmarshal(line, &msg))
+	return msg
+}
+
+func rawParams(params []interface{}) []json.RawMessage {
+	raw := make([]json.RawMessage, 0, len(params))
+	for _, param := range params {
+		b, _ := json.Marshal(param)
+		raw = append(raw, b)
+	}
+	return raw
+}
+
+func errorCode(msg map[string]interface{}) int {
+	stratumErr, ok := msg["error"].([]interface{})
+	if !ok {
+		return 0
+	}
+	return int(stratumErr[0].(float64))
+}
+
+func TestClientSession(t *testing.T) {
+	cfg := &conf.Configuration{}
+	cfg.Stratum.Password = "secret"
+	// Shares of the lowest difficulty meet the target of the test blocks.
+	cfg.Stratum.Difficulty = 1e-10
+	cfg.Stratum.MinDifficulty = 1e-10
+	cfg.Stratum.MaxDifficulty = 1
+	cfg.Stratum.ShareInterval = 10
+	cfg.Stratum.JobInterval = 30
+	s := newServer(cfg, testPayScript())
+	var submitted []*block.Block
+	s.submitBlock = func(bk *block.Block) error {
+		submitted = append(submitted, bk)
+		return nil
+	}
+	j := newTestJob(t, "1")
+	s.addJob(j, true)
+
+	serverConn, minerConn := net.Pipe()
+	defer minerConn.Close()
+	c := s.newClient(serverConn)
+	s.clients[c] = struct{}{}
+	go c.run()
+	m := &testMiner{t: t, conn: minerConn, reader: bufio.NewReader(minerConn)}
+
+	nTime := fmt.Sprintf("%08x", j.template.Header.Time)
+	assert.Equal(t, errNotSubscribed, errorCode(m.call("mining.submit", "w", "1", "00000000", nTime, "00000000")))
+
+	result := m.call("mining.subscribe", "test/1.0")["result"].([]interface{})
+	extraNonce1, err := hex.DecodeString(result[1].(string))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(extraNonce2Size), result[2])
+
+	assert.Equal(t, errUnauthorized, errorCode(m.call("mining.authorize", "w", "wrong")))
+	assert.Equal(t, true, m.call("mining.authorize", "w", "secret")["result"])
+	msg := m.read()
+	assert.Equal(t, "mining.set_difficulty", msg["method"])
+	msg = m.read()
+	assert.Equal(t, "mining.notify", msg["method"])
+	assert.Equal(t, "1", msg["params"].([]interface{})[0])
+
+	extraNonce2 := []byte{0, 0, 0, 1}
+	nonce, header := mine(j, extraNonce1, extraNonce2, j.template.Header.Time)
+	nonceHex := make([]byte, 4)
+	binary.BigEndian.PutUint32(nonceHex, nonce)
+	share := []interface{}{"w", "1", hex.EncodeToString(extraNonce2), nTime, hex.EncodeToString(nonceHex)}
+
+	assert.Equal(t, true, m.call("mining.submit", share...)["result"])
+	if assert.Equal(t, 1, len(submitted)) {
+		assert.Equal(t, header.GetHash(), submitted[0].GetHash())
+		assert.Equal(t, lmerkleroot.BlockMerkleRoot(submitted[0].Txs, nil), submitted[0].Header.MerkleRoot)
+	}
+	assert.Equal(t, errDuplicate, errorCode(m.call("mining.submit", share...)))
+
+	share[1] = "2"
+	assert.Equal(t, errJobNotFound, errorCode(m.call("mining.submit", share...)))
+	share[1] = "1"
+	share[3] = "00000001"
+	assert.Equal(t, errOther, errorCode(m.call("mining.submit", share...)))
+
+	c.lock.Lock()
+	c.difficulty, c.prevDifficulty = 1e30, 1e30
+	c.lock.Unlock()
+	share[2], share[3] = "00000002", nTime
+	assert.Equal(t, errLowDifficulty, errorCode(m.call("mining.submit", share...)))
+
+	// A new job comes with the difficulty set by vardiff.
+	c.lock.Lock()
+	c.difficulty, c.prevDifficulty = 1e-10, 1e-10
+	c.shares = vardiffShares
+	c.lock.Unlock()
+	go s.addJob(newTestJob(t, "2"), false)
+	msg = m.read()
+	assert.Equal(t, "mining.set_difficulty", msg["method"])
+	msg = m.read()
+	assert.Equal(t, "mining.notify", msg["method"])
+	assert.Equal(t, "2", msg["params"].([]interface{})[0])
+}
@@ -8,15 +8,16 @@ import (
 	"github.com/copernet/copernicus/model/mempool"
 	"github.com/copernet/copernicus/model/tx"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 )
 
-func HandleRejectedTx(txn *tx.Tx, err error, nodeID int64, recentRejects map[util.Hash]struct{}) (missTxs []util.Hash, rejectTxs []util.Hash) {
+func HandleRejectedTx(txn *tx.Tx, err error, nodeID int64, recentRejects *bloom.RollingFilter) (missTxs []util.Hash, rejectTxs []util.Hash) {
 	missingInputs := errcode.IsErrorCode(err, errcode.TxErrNoPreviousOut)
-	isNormalOrphan := missingInputs && !txn.AnyInputTxIn(recentRejects)
+	isNormalOrphan := missingInputs && !anyInputRejected(txn, recentRejects)
 
 	if isNormalOrphan {
 		mempool.GetInstance().AddOrphanTx(txn, nodeID)
-		missTxs = txn.PrevoutHashs()
+		missTxs = lmempool.MissingParents(txn)
 		return
 	}
 
@@ -24,7 +25,18 @@ func HandleRejectedTx(txn *tx.Tx, err error, nodeID int64, recentRejects map[uti
 	return
 }
 
-func ProcessTransaction(txn *tx.Tx, recentRejects map[util.Hash]struct{}, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
+// anyInputRejected reports whether the transaction spends a recently rejected
+// transaction.
+func anyInputRejected(txn *tx.Tx, recentRejects *bloom.RollingFilter) bool {
+	for _, e := range txn.GetIns() {
+		if recentRejects.ContainsHash(&e.PreviousOutPoint.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+func ProcessTransaction(txn *tx.Tx, recentRejects *bloom.RollingFilter, nodeID int64) ([]*tx.Tx, []util.Hash, []util.Hash, error) {
 	err := lmempool.AcceptTxToMemPool(txn)
 	if err == nil {
 		lmempool.CheckMempool(chain.GetInstance().Height())
@@ -39,6 +51,34 @@ func ProcessTransaction(txn *tx.Tx, recentRejects map[util.Hash]struct{}, nodeID
 		return acceptedTxs, nil, rejectTxs, nil
 	}
 
+	if packageTxs := acceptLowFeePackage(txn, err); len(packageTxs) > 0 {
+		lmempool.CheckMempool(chain.GetInstance().Height())
+		acceptedTxs := packageTxs
+		var rejectTxs []util.Hash
+		for _, packageTx := range packageTxs {
+			acceptedOrphans, rejects := lmempool.TryAcceptOrphansTxs(packageTx, chain.GetInstance().Height(), true)
+			acceptedTxs = append(acceptedTxs, acceptedOrphans...)
+			rejectTxs = append(rejectTxs, rejects...)
+		}
+		return acceptedTxs, nil, rejectTxs, nil
+	}
+
 	missTxs, rejectTxs := HandleRejectedTx(txn, err, nodeID, recentRejects)
 	return nil, missTxs, rejectTxs, err
 }
+
+// acceptLowFeePackage reconsiders a transaction refused by the mempool as a
+// package with its parent or child, whichever arrived first: a parent paying
+// less than the mempool min fee is kept until a child paying for it arrives,
+// or accepted with an orphan child which already did.
+func acceptLowFeePackage(txn *tx.Tx, err error) []*tx.Tx {
+	if errcode.IsErrorCode(err, errcode.TxErrNoPreviousOut) {
+		return lmempool.AcceptWithLowFeeParent(txn)
+	}
+
+	if code, _, ok := errcode.IsRejectCode(err); ok && code == errcode.RejectInsufficientFee {
+		lmempool.AddLowFeeTx(txn)
+		return lmempool.AcceptWithOrphanChild(txn)
+	}
+	return nil
+}
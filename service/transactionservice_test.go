@@ -18,6 +18,7 @@ import (
 	"github.com/copernet/copernicus/persist/disk"
 	"github.com/copernet/copernicus/service/mining"
 	"github.com/copernet/copernicus/util"
+	"github.com/copernet/copernicus/util/bloom"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"math"
@@ -89,7 +90,7 @@ func TestProcessTransaction(t *testing.T) {
 	txs := block1260985.Txs
 
 	nodeID := int64(0)
-	recentRejects := make(map[util.Hash]struct{})
+	recentRejects := bloom.NewRollingFilter(100, 0.000001)
 	acceptedTxs, missTxHash, rejectTxHash, err := ProcessTransaction(txs[1], recentRejects, nodeID)
 	assert.NotNil(t, err)
 	assert.Empty(t, missTxHash)
@@ -141,7 +142,7 @@ func TestProcessTransactionNormal(t *testing.T) {
 	transaction.AddTxOut(txOut)
 
 	nodeID := int64(0)
-	recentRejects := make(map[util.Hash]struct{})
+	recentRejects := bloom.NewRollingFilter(100, 0.000001)
 	acceptedTxs, missTxHash, rejectTxHash, err := ProcessTransaction(transaction, recentRejects, nodeID)
 	assert.Nil(t, err)
 	assert.Equal(t, transaction, acceptedTxs[0])
@@ -0,0 +1,140 @@
+package bloom
+
+import (
+	"math"
+	"sync"
+
+	"github.com/copernet/copernicus/util"
+)
+
+// RollingFilter is a bloom filter which keeps the last elements added: it
+// holds between elements and 1.5 * elements of them, forgetting the oldest
+// third at once.  The entries are tagged in two bits with one of three
+// generations; starting a new generation clears the entries of the one it
+// replaces.
+//
+// This is the rolling bloom filter of bitcoind.  It is safe for concurrent
+// access.
+type RollingFilter struct {
+	mtx                   sync.Mutex
+	entriesPerGeneration  int
+	entriesThisGeneration int
+	generation            uint32
+	hashFuncs             uint32
+	tweak                 uint32
+	data                  []uint64
+}
+
+// NewRollingFilter creates a rolling filter remembering at least the last
+// elements added, with a false positive rate of fprate.
+func NewRollingFilter(elements int, fprate float64) *RollingFilter {
+	if fprate > 1.0 {
+		fprate = 1.0
+	}
+	if fprate < 1e-9 {
+		fprate = 1e-9
+	}
+	logFpRate := math.Log(fprate)
+
+	// The filter holds three generations of half the elements each.
+	entriesPerGeneration := (elements + 1) / 2
+	maxElements := float64(entriesPerGeneration * 3)
+
+	// The number of hash functions minimizing the false positive rate,
+	// then the number of bits giving the rate with as many hash functions.
+	hashFuncs := math.Max(1, math.Min(math.Round(logFpRate/math.Log(0.5)), 50))
+	filterBits := math.Ceil(-1.0 * hashFuncs * maxElements / math.Log(1.0-math.Exp(logFpRate/hashFuncs)))
+
+	rf := &RollingFilter{
+		entriesPerGeneration: entriesPerGeneration,
+		hashFuncs:            uint32(hashFuncs),
+		// Each pair of words holds the two bits of the generations of
+		// 64 entries.
+		data: make([]uint64, ((uint64(filterBits)+63)/64)<<1),
+	}
+	rf.reset()
+	return rf
+}
+
+// Reset forgets all the elements added.
+func (rf *RollingFilter) Reset() {
+	rf.mtx.Lock()
+	rf.reset()
+	rf.mtx.Unlock()
+}
+
+func (rf *RollingFilter) reset() {
+	rf.tweak = uint32(util.GetRand(math.MaxUint32))
+	rf.entriesThisGeneration = 0
+	rf.generation = 1
+	for i := range rf.data {
+		rf.data[i] = 0
+	}
+}
+
+// position returns the index of the pair of words and the bit in the words
+// for the passed data and hash function.
+func (rf *RollingFilter) position(hashNum uint32, data []byte) (int, uint) {
+	h := MurmurHash3(hashNum*0xfba4c795+rf.tweak, data)
+	pos := int((uint64(h) * uint64(len(rf.data))) >> 32)
+	return pos &^ 1, uint(h & 63)
+}
+
+// Add adds the passed data, starting a new generation first if the current one
+// is full.
+func (rf *RollingFilter) Add(data []byte) {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+
+	if rf.entriesThisGeneration == rf.entriesPerGeneration {
+		rf.entriesThisGeneration = 0
+		rf.generation++
+		if rf.generation == 4 {
+			rf.generation = 1
+		}
+		// Clear the entries of the generation being replaced.
+		mask1 := -uint64(rf.generation & 1)
+		mask2 := -uint64(rf.generation >> 1)
+		for p := 0; p < len(rf.data); p += 2 {
+			p1, p2 := rf.data[p], rf.data[p+1]
+			mask := (p1 ^ mask1) | (p2 ^ mask2)
+			rf.data[p] = p1 & mask
+			rf.data[p+1] = p2 & mask
+		}
+	}
+	rf.entriesThisGeneration++
+
+	for n := uint32(0); n < rf.hashFuncs; n++ {
+		pos, bit := rf.position(n, data)
+		rf.data[pos] &^= 1 << bit
+		rf.data[pos] |= uint64(rf.generation&1) << bit
+		rf.data[pos+1] &^= 1 << bit
+		rf.data[pos+1] |= uint64(rf.generation>>1) << bit
+	}
+}
+
+// AddHash adds the passed hash.
+func (rf *RollingFilter) AddHash(hash *util.Hash) {
+	rf.Add(hash[:])
+}
+
+// Contains returns true if the passed data might have been added recently and
+// false if it definitely was not.
+func (rf *RollingFilter) Contains(data []byte) bool {
+	rf.mtx.Lock()
+	defer rf.mtx.Unlock()
+
+	for n := uint32(0); n < rf.hashFuncs; n++ {
+		pos, bit := rf.position(n, data)
+		if (rf.data[pos]|rf.data[pos+1])>>bit&1 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsHash returns true if the passed hash might have been added recently
+// and false if it definitely was not.
+func (rf *RollingFilter) ContainsHash(hash *util.Hash) bool {
+	return rf.Contains(hash[:])
+}
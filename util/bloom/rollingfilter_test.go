@@ -0,0 +1,55 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func rollingKey(i int) []byte {
+	key := make([]byte, 32)
+	binary.LittleEndian.PutUint32(key, uint32(i))
+	return key
+}
+
+// TestRollingFilter ensures a rolling filter keeps its last elements, forgets
+// the oldest ones and stays near its false positive rate.
+func TestRollingFilter(t *testing.T) {
+	rf := NewRollingFilter(100, 0.01)
+
+	// The last 100 elements added are always kept.
+	for i := 0; i < 400; i++ {
+		rf.Add(rollingKey(i))
+		for j := i - 99; j <= i; j++ {
+			if j >= 0 && !rf.Contains(rollingKey(j)) {
+				t.Fatalf("element %d missing after adding %d", j, i)
+			}
+		}
+	}
+
+	// The elements older than 1.5 generations are forgotten but for false
+	// positives.
+	falsePositives := 0
+	for i := 0; i < 200; i++ {
+		if rf.Contains(rollingKey(i)) {
+			falsePositives++
+		}
+	}
+	for i := 1000; i < 10000; i++ {
+		if rf.Contains(rollingKey(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("too many false positives: %d", falsePositives)
+	}
+
+	rf.Reset()
+	for i := 300; i < 400; i++ {
+		if rf.Contains(rollingKey(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("too many false positives after reset: %d", falsePositives)
+	}
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// warnings holds the warnings currently raised, keyed by the subsystem which
+// raised them.
+var warnings = struct {
+	sync.RWMutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// SetWarning raises the warning of the given subsystem, replacing its previous
+// one.  An empty warning clears it.  It is safe for concurrent access.
+func SetWarning(subsystem, warning string) {
+	warnings.Lock()
+	defer warnings.Unlock()
+
+	if warning == "" {
+		delete(warnings.m, subsystem)
+		return
+	}
+	warnings.m[subsystem] = warning
+}
+
+// GetWarnings returns the warnings currently raised, as reported by RPCs such
+// as getnetworkinfo and getblockchaininfo.  It is safe for concurrent access.
+func GetWarnings() string {
+	warnings.RLock()
+	defer warnings.RUnlock()
+
+	subsystems := make([]string, 0, len(warnings.m))
+	for subsystem := range warnings.m {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+
+	msgs := make([]string, 0, len(subsystems))
+	for _, subsystem := range subsystems {
+		msgs = append(msgs, warnings.m[subsystem])
+	}
+	return strings.Join(msgs, " ")
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnings(t *testing.T) {
+	assert.Equal(t, "", GetWarnings())
+
+	SetWarning("net", "Stale tip.")
+	SetWarning("chain", "Unknown rules.")
+	assert.Equal(t, "Unknown rules. Stale tip.", GetWarnings())
+
+	SetWarning("net", "Still stale.")
+	assert.Equal(t, "Unknown rules. Still stale.", GetWarnings())
+
+	SetWarning("chain", "")
+	SetWarning("net", "")
+	assert.Equal(t, "", GetWarnings())
+}